@@ -0,0 +1,462 @@
+package aspath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Op is the kind of a node in a parsed AS path regular expression
+type Op uint8
+
+const (
+	// OpASN matches a single AS number, e.g. AS65537
+	OpASN Op = iota + 1
+	// OpRange matches an inclusive range of AS numbers, e.g. AS1-AS5. Ranges
+	// may only appear within a class.
+	OpRange
+	// OpSet matches any AS number contained by an as-set, e.g. AS-FOO
+	OpSet
+	// OpPeerAS matches the AS number of the peer the route is exchanged with
+	OpPeerAS
+	// OpAny matches any AS number, written as .
+	OpAny
+	// OpClass matches any of the AS numbers, ranges and sets it contains, or
+	// with Negated set, any AS number which is not matched by them, e.g.
+	// [AS1 AS-FOO] or [^AS1-AS5]
+	OpClass
+	// OpBegin matches the beginning of the AS path, written as ^
+	OpBegin
+	// OpEnd matches the end of the AS path, written as $
+	OpEnd
+	// OpConcat matches each of it's sub expressions in turn
+	OpConcat
+	// OpAlternate matches any one of it's sub expressions, e.g. AS1 | AS2
+	OpAlternate
+	// OpRepeat matches it's sub expression between Min and Max times, e.g.
+	// AS1*, AS1{2,3} or AS-FOO~+
+	OpRepeat
+)
+
+// Regexp is a node in a parsed RPSL AS path regular expression, as described
+// by section 5.4 of RFC 2622
+type Regexp struct {
+	Op      Op
+	ASN     uint32    // OpASN, and the first AS number of OpRange
+	High    uint32    // the last AS number of OpRange
+	Name    string    // the upper-cased as-set name of OpSet
+	Negated bool      // OpClass is negated
+	Min     int       // OpRepeat minimum count
+	Max     int       // OpRepeat maximum count, -1 for no limit
+	Same    bool      // OpRepeat uses the ~ operator, so each repetition must be the same AS number
+	Sub     []*Regexp // sub expressions, or the members of a class
+}
+
+// Parse parses an RPSL AS path regular expression, such as <^AS1 AS-FOO* $>.
+// The enclosing angle brackets are optional.
+func Parse(s string) (*Regexp, error) {
+	expr := strings.TrimSpace(s)
+	if strings.HasPrefix(expr, "<") {
+		if !strings.HasSuffix(expr, ">") {
+			return nil, fmt.Errorf("AS path regular expression %q is missing the closing >", s)
+		}
+		expr = expr[1 : len(expr)-1]
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AS path regular expression %q: %v", s, err)
+	}
+
+	p := &parser{tokens: tokens}
+	re, err := p.parseAlternate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid AS path regular expression %q: %v", s, err)
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid AS path regular expression %q: unexpected %q", s, p.tokens[p.pos])
+	}
+
+	return re, nil
+}
+
+// MustParse is like Parse but panics if the expression can not be parsed
+func MustParse(s string) *Regexp {
+	re, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return re
+}
+
+// Sets returns the names of the as-sets referenced by the expression, in the
+// order they first appear
+func (re *Regexp) Sets() []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	var walk func(*Regexp)
+	walk = func(n *Regexp) {
+		if n.Op == OpSet && !seen[n.Name] {
+			seen[n.Name] = true
+			names = append(names, n.Name)
+		}
+		for _, sub := range n.Sub {
+			walk(sub)
+		}
+	}
+	walk(re)
+
+	return names
+}
+
+// String returns the expression in RPSL syntax, enclosed in angle brackets
+func (re *Regexp) String() string {
+	return "<" + re.string() + ">"
+}
+
+func (re *Regexp) string() string {
+	switch re.Op {
+	case OpASN:
+		return fmt.Sprintf("AS%d", re.ASN)
+	case OpRange:
+		return fmt.Sprintf("AS%d-AS%d", re.ASN, re.High)
+	case OpSet:
+		return re.Name
+	case OpPeerAS:
+		return "PeerAS"
+	case OpAny:
+		return "."
+	case OpBegin:
+		return "^"
+	case OpEnd:
+		return "$"
+	case OpClass:
+		items := make([]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			items[i] = sub.string()
+		}
+		if re.Negated {
+			return "[^" + strings.Join(items, " ") + "]"
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case OpConcat:
+		items := make([]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			items[i] = sub.string()
+			if sub.Op == OpAlternate {
+				items[i] = "(" + items[i] + ")"
+			}
+		}
+		return strings.Join(items, " ")
+	case OpAlternate:
+		items := make([]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			items[i] = sub.string()
+		}
+		return strings.Join(items, " | ")
+	case OpRepeat:
+		sub := re.Sub[0].string()
+		if op := re.Sub[0].Op; op == OpConcat || op == OpAlternate || op == OpRepeat {
+			sub = "(" + sub + ")"
+		}
+		return sub + re.Operator()
+	}
+
+	return ""
+}
+
+// Operator returns the repetition operator of an OpRepeat node, e.g. * or
+// ~{2,3}
+func (re *Regexp) Operator() string {
+	var op string
+	switch {
+	case re.Min == 0 && re.Max == -1:
+		op = "*"
+	case re.Min == 1 && re.Max == -1:
+		op = "+"
+	case re.Min == 0 && re.Max == 1 && !re.Same:
+		op = "?"
+	case re.Max == -1:
+		op = fmt.Sprintf("{%d,}", re.Min)
+	case re.Min == re.Max:
+		op = fmt.Sprintf("{%d}", re.Min)
+	default:
+		op = fmt.Sprintf("{%d,%d}", re.Min, re.Max)
+	}
+
+	if re.Same {
+		return "~" + op
+	}
+
+	return op
+}
+
+// tokenize splits the expression into operators and words, such as AS
+// numbers and set names
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("^$.[]()|*+?~", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '{':
+			end := strings.IndexByte(expr[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("missing }")
+			}
+			tokens = append(tokens, expr[i:i+end+1])
+			i += end + 1
+		case isWordByte(c):
+			start := i
+			for i < len(expr) && isWordByte(expr[i]) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == ':'
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) parseAlternate() (*Regexp, error) {
+	var alternatives []*Regexp
+	for {
+		re, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, re)
+
+		if p.peek() != "|" {
+			break
+		}
+		p.next()
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+
+	return &Regexp{Op: OpAlternate, Sub: alternatives}, nil
+}
+
+func (p *parser) parseConcat() (*Regexp, error) {
+	var items []*Regexp
+	for tok := p.peek(); tok != "" && tok != "|" && tok != ")"; tok = p.peek() {
+		re, err := p.parseRepeat()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, re)
+	}
+
+	switch len(items) {
+	case 0:
+		return nil, fmt.Errorf("empty expression")
+	case 1:
+		return items[0], nil
+	}
+
+	return &Regexp{Op: OpConcat, Sub: items}, nil
+}
+
+func (p *parser) parseRepeat() (*Regexp, error) {
+	re, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		same := tok == "~"
+		if same {
+			p.next()
+			tok = p.peek()
+		}
+
+		var min, max int
+		switch {
+		case tok == "*":
+			min, max = 0, -1
+		case tok == "+":
+			min, max = 1, -1
+		case tok == "?" && !same:
+			min, max = 0, 1
+		case strings.HasPrefix(tok, "{"):
+			if min, max, err = parseBounds(tok); err != nil {
+				return nil, err
+			}
+		case same:
+			return nil, fmt.Errorf("~ must be followed by *, + or {m,n}")
+		default:
+			return re, nil
+		}
+		p.next()
+
+		if re.Op == OpBegin || re.Op == OpEnd {
+			return nil, fmt.Errorf("%s can not be repeated", re.string())
+		}
+		re = &Regexp{Op: OpRepeat, Min: min, Max: max, Same: same, Sub: []*Regexp{re}}
+	}
+}
+
+// parseBounds parses a {m}, {m,} or {m,n} repetition operator
+func parseBounds(tok string) (min, max int, err error) {
+	spec := strings.Replace(tok[1:len(tok)-1], " ", "", -1)
+	parts := strings.SplitN(spec, ",", 2)
+
+	if min, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("invalid repetition %s", tok)
+	}
+
+	switch {
+	case len(parts) == 1:
+		max = min
+	case parts[1] == "":
+		max = -1
+	default:
+		if max, err = strconv.Atoi(parts[1]); err != nil || max < min {
+			return 0, 0, fmt.Errorf("invalid repetition %s", tok)
+		}
+	}
+
+	if min < 0 {
+		return 0, 0, fmt.Errorf("invalid repetition %s", tok)
+	}
+
+	return min, max, nil
+}
+
+func (p *parser) parseAtom() (*Regexp, error) {
+	switch tok := p.next(); tok {
+	case "^":
+		return &Regexp{Op: OpBegin}, nil
+	case "$":
+		return &Regexp{Op: OpEnd}, nil
+	case ".":
+		return &Regexp{Op: OpAny}, nil
+	case "(":
+		re, err := p.parseAlternate()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return re, nil
+	case "[":
+		return p.parseClass()
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return parseWord(tok, false)
+	}
+}
+
+func (p *parser) parseClass() (*Regexp, error) {
+	class := &Regexp{Op: OpClass}
+	if p.peek() == "^" {
+		p.next()
+		class.Negated = true
+	}
+
+	for tok := p.next(); tok != "]"; tok = p.next() {
+		if tok == "" {
+			return nil, fmt.Errorf("missing ]")
+		}
+
+		item, err := parseWord(tok, true)
+		if err != nil {
+			return nil, err
+		}
+		class.Sub = append(class.Sub, item)
+	}
+
+	if len(class.Sub) == 0 {
+		return nil, fmt.Errorf("empty class")
+	}
+
+	return class, nil
+}
+
+// parseWord parses an AS number, as-set name or the PeerAS keyword. Within a
+// class, a word may also be a range of AS numbers.
+func parseWord(word string, inClass bool) (*Regexp, error) {
+	upper := strings.ToUpper(word)
+
+	if upper == "PEERAS" {
+		return &Regexp{Op: OpPeerAS}, nil
+	}
+
+	if asn, ok := parseASN(upper); ok {
+		return &Regexp{Op: OpASN, ASN: asn}, nil
+	}
+
+	if parts := strings.SplitN(upper, "-", 2); inClass && len(parts) == 2 {
+		low, lowOK := parseASN(parts[0])
+		high, highOK := parseASN(parts[1])
+		if lowOK && highOK && low <= high {
+			return &Regexp{Op: OpRange, ASN: low, High: high}, nil
+		}
+	}
+
+	if lexer.SetClass(upper) == token.CLASS_AS_SET {
+		return &Regexp{Op: OpSet, Name: upper}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", word)
+}
+
+// ParseASN parses an AS number such as AS65537
+func ParseASN(s string) (uint32, error) {
+	asn, ok := parseASN(strings.ToUpper(s))
+	if !ok {
+		return 0, fmt.Errorf("invalid AS number %q", s)
+	}
+
+	return asn, nil
+}
+
+func parseASN(s string) (uint32, bool) {
+	if !strings.HasPrefix(s, "AS") {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(s[2:], 10, 32)
+	return uint32(n), err == nil
+}
@@ -0,0 +1,133 @@
+package aspath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<^AS1 AS-FOO* $>", "<^ AS1 AS-FOO* $>"},
+		{"^as1 as2", "<^ AS1 AS2>"},
+		{"<AS1 | AS2 AS3>", "<AS1 | AS2 AS3>"},
+		{"<^(AS1 | AS2) .+ $>", "<^ (AS1 | AS2) .+ $>"},
+		{"<[AS1-AS5 AS-FOO AS65537:AS-BAR]>", "<[AS1-AS5 AS-FOO AS65537:AS-BAR]>"},
+		{"<[^AS1 AS2]>", "<[^AS1 AS2]>"},
+		{"<AS1{2} AS2{1,3} AS3{2,}>", "<AS1{2} AS2{1,3} AS3{2,}>"},
+		{"<AS1~* AS-FOO~{2,4} (AS1 AS2)?>", "<AS1~* AS-FOO~{2,4} (AS1 AS2)?>"},
+		{"<^PeerAS .* $>", "<^ PeerAS .* $>"},
+	}
+
+	for _, tt := range tests {
+		re, err := Parse(tt.input)
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.expected, re.String(), tt.input)
+
+			// the canonical form parses to the same expression
+			reparsed, err := Parse(re.String())
+			if assert.NoError(t, err, re.String()) {
+				assert.Equal(t, re, reparsed)
+			}
+		}
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	re := MustParse("<^AS1 [AS2-AS4 AS-FOO]~+ $>")
+
+	assert.Equal(t, &Regexp{Op: OpConcat, Sub: []*Regexp{
+		{Op: OpBegin},
+		{Op: OpASN, ASN: 1},
+		{Op: OpRepeat, Min: 1, Max: -1, Same: true, Sub: []*Regexp{
+			{Op: OpClass, Sub: []*Regexp{
+				{Op: OpRange, ASN: 2, High: 4},
+				{Op: OpSet, Name: "AS-FOO"},
+			}},
+		}},
+		{Op: OpEnd},
+	}}, re)
+	assert.Equal(t, []string{"AS-FOO"}, re.Sets())
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<AS1", `AS path regular expression "<AS1" is missing the closing >`},
+		{"<>", `invalid AS path regular expression "<>": empty expression`},
+		{"<(AS1>", `invalid AS path regular expression "<(AS1>": missing )`},
+		{"<AS1)>", `invalid AS path regular expression "<AS1)>": unexpected ")"`},
+		{"<[AS1>", `invalid AS path regular expression "<[AS1>": missing ]`},
+		{"<AS1-AS2>", `invalid AS path regular expression "<AS1-AS2>": unexpected "AS1-AS2"`},
+		{"<RS-FOO>", `invalid AS path regular expression "<RS-FOO>": unexpected "RS-FOO"`},
+		{"<^*>", `invalid AS path regular expression "<^*>": ^ can not be repeated`},
+		{"<AS1~?>", `invalid AS path regular expression "<AS1~?>": ~ must be followed by *, + or {m,n}`},
+		{"<AS1{3,2}>", `invalid AS path regular expression "<AS1{3,2}>": invalid repetition {3,2}`},
+		{"<AS1 & AS2>", `invalid AS path regular expression "<AS1 & AS2>": unexpected '&'`},
+		{"<AS1{2>", `invalid AS path regular expression "<AS1{2>": missing }`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	sets := map[string][]uint32{"AS-FOO": {65537, 65538}}
+	tests := []struct {
+		expr     string
+		path     []uint32
+		expected bool
+	}{
+		{"<AS65537>", []uint32{65001, 65537, 65002}, true},
+		{"<AS65537$>", []uint32{65001, 65537, 65002}, false},
+		{"<AS65537$>", []uint32{65001, 65537}, true},
+		{"<^AS65537>", []uint32{65001, 65537}, false},
+		{"<^PeerAS>", []uint32{65001, 65537}, true},
+		{"<^PeerAS AS-FOO*$>", []uint32{65001, 65537, 65538}, true},
+		{"<^PeerAS AS-FOO*$>", []uint32{65001, 65537, 65539}, false},
+		{"<^PeerAS+ $>", []uint32{65001, 65001, 65001}, true},
+		{"<AS-BAR>", []uint32{65001}, false},
+		{"<^.* [AS65000-AS65010]$>", []uint32{65537, 65005}, true},
+		{"<^.* [^AS65000-AS65010]$>", []uint32{65537, 65005}, false},
+		{"<^AS65001 (AS65002 | AS65003) AS65004$>", []uint32{65001, 65003, 65004}, true},
+		{"<^AS65001{2,3}$>", []uint32{65001}, false},
+		{"<^AS65001{2,3}$>", []uint32{65001, 65001, 65001}, true},
+		{"<^AS65001{2,3}$>", []uint32{65001, 65001, 65001, 65001}, false},
+		{"<^AS-FOO~+$>", []uint32{65537, 65537}, true},
+		{"<^AS-FOO~+$>", []uint32{65537, 65538}, false},
+		{"<^AS-FOO+$>", []uint32{65537, 65538}, true},
+		{"<^(AS65001 AS65002)~{2}$>", []uint32{65001, 65002, 65001, 65002}, true},
+		{"<^$>", nil, true},
+		{"<^AS65001?$>", nil, true},
+	}
+
+	for _, tt := range tests {
+		actual := MustParse(tt.expr).Match(tt.path, 65001, sets)
+		assert.Equal(t, tt.expected, actual, "%s %v", tt.expr, tt.path)
+	}
+}
+
+func TestMatchNestedRepetition(t *testing.T) {
+	// nested repetitions would take exponential time to match by backtracking
+	path := make([]uint32, 40)
+	for i := range path {
+		path[i] = uint32(65001 + i%2)
+	}
+
+	for _, expr := range []string{"<(.*)* AS1$>", "<(. .*)* AS1$>", "<(.+)+ AS1$>", "<^(AS65001 | AS65002 | .)* AS1$>"} {
+		assert.False(t, MustParse(expr).Match(path, 65001, nil), expr)
+	}
+
+	assert.True(t, MustParse("<^(.+)+ AS65002$>").Match(path, 65001, nil))
+	assert.True(t, MustParse("<^(AS65001 AS65002)~*$>").Match(path, 65001, nil))
+	assert.False(t, MustParse("<^(AS65001 AS65002)~{3}$>").Match(path, 65001, nil))
+	assert.True(t, MustParse("<^(AS65001 AS65002){20}$>").Match(path, 65001, nil))
+	assert.True(t, MustParse("<^(AS65001 AS65002){19,1000000}$>").Match(path, 65001, nil))
+}
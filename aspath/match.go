@@ -0,0 +1,226 @@
+package aspath
+
+import "sort"
+
+// Match reports whether the expression matches the AS path, given nearest AS
+// first as it is sent in BGP, so the last AS is the origin. peerAS is matched
+// by PeerAS, and sets holds the sorted AS numbers of each as-set referenced by
+// the expression, as returned by Sets. An as-set which is not in sets matches
+// no AS. Like a regular expression over text, the expression may match any
+// part of the path unless it is anchored with ^ or $.
+func (re *Regexp) Match(path []uint32, peerAS uint32, sets map[string][]uint32) bool {
+	m := &matcher{path: path, peerAS: peerAS, sets: sets, memo: make(map[memoKey][]bool)}
+	for start := 0; start <= len(path); start++ {
+		if some(m.ends(re, start)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matcher matches an expression against a path by finding the set of
+// positions at which each node's match could end, given the position it
+// starts at. The sets are memoised by node and start position, so matching
+// takes polynomial time in the length of the path however the expression
+// nests repetitions.
+type matcher struct {
+	path   []uint32
+	peerAS uint32
+	sets   map[string][]uint32
+	memo   map[memoKey][]bool
+}
+
+type memoKey struct {
+	re  *Regexp
+	pos int
+}
+
+// ends returns the positions at which a match of the node starting at pos
+// could end, indexed by position
+func (m *matcher) ends(re *Regexp, pos int) []bool {
+	key := memoKey{re, pos}
+	if ends, ok := m.memo[key]; ok {
+		return ends
+	}
+
+	ends := make([]bool, len(m.path)+1)
+	switch re.Op {
+	case OpBegin:
+		ends[pos] = pos == 0
+	case OpEnd:
+		ends[pos] = pos == len(m.path)
+	case OpConcat:
+		ends[pos] = true
+		for _, sub := range re.Sub {
+			ends = m.step(sub, ends)
+		}
+	case OpAlternate:
+		for _, sub := range re.Sub {
+			union(ends, m.ends(sub, pos))
+		}
+	case OpRepeat:
+		if re.Same {
+			m.repeatSame(re, pos, ends)
+		} else {
+			m.repeat(re, pos, ends)
+		}
+	default:
+		if pos < len(m.path) && m.matchASN(re, m.path[pos]) {
+			ends[pos+1] = true
+		}
+	}
+
+	m.memo[key] = ends
+	return ends
+}
+
+// step returns the positions at which a match of the node could end, starting
+// from any of the positions in from
+func (m *matcher) step(re *Regexp, from []bool) []bool {
+	ends := make([]bool, len(m.path)+1)
+	for pos, ok := range from {
+		if ok {
+			union(ends, m.ends(re, pos))
+		}
+	}
+
+	return ends
+}
+
+// repeat sets the positions at which between Min and Max repetitions of the
+// node's sub expression could end. Each repetition which matches something
+// consumes at least one AS, so beyond len(path)+1 repetitions the reachable
+// positions no longer change, which bounds the repetitions followed.
+func (m *matcher) repeat(re *Regexp, pos int, ends []bool) {
+	limit := len(m.path) + 1
+
+	current := make([]bool, len(m.path)+1)
+	current[pos] = true
+	for count := 0; count < re.Min && count <= limit; count++ {
+		if current = m.step(re.Sub[0], current); !some(current) {
+			return
+		}
+	}
+	union(ends, current)
+
+	if re.Max == -1 {
+		// only the positions reached for the first time need to be followed
+		// further
+		for frontier := current; some(frontier); {
+			next := m.step(re.Sub[0], frontier)
+			frontier = make([]bool, len(m.path)+1)
+			for i, ok := range next {
+				if ok && !ends[i] {
+					ends[i], frontier[i] = true, true
+				}
+			}
+		}
+		return
+	}
+
+	for count := re.Min; count < re.Max && count <= re.Min+limit; count++ {
+		if current = m.step(re.Sub[0], current); !some(current) {
+			return
+		}
+		union(ends, current)
+	}
+}
+
+// repeatSame sets the positions at which between Min and Max repetitions of
+// the node's sub expression could end when, with the ~ operator, every
+// repetition must match the same AS numbers as the first
+func (m *matcher) repeatSame(re *Regexp, pos int, ends []bool) {
+	if re.Min == 0 {
+		ends[pos] = true
+	}
+	if re.Max == 0 {
+		return
+	}
+
+	for end, ok := range m.ends(re.Sub[0], pos) {
+		if !ok {
+			continue
+		}
+		if end == pos {
+			// an empty match can be repeated any number of times
+			ends[pos] = true
+			continue
+		}
+
+		first := m.path[pos:end]
+		for count, next := 1, end; ; count++ {
+			if count >= re.Min {
+				ends[next] = true
+			}
+			if re.Max != -1 && count >= re.Max || next+len(first) > len(m.path) {
+				break
+			}
+			if !equal(m.path[next:next+len(first)], first) || !m.ends(re.Sub[0], next)[next+len(first)] {
+				break
+			}
+			next += len(first)
+		}
+	}
+}
+
+// matchASN reports whether a node matching a single AS matches the AS number
+func (m *matcher) matchASN(re *Regexp, asn uint32) bool {
+	switch re.Op {
+	case OpASN:
+		return asn == re.ASN
+	case OpRange:
+		return asn >= re.ASN && asn <= re.High
+	case OpSet:
+		asns := m.sets[re.Name]
+		i := sort.Search(len(asns), func(i int) bool { return asns[i] >= asn })
+		return i < len(asns) && asns[i] == asn
+	case OpPeerAS:
+		return asn == m.peerAS
+	case OpAny:
+		return true
+	case OpClass:
+		for _, sub := range re.Sub {
+			if m.matchASN(sub, asn) {
+				return !re.Negated
+			}
+		}
+		return re.Negated
+	}
+
+	return false
+}
+
+// union adds the positions in b to a
+func union(a, b []bool) {
+	for i, ok := range b {
+		if ok {
+			a[i] = true
+		}
+	}
+}
+
+// some reports whether any position is set
+func some(positions []bool) bool {
+	for _, ok := range positions {
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equal(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,251 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// valueColumn is the column at which attribute values begin when an object is
+// formatted. This matches the layout used by the RIPE and IRRd databases.
+const valueColumn = 16
+
+// listTypes are the value token types which are written as a comma separated
+// list when more than one is found on the same line, e.g.
+//
+//	mnt-by:         OTHER1-MNT, OTHER2-MNT
+var listTypes = map[token.Type]bool{
+	token.DATA_ASN:        true,
+	token.DATA_IPv4_CIDR:  true,
+	token.DATA_IPv6_CIDR:  true,
+	token.DATA_NIC_HANDLE: true,
+}
+
+// authPrefixes are written before the values of auth lines, as the lexer
+// leaves the scheme out of the values of the RFC 2622 and RFC 2725 schemes
+var authPrefixes = map[token.Type]string{
+	token.DATA_CRYPT_PASS:     "CRYPT-PW ",
+	token.DATA_MD5_PASS:       "MD5-PW ",
+	token.DATA_MAIL_FROM_PASS: "MAIL-FROM ",
+	token.DATA_PGP_KEY:        "PGPKEY-",
+}
+
+// Object is a single RPSL object. The first attribute is always the class
+// attribute, e.g. route: 192.0.2.0/24, followed by the object's attributes in
+// the order they were found in the input.
+type Object struct {
+	Attributes []*Attribute
+}
+
+// Attribute is a single attribute of an object, along with the values lexed
+// from it's first line and any continuation lines that followed it.
+type Attribute struct {
+	Token         token.Token   // the class or attribute token, e.g. token.ATTR_MAINTAINED_BY
+	Values        []token.Token // the value tokens found on the attribute's first line
+	Continuations []*Attribute  // continuation lines, each using a token.ATTR_CONTINUATION token
+}
+
+// Class returns the object class of the object, e.g. token.CLASS_ROUTE
+func (o *Object) Class() token.Type {
+	if len(o.Attributes) == 0 {
+		return token.ILLEGAL
+	}
+
+	return o.Attributes[0].Token.Type
+}
+
+// Name returns the value of the class attribute, e.g. AS-FOO for an as-set
+func (o *Object) Name() string {
+	if len(o.Attributes) == 0 {
+		return ""
+	}
+
+	return o.Attributes[0].Value()
+}
+
+// Get returns all of the attributes of the given type, in order
+func (o *Object) Get(t token.Type) []*Attribute {
+	var attrs []*Attribute
+	for _, attr := range o.Attributes {
+		if attr.Token.Type == t {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return attrs
+}
+
+// Value returns the value of the first attribute of the given type, or an
+// empty string if the object does not contain one
+func (o *Object) Value(t token.Type) string {
+	for _, attr := range o.Attributes {
+		if attr.Token.Type == t {
+			return attr.Value()
+		}
+	}
+
+	return ""
+}
+
+// Values returns the literal of every value token of every attribute of the
+// given type, including those found on continuation lines. For example, an
+// object with the attributes:
+//
+//	mnt-by:         OTHER1-MNT, OTHER2-MNT
+//	mnt-by:         TEST-MNT
+//
+// returns OTHER1-MNT, OTHER2-MNT and TEST-MNT for token.ATTR_MAINTAINED_BY
+func (o *Object) Values(t token.Type) []string {
+	var values []string
+	for _, attr := range o.Get(t) {
+		for _, tok := range attr.Values {
+			values = append(values, tok.Literal)
+		}
+
+		for _, cont := range attr.Continuations {
+			for _, tok := range cont.Values {
+				values = append(values, tok.Literal)
+			}
+		}
+	}
+
+	return values
+}
+
+// PrimaryKey returns the attributes which uniquely identify the object within
+// it's class. For route and route6 objects this is the prefix and the origin,
+// for person and role objects it is the nic-hdl, and for all other classes it
+// is the class attribute.
+func (o *Object) PrimaryKey() []*Attribute {
+	if len(o.Attributes) == 0 {
+		return nil
+	}
+
+	switch o.Class() {
+	case token.CLASS_ROUTE, token.CLASS_ROUTE6:
+		key := []*Attribute{o.Attributes[0]}
+		if origin := o.Get(token.ATTR_ORIGIN); len(origin) > 0 {
+			key = append(key, origin[0])
+		}
+		return key
+	case token.CLASS_PERSON, token.CLASS_ROLE:
+		if nicHdl := o.Get(token.ATTR_NIC_HANDLE); len(nicHdl) > 0 {
+			return nicHdl[:1]
+		}
+	}
+
+	return o.Attributes[:1]
+}
+
+// Key returns the object's primary key as a single string, e.g.
+// 192.0.2.0/24AS65537 for a route object. Each value is normalized, so the key
+// can be used to match different versions of the same object.
+func (o *Object) Key() string {
+	var key strings.Builder
+	for _, attr := range o.PrimaryKey() {
+		for _, tok := range attr.Values {
+			key.WriteString(Normalize(tok))
+		}
+	}
+
+	return key.String()
+}
+
+// Normalize returns the value token in a canonical form, suitable for
+// comparison. Names are case-insensitive in RPSL so are upper-cased, and
+// prefixes may be written with leading zeros or with differing IPv6
+// compression. Free text is returned as written.
+func Normalize(tok token.Token) string {
+	switch tok.Type {
+	case token.DATA_IPv4_CIDR, token.DATA_IPv6_CIDR:
+		return prefix.Canonical(tok.Literal)
+	case token.DATA_ASN, token.DATA_NIC_HANDLE, token.DATA_REGISTRY_NAME:
+		return strings.ToUpper(tok.Literal)
+	default:
+		return tok.Literal
+	}
+}
+
+// String formats the object as RPSL text, terminated by a newline
+func (o *Object) String() string {
+	var out bytes.Buffer
+	for _, attr := range o.Attributes {
+		out.WriteString(attr.String())
+	}
+
+	return out.String()
+}
+
+// Name returns the attribute's name, e.g. mnt-by
+func (a *Attribute) Name() string {
+	return a.Token.Type.Name()
+}
+
+// Value returns the value found on the attribute's first line
+func (a *Attribute) Value() string {
+	return joinValues(a.Values)
+}
+
+// Lines returns the value of the attribute's first line, followed by the
+// value of each continuation line
+func (a *Attribute) Lines() []string {
+	lines := []string{a.Value()}
+	for _, cont := range a.Continuations {
+		lines = append(lines, cont.Value())
+	}
+
+	return lines
+}
+
+// String formats the attribute, and any continuation lines, as RPSL text
+func (a *Attribute) String() string {
+	var out bytes.Buffer
+	writeLine(&out, a.Name()+":", a.Value())
+	for _, cont := range a.Continuations {
+		writeLine(&out, cont.Name(), cont.Value())
+	}
+
+	return out.String()
+}
+
+// writeLine writes a single name and value pair, padding the name so that the
+// value begins at the value column
+func writeLine(out *bytes.Buffer, name, value string) {
+	out.WriteString(name)
+	if value != "" {
+		padding := valueColumn - len(name)
+		if padding < 1 {
+			padding = 1
+		}
+		out.WriteString(strings.Repeat(" ", padding))
+		out.WriteString(value)
+	}
+	out.WriteString("\n")
+}
+
+// joinValues combines the value tokens of a single line back into text
+func joinValues(tokens []token.Token) string {
+	separator := " "
+	if len(tokens) > 1 {
+		list := true
+		for _, tok := range tokens {
+			if !listTypes[tok.Type] {
+				list = false
+				break
+			}
+		}
+
+		if list {
+			separator = ", "
+		}
+	}
+
+	literals := make([]string, len(tokens))
+	for i, tok := range tokens {
+		literals[i] = authPrefixes[tok.Type] + tok.Literal
+	}
+
+	return strings.Join(literals, separator)
+}
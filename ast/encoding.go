@@ -0,0 +1,183 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// document is the JSON and YAML representation of an object. Attributes are
+// kept as an ordered list so that duplicate attributes, such as multiple
+// mnt-by lines, and their ordering survive a round trip.
+type document struct {
+	Class      string              `json:"class" yaml:"class"`
+	Attributes []documentAttribute `json:"attributes" yaml:"attributes"`
+}
+
+type documentAttribute struct {
+	Name          string   `json:"name" yaml:"name"`
+	Value         string   `json:"value" yaml:"value"`
+	Continuations []string `json:"continuations,omitempty" yaml:"continuations,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (o *Object) MarshalJSON() ([]byte, error) {
+	doc, err := o.document()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The attribute values are lexed,
+// so the resulting object is identical to one parsed from RPSL text.
+func (o *Object) UnmarshalJSON(data []byte) error {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	return o.fromDocument(doc)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface used by gopkg.in/yaml.v2
+func (o *Object) MarshalYAML() (interface{}, error) {
+	return o.document()
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface used by
+// gopkg.in/yaml.v2
+func (o *Object) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var doc document
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+
+	return o.fromDocument(doc)
+}
+
+func (o *Object) document() (document, error) {
+	if len(o.Attributes) == 0 {
+		return document{}, fmt.Errorf("object has no attributes")
+	}
+
+	doc := document{
+		Class:      o.Class().Name(),
+		Attributes: make([]documentAttribute, len(o.Attributes)),
+	}
+
+	for i, attr := range o.Attributes {
+		doc.Attributes[i] = documentAttribute{
+			Name:  attr.Name(),
+			Value: attr.Value(),
+		}
+
+		for _, cont := range attr.Continuations {
+			doc.Attributes[i].Continuations = append(doc.Attributes[i].Continuations, cont.Value())
+		}
+	}
+
+	return doc, nil
+}
+
+// lineBreaks are the characters the lexer ends a line on
+const lineBreaks = "\n\v\f\r"
+
+func (o *Object) fromDocument(doc document) error {
+	if len(doc.Attributes) == 0 {
+		return fmt.Errorf("object has no attributes")
+	}
+
+	if doc.Class != "" && !strings.EqualFold(doc.Class, doc.Attributes[0].Name) {
+		return fmt.Errorf("object class %q does not match first attribute %q", doc.Class, doc.Attributes[0].Name)
+	}
+
+	lines := make([][]string, len(doc.Attributes))
+	for i, attr := range doc.Attributes {
+		// a value containing line breaks is treated as a value followed by
+		// continuation lines. Any other character the lexer ends a line on
+		// would start a new attribute, so it is rejected.
+		lines[i] = append(strings.Split(attr.Value, "\n"), attr.Continuations...)
+		for _, line := range lines[i] {
+			if strings.ContainsAny(line, lineBreaks) {
+				return fmt.Errorf("attribute %q contains a line break", attr.Name)
+			}
+		}
+	}
+
+	return o.fromLines(doc.Attributes, lines)
+}
+
+// fromLines builds the object by formatting the provided attribute names and
+// values as RPSL text, then lexing that text
+func (o *Object) fromLines(attrs []documentAttribute, lines [][]string) error {
+	var text bytes.Buffer
+	for i, attr := range attrs {
+		t, ok := token.Lookup(attr.Name)
+		switch {
+		case !ok:
+			return fmt.Errorf("unknown attribute %q", attr.Name)
+		case i == 0 && !t.IsClass():
+			return fmt.Errorf("unknown object class %q", attr.Name)
+		case i > 0 && (!t.IsAttribute() || t == token.ATTR_CONTINUATION):
+			return fmt.Errorf("attribute %q is not valid within an object", attr.Name)
+		}
+
+		writeLine(&text, t.Name()+":", lines[i][0])
+		for _, cont := range lines[i][1:] {
+			writeLine(&text, token.ATTR_CONTINUATION.Name(), cont)
+		}
+	}
+
+	obj, err := lexObject(attrs[0].Name, text.String())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(obj.Attributes) < len(attrs):
+		return fmt.Errorf("unable to lex attribute %q", attrs[len(obj.Attributes)].Name)
+	case len(obj.Attributes) > len(attrs):
+		return fmt.Errorf("unexpected attribute %q", obj.Attributes[len(attrs)].Name())
+	}
+
+	*o = *obj
+	return nil
+}
+
+// lexObject lexes the text of a single object and builds the object from the
+// emitted tokens
+func lexObject(inputName, inputText string) (*Object, error) {
+	l := lexer.Lex(inputName, inputText)
+	obj := &Object{}
+
+	var attr, line *Attribute
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch {
+		case tok.Type == token.ILLEGAL:
+			return nil, fmt.Errorf("line %d: invalid value %q", tok.Line, tok.Literal)
+		case tok.Type.IsClass() && attr != nil:
+			// drain the lexer so that it's goroutine exits
+			for tok.Type != token.EOF {
+				tok = l.NextToken()
+			}
+			return nil, fmt.Errorf("input contains more than one object")
+		case tok.Type == token.ATTR_CONTINUATION:
+			line = &Attribute{Token: tok}
+			attr.Continuations = append(attr.Continuations, line)
+		case tok.Type.IsClass() || tok.Type.IsAttribute():
+			attr = &Attribute{Token: tok}
+			line = attr
+			obj.Attributes = append(obj.Attributes, attr)
+		default:
+			line.Values = append(line.Values, tok)
+		}
+	}
+
+	return obj, nil
+}
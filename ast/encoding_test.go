@@ -0,0 +1,159 @@
+package ast
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const testRoute = `route:          192.0.2.0/24
+descr:          example route
++               continued
+origin:         AS65537
+mnt-by:         OTHER1-MNT, OTHER2-MNT
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+func testObject(t *testing.T) *Object {
+	obj, err := lexObject("test", testRoute)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return obj
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	obj := testObject(t)
+
+	data, err := json.Marshal(obj)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	expected := `{"class":"route","attributes":[` +
+		`{"name":"route","value":"192.0.2.0/24"},` +
+		`{"name":"descr","value":"example route","continuations":["continued"]},` +
+		`{"name":"origin","value":"AS65537"},` +
+		`{"name":"mnt-by","value":"OTHER1-MNT, OTHER2-MNT"},` +
+		`{"name":"mnt-by","value":"TEST-MNT"},` +
+		`{"name":"source","value":"TEST"}]}`
+	assert.JSONEq(t, expected, string(data))
+
+	decoded := &Object{}
+	if !assert.NoError(t, json.Unmarshal(data, decoded)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, testRoute, decoded.String())
+	assert.Equal(t, []string{"OTHER1-MNT", "OTHER2-MNT", "TEST-MNT"}, decoded.Values(token.ATTR_MAINTAINED_BY))
+}
+
+func TestAuthRoundTrip(t *testing.T) {
+	const mntner = `mntner:         TEST-MNT
+auth:           CRYPT-PW dhbKKWgspIXyA
+auth:           MD5-PW $1$saltsalt$ZliGyAN3DciDHEkDboonh/
+auth:           MAIL-FROM .*@example\.com
+auth:           PGPKEY-80F238C6
+auth:           X509-1
+auth:           NONE
+source:         TEST
+`
+
+	obj, err := lexObject("test", mntner)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, mntner, obj.String())
+
+	data, err := json.Marshal(obj)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	decoded := &Object{}
+	if assert.NoError(t, json.Unmarshal(data, decoded)) {
+		assert.Equal(t, mntner, decoded.String())
+	}
+}
+
+func TestJSONUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"no attributes", `{"class":"route","attributes":[]}`},
+		{"class mismatch", `{"class":"route","attributes":[{"name":"route6","value":"2001:db8::/32"}]}`},
+		{"unknown class", `{"attributes":[{"name":"inetnum","value":"192.0.2.0 - 192.0.2.255"}]}`},
+		{"unknown attribute", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"country","value":"NL"}]}`},
+		{"class as attribute", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"route6","value":"2001:db8::/32"}]}`},
+		{"illegal value", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"origin","value":"65537"}]}`},
+		{"carriage return", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"mnt-by","value":"FOO-MNT\rsource: EVIL"}]}`},
+		{"carriage return extra attribute", `{"attributes":[{"name":"route","value":"192.0.2.0/24\rorigin: AS65537"},{"name":"mnt-by","value":"FOO-MNT"}]}`},
+		{"line break in continuation", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"descr","value":"a","continuations":["b\nsource: EVIL"]}]}`},
+		{"form feed", `{"attributes":[{"name":"route","value":"192.0.2.0/24"},{"name":"descr","value":"a\fsource: EVIL"}]}`},
+	}
+
+	for _, tt := range tests {
+		obj := &Object{}
+		assert.Error(t, json.Unmarshal([]byte(tt.input), obj), tt.name)
+	}
+}
+
+func TestMarshalEmptyObject(t *testing.T) {
+	_, err := json.Marshal(&Object{})
+	assert.EqualError(t, err, "json: error calling MarshalJSON for type *ast.Object: object has no attributes")
+
+	_, err = yaml.Marshal(&Object{})
+	assert.EqualError(t, err, "object has no attributes")
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	obj := testObject(t)
+
+	data, err := yaml.Marshal(obj)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	decoded := &Object{}
+	if !assert.NoError(t, yaml.Unmarshal(data, decoded)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, testRoute, decoded.String())
+}
+
+func TestRIPERoundTrip(t *testing.T) {
+	obj := testObject(t)
+
+	data, err := MarshalRIPE([]*Object{obj})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var resp ripeResponse
+	if !assert.NoError(t, json.Unmarshal(data, &resp)) || !assert.Len(t, resp.Objects.Object, 1) {
+		t.FailNow()
+	}
+
+	ro := resp.Objects.Object[0]
+	assert.Equal(t, "route", ro.Type)
+	assert.Equal(t, "TEST", ro.Source.ID)
+	assert.Equal(t, []ripeAttribute{
+		{Name: "route", Value: "192.0.2.0/24"},
+		{Name: "origin", Value: "AS65537"},
+	}, ro.PrimaryKey.Attribute)
+	assert.Equal(t, ripeAttribute{Name: "descr", Value: "example route\ncontinued"}, ro.Attributes.Attribute[1])
+
+	objects, err := UnmarshalRIPE(data)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, testRoute, objects[0].String())
+}
@@ -0,0 +1,128 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/token"
+)
+
+// The RIPE REST API, and IRRd's compatible JSON output, wrap every object in
+// a number of single field objects, e.g.
+//
+//	{"objects": {"object": [{"type": "route", "attributes": {"attribute": [...]}}]}}
+type ripeResponse struct {
+	Objects ripeObjects `json:"objects"`
+}
+
+type ripeObjects struct {
+	Object []ripeObject `json:"object"`
+}
+
+type ripeObject struct {
+	Type       string        `json:"type"`
+	Source     *ripeSource   `json:"source,omitempty"`
+	PrimaryKey *ripeAttrList `json:"primary-key,omitempty"`
+	Attributes ripeAttrList  `json:"attributes"`
+}
+
+type ripeSource struct {
+	ID string `json:"id"`
+}
+
+type ripeAttrList struct {
+	Attribute []ripeAttribute `json:"attribute"`
+}
+
+type ripeAttribute struct {
+	Name           string `json:"name"`
+	Value          string `json:"value"`
+	ReferencedType string `json:"referenced-type,omitempty"`
+}
+
+// referencedTypes are the attributes which reference another object, and the
+// class of the object they reference
+var referencedTypes = map[token.Type]token.Type{
+	token.ATTR_ADMIN_CONTACT:        token.CLASS_PERSON,
+	token.ATTR_TECHNICAL_CONTACT:    token.CLASS_PERSON,
+	token.ATTR_MAINTAINED_BY:        token.CLASS_MAINTAINER,
+	token.ATTR_MAINTAINER_LOWER:     token.CLASS_MAINTAINER,
+	token.ATTR_MEMBERS_BY_REFERENCE: token.CLASS_MAINTAINER,
+	token.ATTR_MEMBER_OF_ROUTE_SET:  token.CLASS_ROUTE_SET,
+	token.ATTR_ORIGIN:               token.CLASS_AUT_NUM,
+}
+
+// MarshalRIPE encodes the objects using the RIPE REST API response format,
+// which is also produced by IRRd v4. Continuation lines are joined to the
+// attribute's value with a newline.
+func MarshalRIPE(objects []*Object) ([]byte, error) {
+	resp := ripeResponse{}
+	for _, obj := range objects {
+		if len(obj.Attributes) == 0 {
+			return nil, fmt.Errorf("object has no attributes")
+		}
+
+		ro := ripeObject{
+			Type:       obj.Class().Name(),
+			PrimaryKey: &ripeAttrList{},
+		}
+
+		if source := obj.Value(token.ATTR_REGISTRY_SOURCE); source != "" {
+			ro.Source = &ripeSource{ID: source}
+		}
+
+		for _, attr := range obj.PrimaryKey() {
+			ro.PrimaryKey.Attribute = append(ro.PrimaryKey.Attribute, ripeAttribute{
+				Name:  attr.Name(),
+				Value: attr.Value(),
+			})
+		}
+
+		for _, attr := range obj.Attributes {
+			ra := ripeAttribute{
+				Name:  attr.Name(),
+				Value: strings.Join(attr.Lines(), "\n"),
+			}
+
+			if ref, ok := referencedTypes[attr.Token.Type]; ok {
+				ra.ReferencedType = ref.Name()
+			}
+
+			ro.Attributes.Attribute = append(ro.Attributes.Attribute, ra)
+		}
+
+		resp.Objects.Object = append(resp.Objects.Object, ro)
+	}
+
+	return json.Marshal(resp)
+}
+
+// UnmarshalRIPE decodes objects from the RIPE REST API response format, which
+// is also produced by IRRd v4
+func UnmarshalRIPE(data []byte) ([]*Object, error) {
+	var resp ripeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	objects := []*Object{}
+	for _, ro := range resp.Objects.Object {
+		doc := document{Class: ro.Type}
+		for _, ra := range ro.Attributes.Attribute {
+			doc.Attributes = append(doc.Attributes, documentAttribute{
+				Name:  ra.Name,
+				Value: ra.Value,
+			})
+		}
+
+		obj := &Object{}
+		if err := obj.fromDocument(doc); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
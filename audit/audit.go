@@ -0,0 +1,237 @@
+// Package audit flags objects in a database which are likely to be out of
+// date, so that published IRR data can be cleaned up: route objects whose
+// origin does not announce them, routes registered for the same prefix in
+// other sources, objects which have not changed in years, and routes not
+// covered by an RPKI ROA.
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/rpki"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// dateLayout is the layout of the date in a changed attribute
+const dateLayout = "20060102"
+
+// Kind is the kind of problem a finding reports
+type Kind int
+
+// The kinds of problem which may be reported
+const (
+	NotAnnounced Kind = iota // the origin of a route does not announce it's prefix
+	Duplicate                // the prefix of a route is also registered in another source
+	Stale                    // the object has not changed for longer than the maximum age
+	NotCovered               // the route is not covered by any ROA
+)
+
+var kindNames = map[Kind]string{
+	NotAnnounced: "not-announced",
+	Duplicate:    "duplicate",
+	Stale:        "stale",
+	NotCovered:   "not-covered",
+}
+
+// String returns the name of the kind of problem
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler so that kinds are written by
+// name in JSON output
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ParseKind returns the kind with the given name, e.g. not-announced
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kindNames {
+		if strings.EqualFold(n, name) {
+			return k, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown kind %q", name)
+}
+
+// Finding is a single problem found in an object
+type Finding struct {
+	Kind    Kind   `json:"kind"`
+	Source  string `json:"source"`
+	Class   string `json:"class"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// String formats the finding on a single line, e.g.
+//
+//	TEST route 192.0.2.0/24AS65537: not-announced: 192.0.2.0/24 is not announced
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s %s: %s: %s", f.Source, f.Class, f.Key, f.Kind, f.Message)
+}
+
+// Options select the checks which are made, which objects are audited and
+// which findings are reported. Each check is skipped unless the data it
+// needs is given.
+type Options struct {
+	// RIB, if set, is checked for announcements of each route by it's origin
+	RIB *mrt.RIB
+	// Others are the databases of other registries, which are searched along
+	// with the audited database for routes in other sources
+	Others []*db.Database
+	// MaxAge, if not zero, is the number of years after the most recent
+	// changed date after which an object is stale
+	MaxAge int
+	// Now is the time object ages are measured from, or the current time if
+	// zero
+	Now time.Time
+	// Validator, if set, is used to find routes not covered by any ROA
+	Validator *rpki.Validator
+
+	Sources []string // only audit objects from these sources, or every source if empty
+	Kinds   []Kind   // only report these kinds, or every kind if empty
+}
+
+// Audit checks the objects in the database, returning the findings ordered by
+// class and primary key
+func Audit(d *db.Database, opts Options) []Finding {
+	sources := make(map[string]bool)
+	for _, source := range opts.Sources {
+		sources[strings.ToUpper(source)] = true
+	}
+	kinds := make(map[Kind]bool)
+	for _, k := range opts.Kinds {
+		kinds[k] = true
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	var findings []Finding
+	for _, obj := range d.Objects() {
+		source := strings.ToUpper(obj.Value(token.ATTR_REGISTRY_SOURCE))
+		if len(sources) > 0 && !sources[source] {
+			continue
+		}
+
+		add := func(k Kind, format string, args ...interface{}) {
+			if len(kinds) == 0 || kinds[k] {
+				findings = append(findings, Finding{
+					Kind:    k,
+					Source:  source,
+					Class:   obj.Class().Name(),
+					Key:     obj.Key(),
+					Message: fmt.Sprintf(format, args...),
+				})
+			}
+		}
+
+		if class := obj.Class(); class == token.CLASS_ROUTE || class == token.CLASS_ROUTE6 {
+			auditRoute(d, obj, source, opts, add)
+		}
+
+		if opts.MaxAge > 0 {
+			changed, ok := lastChanged(obj)
+			if ok && changed.AddDate(opts.MaxAge, 0, 0).Before(opts.Now) {
+				add(Stale, "last changed %s, more than %d years ago", changed.Format("2006-01-02"), opts.MaxAge)
+			}
+		}
+	}
+
+	return findings
+}
+
+// auditRoute makes the checks specific to route and route6 objects
+func auditRoute(d *db.Database, obj *ast.Object, source string, opts Options, add func(Kind, string, ...interface{})) {
+	ipnet, err := prefix.Parse(obj.Name())
+	if err != nil {
+		return
+	}
+	origin, err := aspath.ParseASN(strings.TrimSpace(obj.Value(token.ATTR_ORIGIN)))
+	if err != nil {
+		return
+	}
+
+	if opts.RIB != nil {
+		announced := opts.RIB.Origins(ipnet)
+		switch {
+		case len(announced) == 0:
+			add(NotAnnounced, "%s is not announced", ipnet)
+		case !contains(announced, origin):
+			names := make([]string, len(announced))
+			for i, asn := range announced {
+				names[i] = fmt.Sprintf("AS%d", asn)
+			}
+			add(NotAnnounced, "%s is announced by %s, not AS%d", ipnet, strings.Join(names, ", "), origin)
+		}
+	}
+
+	var others []string
+	for _, other := range append([]*db.Database{d}, opts.Others...) {
+		for _, route := range other.Routes(ipnet, db.Exact) {
+			if s := strings.ToUpper(route.Value(token.ATTR_REGISTRY_SOURCE)); s != source {
+				others = append(others, fmt.Sprintf("%s with origin %s", s, strings.ToUpper(route.Value(token.ATTR_ORIGIN))))
+			}
+		}
+	}
+	if others = unique(others); len(others) > 0 {
+		add(Duplicate, "%s is also registered in %s", ipnet, strings.Join(others, ", "))
+	}
+
+	if opts.Validator != nil {
+		if state, _ := opts.Validator.Validate(ipnet, origin); state == rpki.NotFound {
+			add(NotCovered, "%s is not covered by any ROA", ipnet)
+		}
+	}
+}
+
+// lastChanged returns the most recent date of the object's changed attributes
+func lastChanged(obj *ast.Object) (time.Time, bool) {
+	var last time.Time
+	for _, attr := range obj.Attributes[1:] {
+		if attr.Token.Type != token.ATTR_CHANGED_AT_AND_BY {
+			continue
+		}
+		for _, tok := range attr.Values {
+			if tok.Type != token.DATA_DATE {
+				continue
+			}
+			if date, err := time.Parse(dateLayout, tok.Literal); err == nil && date.After(last) {
+				last = date
+			}
+		}
+	}
+
+	return last, !last.IsZero()
+}
+
+func contains(asns []uint32, asn uint32) bool {
+	for _, a := range asns {
+		if a == asn {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+	"github.com/kkirsche/rpsl/rpki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func announce(rib *mrt.RIB, cidr string, path ...uint32) {
+	_, ipnet, _ := net.ParseCIDR(cidr)
+	rib.Add(&mrt.Route{Prefix: ipnet, Path: []mrt.Segment{{Type: mrt.ASSequence, ASNs: path}}})
+}
+
+func TestAudit(t *testing.T) {
+	d, err := db.LoadFile("testdata/ours.db")
+	require.NoError(t, err)
+	radb, err := db.LoadFile("testdata/radb.db")
+	require.NoError(t, err)
+
+	rib := mrt.NewRIB()
+	announce(rib, "192.0.2.0/24", 65001, 65537)
+	announce(rib, "198.51.100.0/24", 65001, 65538)
+	announce(rib, "198.51.100.0/24", 65002, 65539, 65538)
+	announce(rib, "2001:db8::/32", 65001, 65537)
+
+	vrps, err := rpki.LoadFile("../rpki/testdata/rpki-client.json")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	validator := rpki.NewValidator(vrps)
+
+	all := Options{
+		RIB:       rib,
+		Others:    []*db.Database{radb},
+		MaxAge:    5,
+		Now:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Validator: validator,
+	}
+	onlyStale := all
+	onlyStale.Kinds = []Kind{Stale}
+	onlyOther := all
+	onlyOther.Sources = []string{"other"}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"all", all, []string{
+			"TEST route 192.0.2.0/24AS65537: duplicate: 192.0.2.0/24 is also registered in RADB with origin AS65537, RADB with origin AS65539",
+			"TEST route 198.51.100.0/24AS65537: not-announced: 198.51.100.0/24 is announced by AS65538, not AS65537",
+			"TEST route 198.51.100.0/24AS65537: not-covered: 198.51.100.0/24 is not covered by any ROA",
+			"TEST route 198.51.100.0/24AS65537: stale: last changed 2015-01-01, more than 5 years ago",
+			"TEST route 203.0.113.0/24AS65537: not-announced: 203.0.113.0/24 is not announced",
+			"TEST route 203.0.113.0/24AS65537: duplicate: 203.0.113.0/24 is also registered in OTHER with origin AS65538",
+			"OTHER route 203.0.113.0/24AS65538: not-announced: 203.0.113.0/24 is not announced",
+			"OTHER route 203.0.113.0/24AS65538: duplicate: 203.0.113.0/24 is also registered in TEST with origin AS65537",
+		}},
+		{"kinds", onlyStale, []string{
+			"TEST route 198.51.100.0/24AS65537: stale: last changed 2015-01-01, more than 5 years ago",
+		}},
+		{"sources", onlyOther, []string{
+			"OTHER route 203.0.113.0/24AS65538: not-announced: 203.0.113.0/24 is not announced",
+			"OTHER route 203.0.113.0/24AS65538: duplicate: 203.0.113.0/24 is also registered in TEST with origin AS65537",
+		}},
+		{"no data", Options{}, []string{
+			"TEST route 203.0.113.0/24AS65537: duplicate: 203.0.113.0/24 is also registered in OTHER with origin AS65538",
+			"OTHER route 203.0.113.0/24AS65538: duplicate: 203.0.113.0/24 is also registered in TEST with origin AS65537",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			for _, f := range Audit(d, tt.opts) {
+				actual = append(actual, f.String())
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for k, name := range kindNames {
+		actual, err := ParseKind(strings.ToUpper(name))
+		assert.NoError(t, err)
+		assert.Equal(t, k, actual)
+	}
+
+	_, err := ParseKind("bogus")
+	assert.EqualError(t, err, `unknown kind "bogus"`)
+}
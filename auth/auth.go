@@ -0,0 +1,455 @@
+// Package auth implements the RFC 2725 authorization model for updates to RPSL
+// objects. Given a proposed create, modify or delete and the current database,
+// Check works out which mntner objects must authorize the update and evaluates
+// the submitter's credentials against each mntner's auth lines.
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Operation is the kind of update being authorized
+type Operation int
+
+const (
+	// Create adds an object which does not yet exist
+	Create Operation = iota
+	// Modify replaces an existing object
+	Modify
+	// Delete removes an existing object
+	Delete
+)
+
+func (op Operation) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Delete:
+		return "delete"
+	}
+
+	return fmt.Sprintf("Operation(%d)", int(op))
+}
+
+// Credentials are presented by the submitter of an update
+type Credentials struct {
+	Passwords    []string            // cleartext passwords, checked against CRYPT-PW, MD5-PW and BCRYPT-PW auth lines
+	From         string              // the e-mail address the update was sent from, checked against MAIL-FROM auth lines
+	PGPKeys      []string            // the key-cert names of keys with valid signatures over the update, e.g. PGPKEY-80F238C6
+	Certificates []*x509.Certificate // verified client certificates, checked against X509 auth lines
+}
+
+// Mntner is the result of checking the credentials against a single mntner
+type Mntner struct {
+	Name   string
+	Object *ast.Object // nil if the mntner does not exist
+	Passed bool
+	Scheme string   // the scheme of the auth line which passed, e.g. MAIL-FROM
+	Notes  []string // why auth lines could not be checked, e.g. an unsupported scheme
+}
+
+func (m *Mntner) String() string {
+	var s string
+	switch {
+	case m.Object == nil:
+		s = m.Name + " does not exist"
+	case m.Passed:
+		s = m.Name + " passed with " + m.Scheme
+	default:
+		s = m.Name + " failed"
+	}
+	if len(m.Notes) > 0 {
+		s += " (" + strings.Join(m.Notes, ", ") + ")"
+	}
+
+	return s
+}
+
+// Requirement is a set of mntners, any one of which may authorize the update
+type Requirement struct {
+	Reason  string // why the mntners must authorize the update, e.g. mnt-by of aut-num AS65537
+	Mntners []*Mntner
+	Passed  bool
+}
+
+func (r *Requirement) String() string {
+	status := "failed"
+	if r.Passed {
+		status = "passed"
+	}
+
+	var mntners []string
+	for _, m := range r.Mntners {
+		mntners = append(mntners, m.String())
+	}
+	if len(mntners) == 0 {
+		mntners = append(mntners, "no mntners")
+	}
+
+	return fmt.Sprintf("%s: %s: %s", status, r.Reason, strings.Join(mntners, "; "))
+}
+
+// Result explains whether an update is authorized
+type Result struct {
+	Operation    Operation
+	Object       *ast.Object
+	Requirements []*Requirement
+	Authorized   bool
+}
+
+// String explains the result, one line per requirement
+func (r *Result) String() string {
+	status := "not authorized"
+	if r.Authorized {
+		status = "authorized"
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s %s %s: %s\n", r.Operation, r.Object.Class().Name(), r.Object.Key(), status)
+	for _, req := range r.Requirements {
+		fmt.Fprintf(&out, "  %s\n", req)
+	}
+
+	return out.String()
+}
+
+type checker struct {
+	d       *db.Database
+	op      Operation
+	obj     *ast.Object
+	creds   Credentials
+	mntners map[string]*Mntner
+	result  *Result
+}
+
+// Check determines which mntners must authorize the operation on obj, and
+// whether the credentials satisfy them. For a modify obj is the replacement
+// object, for a delete only its class and primary key are used. An error is
+// returned if a created object already exists or a modified or deleted object
+// does not.
+func Check(d *db.Database, op Operation, obj *ast.Object, creds Credentials) (*Result, error) {
+	if len(obj.Attributes) == 0 {
+		return nil, fmt.Errorf("object has no attributes")
+	}
+
+	existing, exists := d.Get(obj.Class(), obj.Key())
+	switch {
+	case op == Create && exists:
+		return nil, fmt.Errorf("%s %s already exists", obj.Class().Name(), obj.Key())
+	case op != Create && !exists:
+		return nil, fmt.Errorf("%s %s does not exist", obj.Class().Name(), obj.Key())
+	}
+
+	c := &checker{
+		d:       d,
+		op:      op,
+		obj:     obj,
+		creds:   creds,
+		mntners: make(map[string]*Mntner),
+		result:  &Result{Operation: op, Object: obj},
+	}
+
+	if op != Create {
+		// changes to an existing object are authorized by its current mntners
+		c.require("mnt-by of the existing "+obj.Class().Name(), existing.Values(token.ATTR_MAINTAINED_BY))
+	} else {
+		c.require("mnt-by of the new "+obj.Class().Name(), obj.Values(token.ATTR_MAINTAINED_BY))
+		if err := c.checkCreate(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.result.Authorized = true
+	for _, req := range c.result.Requirements {
+		if !req.Passed {
+			c.result.Authorized = false
+		}
+	}
+
+	return c.result, nil
+}
+
+// checkCreate adds the requirements for objects created within the hierarchy
+// of another object
+func (c *checker) checkCreate() error {
+	switch class := c.obj.Class(); class {
+	case token.CLASS_ROUTE, token.CLASS_ROUTE6:
+		ipnet, err := prefix.Parse(c.obj.Name())
+		if err != nil {
+			return err
+		}
+		c.checkParentRoute(ipnet)
+		c.checkOrigin(ipnet)
+	case token.CLASS_AS_SET, token.CLASS_ROUTE_SET, token.CLASS_FILTER_SET, token.CLASS_PEERING_SET, token.CLASS_ROUTER_SET:
+		c.checkParentSet()
+	}
+
+	return nil
+}
+
+// checkParentRoute requires a new route to be authorized by the route with
+// the same prefix but a different origin or, if there is none, by the most
+// specific covering route. RFC 2725 uses the covering inetnum when there is
+// no covering route, but inetnum objects are not supported.
+func (c *checker) checkParentRoute(ipnet *net.IPNet) {
+	var parents []*ast.Object
+	for _, route := range c.d.Routes(ipnet, db.Exact) {
+		if route.Class() == c.obj.Class() && route.Key() != c.obj.Key() {
+			parents = append(parents, route)
+		}
+	}
+	if len(parents) == 0 {
+		parents = c.d.Routes(ipnet, db.LessSpecific)
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	var names []string
+	for _, parent := range parents {
+		names = append(names, routeMntners(parent, ipnet)...)
+	}
+
+	reason := "mnt-routes of the covering " + parents[0].Class().Name()
+	if len(parents) == 1 {
+		reason += " " + parents[0].Key()
+	}
+	c.require(reason, names)
+}
+
+// checkOrigin requires a new route to be authorized by its origin aut-num, if
+// the aut-num exists
+func (c *checker) checkOrigin(ipnet *net.IPNet) {
+	origin := c.obj.Value(token.ATTR_ORIGIN)
+	autNum, ok := c.d.Get(token.CLASS_AUT_NUM, origin)
+	if !ok {
+		return
+	}
+
+	names, ok := mntRoutes(autNum, ipnet)
+	if !ok {
+		names = autNum.Values(token.ATTR_MAINTAINED_BY)
+	}
+	c.require("mnt-routes of aut-num "+autNum.Name(), names)
+}
+
+// checkParentSet requires a new hierarchical set, e.g. AS65537:AS-CUSTOMERS,
+// to be authorized by the object it is named within
+func (c *checker) checkParentSet() {
+	name := c.obj.Name()
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return
+	}
+
+	name = name[:i]
+	class := parentClass(name)
+	parent, ok := c.d.Get(class, name)
+	if !ok {
+		c.result.Requirements = append(c.result.Requirements, &Requirement{
+			Reason: fmt.Sprintf("mnt-lower of %s %s, which does not exist", class.Name(), strings.ToUpper(name)),
+		})
+		return
+	}
+
+	names := parent.Values(token.ATTR_MAINTAINER_LOWER)
+	if len(names) == 0 {
+		names = parent.Values(token.ATTR_MAINTAINED_BY)
+	}
+	c.require(fmt.Sprintf("mnt-lower of %s %s", class.Name(), parent.Name()), names)
+}
+
+// parentClass returns the class of a set name component, e.g. as-set for
+// AS65537:AS-CUSTOMERS or aut-num for AS65537
+func parentClass(name string) token.Type {
+	if class := lexer.SetClass(name); class != token.ILLEGAL {
+		return class
+	}
+
+	return token.CLASS_AUT_NUM
+}
+
+// routeMntners returns the mntners of a covering route which may authorize
+// more specific routes: mnt-routes, falling back to mnt-lower then mnt-by
+func routeMntners(route *ast.Object, ipnet *net.IPNet) []string {
+	if names, ok := mntRoutes(route, ipnet); ok {
+		return names
+	}
+	if names := route.Values(token.ATTR_MAINTAINER_LOWER); len(names) > 0 {
+		return names
+	}
+
+	return route.Values(token.ATTR_MAINTAINED_BY)
+}
+
+// mntRoutes returns the mntners listed in the object's mnt-routes attributes
+// which apply to the prefix, and whether the object has any mnt-routes
+func mntRoutes(obj *ast.Object, ipnet *net.IPNet) ([]string, bool) {
+	attrs := obj.Get(token.ATTR_MAINTAINER_ROUTES)
+	var names []string
+	for _, attr := range attrs {
+		value := strings.Join(attr.Lines(), " ")
+		list, ranges := value, ""
+		if i := strings.Index(value, "{"); i >= 0 {
+			list, ranges = value[:i], strings.TrimSuffix(value[i+1:], "}")
+		}
+
+		applies := true
+		if strings.TrimSpace(ranges) != "" {
+			applies = false
+			for _, r := range strings.FieldsFunc(ranges, isSeparator) {
+				if rng, err := prefix.ParseRange(r); err == nil && rng.Contains(ipnet) {
+					applies = true
+				}
+			}
+		}
+		if !applies {
+			continue
+		}
+
+		for _, name := range strings.FieldsFunc(list, isSeparator) {
+			if !strings.EqualFold(name, "ANY") {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, len(attrs) > 0
+}
+
+func isSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
+
+// require adds a requirement that one of the named mntners authorizes the
+// update
+func (c *checker) require(reason string, names []string) {
+	req := &Requirement{Reason: reason}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		m := c.mntner(name)
+		req.Mntners = append(req.Mntners, m)
+		if m.Passed {
+			req.Passed = true
+		}
+	}
+
+	c.result.Requirements = append(c.result.Requirements, req)
+}
+
+// mntner checks the credentials against the named mntner, caching the result
+func (c *checker) mntner(name string) *Mntner {
+	if m, ok := c.mntners[name]; ok {
+		return m
+	}
+
+	m := &Mntner{Name: name}
+	c.mntners[name] = m
+
+	obj, ok := c.d.Get(token.CLASS_MAINTAINER, name)
+	if c.op == Create && c.obj.Class() == token.CLASS_MAINTAINER && strings.EqualFold(c.obj.Name(), name) {
+		// a new mntner is authorized by its own auth lines
+		obj, ok = c.obj, true
+	}
+	if !ok {
+		return m
+	}
+
+	m.Object = obj
+	for _, attr := range obj.Get(token.ATTR_AUTHENTICATION) {
+		if len(attr.Values) == 0 {
+			continue
+		}
+
+		passed, err := check(c.d, attr.Values[0], c.creds)
+		if err != nil {
+			m.Notes = append(m.Notes, err.Error())
+			continue
+		}
+		if passed {
+			m.Passed = true
+			m.Scheme = scheme(attr.Values[0])
+			break
+		}
+	}
+
+	return m
+}
+
+// scheme returns the name of an auth line's scheme
+func scheme(tok token.Token) string {
+	switch tok.Type {
+	case token.DATA_CRYPT_PASS:
+		return "CRYPT-PW"
+	case token.DATA_MD5_PASS:
+		return "MD5-PW"
+	case token.DATA_MAIL_FROM_PASS:
+		return "MAIL-FROM"
+	case token.DATA_PGP_KEY:
+		return "PGPKEY"
+	case token.DATA_NO_AUTH:
+		return "NONE"
+	case token.DATA_AUTH:
+		prefix, _ := lexer.AuthScheme(tok.Literal)
+		return strings.TrimSuffix(prefix, "-")
+	}
+
+	return tok.Type.String()
+}
+
+// check reports whether the credentials satisfy a single auth line, or an
+// error if the auth line cannot be checked
+func check(d *db.Database, tok token.Token, creds Credentials) (bool, error) {
+	switch tok.Type {
+	case token.DATA_NO_AUTH:
+		return true, nil
+	case token.DATA_MAIL_FROM_PASS:
+		if creds.From == "" {
+			return false, nil
+		}
+		re, err := regexp.Compile("(?i)^(?:" + tok.Literal + ")$")
+		if err != nil {
+			return false, fmt.Errorf("invalid MAIL-FROM %s", tok.Literal)
+		}
+		return re.MatchString(creds.From), nil
+	case token.DATA_CRYPT_PASS, token.DATA_MD5_PASS:
+		for _, password := range creds.Passwords {
+			if VerifyPassword(tok.Literal, password) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case token.DATA_PGP_KEY:
+		for _, key := range creds.PGPKeys {
+			if strings.EqualFold(key, "PGPKEY-"+tok.Literal) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case token.DATA_AUTH:
+		prefix, _ := lexer.AuthScheme(tok.Literal)
+		if v, ok := lookupVerifier(prefix); ok {
+			return v.Verify(d, strings.TrimSpace(tok.Literal[len(prefix):]), creds)
+		}
+	}
+
+	return false, fmt.Errorf("%s is not supported", scheme(tok))
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, text string) *ast.Object {
+	objects, err := parser.Parse("update", text)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1) {
+		t.FailNow()
+	}
+
+	return objects[0]
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         Operation
+		object     string
+		creds      Credentials
+		authorized bool
+	}{
+		{
+			name:       "modify with mail-from",
+			op:         Modify,
+			object:     "aut-num: AS65537\nas-name: TEST\nmnt-by: TEST-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "noc@EXAMPLE.com"},
+			authorized: true,
+		},
+		{
+			name:   "modify with the wrong sender",
+			op:     Modify,
+			object: "aut-num: AS65537\nas-name: TEST\nmnt-by: TEST-MNT\nsource: TEST\n",
+			creds:  Credentials{From: "noc@example.com.evil"},
+		},
+		{
+			name:       "modify with pgp",
+			op:         Modify,
+			object:     "aut-num: AS65537\nas-name: TEST\nmnt-by: OPEN-MNT\nsource: TEST\n",
+			creds:      Credentials{PGPKeys: []string{"pgpkey-80f238c6"}},
+			authorized: true,
+		},
+		{
+			name:   "delete with the wrong password",
+			op:     Delete,
+			object: "aut-num: AS65538\nas-name: OTHER\nmnt-by: CRYPT-MNT\nsource: TEST\n",
+			creds:  Credentials{Passwords: []string{"hunter2"}},
+		},
+		{
+			name:       "delete with crypt-pw",
+			op:         Delete,
+			object:     "aut-num: AS65538\nas-name: OTHER\nmnt-by: CRYPT-MNT\nsource: TEST\n",
+			creds:      Credentials{Passwords: []string{"hunter2", "secret"}},
+			authorized: true,
+		},
+		{
+			name:       "create with md5-pw",
+			op:         Create,
+			object:     "aut-num: AS65540\nas-name: NEW\nmnt-by: MD5-MNT\nsource: TEST\n",
+			creds:      Credentials{Passwords: []string{"hunter2"}},
+			authorized: true,
+		},
+		{
+			name:       "route within mnt-routes of the covering route and aut-num",
+			op:         Create,
+			object:     "route: 198.51.100.0/24\norigin: AS65537\nmnt-by: CUSTOMER-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "customer@example.org"},
+			authorized: true,
+		},
+		{
+			name:   "route outside mnt-routes of the aut-num",
+			op:     Create,
+			object: "route: 198.51.102.0/24\norigin: AS65537\nmnt-by: OPEN-MNT\nsource: TEST\n",
+		},
+		{
+			name:       "route authorized by mnt-lower of the covering route",
+			op:         Create,
+			object:     "route: 192.0.2.128/25\norigin: AS65539\nmnt-by: OPEN-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "lower@example.net"},
+			authorized: true,
+		},
+		{
+			name:   "route with a different origin for an existing prefix",
+			op:     Create,
+			object: "route: 203.0.113.0/24\norigin: AS65539\nmnt-by: OPEN-MNT\nsource: TEST\n",
+		},
+		{
+			name:       "set within an as-set",
+			op:         Create,
+			object:     "as-set: AS-TEST:AS-CUSTOMERS\nmembers: AS65538\nmnt-by: OPEN-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "lower@example.net"},
+			authorized: true,
+		},
+		{
+			name:       "set within an aut-num",
+			op:         Create,
+			object:     "as-set: AS65537:AS-PEERS\nmembers: AS65538\nmnt-by: OPEN-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "lower@example.net"},
+			authorized: true,
+		},
+		{
+			name:   "set within a missing as-set",
+			op:     Create,
+			object: "as-set: AS-MISSING:AS-PEERS\nmembers: AS65538\nmnt-by: OPEN-MNT\nsource: TEST\n",
+		},
+		{
+			name:       "new mntner authorizes itself",
+			op:         Create,
+			object:     "mntner: NEW-MNT\nauth: MAIL-FROM new@example.com\nmnt-by: NEW-MNT\nsource: TEST\n",
+			creds:      Credentials{From: "new@example.com"},
+			authorized: true,
+		},
+		{
+			name:   "missing mntner",
+			op:     Create,
+			object: "aut-num: AS65540\nas-name: NEW\nmnt-by: MISSING-MNT\nsource: TEST\n",
+		},
+	}
+
+	d, err := db.LoadFile("testdata/auth.db")
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Check(d, tt.op, mustParse(t, tt.object), tt.creds)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.authorized, result.Authorized, result.String())
+			}
+		})
+	}
+}
+
+func TestCheckExistence(t *testing.T) {
+	d, err := db.LoadFile("testdata/auth.db")
+	require.NoError(t, err)
+
+	_, err = Check(d, Create, mustParse(t, "aut-num: AS65537\nas-name: TEST\nmnt-by: TEST-MNT\nsource: TEST\n"), Credentials{})
+	assert.EqualError(t, err, "aut-num AS65537 already exists")
+
+	_, err = Check(d, Delete, mustParse(t, "aut-num: AS65540\nas-name: NEW\nmnt-by: TEST-MNT\nsource: TEST\n"), Credentials{})
+	assert.EqualError(t, err, "aut-num AS65540 does not exist")
+}
+
+func TestResultString(t *testing.T) {
+	d, err := db.LoadFile("testdata/auth.db")
+	require.NoError(t, err)
+
+	route := mustParse(t, "route: 198.51.102.0/24\norigin: AS65537\nmnt-by: OPEN-MNT\nsource: TEST\n")
+	result, err := Check(d, Create, route, Credentials{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `create route 198.51.102.0/24AS65537: not authorized
+  passed: mnt-by of the new route: OPEN-MNT passed with NONE
+  passed: mnt-routes of the covering route 198.51.100.0/22AS65537: OPEN-MNT passed with NONE
+  failed: mnt-routes of aut-num AS65537: no mntners
+`, result.String())
+	}
+
+	aut := mustParse(t, "aut-num: AS65538\nas-name: OTHER\nmnt-by: CRYPT-MNT\nsource: TEST\n")
+	result, err = Check(d, Modify, aut, Credentials{From: "noc@example.com"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `modify aut-num AS65538: not authorized
+  failed: mnt-by of the existing aut-num: CRYPT-MNT failed
+`, result.String())
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// KeyCert is the public key held in a key-cert object, either a PGP public
+// key, for key-certs named PGPKEY-<id>, or an X.509 certificate, for key-certs
+// named X509-<n>
+type KeyCert struct {
+	Name        string   // e.g. PGPKEY-80F238C6 or X509-1
+	Method      string   // PGP or X509
+	Owner       []string // the user IDs of a PGP key, or the subject of a certificate
+	Fingerprint string   // e.g. D079 99F1 92D5 41B6 E7BC  6578 9175 DB8D 80F2 38C6
+	Entity      *openpgp.Entity
+	Certificate *x509.Certificate
+}
+
+// ParseKeyCert parses the public key held in the certif attributes of a
+// key-cert object. A PGP key-cert must be named after the key's ID. The
+// method, owner and fingerpr attributes are generated from the key rather
+// than read from the object.
+func ParseKeyCert(obj *ast.Object) (*KeyCert, error) {
+	if obj.Class() != token.CLASS_KEY_CERT {
+		return nil, fmt.Errorf("expected a key-cert object, got %s", obj.Class().Name())
+	}
+
+	var armoured strings.Builder
+	for _, attr := range obj.Get(token.ATTR_CERTIFICATE) {
+		for _, line := range attr.Lines() {
+			armoured.WriteString(line + "\n")
+		}
+	}
+
+	name := strings.ToUpper(obj.Name())
+	if strings.HasPrefix(name, "X509-") {
+		return parseX509(name, armoured.String())
+	}
+
+	return parsePGP(name, armoured.String())
+}
+
+func parsePGP(name, armoured string) (*KeyCert, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoured))
+	if err != nil {
+		return nil, fmt.Errorf("%s: reading public key: %v", name, err)
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("%s: expected a single public key, found %d", name, len(entities))
+	}
+
+	entity := entities[0]
+	if id := "PGPKEY-" + entity.PrimaryKey.KeyIdShortString(); name != id {
+		return nil, fmt.Errorf("%s: key ID does not match, expected %s", name, id)
+	}
+
+	kc := &KeyCert{
+		Name:        name,
+		Method:      "PGP",
+		Fingerprint: fingerprint(entity.PrimaryKey.Fingerprint[:]),
+		Entity:      entity,
+	}
+	for id := range entity.Identities {
+		kc.Owner = append(kc.Owner, id)
+	}
+
+	return kc, nil
+}
+
+func parseX509(name, armoured string) (*KeyCert, error) {
+	block, _ := pem.Decode([]byte(armoured))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: expected a PEM encoded certificate", name)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: reading certificate: %v", name, err)
+	}
+
+	sum := sha1.Sum(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+
+	return &KeyCert{
+		Name:        name,
+		Method:      "X509",
+		Owner:       []string{cert.Subject.String()},
+		Fingerprint: strings.Join(hex, ":"),
+		Certificate: cert,
+	}, nil
+}
+
+// fingerprint formats a PGP fingerprint as groups of four hex digits, with an
+// extra space between the two halves, as gpg does
+func fingerprint(fpr []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(fpr); i += 2 {
+		if i > 0 {
+			out.WriteByte(' ')
+		}
+		if i == len(fpr)/2 {
+			out.WriteByte(' ')
+		}
+		fmt.Fprintf(&out, "%X", fpr[i:i+2])
+	}
+
+	return out.String()
+}
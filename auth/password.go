@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// itoa64 is the alphabet used to encode salts and hashes by crypt(3)
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Magic prefixes MD5-crypt hashes
+const md5Magic = "$1$"
+
+// DefaultBcryptCost is the cost used by BcryptPassword when none is given
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// VerifyPassword reports whether the password matches the hash, which may be
+// a traditional DES crypt hash as used by CRYPT-PW, e.g. abgOeLfPimXQo, an
+// MD5-crypt hash as used by MD5-PW, e.g. $1$fgW84Y9r$xUQ43MEBxd3efEdhR2Pu3.,
+// or a bcrypt hash beginning $2a$, $2b$ or $2y$
+func VerifyPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, md5Magic):
+		salt := strings.TrimPrefix(hash, md5Magic)
+		if i := strings.Index(salt, "$"); i >= 0 {
+			salt = salt[:i]
+		}
+		return equal(md5Crypt(password, salt), hash)
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case len(hash) == 13:
+		return equal(desCrypt(password, hash[:2]), hash)
+	}
+
+	return false
+}
+
+// CryptPassword hashes the password with traditional DES crypt and a random
+// salt, for use in a CRYPT-PW auth line. Only the first eight characters of
+// the password are used, so MD5Password or BcryptPassword should be preferred.
+func CryptPassword(password string) (string, error) {
+	salt, err := randomSalt(2)
+	if err != nil {
+		return "", err
+	}
+
+	return desCrypt(password, salt), nil
+}
+
+// MD5Password hashes the password with MD5-crypt and a random salt, for use in
+// an MD5-PW auth line
+func MD5Password(password string) (string, error) {
+	salt, err := randomSalt(8)
+	if err != nil {
+		return "", err
+	}
+
+	return md5Crypt(password, salt), nil
+}
+
+// BcryptPassword hashes the password with bcrypt, using DefaultBcryptCost if
+// cost is zero
+func BcryptPassword(password string, cost int) (string, error) {
+	if cost == 0 {
+		cost = DefaultBcryptCost
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func randomSalt(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating salt: %v", err)
+	}
+
+	for i, b := range buf {
+		buf[i] = itoa64[b&0x3f]
+	}
+
+	return string(buf), nil
+}
+
+// md5Crypt implements the FreeBSD MD5-crypt algorithm, returning a hash such
+// as $1$fgW84Y9r$xUQ43MEBxd3efEdhR2Pu3.
+func md5Crypt(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+	alt := md5.Sum([]byte(password + salt + password))
+
+	ctx := md5.New()
+	ctx.Write([]byte(password + md5Magic + salt))
+	for n := len(pw); n > 0; n -= 16 {
+		if n > 16 {
+			ctx.Write(alt[:])
+		} else {
+			ctx.Write(alt[:n])
+		}
+	}
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	// stretch the hash to slow down brute force attacks
+	for i := 0; i < 1000; i++ {
+		ctx := md5.New()
+		if i&1 == 1 {
+			ctx.Write(pw)
+		} else {
+			ctx.Write(final)
+		}
+		if i%3 != 0 {
+			ctx.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx.Write(pw)
+		}
+		if i&1 == 1 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(pw)
+		}
+		final = ctx.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(md5Magic + salt + "$")
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(&out, uint(final[g[0]])<<16|uint(final[g[1]])<<8|uint(final[g[2]]), 4)
+	}
+	to64(&out, uint(final[11]), 2)
+
+	return out.String()
+}
+
+// to64 writes the n least significant 6 bit groups of v, least significant
+// first
+func to64(out *strings.Builder, v uint, n int) {
+	for ; n > 0; n-- {
+		out.WriteByte(itoa64[v&0x3f])
+		v >>= 6
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	tests := []struct {
+		hash     string
+		password string
+		valid    bool
+	}{
+		{"abgOeLfPimXQo", "test", true},
+		{"abgOeLfPimXQo", "Test", false},
+		{"dhbKKWgspIXyA", "secret", true},
+		// only the first eight characters are used by DES crypt
+		{"./GLbXuBxqD4c", "abcdefghij", true},
+		{"./GLbXuBxqD4c", "abcdefghXX", true},
+		{"..X8NBuQ4l6uQ", "", true},
+		{"$1$fgW84Y9r$xUQ43MEBxd3efEdhR2Pu3.", "password", true},
+		{"$1$fgW84Y9r$xUQ43MEBxd3efEdhR2Pu3.", "passwore", false},
+		{"$1$saltsalt$ZliGyAN3DciDHEkDboonh/", "hunter2", true},
+		{"$2a$04$kC1KKnJQ29YAfOo5gcLF3.0P0WAe/6yqbJhVzMv0dn2WPK9ccJ2su", "hunter2", false},
+		{"", "", false},
+		{"not a hash", "not a hash", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, VerifyPassword(tt.hash, tt.password), "%s %q", tt.hash, tt.password)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := CryptPassword("secret")
+	if assert.NoError(t, err) {
+		assert.Len(t, hash, 13)
+		assert.True(t, VerifyPassword(hash, "secret"))
+		assert.False(t, VerifyPassword(hash, "hunter2"))
+	}
+
+	hash, err = MD5Password("secret")
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^\$1\$[./0-9A-Za-z]{8}\$[./0-9A-Za-z]{22}$`, hash)
+		assert.True(t, VerifyPassword(hash, "secret"))
+		assert.False(t, VerifyPassword(hash, "hunter2"))
+	}
+
+	hash, err = BcryptPassword("secret", 4)
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^\$2a\$04\$`, hash)
+		assert.True(t, VerifyPassword(hash, "secret"))
+		assert.False(t, VerifyPassword(hash, "hunter2"))
+	}
+}
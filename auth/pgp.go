@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// ErrNotSigned is returned when a message has no PGP signature
+var ErrNotSigned = errors.New("message is not PGP signed")
+
+// Signed is the text of a message with a valid PGP signature
+type Signed struct {
+	KeyCert string // the key-cert of the signing key, for Credentials.PGPKeys
+	Text    []byte
+}
+
+// VerifyClearsigned verifies a PGP clearsigned message, such as the body of
+// an update e-mail, against the key-cert objects in the database. Signatures
+// by keys which are unknown, expired or revoked are rejected.
+func VerifyClearsigned(d *db.Database, message []byte) (*Signed, error) {
+	block, _ := clearsign.Decode(message)
+	if block == nil {
+		return nil, ErrNotSigned
+	}
+
+	signature, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %v", err)
+	}
+
+	name, err := verify(d, block.Bytes, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// the line break ending the text is part of the signature's armor, but
+	// the text is returned as it appears in the message, ending with a line
+	// break
+	text := block.Plaintext
+	if len(text) > 0 && !bytes.HasSuffix(text, []byte("\n")) {
+		text = append(text, '\n')
+	}
+
+	return &Signed{KeyCert: name, Text: text}, nil
+}
+
+// VerifyMIME verifies a PGP/MIME message (RFC 3156), given the value of its
+// Content-Type header and its body, against the key-cert objects in the
+// database. The returned text is the signed MIME part, including its headers.
+// Signatures by keys which are unknown, expired or revoked are rejected.
+func VerifyMIME(d *db.Database, contentType string, body []byte) (*Signed, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing content type: %v", err)
+	}
+	if mediaType != "multipart/signed" || !strings.EqualFold(params["protocol"], "application/pgp-signature") {
+		return nil, ErrNotSigned
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("multipart/signed message has no boundary")
+	}
+
+	parts := splitParts(canonicalLines(body), params["boundary"])
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("multipart/signed message has %d parts, expected 2", len(parts))
+	}
+
+	// the signature part's headers are ignored, as the armour is enough to
+	// find the signature
+	block, err := armor.Decode(bytes.NewReader(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %v", err)
+	}
+	if block.Type != openpgp.SignatureType {
+		return nil, fmt.Errorf("reading signature: unexpected %s", block.Type)
+	}
+	signature, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %v", err)
+	}
+
+	name, err := verify(d, parts[0], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signed{KeyCert: name, Text: parts[0]}, nil
+}
+
+// canonicalLines converts line endings to CRLF, as signatures over MIME parts
+// are calculated over the canonical form
+func canonicalLines(body []byte) []byte {
+	body = bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(body, []byte("\n"), []byte("\r\n"), -1)
+}
+
+// splitParts returns the body parts of a multipart message. The CRLF before
+// each delimiter belongs to the delimiter rather than the part.
+func splitParts(body []byte, boundary string) [][]byte {
+	delimiter := []byte("\r\n--" + boundary)
+	body = append([]byte("\r\n"), body...)
+
+	var parts [][]byte
+	i := bytes.Index(body, delimiter)
+	for i >= 0 {
+		rest := body[i+len(delimiter):]
+		if bytes.HasPrefix(rest, []byte("--")) {
+			break
+		}
+		// skip any transport padding after the delimiter
+		eol := bytes.Index(rest, []byte("\r\n"))
+		if eol < 0 {
+			break
+		}
+		rest = rest[eol+2:]
+
+		next := bytes.Index(rest, delimiter)
+		if next < 0 {
+			break
+		}
+		parts = append(parts, rest[:next])
+		body, i = rest, next
+	}
+
+	return parts
+}
+
+// verify checks a detached signature over the signed bytes, returning the
+// name of the key-cert which made it. Keys which are revoked or expired, or
+// not permitted to sign, are rejected even if the signature is valid.
+func verify(d *db.Database, signed, signature []byte) (string, error) {
+	p, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return "", fmt.Errorf("reading signature: %v", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("reading signature: unsupported %T", p)
+	}
+	if sig.IssuerKeyId == nil {
+		return "", fmt.Errorf("signature does not identify its key")
+	}
+
+	kc, err := keyCert(d, *sig.IssuerKeyId)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	keys := openpgp.EntityList{kc.Entity}.KeysById(*sig.IssuerKeyId)
+	for _, key := range keys {
+		switch {
+		case len(kc.Entity.Revocations) > 0:
+			return "", fmt.Errorf("%s has been revoked", kc.Name)
+		case key.SelfSignature == nil:
+			return "", fmt.Errorf("%s has no self-signature", kc.Name)
+		case key.SelfSignature.RevocationReason != nil:
+			return "", fmt.Errorf("%s has been revoked", kc.Name)
+		case key.PublicKey.KeyExpired(key.SelfSignature, now) || expired(kc.Entity, now):
+			return "", fmt.Errorf("%s has expired", kc.Name)
+		}
+	}
+
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 &&
+		now.After(sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs)*time.Second)) {
+		return "", fmt.Errorf("signature by %s has expired", kc.Name)
+	}
+
+	if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{kc.Entity}, bytes.NewReader(signed), bytes.NewReader(signature), nil); err != nil {
+		return "", fmt.Errorf("invalid signature by %s: %v", kc.Name, err)
+	}
+
+	return kc.Name, nil
+}
+
+// expired reports whether every identity of the entity has expired, which
+// expires the primary key and so any subkeys
+func expired(entity *openpgp.Entity, now time.Time) bool {
+	for _, id := range entity.Identities {
+		if id.SelfSignature != nil && !entity.PrimaryKey.KeyExpired(id.SelfSignature, now) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keyCert finds the key-cert holding the key with the given ID. Key-certs are
+// named after their primary key, so those holding a signing subkey are found
+// by searching every key-cert.
+func keyCert(d *db.Database, id uint64) (*KeyCert, error) {
+	name := fmt.Sprintf("PGPKEY-%08X", uint32(id))
+	if obj, ok := d.Get(token.CLASS_KEY_CERT, name); ok {
+		kc, err := ParseKeyCert(obj)
+		if err != nil {
+			return nil, err
+		}
+		if kc.Entity != nil && kc.Entity.PrimaryKey.KeyId == id {
+			return kc, nil
+		}
+	}
+
+	for _, obj := range d.Objects(token.CLASS_KEY_CERT) {
+		kc, err := ParseKeyCert(obj)
+		if err != nil || kc.Entity == nil {
+			continue
+		}
+		if len(openpgp.EntityList{kc.Entity}.KeysById(id)) > 0 {
+			return kc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no key-cert for key %016X", id)
+}
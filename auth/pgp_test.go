@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const signedUpdate = `aut-num:        AS65537
+as-name:        TEST
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+func readFile(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(name)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return data
+}
+
+func TestParseKeyCert(t *testing.T) {
+	d, err := db.LoadFile("testdata/pgp/keys.db")
+	require.NoError(t, err)
+
+	obj, ok := d.Get(token.CLASS_KEY_CERT, "PGPKEY-926F2440")
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+
+	kc, err := ParseKeyCert(obj)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "PGPKEY-926F2440", kc.Name)
+		assert.Equal(t, "PGP", kc.Method)
+		assert.Equal(t, []string{"Test Maintainer <noc@example.com>"}, kc.Owner)
+		assert.Equal(t, obj.Value(token.ATTR_FINGERPRINT), kc.Fingerprint)
+	}
+
+	renamed := mustParse(t, strings.Replace(obj.String(), "PGPKEY-926F2440", "PGPKEY-80F238C6", 1))
+	_, err = ParseKeyCert(renamed)
+	assert.EqualError(t, err, "PGPKEY-80F238C6: key ID does not match, expected PGPKEY-926F2440")
+}
+
+func TestVerifyClearsigned(t *testing.T) {
+	valid := readFile(t, "testdata/pgp/clearsigned.txt")
+
+	tests := []struct {
+		name    string
+		message []byte
+		keyCert string
+		err     string
+	}{
+		{name: "valid", message: valid, keyCert: "PGPKEY-926F2440"},
+		{name: "tampered", message: bytes.Replace(valid, []byte("AS65537"), []byte("AS65538"), 1), err: "invalid signature by PGPKEY-926F2440: openpgp: invalid signature: RSA verification failure"},
+		{name: "expired", message: readFile(t, "testdata/pgp/expired.txt"), err: "PGPKEY-25572F02 has expired"},
+		{name: "revoked", message: readFile(t, "testdata/pgp/revoked.txt"), err: "PGPKEY-F719AB99 has been revoked"},
+		{name: "unsigned", message: []byte(signedUpdate), err: ErrNotSigned.Error()},
+	}
+
+	d, err := db.LoadFile("testdata/pgp/keys.db")
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := VerifyClearsigned(d, tt.message)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.keyCert, signed.KeyCert)
+				assert.Equal(t, signedUpdate, string(signed.Text))
+			}
+		})
+	}
+
+	_, err = VerifyClearsigned(db.New(), valid)
+	assert.EqualError(t, err, "no key-cert for key 0DEE819E926F2440")
+}
+
+func TestVerifyMIME(t *testing.T) {
+	valid := readFile(t, "testdata/pgp/mime.eml")
+
+	tests := []struct {
+		name    string
+		message []byte
+		keyCert string
+		err     string
+	}{
+		{name: "valid", message: valid, keyCert: "PGPKEY-926F2440"},
+		{name: "unix line endings", message: bytes.Replace(valid, []byte("\r\n"), []byte("\n"), -1), keyCert: "PGPKEY-926F2440"},
+		{name: "tampered", message: bytes.Replace(valid, []byte("AS65537"), []byte("AS65538"), 1), err: "invalid signature by PGPKEY-926F2440: openpgp: invalid signature: RSA verification failure"},
+		{name: "unsigned", message: []byte("Content-Type: text/plain\r\n\r\n" + signedUpdate), err: ErrNotSigned.Error()},
+	}
+
+	d, err := db.LoadFile("testdata/pgp/keys.db")
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(bytes.NewReader(tt.message))
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, err := ioutil.ReadAll(msg.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			signed, err := VerifyMIME(d, msg.Header.Get("Content-Type"), body)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.keyCert, signed.KeyCert)
+				assert.Contains(t, string(signed.Text), "Content-Type: text/plain")
+				assert.Contains(t, string(signed.Text), "aut-num:        AS65537\r\n")
+			}
+		})
+	}
+}
+
+func TestCheckPGPKey(t *testing.T) {
+	d, err := db.LoadFile("testdata/pgp/keys.db")
+	require.NoError(t, err)
+	for _, text := range []string{
+		"mntner: TEST-MNT\nauth: PGPKEY-926F2440\nmnt-by: TEST-MNT\nsource: TEST\n",
+		"aut-num: AS65537\nas-name: TEST\nmnt-by: TEST-MNT\nsource: TEST\n",
+	} {
+		if !assert.NoError(t, d.Add(mustParse(t, text))) {
+			t.FailNow()
+		}
+	}
+
+	signed, err := VerifyClearsigned(d, readFile(t, "testdata/pgp/clearsigned.txt"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	result, err := Check(d, Modify, mustParse(t, string(signed.Text)), Credentials{PGPKeys: []string{signed.KeyCert}})
+	if assert.NoError(t, err) {
+		assert.True(t, result.Authorized, result.String())
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Verifier checks credentials against the value of an auth line using a
+// scheme registered with lexer.RegisterAuthScheme
+type Verifier interface {
+	// Verify reports whether the credentials satisfy the auth line, given its
+	// value without the scheme prefix, or an error if it cannot be checked
+	Verify(d *db.Database, value string, creds Credentials) (bool, error)
+}
+
+// VerifierFunc adapts a function to a Verifier
+type VerifierFunc func(d *db.Database, value string, creds Credentials) (bool, error)
+
+// Verify calls f(d, value, creds)
+func (f VerifierFunc) Verify(d *db.Database, value string, creds Credentials) (bool, error) {
+	return f(d, value, creds)
+}
+
+var (
+	verifiersMu sync.RWMutex
+	verifiers   = map[string]Verifier{}
+)
+
+func init() {
+	RegisterVerifier("BCRYPT-PW", VerifierFunc(verifyBcrypt))
+	RegisterVerifier("X509-", VerifierFunc(verifyX509))
+}
+
+// RegisterVerifier sets the Verifier for auth lines using the scheme with the
+// given prefix, which must also be registered with lexer.RegisterAuthScheme.
+// Auth lines using a scheme without a Verifier never pass.
+func RegisterVerifier(prefix string, v Verifier) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+
+	verifiers[strings.ToUpper(prefix)] = v
+}
+
+func lookupVerifier(prefix string) (Verifier, bool) {
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+
+	v, ok := verifiers[strings.ToUpper(prefix)]
+	return v, ok
+}
+
+// verifyBcrypt checks a BCRYPT-PW hash against the passwords
+func verifyBcrypt(_ *db.Database, hash string, creds Credentials) (bool, error) {
+	for _, password := range creds.Passwords {
+		if VerifyPassword(hash, password) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// verifyX509 checks the certificate held in the X509-<n> key-cert against the
+// client certificates. Certificates outside their validity period never pass.
+func verifyX509(d *db.Database, n string, creds Credentials) (bool, error) {
+	name := "X509-" + n
+	obj, ok := d.Get(token.CLASS_KEY_CERT, name)
+	if !ok {
+		return false, fmt.Errorf("key-cert %s does not exist", name)
+	}
+
+	kc, err := ParseKeyCert(obj)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if now.Before(kc.Certificate.NotBefore) || now.After(kc.Certificate.NotAfter) {
+		return false, fmt.Errorf("%s has expired", name)
+	}
+
+	for _, cert := range creds.Certificates {
+		if cert != nil && bytes.Equal(cert.Raw, kc.Certificate.Raw) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
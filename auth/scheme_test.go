@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadCertificate(t *testing.T, d *db.Database, name string) *x509.Certificate {
+	obj, ok := d.Get(token.CLASS_KEY_CERT, name)
+	if !assert.True(t, ok, name) {
+		t.FailNow()
+	}
+
+	kc, err := ParseKeyCert(obj)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return kc.Certificate
+}
+
+func TestParseKeyCertX509(t *testing.T) {
+	d := db.New()
+	if !assert.NoError(t, d.LoadFile("testdata/x509/keys.db")) {
+		t.FailNow()
+	}
+
+	obj, _ := d.Get(token.CLASS_KEY_CERT, "X509-1")
+	kc, err := ParseKeyCert(obj)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "X509-1", kc.Name)
+		assert.Equal(t, "X509", kc.Method)
+		assert.Equal(t, obj.Values(token.ATTR_OWNER), kc.Owner)
+		assert.Equal(t, obj.Value(token.ATTR_FINGERPRINT), kc.Fingerprint)
+		assert.Nil(t, kc.Entity)
+	}
+
+	_, err = ParseKeyCert(mustParse(t, "key-cert: X509-4\ncertif: not a certificate\nsource: TEST\n"))
+	assert.EqualError(t, err, "X509-4: expected a PEM encoded certificate")
+}
+
+func TestCheckAuthSchemes(t *testing.T) {
+	d, err := db.LoadFile("testdata/auth.db")
+	require.NoError(t, err)
+	if !assert.NoError(t, d.LoadFile("testdata/x509/keys.db")) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name       string
+		mntner     string
+		creds      Credentials
+		authorized bool
+		result     string
+	}{
+		{
+			name:       "bcrypt-pw",
+			mntner:     "BCRYPT-MNT",
+			creds:      Credentials{Passwords: []string{"secret"}},
+			authorized: true,
+			result:     "BCRYPT-MNT passed with BCRYPT-PW",
+		},
+		{
+			name:   "bcrypt-pw with the wrong password",
+			mntner: "BCRYPT-MNT",
+			creds:  Credentials{Passwords: []string{"hunter2"}},
+			result: "BCRYPT-MNT failed",
+		},
+		{
+			name:       "x509",
+			mntner:     "X509-MNT",
+			creds:      Credentials{Certificates: []*x509.Certificate{loadCertificate(t, d, "X509-1")}},
+			authorized: true,
+			result:     "X509-MNT passed with X509",
+		},
+		{
+			name:   "x509 with another certificate",
+			mntner: "X509-MNT",
+			creds:  Credentials{Certificates: []*x509.Certificate{loadCertificate(t, d, "X509-2")}},
+			result: "X509-MNT failed (X509-3 has expired, SSO is not supported)",
+		},
+		{
+			name:   "x509 with an expired certificate",
+			mntner: "X509-MNT",
+			creds:  Credentials{Certificates: []*x509.Certificate{loadCertificate(t, d, "X509-3")}},
+			result: "X509-MNT failed (X509-3 has expired, SSO is not supported)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := mustParse(t, "aut-num: AS65540\nas-name: NEW\nmnt-by: "+tt.mntner+"\nsource: TEST\n")
+			result, err := Check(d, Create, obj, tt.creds)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.authorized, result.Authorized, result.String())
+				assert.Equal(t, tt.result, result.Requirements[0].Mntners[0].String())
+			}
+		})
+	}
+}
+
+func TestRegisterVerifier(t *testing.T) {
+	lexer.RegisterAuthScheme("TEST-TOKEN", nil)
+	mntner := mustParse(t, "mntner: TOKEN-MNT\nauth: TEST-TOKEN abc123\nmnt-by: TOKEN-MNT\nsource: TEST\n")
+
+	d := db.New()
+	result, err := Check(d, Create, mntner, Credentials{})
+	if assert.NoError(t, err) {
+		assert.False(t, result.Authorized)
+		assert.Equal(t, "TOKEN-MNT failed (TEST-TOKEN is not supported)", result.Requirements[0].Mntners[0].String())
+	}
+
+	RegisterVerifier("test-token", VerifierFunc(func(d *db.Database, value string, creds Credentials) (bool, error) {
+		return value == "abc123" && creds.From == "token@example.com", nil
+	}))
+
+	result, err = Check(d, Create, mntner, Credentials{From: "token@example.com"})
+	if assert.NoError(t, err) {
+		assert.True(t, result.Authorized, result.String())
+		assert.Equal(t, "TOKEN-MNT passed with TEST-TOKEN", result.Requirements[0].Mntners[0].String())
+	}
+}
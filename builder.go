@@ -0,0 +1,310 @@
+package rpsl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/schema"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Builder constructs an RPSL object one attribute at a time, validating each
+// attribute against the schema of the object's class as it is added. The
+// first error encountered is kept, and subsequent calls have no effect, so
+// calls may be chained:
+//
+//	obj, err := rpsl.NewRoute("192.0.2.0/24").
+//		Origin("AS65537").
+//		MntBy("FOO-MNT").
+//		Source("RADB").
+//		Build()
+type Builder struct {
+	class  *schema.Class
+	types  []token.Type
+	values []string
+	err    error
+}
+
+// New creates a Builder for an object of the given class, where name is the
+// value of the class attribute
+func New(class token.Type, name string) *Builder {
+	b := &Builder{}
+
+	c, ok := schema.Lookup(class)
+	if !ok {
+		b.err = fmt.Errorf("unsupported object class %s", class)
+		return b
+	}
+
+	b.class = c
+	return b.Add(class, name)
+}
+
+// NewRoute creates a Builder for a route object
+func NewRoute(prefix string) *Builder {
+	return New(token.CLASS_ROUTE, prefix)
+}
+
+// NewRoute6 creates a Builder for a route6 object
+func NewRoute6(prefix string) *Builder {
+	return New(token.CLASS_ROUTE6, prefix)
+}
+
+// NewAutNum creates a Builder for an aut-num object
+func NewAutNum(asn string) *Builder {
+	return New(token.CLASS_AUT_NUM, asn)
+}
+
+// NewASSet creates a Builder for an as-set object
+func NewASSet(name string) *Builder {
+	return New(token.CLASS_AS_SET, name)
+}
+
+// NewRouteSet creates a Builder for a route-set object
+func NewRouteSet(name string) *Builder {
+	return New(token.CLASS_ROUTE_SET, name)
+}
+
+// NewMntner creates a Builder for a mntner object
+func NewMntner(name string) *Builder {
+	return New(token.CLASS_MAINTAINER, name)
+}
+
+// NewPerson creates a Builder for a person object
+func NewPerson(name string) *Builder {
+	return New(token.CLASS_PERSON, name)
+}
+
+// NewRole creates a Builder for a role object
+func NewRole(name string) *Builder {
+	return New(token.CLASS_ROLE, name)
+}
+
+// Add appends an attribute to the object. An error is recorded if the
+// attribute is not permitted in the object's class, if the attribute may only
+// appear once and has already been added, or if the value's syntax is invalid.
+func (b *Builder) Add(t token.Type, value string) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	def, ok := b.class.Attribute(t)
+	if !ok {
+		b.err = fmt.Errorf("attribute %s is not permitted in %s objects", t.Name(), b.class.Type.Name())
+		return b
+	}
+
+	if !def.Multiple && b.has(t) {
+		b.err = fmt.Errorf("attribute %s may only appear once", t.Name())
+		return b
+	}
+
+	if strings.ContainsAny(value, "\r\n") {
+		b.err = fmt.Errorf("%s value must not contain line breaks", t.Name())
+		return b
+	}
+
+	if err := schema.ValidateValue(t, value); err != nil {
+		b.err = err
+		return b
+	}
+
+	b.types = append(b.types, t)
+	b.values = append(b.values, value)
+	return b
+}
+
+// addList adds a single attribute whose value is a comma separated list
+func (b *Builder) addList(t token.Type, values []string) *Builder {
+	return b.Add(t, strings.Join(values, ", "))
+}
+
+// Descr adds a descr attribute
+func (b *Builder) Descr(description string) *Builder {
+	return b.Add(token.ATTR_DESCRIPTION, description)
+}
+
+// Remarks adds a remarks attribute
+func (b *Builder) Remarks(remarks string) *Builder {
+	return b.Add(token.ATTR_REMARKS, remarks)
+}
+
+// Origin adds the origin attribute of a route or route6 object
+func (b *Builder) Origin(asn string) *Builder {
+	return b.Add(token.ATTR_ORIGIN, asn)
+}
+
+// ASName adds the as-name attribute of an aut-num object
+func (b *Builder) ASName(name string) *Builder {
+	return b.Add(token.ATTR_AS_NAME, name)
+}
+
+// MntBy adds a mnt-by attribute listing the given maintainers
+func (b *Builder) MntBy(mntners ...string) *Builder {
+	return b.addList(token.ATTR_MAINTAINED_BY, mntners)
+}
+
+// MemberOf adds a member-of attribute listing the given sets
+func (b *Builder) MemberOf(sets ...string) *Builder {
+	return b.addList(token.ATTR_MEMBER_OF_ROUTE_SET, sets)
+}
+
+// Members adds a members attribute listing the given members
+func (b *Builder) Members(members ...string) *Builder {
+	return b.addList(token.ATTR_AS_SET_MEMBERS, members)
+}
+
+// MpMembers adds an mp-members attribute listing the given members
+func (b *Builder) MpMembers(members ...string) *Builder {
+	return b.addList(token.ATTR_MULTI_PROTO_MEMBERS, members)
+}
+
+// MbrsByRef adds an mbrs-by-ref attribute listing the given maintainers
+func (b *Builder) MbrsByRef(mntners ...string) *Builder {
+	return b.addList(token.ATTR_MEMBERS_BY_REFERENCE, mntners)
+}
+
+// AdminC adds an admin-c attribute listing the given nic-hdls
+func (b *Builder) AdminC(nicHdls ...string) *Builder {
+	return b.addList(token.ATTR_ADMIN_CONTACT, nicHdls)
+}
+
+// TechC adds a tech-c attribute listing the given nic-hdls
+func (b *Builder) TechC(nicHdls ...string) *Builder {
+	return b.addList(token.ATTR_TECHNICAL_CONTACT, nicHdls)
+}
+
+// NICHdl adds the nic-hdl attribute of a person or role object
+func (b *Builder) NICHdl(nicHdl string) *Builder {
+	return b.Add(token.ATTR_NIC_HANDLE, nicHdl)
+}
+
+// Address adds an address attribute
+func (b *Builder) Address(address string) *Builder {
+	return b.Add(token.ATTR_ADDRESS, address)
+}
+
+// Phone adds a phone attribute
+func (b *Builder) Phone(number string) *Builder {
+	return b.Add(token.ATTR_PHONE_NUMBER, number)
+}
+
+// FaxNo adds a fax-no attribute
+func (b *Builder) FaxNo(number string) *Builder {
+	return b.Add(token.ATTR_FAX_NUMBER, number)
+}
+
+// EMail adds an e-mail attribute
+func (b *Builder) EMail(email string) *Builder {
+	return b.Add(token.ATTR_EMAIL, email)
+}
+
+// Notify adds a notify attribute
+func (b *Builder) Notify(email string) *Builder {
+	return b.Add(token.ATTR_NOTIFY_EMAIL, email)
+}
+
+// MntNfy adds a mnt-nfy attribute
+func (b *Builder) MntNfy(email string) *Builder {
+	return b.Add(token.ATTR_MAINTAINER_NOTIFY_EMAIL, email)
+}
+
+// UpdTo adds an upd-to attribute
+func (b *Builder) UpdTo(email string) *Builder {
+	return b.Add(token.ATTR_UPDATED_TO_EMAIL, email)
+}
+
+// Auth adds an auth attribute, e.g. "PGPKey-80F238C6"
+func (b *Builder) Auth(auth string) *Builder {
+	return b.Add(token.ATTR_AUTHENTICATION, auth)
+}
+
+// Import adds an import policy attribute
+func (b *Builder) Import(policy string) *Builder {
+	return b.Add(token.ATTR_IMPORT, policy)
+}
+
+// Export adds an export policy attribute
+func (b *Builder) Export(policy string) *Builder {
+	return b.Add(token.ATTR_EXPORT, policy)
+}
+
+// MpImport adds an mp-import policy attribute
+func (b *Builder) MpImport(policy string) *Builder {
+	return b.Add(token.ATTR_MULTI_PROTO_IMPORT_POLICY, policy)
+}
+
+// MpExport adds an mp-export policy attribute
+func (b *Builder) MpExport(policy string) *Builder {
+	return b.Add(token.ATTR_MULTI_PROTO_EXPORT_POLICY, policy)
+}
+
+// Changed adds a changed attribute. The date, in the format YYYYMMDD, may be
+// empty.
+func (b *Builder) Changed(email, date string) *Builder {
+	return b.Add(token.ATTR_CHANGED_AT_AND_BY, strings.TrimSpace(email+" "+date))
+}
+
+// Source adds the source attribute
+func (b *Builder) Source(source string) *Builder {
+	return b.Add(token.ATTR_REGISTRY_SOURCE, source)
+}
+
+// Err returns the first error encountered while building the object
+func (b *Builder) Err() error {
+	return b.err
+}
+
+// Build checks that every mandatory attribute is present, then returns the
+// object exactly as it would have been parsed from RPSL text
+func (b *Builder) Build() (*ast.Object, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	for _, def := range b.class.Attributes {
+		if def.Mandatory && !b.has(def.Type) {
+			return nil, fmt.Errorf("mandatory attribute %s is missing", def.Type.Name())
+		}
+	}
+
+	var text bytes.Buffer
+	for i, t := range b.types {
+		fmt.Fprintf(&text, "%s: %s\n", t.Name(), b.values[i])
+	}
+
+	objects, err := parser.Parse(b.class.Type.Name(), text.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objects) != 1 || len(objects[0].Attributes) != len(b.types) {
+		return nil, fmt.Errorf("unable to build %s object", b.class.Type.Name())
+	}
+
+	return objects[0], nil
+}
+
+// String returns the formatted RPSL text of the object, or an empty string if
+// the object could not be built
+func (b *Builder) String() string {
+	obj, err := b.Build()
+	if err != nil {
+		return ""
+	}
+
+	return obj.String()
+}
+
+func (b *Builder) has(t token.Type) bool {
+	for _, existing := range b.types {
+		if existing == t {
+			return true
+		}
+	}
+
+	return false
+}
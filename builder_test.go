@@ -0,0 +1,81 @@
+package rpsl
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	obj, err := NewRoute("192.0.2.0/24").
+		Descr("customer prefix").
+		Origin("AS65537").
+		MntBy("FOO-MNT", "BAR-MNT").
+		Changed("noc@example.com", "20190701").
+		Source("RADB").
+		Build()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, token.CLASS_ROUTE, obj.Class())
+	assert.Equal(t, []string{"FOO-MNT", "BAR-MNT"}, obj.Values(token.ATTR_MAINTAINED_BY))
+	assert.Equal(t, `route:          192.0.2.0/24
+descr:          customer prefix
+origin:         AS65537
+mnt-by:         FOO-MNT, BAR-MNT
+changed:        noc@example.com 20190701
+source:         RADB
+`, obj.String())
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		err     string
+	}{
+		{
+			"invalid prefix",
+			NewRoute("2001:db8::/32").Origin("AS65537"),
+			`invalid route value "2001:db8::/32": expected an IPv4 prefix`,
+		},
+		{
+			"repeated single-valued attribute",
+			NewRoute6("2001:db8::/32").Origin("AS65537").Origin("AS65538"),
+			"attribute origin may only appear once",
+		},
+		{
+			"attribute not in class",
+			NewRoute("192.0.2.0/24").ASName("TEST-AS"),
+			"attribute as-name is not permitted in route objects",
+		},
+		{
+			"first error is kept",
+			NewRoute("192.0.2.0/24").Origin("65537").MntBy("1-MNT"),
+			`invalid origin value "65537": expected an AS number such as AS65537`,
+		},
+		{
+			"missing mandatory attribute",
+			NewRoute("192.0.2.0/24").Origin("AS65537").Source("RADB"),
+			"mandatory attribute mnt-by is missing",
+		},
+		{
+			"line breaks",
+			NewRoute("192.0.2.0/24").Descr("one\ntwo"),
+			"descr value must not contain line breaks",
+		},
+		{
+			"unsupported class",
+			New(token.CLASS_DICTIONARY, "RPSL"),
+			"unsupported object class CLASS_DICTIONARY",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.builder.Build()
+		assert.EqualError(t, err, tt.err, tt.name)
+		assert.Equal(t, "", tt.builder.String(), tt.name)
+	}
+}
@@ -0,0 +1,117 @@
+// Command rpslaudit flags objects in an RPSL database which are likely to be
+// out of date: routes whose origin does not announce them in an MRT RIB dump,
+// routes whose prefix is also registered in other sources, objects which have
+// not changed for years, and routes not covered by an RPKI ROA, e.g.
+//
+//	rpslaudit -db irr.db -rib rib.20240101.0000.bz2 -vrps vrps.json
+//	rpslaudit -db irr.db -other radb.db,ripe.db -max-age 5 -kind duplicate,stale
+//
+// It exits with status 1 if anything is found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/audit"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+	"github.com/kkirsche/rpsl/rpki"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to audit (required)")
+	others := flag.String("other", "", "comma separated RPSL database files of other registries to search for duplicate routes")
+	ribFiles := flag.String("rib", "", "comma separated MRT RIB dumps and update files to check route announcements against, read in order and optionally compressed with gzip or bzip2")
+	vrpFile := flag.String("vrps", "", "JSON file of VRPs to check ROA coverage against")
+	maxAge := flag.Int("max-age", 0, "report objects last changed more than this many years ago")
+	sources := flag.String("source", "", "comma separated sources to audit, default all")
+	kinds := flag.String("kind", "", "comma separated kinds of finding to report, default all")
+	format := flag.String("format", "text", "output format: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> [-other files] [-rib files] [-vrps file] [-max-age years] [-source list] [-kind list] [-format text|json]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 || *database == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := audit.Options{MaxAge: *maxAge, Sources: split(*sources)}
+	for _, name := range split(*kinds) {
+		k, err := audit.ParseKind(name)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Kinds = append(opts.Kinds, k)
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	for _, name := range split(*others) {
+		other := db.New()
+		if err := other.LoadFile(name); err != nil {
+			fatal(err)
+		}
+		opts.Others = append(opts.Others, other)
+	}
+
+	if names := split(*ribFiles); len(names) > 0 {
+		rib, err := mrt.LoadFile(names...)
+		if err != nil {
+			fatal(err)
+		}
+		opts.RIB = rib
+	}
+
+	if *vrpFile != "" {
+		vrps, err := rpki.LoadFile(*vrpFile)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Validator = rpki.NewValidator(vrps)
+	}
+
+	findings := audit.Audit(d, opts)
+
+	var err error
+	switch *format {
+	case "text":
+		err = audit.WriteText(os.Stdout, findings)
+	case "json":
+		err = audit.WriteJSON(os.Stdout, findings)
+	default:
+		err = fmt.Errorf("unknown output format %q", *format)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslaudit:", err)
+	os.Exit(2)
+}
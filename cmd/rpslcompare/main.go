@@ -0,0 +1,115 @@
+// Command rpslcompare compares the routes in MRT RIB dumps and BGP4MP update
+// files with the route objects of an RPSL database, and with the import
+// policy of an aut-num, reporting observed routes without a route object,
+// observed routes the policy would reject, and route objects which were never
+// announced, e.g.
+//
+//	rpslcompare -db irr.db rib.20240101.0000.bz2
+//	rpslcompare -db irr.db -local-as 65000 -kind rejected updates.20240101.0000.gz
+//
+// It exits with status 1 if any differences are found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/compare"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to load (required)")
+	localAS := flag.String("local-as", "", "AS number whose import policy observed routes are checked against, e.g. AS65000")
+	sources := flag.String("source", "", "comma separated sources of the route objects to compare, default all")
+	kinds := flag.String("kind", "", "comma separated kinds of difference to report: unregistered, rejected, unannounced or unchecked (default: all)")
+	format := flag.String("format", "text", "output format: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> [-local-as asn] [-source list] [-kind list] [-format text|json] <mrt file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *database == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := compare.Options{Sources: split(*sources)}
+	if *localAS != "" {
+		asn, err := aspath.ParseASN(*localAS)
+		if err != nil {
+			fatal(err)
+		}
+		opts.LocalAS = asn
+	}
+	for _, name := range split(*kinds) {
+		k, err := compare.ParseKind(name)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Kinds = append(opts.Kinds, k)
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	c := compare.New(d, opts)
+	for _, name := range flag.Args() {
+		if err := read(c, name); err != nil {
+			fatal(fmt.Errorf("%s: %s", name, err))
+		}
+	}
+
+	findings := c.Findings()
+
+	var err error
+	switch *format {
+	case "text":
+		err = compare.WriteText(os.Stdout, findings)
+	case "json":
+		err = compare.WriteJSON(os.Stdout, findings)
+	default:
+		err = fmt.Errorf("unknown output format %q", *format)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+func read(c *compare.Comparison, name string) error {
+	f, err := mrt.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.Read(f)
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslcompare:", err)
+	os.Exit(2)
+}
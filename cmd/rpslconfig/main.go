@@ -0,0 +1,120 @@
+// Command rpslconfig generates router configuration from the aut-num policies
+// in an RPSL database, expanding templates written for IRRToolSet's rtconfig,
+// e.g.
+//
+//	rpslconfig -db irr.db -dialect ios template.cfg > router.cfg
+//	echo '@RtConfig import AS65536 192.0.2.2 AS65537 192.0.2.1' | rpslconfig -db irr.db -dialect bird
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/kkirsche/rpsl/policy"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/rpki"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to load (required)")
+	dialectName := flag.String("dialect", "ios", "output dialect: "+dialectNames())
+	aggregate := flag.Bool("A", false, "aggregate prefix lists, without changing the routes they match")
+	vrpFile := flag.String("vrps", "", "JSON file of RPKI VRPs, routes which are RPKI invalid are left out of the generated filters")
+	depth := flag.Int("depth", resolve.DefaultMaxDepth, "maximum depth of nested sets to expand")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> [-dialect name] [-vrps file] [-A] [template ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *database == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dialect, err := generate.ParseDialect(*dialectName)
+	if err != nil {
+		fatal(err)
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	opts := resolve.Options{MaxDepth: *depth}
+	if *vrpFile != "" {
+		vrps, err := rpki.LoadFile(*vrpFile)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Filter = rpki.NewValidator(vrps).Accept
+	}
+
+	rc := &policy.RtConfig{
+		Database: d,
+		Dialect:  dialect,
+		Options:  policy.Options{Aggregate: *aggregate, Resolve: opts},
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if flag.NArg() == 0 {
+		err = process(rc, "<stdin>", os.Stdin, out)
+	}
+	for _, path := range flag.Args() {
+		if err = processFile(rc, path, out); err != nil {
+			break
+		}
+	}
+
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func processFile(rc *policy.RtConfig, path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return process(rc, path, f, w)
+}
+
+// process expands a template, reporting the parts of policies which could not
+// be compiled on stderr
+func process(rc *policy.RtConfig, name string, r io.Reader, w io.Writer) error {
+	rc.Warn = func(line int, msg string) {
+		fmt.Fprintf(os.Stderr, "rpslconfig: %s:%d: warning: %s\n", name, line, msg)
+	}
+
+	if err := rc.Process(r, w); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	return nil
+}
+
+func dialectNames() string {
+	var names []string
+	for _, dialect := range generate.Dialects() {
+		names = append(names, dialect.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslconfig:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,75 @@
+// Command rpsldiff reports the semantic differences between two versions of
+// an RPSL object or database, e.g.
+//
+//	rpsldiff -format summary old.db new.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/diff"
+	"github.com/kkirsche/rpsl/parser"
+)
+
+func main() {
+	format := flag.String("format", "unified", "output format: unified, json or summary")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-format unified|json|summary] <old> <new>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	from, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+
+	to, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	diffs := diff.Databases(from, to)
+	switch *format {
+	case "unified":
+		err = diff.WriteUnified(os.Stdout, diffs)
+	case "json":
+		err = diff.WriteJSON(os.Stdout, diffs)
+	case "summary":
+		err = diff.WriteSummary(os.Stdout, diffs)
+	default:
+		err = fmt.Errorf("unknown output format %q", *format)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	// like diff(1), exit with a status of 1 when differences were found
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func parseFile(name string) ([]*ast.Object, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.Parse(name, string(data))
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpsldiff:", err)
+	os.Exit(2)
+}
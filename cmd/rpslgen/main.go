@@ -0,0 +1,119 @@
+// Command rpslgen generates router filters from the objects in an RPSL
+// database, e.g.
+//
+//	rpslgen -db irr.db -dialect junos -6 AS-EXAMPLE
+//	rpslgen -db irr.db -dialect frr -A AS-EXAMPLE
+//	rpslgen -db irr.db -dialect bird -type origin AS-EXAMPLE
+//	rpslgen -db irr.db -dialect ios -type aspath -name 100 '<^AS65537 AS-EXAMPLE* $>'
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/rpki"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to load (required)")
+	dialectName := flag.String("dialect", "ios", "output dialect: "+dialectNames())
+	name := flag.String("name", "", "name of the generated filter (default: the expanded object, or AS-PATH)")
+	filterType := flag.String("type", "prefix", "filter type: prefix, origin or aspath")
+	ipv6 := flag.Bool("6", false, "generate an IPv6 prefix list")
+	aggregate := flag.Bool("A", false, "aggregate the prefix list, without changing the routes it matches")
+	vrpFile := flag.String("vrps", "", "JSON file of RPKI VRPs, routes which are RPKI invalid are left out of the generated filters")
+	depth := flag.Int("depth", resolve.DefaultMaxDepth, "maximum depth of nested sets to expand")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> [-dialect name] [-vrps file] [-type prefix|origin|aspath] [-6] [-A] [-name name] <as-set|route-set|ASN|AS path regex>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *database == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dialect, err := generate.ParseDialect(*dialectName)
+	if err != nil {
+		fatal(err)
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	opts := resolve.Options{MaxDepth: *depth}
+	if *vrpFile != "" {
+		vrps, err := rpki.LoadFile(*vrpFile)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Filter = rpki.NewValidator(vrps).Accept
+	}
+	object := flag.Arg(0)
+	if *name == "" {
+		*name = strings.ToUpper(object)
+		if *filterType == "aspath" {
+			*name = "AS-PATH"
+		}
+	}
+
+	switch *filterType {
+	case "prefix":
+		err = writePrefixList(d, dialect, *name, object, *ipv6, *aggregate, opts)
+	case "origin":
+		err = writeASPathFilter(d, dialect, *name, "<"+object+"$>", opts)
+	case "aspath":
+		err = writeASPathFilter(d, dialect, *name, object, opts)
+	default:
+		err = fmt.Errorf("unknown filter type %q", *filterType)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func writePrefixList(d *db.Database, dialect generate.Dialect, name, object string, ipv6, aggregate bool, opts resolve.Options) error {
+	ranges, err := generate.Prefixes(d, object, ipv6, opts)
+	if err != nil {
+		return err
+	}
+	if aggregate {
+		ranges = prefix.Aggregate(ranges)
+	}
+
+	list := &generate.PrefixList{Name: name, IPv6: ipv6, Ranges: ranges}
+	return list.Write(os.Stdout, dialect)
+}
+
+func writeASPathFilter(d *db.Database, dialect generate.Dialect, name, expr string, opts resolve.Options) error {
+	f, err := generate.NewASPathFilter(d, name, expr, opts)
+	if err != nil {
+		return err
+	}
+
+	return f.Write(os.Stdout, dialect)
+}
+
+func dialectNames() string {
+	var names []string
+	for _, dialect := range generate.Dialects() {
+		names = append(names, dialect.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslgen:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,86 @@
+// Command rpsllint reports dangling references in RPSL database dumps, such
+// as mnt-by attributes naming mntners which do not exist, e.g.
+//
+//	rpsllint -source RIPE -kind missing-mntner,missing-contact ripe.db
+//	rpsllint -format json radb.db ripe.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lint"
+)
+
+func main() {
+	sources := flag.String("source", "", "comma separated sources to lint, default all")
+	kinds := flag.String("kind", "", "comma separated kinds of finding to report, default all")
+	format := flag.String("format", "text", "output format: text, json or summary")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-source list] [-kind list] [-format text|json|summary] <file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := lint.Options{Sources: split(*sources)}
+	for _, name := range split(*kinds) {
+		k, err := lint.ParseKind(name)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Kinds = append(opts.Kinds, k)
+	}
+
+	d := db.New()
+	for _, name := range flag.Args() {
+		if err := d.LoadFile(name); err != nil {
+			fatal(err)
+		}
+	}
+
+	findings := lint.Lint(d, opts)
+
+	var err error
+	switch *format {
+	case "text":
+		err = lint.WriteText(os.Stdout, findings)
+	case "json":
+		err = lint.WriteJSON(os.Stdout, findings)
+	case "summary":
+		err = lint.WriteSummary(os.Stdout, findings)
+	default:
+		err = fmt.Errorf("unknown output format %q", *format)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpsllint:", err)
+	os.Exit(2)
+}
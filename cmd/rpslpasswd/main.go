@@ -0,0 +1,63 @@
+// Command rpslpasswd hashes a password read from standard input, printing an
+// auth line to add to a mntner, e.g.
+//
+//	echo -n secret | rpslpasswd
+//	echo -n secret | rpslpasswd -scheme crypt
+//	echo -n secret | rpslpasswd -scheme bcrypt -cost 12
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/auth"
+)
+
+func main() {
+	scheme := flag.String("scheme", "md5", "hash scheme: md5 (MD5-PW), crypt (CRYPT-PW) or bcrypt (BCRYPT-PW)")
+	cost := flag.Int("cost", auth.DefaultBcryptCost, "bcrypt cost")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-scheme md5|crypt|bcrypt] [-cost n] < password\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		fatal(fmt.Errorf("reading password: %v", err))
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	var name, hash string
+	switch *scheme {
+	case "md5":
+		name = "MD5-PW"
+		hash, err = auth.MD5Password(password)
+	case "crypt":
+		name = "CRYPT-PW"
+		hash, err = auth.CryptPassword(password)
+	case "bcrypt":
+		name = "BCRYPT-PW"
+		hash, err = auth.BcryptPassword(password, *cost)
+	default:
+		err = fmt.Errorf("unknown scheme %q", *scheme)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("auth:           %s %s\n", name, hash)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslpasswd:", err)
+	os.Exit(2)
+}
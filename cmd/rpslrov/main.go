@@ -0,0 +1,89 @@
+// Command rpslrov validates the route and route6 objects in an RPSL database
+// against RPKI VRPs exported as JSON by rpki-client, Routinator or rtrmon, or
+// fetched from an RTR cache, e.g.
+//
+//	rpslrov -db irr.db -vrps vrps.json
+//	rpslrov -db irr.db -vrps vrps.json -state invalid-asn,invalid-length
+//	rpslrov -db irr.db -rtr rpki.example.net:323
+//
+// It exits with status 1 if any route is RPKI invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/rpki"
+	"github.com/kkirsche/rpsl/rtr"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to load (required)")
+	vrpFile := flag.String("vrps", "", "JSON file of VRPs to validate against")
+	rtrAddress := flag.String("rtr", "", "address of an RTR cache to fetch VRPs from, instead of -vrps")
+	stateNames := flag.String("state", "", "comma separated states of the routes to report: valid, invalid-asn, invalid-length or not-found (default: all)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> -vrps <file>|-rtr <address> [-state states]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 || *database == "" || (*vrpFile == "") == (*rtrAddress == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var states []rpki.State
+	if *stateNames != "" {
+		for _, name := range strings.Split(*stateNames, ",") {
+			state, err := rpki.ParseState(strings.TrimSpace(name))
+			if err != nil {
+				fatal(err)
+			}
+			states = append(states, state)
+		}
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	var validator *rpki.Validator
+	if *rtrAddress != "" {
+		client := rtr.NewClient(func() (net.Conn, error) {
+			return net.DialTimeout("tcp", *rtrAddress, 30*time.Second)
+		})
+		if err := client.Sync(); err != nil {
+			fatal(err)
+		}
+		client.Close()
+		validator = client.Validator()
+	} else {
+		vrps, err := rpki.LoadFile(*vrpFile)
+		if err != nil {
+			fatal(err)
+		}
+		validator = rpki.NewValidator(vrps)
+	}
+
+	results := rpki.Check(d, validator)
+	if err := rpki.WriteReport(os.Stdout, results, states...); err != nil {
+		fatal(err)
+	}
+
+	counts := rpki.Count(results)
+	if counts[rpki.InvalidASN]+counts[rpki.InvalidLength] > 0 {
+		os.Exit(1)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslrov:", err)
+	os.Exit(2)
+}
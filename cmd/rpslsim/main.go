@@ -0,0 +1,149 @@
+// Command rpslsim simulates the import or export policy of an aut-num for a
+// single route, printing whether the route is accepted, the policy and clause
+// which accepted it, and the route's attributes once the clause's actions are
+// applied, e.g.
+//
+//	rpslsim -db irr.db -local-as AS65536 -peer-as AS65537 -path "65537 65538" 10.0.0.0/8
+//	rpslsim -db irr.db -local-as AS65536 -peer-as AS65538 -community 64500:10 -path 65538 -export 198.51.100.0/24
+//
+// It exits with status 1 if the route is rejected.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/policy"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to load (required)")
+	localAS := flag.String("local-as", "", "AS number whose policy is simulated, e.g. AS65536 (required)")
+	peerAS := flag.String("peer-as", "", "AS number of the peer the route is exchanged with, e.g. AS65537 (required)")
+	localAddress := flag.String("local-address", "", "address of the local router, matched against the at clause of peerings")
+	peerAddress := flag.String("peer-address", "", "address of the peer's router")
+	path := flag.String("path", "", "AS path of the route, nearest AS first, e.g. \"65537 65538\"")
+	communities := flag.String("community", "", "comma separated communities of the route, written as ASN:value")
+	export := flag.Bool("export", false, "simulate the export policy rather than the import policy")
+	depth := flag.Int("depth", resolve.DefaultMaxDepth, "maximum depth of nested sets to expand")
+	format := flag.String("format", "text", "output format: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> -local-as asn -peer-as asn [-path asns] [-community list] [-export] [-format text|json] <prefix>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *database == "" || *localAS == "" || *peerAS == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var n policy.Neighbor
+	var err error
+	if n.LocalAS, err = aspath.ParseASN(*localAS); err != nil {
+		fatal(err)
+	}
+	if n.PeerAS, err = aspath.ParseASN(*peerAS); err != nil {
+		fatal(err)
+	}
+	if n.LocalAddress, err = parseAddress(*localAddress); err != nil {
+		fatal(err)
+	}
+	if n.PeerAddress, err = parseAddress(*peerAddress); err != nil {
+		fatal(err)
+	}
+
+	route := policy.Route{Communities: split(*communities)}
+	if route.Prefix, err = prefix.Parse(flag.Arg(0)); err != nil {
+		fatal(err)
+	}
+	if route.Path, err = parsePath(*path); err != nil {
+		fatal(err)
+	}
+
+	dir := policy.Import
+	if *export {
+		dir = policy.Export
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	c := policy.NewCompiler(d, policy.Options{Resolve: resolve.Options{MaxDepth: *depth}})
+	sim, err := c.Simulate(dir, n, route)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch *format {
+	case "text":
+		err = sim.WriteText(os.Stdout)
+	case "json":
+		err = sim.WriteJSON(os.Stdout)
+	default:
+		err = fmt.Errorf("unknown output format %q", *format)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if !sim.Accepted {
+		os.Exit(1)
+	}
+}
+
+// parseAddress parses a router address, returning nil if none is given
+func parseAddress(s string) (net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+
+	return ip, nil
+}
+
+// parsePath parses an AS path of space or comma separated AS numbers, which
+// may be written with or without the AS prefix
+func parsePath(s string) ([]uint32, error) {
+	var path []uint32
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(field), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AS number %q", field)
+		}
+		path = append(path, uint32(n))
+	}
+
+	return path, nil
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslsim:", err)
+	os.Exit(2)
+}
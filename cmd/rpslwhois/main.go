@@ -0,0 +1,85 @@
+// Command rpslwhois queries a whois server, such as the RIPE database or IRRd,
+// and prints the objects returned once they have been parsed, e.g.
+//
+//	rpslwhois -h whois.radb.net -r -T route -i origin AS65537
+//	rpslwhois -h whois.ripe.net -s RIPE -K AS-EXAMPLE
+//	rpslwhois -h whois.radb.net '!iAS-EXAMPLE,1'
+//
+// Queries beginning with ! are sent as IRRd commands and their data printed
+// as returned.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kkirsche/rpsl/whois"
+)
+
+func main() {
+	host := flag.String("h", "whois.radb.net", "whois server to query, as host or host:port")
+	timeout := flag.Duration("timeout", whois.DefaultTimeout, "time limit for the query")
+	noRecursion := flag.Bool("r", false, "do not return the contacts referenced by objects")
+	primaryKeys := flag.Bool("K", false, "only return the primary key attributes of objects")
+	types := flag.String("T", "", "comma separated object classes to return")
+	inverse := flag.String("i", "", "comma separated attributes to do an inverse lookup of the key on")
+	sources := flag.String("s", "", "comma separated sources to search")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-h host] [-r] [-K] [-T types] [-i attributes] [-s sources] <key>|<!command>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client := whois.NewClient(*host)
+	client.Timeout = *timeout
+
+	if key := flag.Arg(0); strings.HasPrefix(key, "!") {
+		data, err := client.IRRd(key)
+		if err != nil {
+			fatal(err)
+		}
+		if data != "" {
+			fmt.Println(data)
+		}
+		return
+	}
+
+	objects, err := client.Search(whois.Query{
+		Key:         flag.Arg(0),
+		Types:       split(*types),
+		Inverse:     split(*inverse),
+		Sources:     split(*sources),
+		NoRecursion: *noRecursion,
+		PrimaryKeys: *primaryKeys,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	for i, obj := range objects {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(obj)
+	}
+}
+
+func split(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslwhois:", err)
+	os.Exit(2)
+}
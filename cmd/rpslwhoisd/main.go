@@ -0,0 +1,62 @@
+// Command rpslwhoisd serves an RPSL database over whois, answering RIPE style
+// queries and IRRd ! commands, e.g.
+//
+//	rpslwhoisd -db irr.db
+//	rpslwhoisd -db irr.db -listen 127.0.0.1:4343
+//
+// The database is reloaded from the file when a SIGHUP is received, queries
+// made while it is being reloaded are answered from the previous database.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/whois"
+)
+
+func main() {
+	database := flag.String("db", "", "RPSL database file to serve (required)")
+	listen := flag.String("listen", ":43", "address to listen on")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -db <file> [-listen address]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 || *database == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	d := db.New()
+	if err := d.LoadFile(*database); err != nil {
+		fatal(err)
+	}
+
+	server := whois.NewServer(d)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := server.ReloadFile(*database); err != nil {
+				log.Printf("rpslwhoisd: reloading %s: %s", *database, err)
+				continue
+			}
+			log.Printf("rpslwhoisd: reloaded %s, %d objects", *database, server.Database().Len())
+		}
+	}()
+
+	fatal(server.ListenAndServe(*listen))
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rpslwhoisd:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,320 @@
+// Package compare compares the routes seen in BGP, read from MRT dumps, with
+// the route objects and aut-num policies of a database. It reports observed
+// routes without a route object, observed routes which the import policy of
+// an aut-num would reject, and route objects which are never announced, to
+// check that generated filters will not drop legitimate routes.
+package compare
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+	"github.com/kkirsche/rpsl/policy"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Kind is the kind of difference a finding reports
+type Kind int
+
+// The kinds of difference which may be reported
+const (
+	Unregistered Kind = iota // an observed route has no route object for it's prefix and origin
+	Rejected                 // an observed route is rejected by the compiled import policy
+	Unannounced              // a route object was not seen announced by it's origin
+	Unchecked                // observed routes could not be checked as the import policy does not compile
+)
+
+var kindNames = map[Kind]string{
+	Unregistered: "unregistered",
+	Rejected:     "rejected",
+	Unannounced:  "unannounced",
+	Unchecked:    "unchecked",
+}
+
+// String returns the name of the kind of difference
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler so that kinds are written by
+// name in JSON output
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ParseKind returns the kind with the given name, e.g. rejected
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kindNames {
+		if strings.EqualFold(n, name) {
+			return k, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown kind %q", name)
+}
+
+// Finding is a single difference between BGP and the database. Observed
+// routes are described by their path and peer, and route objects by their
+// source.
+type Finding struct {
+	Kind    Kind   `json:"kind"`
+	Prefix  string `json:"prefix"`
+	Origin  string `json:"origin,omitempty"`
+	Path    string `json:"path,omitempty"`
+	PeerAS  string `json:"peer_as,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the finding on a single line, e.g.
+//
+//	rejected 192.0.2.0/24 AS65537 path 65001 65537: no entry of AS65001-IMPORT accepts it
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s %s %s", f.Kind, f.Prefix, f.Origin)
+	switch {
+	case f.Source != "":
+		s += " in " + f.Source
+	case f.Path != "":
+		s += " path " + f.Path
+	}
+
+	return s + ": " + f.Message
+}
+
+// Options control which comparisons are made and which findings are reported
+type Options struct {
+	// LocalAS, if set, is the aut-num whose import policy is compiled for the
+	// peer of each observed route, reporting the routes it rejects
+	LocalAS uint32
+	// Policy controls how import policies are compiled
+	Policy policy.Options
+
+	Sources []string // only compare route objects from these sources, or every source if empty
+	Kinds   []Kind   // only report these kinds, or every kind if empty
+}
+
+// Comparison compares observed routes with a database
+type Comparison struct {
+	d        *db.Database
+	opts     Options
+	sources  map[string]bool
+	kinds    map[Kind]bool
+	compiler *policy.Compiler
+
+	routeMaps map[string]*policy.RouteMap // keyed by peer AS, address and family, nil if it does not compile
+	seen      map[string]bool             // the findings already reported for observed routes
+	announced map[string]bool             // the prefixes and origins observed
+
+	findings []Finding
+}
+
+// New returns a Comparison of the routes added to it with the database
+func New(d *db.Database, opts Options) *Comparison {
+	c := &Comparison{
+		d:         d,
+		opts:      opts,
+		sources:   make(map[string]bool),
+		kinds:     make(map[Kind]bool),
+		compiler:  policy.NewCompiler(d, opts.Policy),
+		routeMaps: make(map[string]*policy.RouteMap),
+		seen:      make(map[string]bool),
+		announced: make(map[string]bool),
+	}
+	for _, source := range opts.Sources {
+		c.sources[strings.ToUpper(source)] = true
+	}
+	for _, k := range opts.Kinds {
+		c.kinds[k] = true
+	}
+
+	return c
+}
+
+// Read compares every route in an MRT dump
+func (c *Comparison) Read(r io.Reader) error {
+	mr := mrt.NewReader(r)
+	for {
+		route, err := mr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.Add(route); err != nil {
+			return err
+		}
+	}
+}
+
+// Add compares an observed route. Withdrawals are ignored, so every route
+// seen announced is compared. If the import policy for the route's peer can
+// not be compiled, for example as a policy attribute is malformed, an
+// Unchecked finding is reported once for the peer and the routes from it are
+// not checked against the policy. An error is returned if the local aut-num
+// does not exist.
+func (c *Comparison) Add(route *mrt.Route) error {
+	if route.Withdrawn {
+		return nil
+	}
+
+	observed := Finding{
+		Prefix: route.Prefix.String(),
+		Path:   route.PathString(),
+		PeerAS: fmt.Sprintf("AS%d", route.Peer.AS),
+	}
+
+	// aggregates without a single origin can not have a route object
+	if origin, ok := route.Origin(); ok {
+		observed.Origin = fmt.Sprintf("AS%d", origin)
+		c.announced[routeKey(route.Prefix, observed.Origin)] = true
+		if !c.registered(route.Prefix, observed.Origin) {
+			c.add(Unregistered, observed, "no route object for %s with origin %s", observed.Prefix, observed.Origin)
+		}
+	}
+
+	if c.opts.LocalAS == 0 {
+		return nil
+	}
+
+	rm, err := c.routeMap(route.Peer, !prefix.IsIPv4(route.Prefix), observed)
+	if err != nil || rm == nil {
+		return err
+	}
+
+	if rm.Match(policyRoute(route)) == nil {
+		c.add(Rejected, observed, "no entry of %s accepts it", rm.Name)
+	}
+
+	return nil
+}
+
+// Findings returns the findings for the routes added so far, in the order
+// they were observed, followed by the route objects whose origin was not
+// seen announcing them, ordered by class and primary key
+func (c *Comparison) Findings() []Finding {
+	findings := append([]Finding{}, c.findings...)
+	if len(c.kinds) > 0 && !c.kinds[Unannounced] {
+		return findings
+	}
+
+	for _, obj := range c.d.Objects(token.CLASS_ROUTE, token.CLASS_ROUTE6) {
+		source := strings.ToUpper(obj.Value(token.ATTR_REGISTRY_SOURCE))
+		if len(c.sources) > 0 && !c.sources[source] {
+			continue
+		}
+
+		ipnet, err := prefix.Parse(obj.Name())
+		if err != nil {
+			continue
+		}
+		origin := strings.ToUpper(strings.TrimSpace(obj.Value(token.ATTR_ORIGIN)))
+		if !c.announced[routeKey(ipnet, origin)] {
+			findings = append(findings, Finding{
+				Kind:    Unannounced,
+				Prefix:  ipnet.String(),
+				Origin:  origin,
+				Source:  source,
+				Message: "not seen announced by " + origin,
+			})
+		}
+	}
+
+	return findings
+}
+
+// add records a finding for an observed route, once for each peer AS and path,
+// or for Unchecked findings once for each peer AS and message
+func (c *Comparison) add(k Kind, observed Finding, format string, args ...interface{}) {
+	if len(c.kinds) > 0 && !c.kinds[k] {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	key := fmt.Sprintf("%s %s %s %s", k, observed.Prefix, observed.PeerAS, observed.Path)
+	switch k {
+	case Unregistered:
+		key = fmt.Sprintf("%s %s %s", k, observed.Prefix, observed.Origin)
+	case Unchecked:
+		key = fmt.Sprintf("%s %s %s", k, observed.PeerAS, msg)
+	}
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	observed.Kind = k
+	observed.Message = msg
+	c.findings = append(c.findings, observed)
+}
+
+// registered reports whether a route object of one of the compared sources
+// exists for exactly the prefix and origin
+func (c *Comparison) registered(ipnet *net.IPNet, origin string) bool {
+	for _, obj := range c.d.Routes(ipnet, db.Exact) {
+		source := strings.ToUpper(obj.Value(token.ATTR_REGISTRY_SOURCE))
+		if len(c.sources) > 0 && !c.sources[source] {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(obj.Value(token.ATTR_ORIGIN)), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeMap returns the import policy of the local AS for the peer, compiling
+// it the first time it is needed. If it can not be compiled an Unchecked
+// finding is reported for the observed route and nil is returned.
+func (c *Comparison) routeMap(peer mrt.Peer, ipv6 bool, observed Finding) (*policy.RouteMap, error) {
+	key := fmt.Sprintf("%d %s %t", peer.AS, peer.Address, ipv6)
+	if rm, ok := c.routeMaps[key]; ok {
+		return rm, nil
+	}
+
+	autNum := fmt.Sprintf("AS%d", c.opts.LocalAS)
+	if _, ok := c.d.Get(token.CLASS_AUT_NUM, autNum); !ok {
+		return nil, fmt.Errorf("aut-num %s not found", autNum)
+	}
+
+	rm, err := c.compiler.Compile(policy.Import, policy.Neighbor{
+		LocalAS:     c.opts.LocalAS,
+		PeerAS:      peer.AS,
+		PeerAddress: peer.Address,
+	}, ipv6)
+	if err != nil {
+		c.add(Unchecked, observed, "import policy of %s can not be compiled: %s", autNum, err)
+		rm = nil
+	}
+
+	c.routeMaps[key] = rm
+	return rm, nil
+}
+
+// policyRoute converts an observed route to be matched against a route map.
+// The AS numbers of AS_SETs are matched as if they were a sequence, and
+// confederation segments are left out.
+func policyRoute(route *mrt.Route) policy.Route {
+	r := policy.Route{Prefix: route.Prefix}
+	for _, s := range route.Path {
+		if s.Type == mrt.ASSequence || s.Type == mrt.ASSet {
+			r.Path = append(r.Path, s.ASNs...)
+		}
+	}
+
+	for _, community := range route.Communities {
+		r.Communities = append(r.Communities, fmt.Sprintf("%d:%d", community>>16, community&0xffff))
+	}
+
+	return r
+}
+
+func routeKey(ipnet *net.IPNet, origin string) string {
+	return ipnet.String() + " " + origin
+}
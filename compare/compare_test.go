@@ -0,0 +1,128 @@
+package compare
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/mrt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func route(cidr string, peer string, path []uint32, communities ...uint32) *mrt.Route {
+	_, ipnet, _ := net.ParseCIDR(cidr)
+	return &mrt.Route{
+		Peer:        mrt.Peer{Address: net.ParseIP(peer), AS: path[0]},
+		Prefix:      ipnet,
+		Path:        []mrt.Segment{{Type: mrt.ASSequence, ASNs: path}},
+		Communities: communities,
+	}
+}
+
+func observed() []*mrt.Route {
+	withdrawn := route("192.0.2.0/24", "192.0.2.1", []uint32{65001})
+	withdrawn.Withdrawn, withdrawn.Path = true, nil
+
+	return []*mrt.Route{
+		route("192.0.2.0/24", "192.0.2.1", []uint32{65001, 65537}),
+		route("192.0.2.0/24", "192.0.2.2", []uint32{65002, 65537}),
+		route("192.0.2.0/24", "192.0.2.2", []uint32{65002, 65537}, 65002<<16|1),
+		route("198.51.100.128/25", "192.0.2.1", []uint32{65001, 65538}),
+		route("2001:db8::/32", "2001:db8::1", []uint32{65001, 65537}),
+		withdrawn,
+		route("198.51.100.128/25", "192.0.2.1", []uint32{65001, 65538}),
+	}
+}
+
+func TestCompare(t *testing.T) {
+	d, err := db.LoadFile("testdata/irr.db")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"all", Options{LocalAS: 65000}, []string{
+			"rejected 192.0.2.0/24 AS65537 path 65002 65537: no entry of AS65002-IMPORT accepts it",
+			"unregistered 198.51.100.128/25 AS65538 path 65001 65538: no route object for 198.51.100.128/25 with origin AS65538",
+			"rejected 198.51.100.128/25 AS65538 path 65001 65538: no entry of AS65001-IMPORT accepts it",
+			"unannounced 198.51.100.0/24 AS65538 in TEST: not seen announced by AS65538",
+			"unannounced 203.0.113.0/24 AS65538 in OTHER: not seen announced by AS65538",
+		}},
+		{"without policy", Options{Sources: []string{"test"}}, []string{
+			"unregistered 198.51.100.128/25 AS65538 path 65001 65538: no route object for 198.51.100.128/25 with origin AS65538",
+			"unannounced 198.51.100.0/24 AS65538 in TEST: not seen announced by AS65538",
+		}},
+		{"kinds", Options{LocalAS: 65000, Kinds: []Kind{Rejected}}, []string{
+			"rejected 192.0.2.0/24 AS65537 path 65002 65537: no entry of AS65002-IMPORT accepts it",
+			"rejected 198.51.100.128/25 AS65538 path 65001 65538: no entry of AS65001-IMPORT accepts it",
+		}},
+		{"other source", Options{Sources: []string{"OTHER"}, Kinds: []Kind{Unregistered}}, []string{
+			"unregistered 192.0.2.0/24 AS65537 path 65001 65537: no route object for 192.0.2.0/24 with origin AS65537",
+			"unregistered 198.51.100.128/25 AS65538 path 65001 65538: no route object for 198.51.100.128/25 with origin AS65538",
+			"unregistered 2001:db8::/32 AS65537 path 65001 65537: no route object for 2001:db8::/32 with origin AS65537",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(d, tt.opts)
+			for _, r := range observed() {
+				if !assert.NoError(t, c.Add(r)) {
+					t.FailNow()
+				}
+			}
+
+			var actual []string
+			for _, f := range c.Findings() {
+				actual = append(actual, f.String())
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCompareMissingAutNum(t *testing.T) {
+	d, err := db.LoadFile("testdata/irr.db")
+	require.NoError(t, err)
+	c := New(d, Options{LocalAS: 65099})
+	err = c.Add(observed()[0])
+	assert.EqualError(t, err, "aut-num AS65099 not found")
+}
+
+func TestCompareUncompiledPolicy(t *testing.T) {
+	d, err := db.LoadFile("testdata/irr.db")
+	require.NoError(t, err)
+	c := New(d, Options{LocalAS: 65003, Kinds: []Kind{Rejected, Unchecked}})
+	for _, r := range observed() {
+		if !assert.NoError(t, c.Add(r)) {
+			t.FailNow()
+		}
+	}
+
+	// the malformed import is reported once for each peer, and the remaining
+	// routes are still compared
+	var actual []string
+	for _, f := range c.Findings() {
+		actual = append(actual, f.String())
+	}
+	assert.Equal(t, []string{
+		`unchecked 192.0.2.0/24 AS65537 path 65001 65537: import policy of AS65003 can not be compiled: invalid import policy "from AS65002 accept {": expected value, found end of policy`,
+		`unchecked 192.0.2.0/24 AS65537 path 65002 65537: import policy of AS65003 can not be compiled: invalid import policy "from AS65002 accept {": expected value, found end of policy`,
+		"rejected 2001:db8::/32 AS65537 path 65001 65537: no entry of AS65001-IMPORT-IPV6 accepts it",
+	}, actual)
+}
+
+func TestParseKind(t *testing.T) {
+	for k, name := range kindNames {
+		actual, err := ParseKind(strings.ToUpper(name))
+		assert.NoError(t, err)
+		assert.Equal(t, k, actual)
+	}
+
+	_, err := ParseKind("bogus")
+	assert.EqualError(t, err, `unknown kind "bogus"`)
+}
@@ -0,0 +1,29 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteText writes a single line per finding
+func WriteText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON writes the findings as a JSON array
+func WriteJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
@@ -0,0 +1,472 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/schema"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Query selects which prefixes are returned by a prefix lookup. The queries
+// match the IRRd and RIPE whois query flags.
+type Query int
+
+const (
+	// Exact returns objects with exactly the given prefix
+	Exact Query = iota
+	// LessSpecific returns the objects with the most specific prefix covering
+	// the given prefix, excluding an exact match (-l)
+	LessSpecific
+	// AllLessSpecific returns the objects for all prefixes covering the given
+	// prefix, including an exact match (-L)
+	AllLessSpecific
+	// MoreSpecific returns the objects one level more specific than the given
+	// prefix, excluding an exact match (-m)
+	MoreSpecific
+	// AllMoreSpecific returns the objects for all prefixes covered by the
+	// given prefix, excluding an exact match (-M)
+	AllMoreSpecific
+)
+
+// key identifies an object by it's class and primary key
+type key struct {
+	class token.Type
+	pk    string
+}
+
+// Database is an in-memory collection of RPSL objects, indexed by class and
+// primary key, by the objects they reference, and by prefix. A Database is
+// safe for concurrent use.
+type Database struct {
+	mu sync.RWMutex
+
+	// a database returned by Stage makes changes to staged, and reads combine
+	// it with base, leaving out the objects of base which staged replaces and
+	// those which are removed
+	base, staged *Database
+	removed      map[key]bool
+
+	objects map[key]*ast.Object
+
+	// inverse indexes, keyed by the upper-cased referenced name
+	origin     map[string][]*ast.Object
+	mntBy      map[string][]*ast.Object
+	memberOf   map[string][]*ast.Object
+	contact    map[string][]*ast.Object
+	references map[string][]*ast.Object // every reference given by schema.References
+
+	ipv4 *radixTree
+	ipv6 *radixTree
+}
+
+// New creates an empty Database
+func New() *Database {
+	return &Database{
+		objects:    make(map[key]*ast.Object),
+		origin:     make(map[string][]*ast.Object),
+		mntBy:      make(map[string][]*ast.Object),
+		memberOf:   make(map[string][]*ast.Object),
+		contact:    make(map[string][]*ast.Object),
+		references: make(map[string][]*ast.Object),
+		ipv4:       newRadixTree(),
+		ipv6:       newRadixTree(),
+	}
+}
+
+// Load parses the RPSL text read from r and adds every object to the
+// database. Objects parsed before an error is encountered are still added.
+func (d *Database) Load(inputName string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	objects, parseErr := parser.Parse(inputName, string(data))
+	for _, obj := range objects {
+		if err := d.Add(obj); err != nil {
+			return err
+		}
+	}
+
+	return parseErr
+}
+
+// LoadFile loads the objects from the named files into a new database, in
+// order, see Database.LoadFile
+func LoadFile(names ...string) (*Database, error) {
+	d := New()
+	for _, name := range names {
+		if err := d.LoadFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// LoadFile loads the objects from the named file, such as a database dump
+func (d *Database) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return d.Load(name, f)
+}
+
+// Add adds an object to the database, replacing any existing object with the
+// same class and primary key
+func (d *Database) Add(obj *ast.Object) error {
+	if len(obj.Attributes) == 0 {
+		return fmt.Errorf("object has no attributes")
+	}
+
+	ipnet, err := routePrefix(obj)
+	if err != nil {
+		return err
+	}
+
+	if d.base != nil {
+		return d.addStaged(obj)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.put(obj, ipnet)
+	return nil
+}
+
+// put adds an object to the database, replacing any existing object with the
+// same class and primary key, d.mu must be held
+func (d *Database) put(obj *ast.Object, ipnet *net.IPNet) {
+	k := objectKey(obj)
+	if existing, ok := d.objects[k]; ok {
+		d.unindex(existing)
+	}
+
+	d.objects[k] = obj
+	d.index(obj, ipnet)
+}
+
+// Remove removes the object with the same class and primary key as obj,
+// returning the removed object
+func (d *Database) Remove(obj *ast.Object) (*ast.Object, bool) {
+	if d.base != nil {
+		return d.removeStaged(obj)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.take(objectKey(obj))
+}
+
+// take removes the object with the key, d.mu must be held
+func (d *Database) take(k key) (*ast.Object, bool) {
+	existing, ok := d.objects[k]
+	if !ok {
+		return nil, false
+	}
+
+	delete(d.objects, k)
+	d.unindex(existing)
+	return existing, true
+}
+
+// Get returns the object with the given class and primary key. The primary key
+// is as returned by ast.Object.Key, e.g. 192.0.2.0/24AS65537 for a route, and
+// is matched case-insensitively.
+func (d *Database) Get(class token.Type, primaryKey string) (*ast.Object, bool) {
+	if d.base != nil {
+		return d.getStaged(class, primaryKey)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	obj, ok := d.objects[key{class: class, pk: strings.ToUpper(primaryKey)}]
+	return obj, ok
+}
+
+// Len returns the number of objects in the database
+func (d *Database) Len() int {
+	if d.base != nil {
+		return len(d.Objects())
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.objects)
+}
+
+// Objects returns every object of the given classes, or every object if no
+// classes are given, ordered by class and primary key
+func (d *Database) Objects(classes ...token.Type) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.Objects(classes...), d.staged.Objects(classes...), byClassAndKey)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	wanted := make(map[token.Type]bool)
+	for _, class := range classes {
+		wanted[class] = true
+	}
+
+	var keys []key
+	for k := range d.objects {
+		if len(wanted) == 0 || wanted[k.class] {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].class != keys[j].class {
+			return keys[i].class < keys[j].class
+		}
+		return keys[i].pk < keys[j].pk
+	})
+
+	objects := make([]*ast.Object, len(keys))
+	for i, k := range keys {
+		objects[i] = d.objects[k]
+	}
+
+	return objects
+}
+
+// ByOrigin returns the route and route6 objects originated by the AS number
+func (d *Database) ByOrigin(asn string) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.ByOrigin(asn), d.staged.ByOrigin(asn), byKey)
+	}
+
+	return d.lookup(d.origin, asn)
+}
+
+// ByMntBy returns the objects maintained by the mntner
+func (d *Database) ByMntBy(mntner string) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.ByMntBy(mntner), d.staged.ByMntBy(mntner), byKey)
+	}
+
+	return d.lookup(d.mntBy, mntner)
+}
+
+// ByMemberOf returns the objects which claim membership of the set using the
+// member-of attribute
+func (d *Database) ByMemberOf(set string) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.ByMemberOf(set), d.staged.ByMemberOf(set), byKey)
+	}
+
+	return d.lookup(d.memberOf, set)
+}
+
+// ByContact returns the objects which reference the nic-hdl as an admin-c or
+// tech-c
+func (d *Database) ByContact(nicHdl string) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.ByContact(nicHdl), d.staged.ByContact(nicHdl), byKey)
+	}
+
+	return d.lookup(d.contact, nicHdl)
+}
+
+// ByReference returns the objects which reference an object with the primary
+// key, by any of the attributes described by schema.References. Callers
+// should check the class of each reference, as objects of different classes
+// may share a primary key.
+func (d *Database) ByReference(primaryKey string) []*ast.Object {
+	if d.base != nil {
+		return d.merge(d.base.ByReference(primaryKey), d.staged.ByReference(primaryKey), byKey)
+	}
+
+	return d.lookup(d.references, primaryKey)
+}
+
+// Routes returns the route and route6 objects matching the prefix query, from
+// the least specific to the most specific prefix
+func (d *Database) Routes(ipnet *net.IPNet, q Query) []*ast.Object {
+	if d.base != nil {
+		return d.routesStaged(ipnet, q)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tree := d.ipv6
+	if prefix.IsIPv4(ipnet) {
+		tree = d.ipv4
+		ipnet = &net.IPNet{IP: ipnet.IP.To4(), Mask: ipnet.Mask}
+	}
+
+	var nodes []*radixNode
+	switch q {
+	case Exact:
+		return sortObjects(tree.exact(ipnet))
+	case LessSpecific, AllLessSpecific:
+		nodes = tree.lessSpecific(ipnet)
+		ones, _ := ipnet.Mask.Size()
+		if len(nodes) > 0 && q == LessSpecific {
+			// drop an exact match, then keep only the most specific
+			if last, _ := nodes[len(nodes)-1].prefix.Mask.Size(); last == ones {
+				nodes = nodes[:len(nodes)-1]
+			}
+			if len(nodes) > 0 {
+				nodes = nodes[len(nodes)-1:]
+			}
+		}
+	case MoreSpecific:
+		nodes = tree.moreSpecific(ipnet, true)
+	case AllMoreSpecific:
+		nodes = tree.moreSpecific(ipnet, false)
+	}
+
+	var objects []*ast.Object
+	for _, n := range nodes {
+		objects = append(objects, sortObjects(n.objects)...)
+	}
+
+	return objects
+}
+
+func (d *Database) lookup(idx map[string][]*ast.Object, name string) []*ast.Object {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return sortObjects(idx[strings.ToUpper(name)])
+}
+
+// index adds the object to the inverse and prefix indexes, d.mu must be held
+func (d *Database) index(obj *ast.Object, ipnet *net.IPNet) {
+	for _, idx := range d.indexes(obj) {
+		for _, name := range idx.names {
+			idx.m[name] = append(idx.m[name], obj)
+		}
+	}
+
+	if ipnet != nil {
+		d.tree(ipnet).insert(ipnet, obj)
+	}
+}
+
+// unindex removes the object from the inverse and prefix indexes, d.mu must be
+// held
+func (d *Database) unindex(obj *ast.Object) {
+	for _, idx := range d.indexes(obj) {
+		for _, name := range idx.names {
+			idx.m[name] = without(idx.m[name], obj)
+			if len(idx.m[name]) == 0 {
+				delete(idx.m, name)
+			}
+		}
+	}
+
+	if class := obj.Class(); class == token.CLASS_ROUTE || class == token.CLASS_ROUTE6 {
+		if ipnet, err := prefix.Parse(obj.Name()); err == nil {
+			d.tree(ipnet).remove(ipnet, obj)
+		}
+	}
+}
+
+type inverseIndex struct {
+	m     map[string][]*ast.Object
+	names []string
+}
+
+// indexes returns each inverse index the object belongs in, along with the
+// names it is indexed under
+func (d *Database) indexes(obj *ast.Object) []inverseIndex {
+	var idx []inverseIndex
+	if class := obj.Class(); class == token.CLASS_ROUTE || class == token.CLASS_ROUTE6 {
+		idx = append(idx, inverseIndex{d.origin, upper(obj.Values(token.ATTR_ORIGIN))})
+	}
+
+	var refs []string
+	for _, ref := range schema.References(obj) {
+		refs = append(refs, ref.Key)
+	}
+
+	contacts := append(obj.Values(token.ATTR_ADMIN_CONTACT), obj.Values(token.ATTR_TECHNICAL_CONTACT)...)
+	return append(idx,
+		inverseIndex{d.mntBy, upper(obj.Values(token.ATTR_MAINTAINED_BY))},
+		inverseIndex{d.memberOf, upper(obj.Values(token.ATTR_MEMBER_OF_ROUTE_SET))},
+		inverseIndex{d.contact, upper(contacts)},
+		inverseIndex{d.references, upper(refs)},
+	)
+}
+
+// routePrefix returns the prefix of a route or route6 object, or nil for
+// objects of other classes
+func routePrefix(obj *ast.Object) (*net.IPNet, error) {
+	if class := obj.Class(); class != token.CLASS_ROUTE && class != token.CLASS_ROUTE6 {
+		return nil, nil
+	}
+
+	return prefix.Parse(obj.Name())
+}
+
+func (d *Database) tree(ipnet *net.IPNet) *radixTree {
+	if prefix.IsIPv4(ipnet) {
+		return d.ipv4
+	}
+
+	return d.ipv6
+}
+
+func objectKey(obj *ast.Object) key {
+	return key{class: obj.Class(), pk: strings.ToUpper(obj.Key())}
+}
+
+// upper returns the unique upper-cased names, so that an object referencing
+// the same name twice is only indexed once
+func upper(names []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+func without(objects []*ast.Object, obj *ast.Object) []*ast.Object {
+	result := objects[:0]
+	for _, existing := range objects {
+		if existing != obj {
+			result = append(result, existing)
+		}
+	}
+
+	return result
+}
+
+// sortObjects returns a copy of the objects ordered by primary key, so that
+// results are stable and callers can not modify the indexes
+func sortObjects(objects []*ast.Object) []*ast.Object {
+	result := append([]*ast.Object(nil), objects...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key() < result[j].Key()
+	})
+
+	return result
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `route:          10.0.0.0/8
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          10.1.0.0/16
+origin:         AS65537
+member-of:      RS-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          10.1.0.0/16
+origin:         AS65538
+mnt-by:         OTHER-MNT
+source:         TEST
+
+route:          10.1.2.0/24
+origin:         AS65538
+mnt-by:         OTHER-MNT
+source:         TEST
+
+route:          10.2.0.0/16
+origin:         AS65538
+mnt-by:         OTHER-MNT
+source:         TEST
+
+route6:         2001:db8::/32
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+
+as-set:         AS-TEST
+members:        AS65537
+admin-c:        PERSON-TEST
+tech-c:         PERSON-TEST, ROLE-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+
+person:         Test person
+nic-hdl:        PERSON-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+func keys(objects []*ast.Object) []string {
+	result := make([]string, len(objects))
+	for i, obj := range objects {
+		result[i] = obj.Key()
+	}
+
+	return result
+}
+
+func TestDatabaseIndexes(t *testing.T) {
+	d := New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+	assert.Equal(t, 8, d.Len())
+
+	obj, ok := d.Get(token.CLASS_ROUTE, "10.1.0.0/16as65537")
+	if assert.True(t, ok) {
+		assert.Equal(t, "RS-TEST", obj.Value(token.ATTR_MEMBER_OF_ROUTE_SET))
+	}
+
+	_, ok = d.Get(token.CLASS_PERSON, "person-test")
+	assert.True(t, ok)
+
+	assert.Equal(t, []string{"10.0.0.0/8AS65537", "10.1.0.0/16AS65537", "2001:db8::/32AS65537"}, keys(d.ByOrigin("as65537")))
+	assert.Equal(t, []string{"10.1.0.0/16AS65537"}, keys(d.ByMemberOf("RS-TEST")))
+	assert.Len(t, d.ByMntBy("OTHER-MNT"), 3)
+	assert.Equal(t, []string{"AS-TEST"}, keys(d.ByContact("ROLE-TEST")))
+	assert.Equal(t, []string{"AS-TEST"}, keys(d.ByReference("person-test")))
+	assert.Len(t, d.Objects(token.CLASS_ROUTE), 5)
+
+	// replacing an object updates the indexes
+	replacement, _ := d.Get(token.CLASS_ROUTE, "10.1.0.0/16AS65537")
+	replacement = &ast.Object{Attributes: replacement.Attributes[:2]}
+	assert.NoError(t, d.Add(replacement))
+	assert.Empty(t, d.ByMemberOf("RS-TEST"))
+	assert.Equal(t, 8, d.Len())
+
+	removed, ok := d.Remove(replacement)
+	assert.True(t, ok)
+	assert.Equal(t, replacement, removed)
+	assert.Equal(t, []string{"10.0.0.0/8AS65537", "2001:db8::/32AS65537"}, keys(d.ByOrigin("AS65537")))
+	assert.Equal(t, []string{"10.1.0.0/16AS65538"}, keys(d.Routes(mustParseCIDR("10.1.0.0/16"), Exact)))
+}
+
+func TestDatabaseRoutes(t *testing.T) {
+	d := New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+
+	tests := []struct {
+		prefix   string
+		query    Query
+		expected []string
+	}{
+		{"10.1.0.0/16", Exact, []string{"10.1.0.0/16AS65537", "10.1.0.0/16AS65538"}},
+		{"10.1.0.0/24", Exact, []string{}},
+		{"10.1.2.0/24", LessSpecific, []string{"10.1.0.0/16AS65537", "10.1.0.0/16AS65538"}},
+		{"10.1.0.0/16", LessSpecific, []string{"10.0.0.0/8AS65537"}},
+		{"10.1.2.0/24", AllLessSpecific, []string{"10.0.0.0/8AS65537", "10.1.0.0/16AS65537", "10.1.0.0/16AS65538", "10.1.2.0/24AS65538"}},
+		{"10.1.2.128/25", AllLessSpecific, []string{"10.0.0.0/8AS65537", "10.1.0.0/16AS65537", "10.1.0.0/16AS65538", "10.1.2.0/24AS65538"}},
+		{"10.0.0.0/8", MoreSpecific, []string{"10.1.0.0/16AS65537", "10.1.0.0/16AS65538", "10.2.0.0/16AS65538"}},
+		{"10.0.0.0/8", AllMoreSpecific, []string{"10.1.0.0/16AS65537", "10.1.0.0/16AS65538", "10.1.2.0/24AS65538", "10.2.0.0/16AS65538"}},
+		{"0.0.0.0/0", MoreSpecific, []string{"10.0.0.0/8AS65537"}},
+		{"2001:db8:1::/48", LessSpecific, []string{"2001:db8::/32AS65537"}},
+		{"11.0.0.0/8", AllMoreSpecific, []string{}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, keys(d.Routes(mustParseCIDR(tt.prefix), tt.query)), "%s %d", tt.prefix, tt.query)
+	}
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipnet
+}
+
+func TestDatabaseStage(t *testing.T) {
+	d := New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+	staged := d.Stage()
+
+	// the staged database replaces a route, removes another and adds a third,
+	// while the database it was staged from is unchanged
+	route, _ := d.Get(token.CLASS_ROUTE, "10.1.0.0/16AS65537")
+	replacement := &ast.Object{Attributes: route.Attributes[:2]}
+	removed, _ := d.Get(token.CLASS_ROUTE, "10.1.2.0/24AS65538")
+	added := mustParseObject(t, "route: 10.1.2.128/25\norigin: AS65537\nmnt-by: TEST-MNT\nsource: TEST\n")
+
+	assert.NoError(t, staged.Add(replacement))
+	_, ok := staged.Remove(removed)
+	assert.True(t, ok)
+	assert.NoError(t, staged.Add(added))
+
+	expected := New()
+	require.NoError(t, expected.Load("test", strings.NewReader(testDatabase)))
+	assert.NoError(t, expected.Add(replacement))
+	expected.Remove(removed)
+	assert.NoError(t, expected.Add(added))
+
+	assert.Equal(t, 8, d.Len())
+	assert.Equal(t, expected.Len(), staged.Len())
+	assert.Equal(t, keys(expected.Objects()), keys(staged.Objects()))
+	assert.Equal(t, keys(expected.ByOrigin("AS65537")), keys(staged.ByOrigin("AS65537")))
+	assert.Empty(t, staged.ByMemberOf("RS-TEST"))
+	assert.Equal(t, []string{"10.1.0.0/16AS65537"}, keys(d.ByMemberOf("RS-TEST")))
+	assert.Equal(t, keys(expected.ByReference("TEST-MNT")), keys(staged.ByReference("TEST-MNT")))
+	assert.NotContains(t, keys(staged.ByReference("TEST-MNT")), "10.1.0.0/16AS65537")
+	assert.Len(t, d.ByReference("TEST-MNT"), 5)
+
+	_, ok = staged.Get(token.CLASS_ROUTE, "10.1.2.0/24as65538")
+	assert.False(t, ok)
+	_, ok = d.Get(token.CLASS_ROUTE, "10.1.2.128/25AS65537")
+	assert.False(t, ok)
+
+	for _, p := range []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.128/25", "10.1.2.192/26", "2001:db8:1::/48"} {
+		for _, q := range []Query{Exact, LessSpecific, AllLessSpecific, MoreSpecific, AllMoreSpecific} {
+			ipnet := mustParseCIDR(p)
+			assert.Equal(t, keys(expected.Routes(ipnet, q)), keys(staged.Routes(ipnet, q)), "%s %d", p, q)
+		}
+	}
+
+	assert.NoError(t, staged.Commit())
+	assert.Equal(t, keys(expected.Objects()), keys(d.Objects()))
+	assert.Equal(t, keys(expected.Routes(mustParseCIDR("10.0.0.0/8"), AllMoreSpecific)), keys(d.Routes(mustParseCIDR("10.0.0.0/8"), AllMoreSpecific)))
+	assert.Equal(t, d.Len(), staged.Len())
+
+	assert.EqualError(t, d.Commit(), "database is not staged")
+}
+
+func TestLoadFile(t *testing.T) {
+	_, err := LoadFile("testdata/missing.db")
+	assert.Error(t, err)
+}
+
+func mustParseObject(t *testing.T, text string) *ast.Object {
+	objects, err := parser.Parse("test", text)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1) {
+		t.FailNow()
+	}
+
+	return objects[0]
+}
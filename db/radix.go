@@ -0,0 +1,136 @@
+package db
+
+import (
+	"net"
+
+	"github.com/kkirsche/rpsl/ast"
+)
+
+// radixTree is a binary trie of prefixes, used to answer exact, less specific
+// and more specific prefix queries. A separate tree is kept for each address
+// family.
+type radixTree struct {
+	root *radixNode
+}
+
+type radixNode struct {
+	children [2]*radixNode
+	prefix   *net.IPNet
+	objects  []*ast.Object
+}
+
+func newRadixTree() *radixTree {
+	return &radixTree{root: &radixNode{}}
+}
+
+// bit returns the nth most significant bit of the IP address
+func bit(ip net.IP, n int) int {
+	return int(ip[n/8]>>uint(7-n%8)) & 1
+}
+
+func (t *radixTree) insert(ipnet *net.IPNet, obj *ast.Object) {
+	ones, _ := ipnet.Mask.Size()
+	n := t.root
+	for i := 0; i < ones; i++ {
+		b := bit(ipnet.IP, i)
+		if n.children[b] == nil {
+			n.children[b] = &radixNode{}
+		}
+		n = n.children[b]
+	}
+
+	n.prefix = ipnet
+	n.objects = append(n.objects, obj)
+}
+
+func (t *radixTree) remove(ipnet *net.IPNet, obj *ast.Object) {
+	n := t.find(ipnet)
+	if n == nil {
+		return
+	}
+
+	for i, existing := range n.objects {
+		if existing == obj {
+			n.objects = append(n.objects[:i], n.objects[i+1:]...)
+			break
+		}
+	}
+
+	// empty nodes are left in place, they are cheap and are reused if the
+	// prefix is added again
+	if len(n.objects) == 0 {
+		n.prefix = nil
+	}
+}
+
+// find returns the node for the prefix, or nil if the tree has no such node
+func (t *radixTree) find(ipnet *net.IPNet) *radixNode {
+	ones, _ := ipnet.Mask.Size()
+	n := t.root
+	for i := 0; i < ones && n != nil; i++ {
+		n = n.children[bit(ipnet.IP, i)]
+	}
+
+	return n
+}
+
+// exact returns the objects with exactly the given prefix
+func (t *radixTree) exact(ipnet *net.IPNet) []*ast.Object {
+	if n := t.find(ipnet); n != nil {
+		return n.objects
+	}
+
+	return nil
+}
+
+// lessSpecific returns the nodes holding objects which cover the prefix, from
+// the least specific to the most specific, including the prefix itself
+func (t *radixTree) lessSpecific(ipnet *net.IPNet) []*radixNode {
+	ones, _ := ipnet.Mask.Size()
+
+	var nodes []*radixNode
+	n := t.root
+	for i := 0; n != nil; i++ {
+		if len(n.objects) > 0 {
+			nodes = append(nodes, n)
+		}
+
+		if i == ones {
+			break
+		}
+		n = n.children[bit(ipnet.IP, i)]
+	}
+
+	return nodes
+}
+
+// moreSpecific returns the nodes holding objects which are covered by the
+// prefix, excluding the prefix itself. If oneLevel is set, only the nodes
+// with no other covering node beneath the prefix are returned.
+func (t *radixTree) moreSpecific(ipnet *net.IPNet, oneLevel bool) []*radixNode {
+	start := t.find(ipnet)
+	if start == nil {
+		return nil
+	}
+
+	var nodes []*radixNode
+	var walk func(n *radixNode)
+	walk = func(n *radixNode) {
+		for _, child := range n.children {
+			if child == nil {
+				continue
+			}
+
+			if len(child.objects) > 0 {
+				nodes = append(nodes, child)
+				if oneLevel {
+					continue
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(start)
+
+	return nodes
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Stage returns a database layered over d, to which changes can be made
+// without affecting d. Reads of the staged database see the objects of d with
+// the staged changes applied, and reads of d do not see the staged changes
+// until they are committed by Commit. A staged database which is not
+// committed is simply discarded.
+func (d *Database) Stage() *Database {
+	return &Database{base: d, staged: New(), removed: make(map[key]bool)}
+}
+
+// Commit applies the changes made to a database returned by Stage to the
+// database it was staged from. The changes are applied in a single step while
+// holding that database's lock, so concurrent readers see either none or all
+// of them. The staged database is left empty, ready for further changes.
+func (d *Database) Commit() error {
+	if d.base == nil {
+		return fmt.Errorf("database is not staged")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.staged.mu.Lock()
+	defer d.staged.mu.Unlock()
+	d.base.mu.Lock()
+	defer d.base.mu.Unlock()
+
+	for k := range d.removed {
+		d.base.take(k)
+	}
+	for _, obj := range d.staged.objects {
+		// staged objects were validated when they were added
+		ipnet, _ := routePrefix(obj)
+		d.base.put(obj, ipnet)
+	}
+
+	d.removed = make(map[key]bool)
+	d.staged.reset()
+	return nil
+}
+
+// reset removes every object, d.mu must be held
+func (d *Database) reset() {
+	fresh := New()
+	d.objects = fresh.objects
+	d.origin, d.mntBy, d.memberOf, d.contact = fresh.origin, fresh.mntBy, fresh.memberOf, fresh.contact
+	d.references = fresh.references
+	d.ipv4, d.ipv6 = fresh.ipv4, fresh.ipv6
+}
+
+func (d *Database) addStaged(obj *ast.Object) error {
+	if err := d.staged.Add(obj); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	delete(d.removed, objectKey(obj))
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *Database) removeStaged(obj *ast.Object) (*ast.Object, bool) {
+	existing, ok := d.Get(obj.Class(), obj.Key())
+	d.staged.Remove(obj)
+	if _, inBase := d.base.Get(obj.Class(), obj.Key()); inBase {
+		d.mu.Lock()
+		d.removed[objectKey(obj)] = true
+		d.mu.Unlock()
+	}
+
+	return existing, ok
+}
+
+func (d *Database) getStaged(class token.Type, primaryKey string) (*ast.Object, bool) {
+	if obj, ok := d.staged.Get(class, primaryKey); ok {
+		return obj, true
+	}
+	if d.isRemoved(key{class: class, pk: strings.ToUpper(primaryKey)}) {
+		return nil, false
+	}
+
+	return d.base.Get(class, primaryKey)
+}
+
+func (d *Database) isRemoved(k key) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.removed[k]
+}
+
+// merge combines the objects read from base with those read from staged,
+// leaving out the objects of base which have been replaced or removed, and
+// orders them with less
+func (d *Database) merge(base, staged []*ast.Object, less func(a, b *ast.Object) bool) []*ast.Object {
+	result := make([]*ast.Object, 0, len(base)+len(staged))
+	for _, obj := range base {
+		k := objectKey(obj)
+		if _, replaced := d.staged.Get(k.class, k.pk); !replaced && !d.isRemoved(k) {
+			result = append(result, obj)
+		}
+	}
+	result = append(result, staged...)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return less(result[i], result[j])
+	})
+
+	return result
+}
+
+func byClassAndKey(a, b *ast.Object) bool {
+	ka, kb := objectKey(a), objectKey(b)
+	if ka.class != kb.class {
+		return ka.class < kb.class
+	}
+
+	return ka.pk < kb.pk
+}
+
+func byKey(a, b *ast.Object) bool {
+	return a.Key() < b.Key()
+}
+
+// byPrefix orders routes as they are found by walking a radix tree: by
+// address, with covering prefixes before those they cover, then by primary
+// key
+func byPrefix(a, b *ast.Object) bool {
+	pa, _ := prefix.Parse(a.Name())
+	pb, _ := prefix.Parse(b.Name())
+	if pa == nil || pb == nil {
+		return byKey(a, b)
+	}
+
+	if c := bytes.Compare(pa.IP.To16(), pb.IP.To16()); c != 0 {
+		return c < 0
+	}
+	if la, lb := prefixLength(pa), prefixLength(pb); la != lb {
+		return la < lb
+	}
+
+	return byKey(a, b)
+}
+
+// routesStaged answers a prefix query by querying base and staged for every
+// less or more specific route, then narrowing the combined routes to a single
+// level for LessSpecific and MoreSpecific
+func (d *Database) routesStaged(ipnet *net.IPNet, q Query) []*ast.Object {
+	all := q
+	switch q {
+	case LessSpecific:
+		all = AllLessSpecific
+	case MoreSpecific:
+		all = AllMoreSpecific
+	}
+
+	routes := d.merge(d.base.Routes(ipnet, all), d.staged.Routes(ipnet, all), byPrefix)
+	switch q {
+	case LessSpecific:
+		return mostSpecific(routes, prefixLength(ipnet))
+	case MoreSpecific:
+		return oneLevel(routes)
+	}
+
+	return routes
+}
+
+// mostSpecific returns the routes with the longest prefix shorter than ones,
+// from routes ordered by byPrefix which all cover the same prefix
+func mostSpecific(routes []*ast.Object, ones int) []*ast.Object {
+	longest, start := -1, len(routes)
+	for i, route := range routes {
+		ipnet, err := prefix.Parse(route.Name())
+		if err != nil {
+			continue
+		}
+		if n := prefixLength(ipnet); n < ones && n > longest {
+			longest, start = n, i
+		}
+	}
+
+	result := []*ast.Object{}
+	for _, route := range routes[start:] {
+		if ipnet, err := prefix.Parse(route.Name()); err == nil && prefixLength(ipnet) == longest {
+			result = append(result, route)
+		}
+	}
+
+	return result
+}
+
+// oneLevel returns the routes which are not covered by a less specific route,
+// from routes ordered by byPrefix
+func oneLevel(routes []*ast.Object) []*ast.Object {
+	var top *net.IPNet
+	result := []*ast.Object{}
+	for _, route := range routes {
+		ipnet, err := prefix.Parse(route.Name())
+		if err != nil {
+			continue
+		}
+		if top != nil && prefixLength(ipnet) > prefixLength(top) && top.Contains(ipnet.IP) {
+			continue
+		}
+
+		top = ipnet
+		result = append(result, route)
+	}
+
+	return result
+}
+
+func prefixLength(ipnet *net.IPNet) int {
+	ones, _ := ipnet.Mask.Size()
+	return ones
+}
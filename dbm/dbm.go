@@ -0,0 +1,342 @@
+// Package dbm processes updates mailed to an IRR's auto-dbm address. Each
+// message is read, any PGP signature verified, and the objects it contains
+// validated, authorized and applied to the database in turn. The
+// acknowledgement and the mnt-nfy, notify and upd-to notifications are written
+// to an Outbox rather than sent.
+package dbm
+
+import (
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/diff"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/schema"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Result is the outcome of a single object in an update message
+type Result struct {
+	Operation auth.Operation
+	NoOp      bool        // the object is identical to the one in the database, so was not changed
+	Text      string      // the paragraph submitted, without pseudo-attributes
+	Object    *ast.Object // the object submitted, nil if it could not be parsed
+	Old       *ast.Object // the object replaced or deleted
+	Reason    string      // the reason given by a delete: pseudo-attribute
+	Errors    []string
+	Auth      *auth.Result // nil if the update failed before it was authorized
+
+	notify []string // the mnt-nfy and notify addresses of the old and new objects
+}
+
+// Succeeded reports whether the update was applied, or was a no-op
+func (r *Result) Succeeded() bool {
+	return len(r.Errors) == 0
+}
+
+// Label identifies the object, e.g. [route] 192.0.2.0/24AS65537, or is the
+// first line of the paragraph if it could not be parsed
+func (r *Result) Label() string {
+	if r.Object == nil {
+		return strings.SplitN(r.Text, "\n", 2)[0]
+	}
+
+	return fmt.Sprintf("[%s] %s", r.Object.Class().Name(), r.Object.Key())
+}
+
+// Report is the outcome of processing an update message
+type Report struct {
+	From      string // the sender's address
+	ReplyTo   string // the address the acknowledgement is sent to
+	Subject   string
+	Date      string
+	MessageID string
+	KeyCert   string   // the key-cert of a valid PGP signature over the message
+	Warnings  []string // problems with the message as a whole
+	Ignored   []string // paragraphs which are not objects
+	Results   []*Result
+}
+
+// Succeeded reports whether every object in the message was processed
+// successfully. A message without objects does not succeed.
+func (r *Report) Succeeded() bool {
+	if len(r.Results) == 0 {
+		return false
+	}
+
+	for _, result := range r.Results {
+		if !result.Succeeded() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Processor applies the updates in mailed messages to a database. A Processor
+// is safe for concurrent use, messages being processed one at a time.
+type Processor struct {
+	From   string // the address messages are sent from, e.g. auto-dbm@example.net
+	Outbox Outbox
+
+	mu sync.Mutex
+	d  *db.Database
+}
+
+// NewProcessor returns a Processor which applies updates to the database,
+// writing acknowledgements and notifications from the address to the outbox
+func NewProcessor(d *db.Database, from string, outbox Outbox) *Processor {
+	return &Processor{From: from, Outbox: outbox, d: d}
+}
+
+// Process reads an RFC 5322 message, applies the updates it contains, and
+// writes the acknowledgement and notifications to the outbox. Each object is
+// applied or rejected on it's own, the report recording the outcome of each.
+// An error is returned only if the message cannot be read or the outbox fails.
+func (p *Processor) Process(r io.Reader) (*Report, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading message: %v", err)
+	}
+
+	report := &Report{
+		Subject:   msg.Header.Get("Subject"),
+		Date:      msg.Header.Get("Date"),
+		MessageID: msg.Header.Get("Message-ID"),
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		report.From = from.Address
+	} else {
+		report.Warnings = append(report.Warnings, "invalid From address, MAIL-FROM authorization is not possible")
+	}
+	report.ReplyTo = report.From
+	if replyTo, err := mail.ParseAddress(msg.Header.Get("Reply-To")); err == nil {
+		report.ReplyTo = replyTo.Address
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, err := readBody(p.d, msg.Header, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	report.KeyCert = b.keyCert
+	report.Warnings = append(report.Warnings, b.warnings...)
+
+	paragraphs, passwords := splitParagraphs(b.text)
+	creds := auth.Credentials{Passwords: passwords, From: report.From}
+	if b.keyCert != "" {
+		creds.PGPKeys = []string{b.keyCert}
+	}
+
+	for _, para := range paragraphs {
+		if !isObject(para.text) {
+			report.Ignored = append(report.Ignored, para.text)
+			continue
+		}
+		report.Results = append(report.Results, p.apply(para, creds))
+	}
+
+	if err := p.send(report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// paragraph is a blank line separated paragraph of an update message, with
+// its pseudo-attributes removed
+type paragraph struct {
+	text    string
+	deleted bool   // the paragraph has a delete: pseudo-attribute
+	reason  string // the value of the delete: pseudo-attribute
+}
+
+// splitParagraphs splits the text of a message into paragraphs, returning the
+// paragraphs and the values of the password: pseudo-attributes, which apply to
+// every object in the message
+func splitParagraphs(text string) ([]paragraph, []string) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+
+	var (
+		paragraphs []paragraph
+		passwords  []string
+		current    paragraph
+		lines      []string
+	)
+	flush := func() {
+		if len(lines) > 0 {
+			current.text = strings.Join(lines, "\n")
+			paragraphs = append(paragraphs, current)
+		}
+		current, lines = paragraph{}, nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		if name, value, ok := pseudoAttribute(line); ok {
+			switch name {
+			case "password":
+				passwords = append(passwords, value)
+			case "delete":
+				current.deleted, current.reason = true, value
+			}
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+	flush()
+
+	return paragraphs, passwords
+}
+
+// pseudoAttribute returns the name and value of a password: or delete: line
+func pseudoAttribute(line string) (string, string, bool) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", "", false
+	}
+
+	name := strings.ToLower(line[:i])
+	if name != "password" && name != "delete" {
+		return "", "", false
+	}
+
+	return name, strings.TrimSpace(line[i+1:]), true
+}
+
+// isObject reports whether the paragraph begins with a class attribute
+func isObject(text string) bool {
+	i := strings.IndexByte(text, ':')
+	if i < 0 {
+		return false
+	}
+
+	t, ok := token.Lookup(strings.ToLower(text[:i]))
+	return ok && t.IsClass()
+}
+
+// apply validates, authorizes and applies the object in a paragraph
+func (p *Processor) apply(para paragraph, creds auth.Credentials) *Result {
+	result := &Result{Text: para.text, Reason: para.reason}
+	if para.deleted {
+		result.Operation = auth.Delete
+	}
+
+	obj, err := parseObject(para.text)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	result.Object = obj
+
+	old, exists := p.d.Get(obj.Class(), obj.Key())
+	switch {
+	case para.deleted && !exists:
+		result.Errors = append(result.Errors, "object does not exist")
+		return result
+	case para.deleted && len(diff.Objects(old, obj)) > 0:
+		result.Errors = append(result.Errors, "object differs from the version in the database")
+		return result
+	case !para.deleted && exists:
+		result.Operation = auth.Modify
+	}
+	if exists {
+		result.Old = old
+	}
+
+	if !para.deleted {
+		for _, err := range schema.Validate(obj) {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		if len(result.Errors) > 0 {
+			return result
+		}
+		if exists && len(diff.Objects(old, obj)) == 0 {
+			result.NoOp = true
+			return result
+		}
+	}
+
+	result.Auth, err = auth.Check(p.d, result.Operation, obj, creds)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	if !result.Auth.Authorized {
+		result.Errors = append(result.Errors, fmt.Sprintf("authorization for %s failed", result.Label()))
+		return result
+	}
+
+	// the mntners of the old object may be removed by the update, so are
+	// looked up first
+	if exists {
+		result.notify = p.notifyAddresses(old)
+	}
+
+	if para.deleted {
+		p.d.Remove(obj)
+		return result
+	}
+
+	if err := p.d.Add(obj); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		result.notify = nil
+		return result
+	}
+	result.notify = append(result.notify, p.notifyAddresses(obj)...)
+
+	return result
+}
+
+// parseObject parses the single object in a paragraph. The parser stops at
+// attributes it does not support, which would otherwise drop the rest of the
+// object, so every attribute line must be accounted for.
+func parseObject(text string) (*ast.Object, error) {
+	objects, err := parser.Parse("update", text+"\n")
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("expected a single object, found %d", len(objects))
+	}
+	obj := objects[0]
+
+	var attributes []string
+	for _, line := range strings.Split(text, "\n") {
+		if line != "" && !strings.ContainsAny(line[:1], " \t+") {
+			attributes = append(attributes, line)
+		}
+	}
+	if len(attributes) > len(obj.Attributes) {
+		line := attributes[len(obj.Attributes)]
+		return nil, fmt.Errorf("unsupported attribute %s", strings.SplitN(line, ":", 2)[0])
+	}
+
+	return obj, nil
+}
+
+// notifyAddresses returns the notify addresses of an object, and the mnt-nfy
+// addresses of it's mntners
+func (p *Processor) notifyAddresses(obj *ast.Object) []string {
+	addresses := obj.Values(token.ATTR_NOTIFY_EMAIL)
+	for _, name := range obj.Values(token.ATTR_MAINTAINED_BY) {
+		if mntner, ok := p.d.Get(token.CLASS_MAINTAINER, name); ok {
+			addresses = append(addresses, mntner.Values(token.ATTR_MAINTAINER_NOTIFY_EMAIL)...)
+		}
+	}
+
+	return addresses
+}
@@ -0,0 +1,252 @@
+package dbm
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProcessor(t *testing.T) (*Processor, *db.Database, *MemoryOutbox) {
+	d := db.New()
+	if !assert.NoError(t, d.LoadFile("testdata/dbm.db")) {
+		t.FailNow()
+	}
+
+	outbox := &MemoryOutbox{}
+	return NewProcessor(d, "auto-dbm@example.net", outbox), d, outbox
+}
+
+func process(t *testing.T, p *Processor, message string) *Report {
+	report, err := p.Process(strings.NewReader(message))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return report
+}
+
+const update = `From: Test Maintainer <noc@example.com>
+Reply-To: tickets@example.com
+To: auto-dbm@example.net
+Subject: routes
+Date: Mon, 2 Jan 2006 15:04:05 +0000
+Message-ID: <update@example.com>
+
+Hi, please process the objects below.
+
+password: hunter2
+
+route:          198.51.100.0/24
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+
+aut-num:        AS65537
+as-name:        NEW
+admin-c:        TM1-TEST
+tech-c:         TM1-TEST
+notify:         as65537@example.com
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          192.0.2.0/24
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+delete:         no longer announced
+
+route:          203.0.113.0/24
+origin:         AS65537
+country:        NL
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          203.0.113.0/24
+origin:         AS65537
+source:         TEST
+`
+
+func TestProcess(t *testing.T) {
+	p, d, outbox := newProcessor(t)
+	report := process(t, p, update)
+
+	assert.Equal(t, "noc@example.com", report.From)
+	assert.Equal(t, "tickets@example.com", report.ReplyTo)
+	assert.Equal(t, []string{"Hi, please process the objects below."}, report.Ignored)
+	assert.False(t, report.Succeeded())
+
+	type outcome struct {
+		op     auth.Operation
+		label  string
+		errors []string
+	}
+	var outcomes []outcome
+	for _, result := range report.Results {
+		outcomes = append(outcomes, outcome{result.Operation, result.Label(), result.Errors})
+	}
+	assert.Equal(t, []outcome{
+		{auth.Create, "[route] 198.51.100.0/24AS65537", nil},
+		{auth.Modify, "[aut-num] AS65537", nil},
+		{auth.Delete, "[route] 192.0.2.0/24AS65537", nil},
+		{auth.Create, "route:          203.0.113.0/24", []string{"unsupported attribute country"}},
+		{auth.Create, "[route] 203.0.113.0/24AS65537", []string{"mandatory attribute mnt-by is missing"}},
+	}, outcomes)
+	assert.Equal(t, "no longer announced", report.Results[2].Reason)
+
+	_, ok := d.Get(token.CLASS_ROUTE, "198.51.100.0/24AS65537")
+	assert.True(t, ok)
+	_, ok = d.Get(token.CLASS_ROUTE, "192.0.2.0/24AS65537")
+	assert.False(t, ok)
+	aut, _ := d.Get(token.CLASS_AUT_NUM, "AS65537")
+	assert.Equal(t, "NEW", aut.Value(token.ATTR_AS_NAME))
+
+	messages := outbox.Messages()
+	if !assert.Len(t, messages, 3) {
+		t.FailNow()
+	}
+
+	ack := messages[0]
+	assert.Equal(t, "auto-dbm@example.net", ack.From)
+	assert.Equal(t, []string{"tickets@example.com"}, ack.To)
+	assert.Equal(t, "FAILED: routes", ack.Subject)
+	assert.Equal(t, "<update@example.com>", ack.InReplyTo)
+	for _, line := range []string{
+		"Number of objects found:                   5\n",
+		"Number of objects processed successfully:  3\n",
+		"Number of objects processed with errors:   2\n",
+		"Create SUCCEEDED: [route] 198.51.100.0/24AS65537\n",
+		"Modify SUCCEEDED: [aut-num] AS65537\n",
+		"Delete SUCCEEDED: [route] 192.0.2.0/24AS65537\n",
+		"Create FAILED: [route] 203.0.113.0/24AS65537\n",
+		"***Error:   unsupported attribute country\n",
+	} {
+		assert.Contains(t, ack.Body, line)
+	}
+
+	assert.Equal(t, []string{"as65537@example.com"}, messages[1].To)
+	assert.Contains(t, messages[1].Body, "OBJECT BELOW MODIFIED:\n\naut-num:        AS65537\nas-name:        OLD\n")
+	assert.NotContains(t, messages[1].Body, "OBJECT BELOW CREATED")
+
+	assert.Equal(t, []string{"nfy@example.com"}, messages[2].To)
+	assert.Equal(t, 1, strings.Count(messages[2].Body, "OBJECT BELOW CREATED:"))
+	assert.Equal(t, 1, strings.Count(messages[2].Body, "OBJECT BELOW MODIFIED:"))
+	assert.Contains(t, messages[2].Body, "OBJECT BELOW DELETED:\n\nroute:          192.0.2.0/24\n")
+	assert.Contains(t, messages[2].Body, "Reason: no longer announced\n")
+}
+
+func TestProcessFailedAuthorization(t *testing.T) {
+	p, d, outbox := newProcessor(t)
+	report := process(t, p, `From: other@example.org
+Subject: hijack
+
+password: guess
+
+route:          192.0.2.0/24
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+delete:         mine now
+
+aut-num:        AS65537
+as-name:        OLD
+admin-c:        TM1-TEST
+tech-c:         TM1-TEST
+notify:         as65537@example.com
+mnt-by:         TEST-MNT
+source:         TEST
+`)
+
+	if assert.Len(t, report.Results, 2) {
+		assert.Equal(t, []string{"authorization for [route] 192.0.2.0/24AS65537 failed"}, report.Results[0].Errors)
+		assert.True(t, report.Results[1].NoOp)
+	}
+	_, ok := d.Get(token.CLASS_ROUTE, "192.0.2.0/24AS65537")
+	assert.True(t, ok)
+
+	messages := outbox.Messages()
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "FAILED: hijack", messages[0].Subject)
+		assert.Contains(t, messages[0].Body, "            failed: mnt-by of the existing route: TEST-MNT failed\n")
+		assert.Contains(t, messages[0].Body, "Modify No Operation: [aut-num] AS65537\n")
+
+		assert.Equal(t, []string{"upd@example.com"}, messages[1].To)
+		assert.Contains(t, messages[1].Body, "The update was sent by other@example.org.\n")
+		assert.Contains(t, messages[1].Body, "DELETE REQUESTED FOR:\n\nroute:          192.0.2.0/24\n")
+	}
+}
+
+func TestProcessSigned(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"clearsigned", "testdata/clearsigned.eml"},
+		{"PGP/MIME", "testdata/mime.eml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := ioutil.ReadFile(tt.file)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			p, d, outbox := newProcessor(t)
+			report := process(t, p, string(message))
+			assert.Equal(t, "PGPKEY-2C296439", report.KeyCert)
+			assert.Empty(t, report.Warnings)
+			assert.True(t, report.Succeeded())
+
+			aut, _ := d.Get(token.CLASS_AUT_NUM, "AS65537")
+			assert.Equal(t, "SIGNED", aut.Value(token.ATTR_AS_NAME))
+
+			messages := outbox.Messages()
+			if assert.Len(t, messages, 3) {
+				assert.Equal(t, "SUCCESS: update", messages[0].Subject)
+				assert.Contains(t, messages[0].Body, "***Info:    Message signed by PGPKEY-2C296439\n")
+				assert.Contains(t, messages[1].Body, "The update was sent by noc@example.com, signed by PGPKEY-2C296439.\n")
+			}
+		})
+	}
+}
+
+func TestProcessTamperedSignature(t *testing.T) {
+	message, err := ioutil.ReadFile("testdata/clearsigned.eml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	p, d, _ := newProcessor(t)
+	report := process(t, p, strings.Replace(string(message), "as-name:        SIGNED", "as-name:        EVIL", 1))
+	assert.Empty(t, report.KeyCert)
+	if assert.Len(t, report.Warnings, 1) {
+		assert.Contains(t, report.Warnings[0], "PGP signature not verified: invalid signature by PGPKEY-2C296439")
+	}
+	assert.False(t, report.Succeeded())
+
+	aut, _ := d.Get(token.CLASS_AUT_NUM, "AS65537")
+	assert.Equal(t, "OLD", aut.Value(token.ATTR_AS_NAME))
+}
+
+func TestMessageWriteTo(t *testing.T) {
+	m := &Message{
+		From:      "auto-dbm@example.net",
+		To:        []string{"noc@example.com"},
+		Subject:   "SUCCESS: update",
+		InReplyTo: "<update@example.com>",
+		Body:      "line one\nline two\n",
+	}
+
+	var b strings.Builder
+	_, err := m.WriteTo(&b)
+	if assert.NoError(t, err) {
+		assert.Contains(t, b.String(), "To: noc@example.com\r\nSubject: SUCCESS: update\r\n")
+		assert.Contains(t, b.String(), "In-Reply-To: <update@example.com>\r\n")
+		assert.True(t, strings.HasSuffix(b.String(), "\r\n\r\nline one\r\nline two\r\n"))
+	}
+}
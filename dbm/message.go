@@ -0,0 +1,149 @@
+package dbm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/db"
+)
+
+// clearsignHeader begins a PGP clearsigned message
+const clearsignHeader = "-----BEGIN PGP SIGNED MESSAGE-----"
+
+// body is the text of an update message, along with the key-cert of a valid
+// PGP signature over it
+type body struct {
+	text     string
+	keyCert  string
+	warnings []string
+}
+
+// readBody returns the text of a message, verifying any PGP signature. The
+// text of multipart messages is that of the first text/plain part. A message
+// with a signature which cannot be verified is processed as if unsigned, with
+// a warning.
+func readBody(d *db.Database, header mail.Header, r io.Reader) (*body, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading message: %v", err)
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing content type: %v", err)
+	}
+
+	switch {
+	case mediaType == "multipart/signed":
+		signed, err := auth.VerifyMIME(d, contentType, data)
+		if err != nil {
+			b, err := readFirstPart(d, params["boundary"], data)
+			if err != nil {
+				return nil, err
+			}
+			b.warnings = append([]string{"PGP signature not verified: " + signatureError(err)}, b.warnings...)
+			return b, nil
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(signed.Text))
+		if err != nil {
+			return nil, fmt.Errorf("reading signed part: %v", err)
+		}
+		b, err := readBody(d, msg.Header, msg.Body)
+		if err != nil {
+			return nil, err
+		}
+		b.keyCert = signed.KeyCert
+		return b, nil
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return readFirstPart(d, params["boundary"], data)
+	case mediaType != "text/plain":
+		return nil, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+
+	text, err := decode(header.Get("Content-Transfer-Encoding"), data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(text, []byte(clearsignHeader)) {
+		return &body{text: string(text)}, nil
+	}
+
+	signed, err := auth.VerifyClearsigned(d, text)
+	if err != nil {
+		return &body{text: string(text), warnings: []string{"PGP signature not verified: " + err.Error()}}, nil
+	}
+
+	return &body{text: string(signed.Text), keyCert: signed.KeyCert}, nil
+}
+
+// signatureError returns the error of a failed PGP/MIME verification, which
+// is ErrNotSigned if the message does not use PGP
+func signatureError(err error) string {
+	if err == auth.ErrNotSigned {
+		return "unsupported signature protocol"
+	}
+
+	return err.Error()
+}
+
+// readFirstPart returns the text of the first text/plain part of a multipart
+// message
+func readFirstPart(d *db.Database, boundary string, data []byte) (*body, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart message has no boundary")
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("multipart message has no text/plain part")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading multipart message: %v", err)
+		}
+
+		// parts without a content type are text/plain
+		contentType := part.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if contentType == "" || err == nil && (mediaType == "text/plain" || strings.HasPrefix(mediaType, "multipart/")) {
+			return readBody(d, mail.Header(part.Header), part)
+		}
+	}
+}
+
+// decode reverses a Content-Transfer-Encoding
+func decode(encoding string, data []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return data, nil
+	case "quoted-printable":
+		text, err := ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return nil, fmt.Errorf("decoding quoted-printable: %v", err)
+		}
+		return text, nil
+	case "base64":
+		text, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(data)))
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64: %v", err)
+		}
+		return text, nil
+	}
+
+	return nil, fmt.Errorf("unsupported transfer encoding %s", encoding)
+}
@@ -0,0 +1,280 @@
+package dbm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// separator divides the sections of acknowledgements
+const separator = "~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~"
+
+// send writes the acknowledgement of an update to the sender, and the
+// notifications of it's changes and authorization failures
+func (p *Processor) send(report *Report) error {
+	date := time.Now()
+
+	var messages []*Message
+	if report.ReplyTo != "" {
+		status := "FAILED"
+		if report.Succeeded() {
+			status = "SUCCESS"
+		}
+		messages = append(messages, &Message{
+			From:      p.From,
+			To:        []string{report.ReplyTo},
+			Subject:   strings.TrimSpace(status + ": " + report.Subject),
+			Date:      date,
+			InReplyTo: report.MessageID,
+			Body:      acknowledgement(report),
+		})
+	}
+
+	changed := make(map[string][]*Result)
+	rejected := make(map[string][]*Result)
+	for _, result := range report.Results {
+		switch {
+		case result.NoOp:
+		case result.Succeeded():
+			for _, address := range result.notify {
+				address = strings.ToLower(address)
+				changed[address] = appendResult(changed[address], result)
+			}
+		case result.Auth != nil && !result.Auth.Authorized:
+			for _, address := range updTo(result.Auth) {
+				address = strings.ToLower(address)
+				rejected[address] = appendResult(rejected[address], result)
+			}
+		}
+	}
+
+	for _, address := range sortedKeys(changed) {
+		messages = append(messages, &Message{
+			From:    p.From,
+			To:      []string{address},
+			Subject: "Notification of database changes",
+			Date:    date,
+			Body:    changeNotification(report, changed[address]),
+		})
+	}
+	for _, address := range sortedKeys(rejected) {
+		messages = append(messages, &Message{
+			From:    p.From,
+			To:      []string{address},
+			Subject: "Notification of failed authorization",
+			Date:    date,
+			Body:    rejectNotification(report, rejected[address]),
+		})
+	}
+
+	for _, m := range messages {
+		if err := p.Outbox.Send(m); err != nil {
+			return fmt.Errorf("sending to %s: %v", strings.Join(m.To, ", "), err)
+		}
+	}
+
+	return nil
+}
+
+// appendResult adds a result to a notification, unless an address is listed
+// more than once for the same object
+func appendResult(results []*Result, result *Result) []*Result {
+	if len(results) > 0 && results[len(results)-1] == result {
+		return results
+	}
+
+	return append(results, result)
+}
+
+// updTo returns the upd-to addresses of the mntners which failed to authorize
+// an update
+func updTo(result *auth.Result) []string {
+	var addresses []string
+	for _, req := range result.Requirements {
+		if req.Passed {
+			continue
+		}
+		for _, m := range req.Mntners {
+			if m.Object != nil {
+				addresses = append(addresses, m.Object.Values(token.ATTR_UPDATED_TO_EMAIL)...)
+			}
+		}
+	}
+
+	return addresses
+}
+
+func sortedKeys(m map[string][]*Result) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// acknowledgement renders the reply to the sender of an update, summarising
+// the outcome of each object
+func acknowledgement(report *Report) string {
+	var b strings.Builder
+	writeHeaders(&b, report)
+
+	var succeeded, failed []*Result
+	counts := make(map[auth.Operation]int)
+	failures := make(map[auth.Operation]int)
+	noOps := 0
+	for _, result := range report.Results {
+		switch {
+		case !result.Succeeded():
+			failed = append(failed, result)
+			failures[result.Operation]++
+		case result.NoOp:
+			succeeded = append(succeeded, result)
+			noOps++
+		default:
+			succeeded = append(succeeded, result)
+			counts[result.Operation]++
+		}
+	}
+
+	b.WriteString("SUMMARY OF UPDATE:\n\n")
+	fmt.Fprintf(&b, "Number of objects found:                   %d\n", len(report.Results))
+	fmt.Fprintf(&b, "Number of objects processed successfully:  %d\n", len(succeeded))
+	fmt.Fprintf(&b, "  Create:         %d\n", counts[auth.Create])
+	fmt.Fprintf(&b, "  Modify:         %d\n", counts[auth.Modify])
+	fmt.Fprintf(&b, "  Delete:         %d\n", counts[auth.Delete])
+	fmt.Fprintf(&b, "  No Operation:   %d\n", noOps)
+	fmt.Fprintf(&b, "Number of objects processed with errors:   %d\n", len(failed))
+	fmt.Fprintf(&b, "  Create:         %d\n", failures[auth.Create])
+	fmt.Fprintf(&b, "  Modify:         %d\n", failures[auth.Modify])
+	fmt.Fprintf(&b, "  Delete:         %d\n", failures[auth.Delete])
+
+	b.WriteString("\nDETAILED EXPLANATION:\n\n")
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(&b, "***Warning: %s\n", warning)
+	}
+	if report.KeyCert != "" {
+		fmt.Fprintf(&b, "***Info:    Message signed by %s\n", report.KeyCert)
+	}
+	if len(report.Warnings) > 0 || report.KeyCert != "" {
+		b.WriteString("\n")
+	}
+
+	if len(report.Ignored) > 0 {
+		b.WriteString(separator + "\n")
+		b.WriteString("The following paragraph(s) do not look like objects\nand were NOT PROCESSED:\n\n")
+		for _, text := range report.Ignored {
+			b.WriteString(text + "\n\n")
+		}
+	}
+
+	if len(failed) > 0 {
+		b.WriteString(separator + "\n")
+		b.WriteString("The following object(s) were found to have ERRORS:\n\n")
+		for _, result := range failed {
+			fmt.Fprintf(&b, "---\n%s FAILED: %s\n\n", operation(result), result.Label())
+			b.WriteString(result.Text + "\n\n")
+			for _, err := range result.Errors {
+				fmt.Fprintf(&b, "***Error:   %s\n", err)
+			}
+			if result.Auth != nil && !result.Auth.Authorized {
+				for _, req := range result.Auth.Requirements {
+					fmt.Fprintf(&b, "            %s\n", req)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(succeeded) > 0 {
+		b.WriteString(separator + "\n")
+		b.WriteString("The following object(s) were processed SUCCESSFULLY:\n\n")
+		for _, result := range succeeded {
+			status := "SUCCEEDED"
+			if result.NoOp {
+				status = "No Operation"
+			}
+			fmt.Fprintf(&b, "---\n%s %s: %s\n\n", operation(result), status, result.Label())
+		}
+	}
+
+	b.WriteString(separator + "\n")
+	return b.String()
+}
+
+// changeNotification renders the notification of successful changes sent to
+// mnt-nfy and notify addresses
+func changeNotification(report *Report, results []*Result) string {
+	var b strings.Builder
+	b.WriteString("This is to notify you of changes to objects in which you are referenced\n")
+	b.WriteString("by a mnt-nfy or notify attribute.\n\n")
+	fmt.Fprintf(&b, "The update was sent by %s.\n\n", sender(report))
+
+	for _, result := range results {
+		switch result.Operation {
+		case auth.Create:
+			b.WriteString("---\nOBJECT BELOW CREATED:\n\n")
+			b.WriteString(result.Object.String() + "\n")
+		case auth.Modify:
+			b.WriteString("---\nOBJECT BELOW MODIFIED:\n\n")
+			b.WriteString(result.Old.String() + "\n")
+			b.WriteString("REPLACED BY:\n\n")
+			b.WriteString(result.Object.String() + "\n")
+		case auth.Delete:
+			b.WriteString("---\nOBJECT BELOW DELETED:\n\n")
+			b.WriteString(result.Old.String() + "\n")
+			if result.Reason != "" {
+				fmt.Fprintf(&b, "Reason: %s\n\n", result.Reason)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// rejectNotification renders the notification of failed authorization sent
+// to the upd-to addresses of the mntners which did not authorize an update
+func rejectNotification(report *Report, results []*Result) string {
+	var b strings.Builder
+	b.WriteString("This is to notify you that updates of objects maintained by your mntner\n")
+	b.WriteString("were rejected, as they failed authorization.\n\n")
+	fmt.Fprintf(&b, "The update was sent by %s.\n\n", sender(report))
+
+	for _, result := range results {
+		fmt.Fprintf(&b, "---\n%s REQUESTED FOR:\n\n", strings.ToUpper(operation(result)))
+		b.WriteString(result.Object.String() + "\n")
+	}
+
+	return b.String()
+}
+
+// writeHeaders quotes the headers of the update at the top of an
+// acknowledgement
+func writeHeaders(b *strings.Builder, report *Report) {
+	fmt.Fprintf(b, "> From:       %s\n", report.From)
+	fmt.Fprintf(b, "> Subject:    %s\n", report.Subject)
+	fmt.Fprintf(b, "> Date:       %s\n", report.Date)
+	fmt.Fprintf(b, "> Message-ID: %s\n\n", report.MessageID)
+}
+
+// operation names the operation of a result, as used in acknowledgements
+func operation(result *Result) string {
+	op := result.Operation.String()
+	return strings.ToUpper(op[:1]) + op[1:]
+}
+
+func sender(report *Report) string {
+	if report.From == "" {
+		return "an unknown sender"
+	}
+	if report.KeyCert != "" {
+		return fmt.Sprintf("%s, signed by %s", report.From, report.KeyCert)
+	}
+
+	return report.From
+}
@@ -0,0 +1,71 @@
+package dbm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an acknowledgement or notification mail
+type Message struct {
+	From      string
+	To        []string
+	Subject   string
+	Date      time.Time
+	InReplyTo string // the Message-ID of the update, for acknowledgements
+	Body      string
+}
+
+// WriteTo writes the message in RFC 5322 form, such as for handing to a mail
+// transfer agent
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.Date.Format(time.RFC1123Z))
+	if m.InReplyTo != "" {
+		fmt.Fprintf(&buf, "In-Reply-To: %s\r\n", m.InReplyTo)
+		fmt.Fprintf(&buf, "References: %s\r\n", m.InReplyTo)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(m.Body, "\n", "\r\n", -1))
+
+	return buf.WriteTo(w)
+}
+
+// Outbox accepts the messages written while processing updates, such as to
+// queue them for delivery
+type Outbox interface {
+	Send(m *Message) error
+}
+
+// MemoryOutbox keeps the messages sent to it in memory. A MemoryOutbox is
+// safe for concurrent use.
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+// Send adds the message to the outbox
+func (o *MemoryOutbox) Send(m *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, m)
+	return nil
+}
+
+// Messages returns the messages sent to the outbox, oldest first
+func (o *MemoryOutbox) Messages() []*Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]*Message(nil), o.messages...)
+}
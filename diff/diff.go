@@ -0,0 +1,243 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Kind describes how an object or an attribute value changed
+type Kind int
+
+// The kinds of change which may be reported
+const (
+	Added Kind = iota
+	Removed
+	Modified
+)
+
+var kindNames = map[Kind]string{
+	Added:    "added",
+	Removed:  "removed",
+	Modified: "modified",
+}
+
+// String returns the name of the kind of change
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler so that kinds are written by
+// name in JSON output
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Change is a single semantic change to an attribute of an object. Modified
+// changes are only reported for attributes which appear once in both versions
+// of the object, all other changes are reported as an added or removed value.
+type Change struct {
+	Kind      Kind   `json:"kind"`
+	Attribute string `json:"attribute"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+// ObjectDiff describes the changes to a single object, identified by it's
+// class and primary key
+type ObjectDiff struct {
+	Kind    Kind     `json:"kind"`
+	Class   string   `json:"class"`
+	Key     string   `json:"key"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// policyTypes are compared as whole policy expressions, see policyKey
+var policyTypes = map[token.Type]bool{
+	token.ATTR_EXPORT:                    true,
+	token.ATTR_IMPORT:                    true,
+	token.ATTR_MULTI_PROTO_EXPORT_POLICY: true,
+	token.ATTR_MULTI_PROTO_IMPORT_POLICY: true,
+}
+
+// listTypes are compared value by value rather than line by line, so moving a
+// member between lines, or reordering members, is not reported as a change
+var listTypes = map[token.Type]bool{
+	token.ATTR_ADMIN_CONTACT:        true,
+	token.ATTR_AS_SET_MEMBERS:       true,
+	token.ATTR_MAINTAINED_BY:        true,
+	token.ATTR_MAINTAINER_LOWER:     true,
+	token.ATTR_MEMBERS_BY_REFERENCE: true,
+	token.ATTR_MEMBER_OF_ROUTE_SET:  true,
+	token.ATTR_MULTI_PROTO_MEMBERS:  true,
+	token.ATTR_TECHNICAL_CONTACT:    true,
+}
+
+// Key returns the identifier used to match two versions of an object, made up
+// of the object's class and primary key
+func Key(obj *ast.Object) string {
+	return obj.Class().Name() + " " + obj.Key()
+}
+
+// Objects compares two versions of an object attribute by attribute. The
+// comparison ignores the order of attributes, and the order of values within
+// multi-valued attributes.
+func Objects(from, to *ast.Object) []Change {
+	oldValues := attributeValues(from)
+	newValues := attributeValues(to)
+
+	var changes []Change
+	for _, t := range attributeTypes(from, to) {
+		name := t.Name()
+		before, after := oldValues[t], newValues[t]
+
+		if len(before) == 1 && len(after) == 1 && !listTypes[t] {
+			if before[0].key != after[0].key {
+				changes = append(changes, Change{Kind: Modified, Attribute: name, Old: before[0].text, New: after[0].text})
+			}
+			continue
+		}
+
+		for _, v := range subtract(before, after) {
+			changes = append(changes, Change{Kind: Removed, Attribute: name, Old: v.text})
+		}
+		for _, v := range subtract(after, before) {
+			changes = append(changes, Change{Kind: Added, Attribute: name, New: v.text})
+		}
+	}
+
+	return changes
+}
+
+// Databases compares two sets of objects, matching objects by their class and
+// primary key. Objects which have not changed are not included.
+func Databases(from, to []*ast.Object) []ObjectDiff {
+	oldObjects := index(from)
+	newObjects := index(to)
+
+	var keys []string
+	for key := range oldObjects {
+		keys = append(keys, key)
+	}
+	for key := range newObjects {
+		if _, ok := oldObjects[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []ObjectDiff
+	for _, key := range keys {
+		before, after := oldObjects[key], newObjects[key]
+		switch {
+		case before == nil:
+			diffs = append(diffs, ObjectDiff{Kind: Added, Class: after.Class().Name(), Key: key, Changes: Objects(&ast.Object{}, after)})
+		case after == nil:
+			diffs = append(diffs, ObjectDiff{Kind: Removed, Class: before.Class().Name(), Key: key, Changes: Objects(before, &ast.Object{})})
+		default:
+			if changes := Objects(before, after); len(changes) > 0 {
+				diffs = append(diffs, ObjectDiff{Kind: Modified, Class: after.Class().Name(), Key: key, Changes: changes})
+			}
+		}
+	}
+
+	return diffs
+}
+
+func index(objects []*ast.Object) map[string]*ast.Object {
+	idx := make(map[string]*ast.Object, len(objects))
+	for _, obj := range objects {
+		if len(obj.Attributes) > 0 {
+			idx[Key(obj)] = obj
+		}
+	}
+
+	return idx
+}
+
+// value is a single attribute value. Values are compared using their key, a
+// normalized form of the text, but reported using the text as written.
+type value struct {
+	key  string
+	text string
+}
+
+// attributeValues groups the values of an object by attribute type
+func attributeValues(obj *ast.Object) map[token.Type][]value {
+	values := make(map[token.Type][]value)
+	for _, attr := range obj.Attributes {
+		t := attr.Token.Type
+		switch {
+		case policyTypes[t]:
+			text := strings.Join(strings.Fields(strings.Join(attr.Lines(), " ")), " ")
+			values[t] = append(values[t], value{key: policyKey(attr, text), text: text})
+		case listTypes[t]:
+			for _, tok := range valueTokens(attr) {
+				values[t] = append(values[t], value{key: ast.Normalize(tok), text: tok.Literal})
+			}
+		default:
+			var keys []string
+			for _, line := range append([]*ast.Attribute{attr}, attr.Continuations...) {
+				var tokens []string
+				for _, tok := range line.Values {
+					tokens = append(tokens, ast.Normalize(tok))
+				}
+				keys = append(keys, strings.Join(tokens, " "))
+			}
+			text := strings.Join(attr.Lines(), "\n")
+			values[t] = append(values[t], value{key: strings.Join(keys, "\n"), text: text})
+		}
+	}
+
+	return values
+}
+
+// attributeTypes returns the attribute types found in either object, in the
+// order they first appear in the new version followed by any which only
+// appear in the old version
+func attributeTypes(from, to *ast.Object) []token.Type {
+	seen := make(map[token.Type]bool)
+	var types []token.Type
+	for _, obj := range []*ast.Object{to, from} {
+		for _, attr := range obj.Attributes {
+			if t := attr.Token.Type; !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+
+	return types
+}
+
+// subtract returns the values in a which are not in b, respecting duplicates
+func subtract(a, b []value) []value {
+	counts := make(map[string]int)
+	for _, v := range b {
+		counts[v.key]++
+	}
+
+	var result []value
+	for _, v := range a {
+		if counts[v.key] > 0 {
+			counts[v.key]--
+			continue
+		}
+		result = append(result, v)
+	}
+
+	return result
+}
+
+// valueTokens returns the value tokens of the attribute's first line and of
+// each continuation line
+func valueTokens(attr *ast.Attribute) []token.Token {
+	tokens := append([]token.Token{}, attr.Values...)
+	for _, cont := range attr.Continuations {
+		tokens = append(tokens, cont.Values...)
+	}
+
+	return tokens
+}
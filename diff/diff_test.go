@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) []*ast.Object {
+	objects, err := parser.Parse("diff", input)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return objects
+}
+
+func TestObjects(t *testing.T) {
+	old := parse(t, `as-set:         AS-SETTEST
+descr:          description
+members:        AS65538, AS65539
+members:        AS65002
+mnt-by:         TEST-MNT
+source:         TEST
+`)[0]
+
+	new := parse(t, `as-set:         as-settest
+descr:          new description
+members:        AS65002
+members:        AS65539, AS65538, AS65001
+mnt-by:         test-mnt
+source:         TEST
+`)[0]
+
+	assert.Equal(t, []Change{
+		{Kind: Modified, Attribute: "descr", Old: "description", New: "new description"},
+		{Kind: Added, Attribute: "members", New: "AS65001"},
+	}, Objects(old, new))
+}
+
+func TestObjectsPolicy(t *testing.T) {
+	old := parse(t, `aut-num:        AS65537
+as-name:        TEST-AS
+import:         from AS3356 accept ANY
+import:         from AS174 accept ANY
+export:         to AS174 announce AS-SETTEST
+source:         TEST
+`)[0]
+
+	new := parse(t, `aut-num:        AS65537
+as-name:        TEST-AS
+import:         from AS174   accept ANY
+export:         to AS174   announce AS-SETTEST
+source:         TEST
+`)[0]
+
+	changes := Objects(old, new)
+	assert.Equal(t, []Change{
+		{Kind: Removed, Attribute: "import", Old: "from AS3356 accept ANY"},
+	}, changes)
+	assert.Equal(t, "removed import from AS3356 accept ANY", Describe(changes[0]))
+}
+
+func TestObjectsPolicyParsed(t *testing.T) {
+	old := parse(t, `aut-num:        AS65537
+as-name:        TEST-AS
+import:         from AS174 action pref = 100; accept AS-ONE AND (AS-TWO OR {10.0.0.0/8^+})
+export:         to AS174 OR AS3356 announce AS65537 AND NOT AS-ONE
+export:         to AS174 announce AS65537 AND
+mp-import:      afi ipv6 from AS174 accept AS-ONE
+source:         TEST
+`)[0]
+
+	new := parse(t, `aut-num:        AS65537
+as-name:        TEST-AS
+import:         from AS174 action pref = 100; accept ({10.0.0.0/8^+} OR AS-TWO) AND AS-ONE
+export:         to (AS3356 OR AS174) announce (as65537 AND (NOT AS-ONE))
+export:         to AS174   announce as65537 AND
+mp-import:      afi ipv6 from AS174 accept AS-TWO
+source:         TEST
+`)[0]
+
+	// reordered operands, parentheses, case and whitespace are not changes,
+	// and the policy which does not parse is compared by it's text
+	assert.Equal(t, []Change{
+		{Kind: Modified, Attribute: "mp-import", Old: "afi ipv6 from AS174 accept AS-ONE", New: "afi ipv6 from AS174 accept AS-TWO"},
+	}, Objects(old, new))
+}
+
+func TestDatabases(t *testing.T) {
+	old := parse(t, `route:          192.0.02.0/24
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          192.0.2.0/24
+origin:         AS65538
+source:         TEST
+
+as-set:         AS-SETTEST
+members:        AS65538
+source:         TEST
+`)
+
+	new := parse(t, `route:          192.0.2.0/24
+origin:         AS65537
+mnt-by:         TEST-MNT
+source:         TEST
+
+as-set:         AS-SETTEST
+members:        AS65537
+source:         TEST
+
+route6:         2001:db8::/48
+origin:         AS65537
+source:         TEST
+`)
+
+	diffs := Databases(old, new)
+	if !assert.Len(t, diffs, 3) {
+		t.FailNow()
+	}
+
+	var summary bytes.Buffer
+	assert.NoError(t, WriteSummary(&summary, diffs))
+	assert.Equal(t, `as-set AS-SETTEST: removed members AS65538, added members AS65537
+route 192.0.2.0/24AS65538: removed
+route6 2001:db8::/48AS65537: added
+`, summary.String())
+
+	var unified bytes.Buffer
+	assert.NoError(t, WriteUnified(&unified, diffs[:1]))
+	assert.Equal(t, `--- a/as-set AS-SETTEST
++++ b/as-set AS-SETTEST
+-members:        AS65538
++members:        AS65537
+`, unified.String())
+
+	var js bytes.Buffer
+	assert.NoError(t, WriteJSON(&js, diffs[:1]))
+	assert.JSONEq(t, `[{"kind":"modified","class":"as-set","key":"as-set AS-SETTEST","changes":[
+		{"kind":"removed","attribute":"members","old":"AS65538"},
+		{"kind":"added","attribute":"members","new":"AS65537"}]}]`, js.String())
+}
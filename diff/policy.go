@@ -0,0 +1,138 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/policy"
+)
+
+// policyKey returns the key a policy attribute is compared by: a canonical
+// form of the parsed policy, in which the operands of AND and OR are sorted
+// and redundant parentheses are dropped, so policies which only differ in how
+// they are written compare equal. Policies which do not parse are compared by
+// their text, ignoring differences in whitespace and case.
+func policyKey(attr *ast.Attribute, text string) string {
+	p, err := policy.ParseAttribute(attr)
+	if err != nil {
+		return strings.ToUpper(text)
+	}
+
+	var parts []string
+	if p.Protocol != "" {
+		parts = append(parts, "protocol "+p.Protocol)
+	}
+	if p.Into != "" {
+		parts = append(parts, "into "+p.Into)
+	}
+	parts = append(parts, expressionKey(p.Expression))
+
+	return strings.ToUpper(strings.Join(parts, " "))
+}
+
+func expressionKey(e *policy.Expression) string {
+	var parts []string
+	if e.AFI != nil {
+		parts = append(parts, "afi "+strings.Join(e.AFI, ", "))
+	}
+
+	factors := make([]string, len(e.Term))
+	for i, f := range e.Term {
+		factors[i] = factorKey(f)
+	}
+	parts = append(parts, "{"+strings.Join(factors, " ")+"}")
+
+	if e.Next != nil {
+		parts = append(parts, e.Operator, expressionKey(e.Next))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func factorKey(f *policy.Factor) string {
+	var parts []string
+	for _, pa := range f.Peerings {
+		parts = append(parts, "peering "+peeringKey(pa.Peering))
+		for _, a := range pa.Actions {
+			parts = append(parts, "action "+a.String()+";")
+		}
+	}
+	parts = append(parts, "filter "+filterKey(f.Filter)+";")
+
+	return strings.Join(parts, " ")
+}
+
+func peeringKey(p *policy.Peering) string {
+	if p.Set != "" {
+		return p.Set
+	}
+
+	s := setExprKey(p.AS)
+	if p.Remote != nil {
+		s += " " + setExprKey(p.Remote)
+	}
+	if p.Local != nil {
+		s += " at " + setExprKey(p.Local)
+	}
+
+	return s
+}
+
+// setExprKey formats an AS or router expression with the operands of
+// consecutive ANDs or ORs sorted
+func setExprKey(e *policy.SetExpr) string {
+	if e.Operator == "" {
+		return e.Name
+	}
+	if e.Operator != "AND" && e.Operator != "OR" {
+		return "(" + setExprKey(e.Left) + " " + e.Operator + " " + setExprKey(e.Right) + ")"
+	}
+
+	var operands []string
+	var collect func(*policy.SetExpr)
+	collect = func(e *policy.SetExpr) {
+		for _, side := range []*policy.SetExpr{e.Left, e.Right} {
+			if side.Operator == e.Operator {
+				collect(side)
+			} else {
+				operands = append(operands, setExprKey(side))
+			}
+		}
+	}
+	collect(e)
+	sort.Strings(operands)
+
+	return "(" + strings.Join(operands, " "+e.Operator+" ") + ")"
+}
+
+// filterKey formats a filter with the operands of consecutive ANDs or ORs
+// sorted
+func filterKey(f *policy.Filter) string {
+	switch f.Op {
+	case policy.FilterNot:
+		return "NOT " + filterKey(f.Sub[0])
+	case policy.FilterAnd, policy.FilterOr:
+		op := " OR "
+		if f.Op == policy.FilterAnd {
+			op = " AND "
+		}
+
+		var operands []string
+		var collect func(*policy.Filter)
+		collect = func(f *policy.Filter) {
+			for _, sub := range f.Sub {
+				if sub.Op == f.Op {
+					collect(sub)
+				} else {
+					operands = append(operands, filterKey(sub))
+				}
+			}
+		}
+		collect(f)
+		sort.Strings(operands)
+		return "(" + strings.Join(operands, op) + ")"
+	default:
+		return f.String()
+	}
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteUnified writes the differences in a unified diff style, with a header
+// per object followed by the removed and added attribute values
+func WriteUnified(w io.Writer, diffs []ObjectDiff) error {
+	for _, d := range diffs {
+		from, to := "a/"+d.Key, "b/"+d.Key
+		switch d.Kind {
+		case Added:
+			from = "/dev/null"
+		case Removed:
+			to = "/dev/null"
+		}
+
+		if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to); err != nil {
+			return err
+		}
+
+		for _, c := range d.Changes {
+			if c.Kind != Added {
+				if err := writeUnifiedLine(w, "-", c.Attribute, c.Old); err != nil {
+					return err
+				}
+			}
+
+			if c.Kind != Removed {
+				if err := writeUnifiedLine(w, "+", c.Attribute, c.New); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeUnifiedLine(w io.Writer, prefix, name, value string) error {
+	// multi-line values are written with continuation lines, as they would be
+	// in the object
+	lines := strings.Split(value, "\n")
+	if _, err := fmt.Fprintf(w, "%s%-16s%s\n", prefix, name+":", lines[0]); err != nil {
+		return err
+	}
+
+	for _, line := range lines[1:] {
+		if _, err := fmt.Fprintf(w, "%s%-16s%s\n", prefix, "+", line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON writes the differences as a JSON array
+func WriteJSON(w io.Writer, diffs []ObjectDiff) error {
+	if diffs == nil {
+		diffs = []ObjectDiff{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diffs)
+}
+
+// WriteSummary writes a single human readable line per changed object, e.g.
+//
+//	route-set RS-FOO: added members AS65001, removed members AS65002
+func WriteSummary(w io.Writer, diffs []ObjectDiff) error {
+	for _, d := range diffs {
+		var err error
+		switch d.Kind {
+		case Added, Removed:
+			_, err = fmt.Fprintf(w, "%s: %s\n", d.Key, d.Kind)
+		default:
+			descriptions := make([]string, len(d.Changes))
+			for i, c := range d.Changes {
+				descriptions[i] = Describe(c)
+			}
+			_, err = fmt.Fprintf(w, "%s: %s\n", d.Key, strings.Join(descriptions, ", "))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Describe returns a short human readable description of the change, such as
+// "added members AS65001" or "removed import from AS3356 accept ANY"
+func Describe(c Change) string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("added %s %s", c.Attribute, oneLine(c.New))
+	case Removed:
+		return fmt.Sprintf("removed %s %s", c.Attribute, oneLine(c.Old))
+	default:
+		return fmt.Sprintf("changed %s from %s to %s", c.Attribute, oneLine(c.Old), oneLine(c.New))
+	}
+}
+
+func oneLine(value string) string {
+	return strings.Replace(value, "\n", " ", -1)
+}
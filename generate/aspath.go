@@ -0,0 +1,633 @@
+package generate
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// maxRangeSize is the largest range of AS numbers in a class which is
+// expanded for dialects that do not support ranges
+const maxRangeSize = 1024
+
+// originsPerLine is the number of AS numbers written on each line of a Cisco
+// style origin filter, to keep within the line length limits of routers
+const originsPerLine = 16
+
+// ASPathFilter is a named filter which matches the AS path of routes against
+// an RPSL AS path regular expression
+type ASPathFilter struct {
+	Name   string
+	Regexp *aspath.Regexp
+	// Sets holds the AS numbers of each as-set referenced by Regexp
+	Sets map[string][]uint32
+}
+
+// UnsupportedError is returned when an AS path filter uses constructs which
+// can not be expressed in a dialect
+type UnsupportedError struct {
+	Dialect    Dialect
+	Constructs []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s can not express %s", e.Dialect, strings.Join(e.Constructs, ", "))
+}
+
+// NewASPathFilter parses the RPSL AS path regular expression and expands the
+// as-sets it references
+func NewASPathFilter(d *db.Database, name, expr string, opts resolve.Options) (*ASPathFilter, error) {
+	re, err := aspath.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ASPathFilter{Name: name, Regexp: re, Sets: make(map[string][]uint32)}
+	for _, set := range re.Sets() {
+		asns, err := Origins(d, set, opts)
+		if err != nil {
+			return nil, err
+		}
+		f.Sets[set] = asns
+	}
+
+	return f, nil
+}
+
+// Match reports whether the filter matches the AS path, given nearest AS
+// first, of a route received from or sent to the peer AS
+func (f *ASPathFilter) Match(path []uint32, peerAS uint32) bool {
+	return f.Regexp.Match(path, peerAS, f.Sets)
+}
+
+// OriginFilter returns a filter matching routes originated by the AS number
+// or any member of the as-set
+func OriginFilter(d *db.Database, name, object string, opts resolve.Options) (*ASPathFilter, error) {
+	return NewASPathFilter(d, name, "<"+object+"$>", opts)
+}
+
+// Origins expands the as-set or AS number to the sorted AS numbers it
+// contains
+func Origins(d *db.Database, object string, opts resolve.Options) ([]uint32, error) {
+	if setType(strings.ToUpper(object)) != token.CLASS_AS_SET {
+		return nil, fmt.Errorf("%s is not an AS number or as-set", object)
+	}
+
+	result, err := resolve.ASSet(d, object, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	asns := make([]uint32, 0, len(result.Members))
+	for _, value := range result.Values() {
+		asn, err := aspath.ParseASN(value)
+		if err != nil {
+			return nil, err
+		}
+		asns = append(asns, asn)
+	}
+
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+	return asns, nil
+}
+
+// asPathData is passed to the AS path filter templates
+type asPathData struct {
+	Name    string
+	Entries []string // translated expressions
+	Origins []uint32 // set when the filter only matches the origin AS
+}
+
+var asPathFuncs = template.FuncMap{
+	"ident": Identifier,
+	"seq":   func(i int) int { return (i + 1) * 10 },
+	"last":  func(i, n int) bool { return i == n-1 },
+	"join":  joinASNs,
+}
+
+var asPathTemplates = map[Dialect]*template.Template{
+	CiscoIOS: template.Must(template.New("ios").Funcs(asPathFuncs).Parse(
+		`no ip as-path access-list {{.Name}}
+{{range .Entries -}}
+ip as-path access-list {{$.Name}} permit {{.}}
+{{end -}}
+`)),
+	CiscoIOSXR: template.Must(template.New("iosxr").Funcs(asPathFuncs).Parse(
+		`no as-path-set {{.Name}}
+as-path-set {{.Name}}
+{{- if .Origins}}
+{{- range $i, $asn := .Origins}}
+  originates-from '{{$asn}}'{{if not (last $i (len $.Origins))}},{{end}}
+{{- end}}
+{{- else}}
+{{- range $i, $e := .Entries}}
+  ios-regex '{{$e}}'{{if not (last $i (len $.Entries))}},{{end}}
+{{- end}}
+{{- end}}
+end-set
+`)),
+	Juniper: template.Must(template.New("junos").Funcs(asPathFuncs).Parse(
+		`policy-options {
+    replace:
+    as-path-group {{.Name}} {
+{{- range $i, $e := .Entries}}
+        as-path a{{$i}} "{{$e}}";
+{{- end}}
+    }
+}
+`)),
+	Arista: template.Must(template.New("eos").Funcs(asPathFuncs).Parse(
+		`no ip as-path access-list {{.Name}}
+{{range .Entries -}}
+ip as-path access-list {{$.Name}} permit {{.}} any
+{{end -}}
+`)),
+	BIRD: template.Must(template.New("bird").Funcs(asPathFuncs).Parse(
+		`function {{ident .Name}}()
+{
+{{- if .Origins}}
+    return bgp_path.last ~ [ {{join .Origins ", "}} ];
+{{- else}}
+    return {{range $i, $e := .Entries}}{{if $i}} || {{end}}bgp_path ~ {{$e}}{{end}};
+{{- end}}
+}
+`)),
+	FRR: template.Must(template.New("frr").Funcs(asPathFuncs).Parse(
+		`no bgp as-path access-list {{.Name}}
+{{range $i, $e := .Entries -}}
+bgp as-path access-list {{$.Name}} seq {{seq $i}} permit {{$e}}
+{{end -}}
+`)),
+	OpenBGPD: template.Must(template.New("openbgpd").Funcs(asPathFuncs).Parse(
+		`{{if .Origins}}as-set {{.Name}} { {{join .Origins " "}} }
+{{end -}}
+{{ident .Name}}_match = "{{index .Entries 0}}"
+`)),
+}
+
+// Write writes the filter in the configuration language of the dialect. An
+// *UnsupportedError is returned if the regular expression can not be
+// expressed in the dialect, in which case nothing is written.
+func (f *ASPathFilter) Write(w io.Writer, dialect Dialect) error {
+	t, ok := asPathTemplates[dialect]
+	if !ok {
+		return fmt.Errorf("AS path filters are not supported for %s", dialect)
+	}
+
+	tr := &translator{sets: f.Sets}
+	data := asPathData{Name: f.Name}
+
+	switch dialect {
+	case CiscoIOS, CiscoIOSXR, Arista, FRR:
+		if origins, ok := tr.origins(f.Regexp); ok && dialect != CiscoIOSXR {
+			data.Entries = ciscoOrigins(origins)
+		} else if ok {
+			data.Origins = origins
+		} else {
+			data.Entries = tr.branches(f.Regexp, tr.cisco)
+		}
+	case Juniper:
+		data.Entries = tr.branches(f.Regexp, tr.junos)
+	case BIRD:
+		if origins, ok := tr.origins(f.Regexp); ok {
+			data.Origins = origins
+		} else {
+			data.Entries = tr.branches(f.Regexp, tr.bird)
+		}
+	case OpenBGPD:
+		data.Entries, data.Origins = tr.openbgpd(f.Name, f.Regexp)
+	}
+
+	if len(tr.unsupported) > 0 {
+		return &UnsupportedError{Dialect: dialect, Constructs: tr.unsupported}
+	}
+
+	return t.Execute(w, data)
+}
+
+// translator converts an RPSL AS path regular expression into a dialect,
+// recording the constructs which the dialect can not express
+type translator struct {
+	sets        map[string][]uint32
+	unsupported []string
+}
+
+func (tr *translator) unsupport(construct string) string {
+	for _, existing := range tr.unsupported {
+		if existing == construct {
+			return ""
+		}
+	}
+
+	tr.unsupported = append(tr.unsupported, construct)
+	return ""
+}
+
+// branches translates each alternative of a top level alternation
+// separately, so that each can be anchored independently
+func (tr *translator) branches(re *aspath.Regexp, translate func(*aspath.Regexp) string) []string {
+	if re.Op != aspath.OpAlternate {
+		return []string{translate(re)}
+	}
+
+	var entries []string
+	for _, sub := range re.Sub {
+		entries = append(entries, translate(sub))
+	}
+
+	return entries
+}
+
+// origins returns the AS numbers matched by a filter of the form
+// <X$>, where X is an AS number, as-set or class
+func (tr *translator) origins(re *aspath.Regexp) ([]uint32, bool) {
+	if re.Op != aspath.OpConcat || len(re.Sub) != 2 || re.Sub[1].Op != aspath.OpEnd {
+		return nil, false
+	}
+
+	switch re.Sub[0].Op {
+	case aspath.OpASN, aspath.OpSet, aspath.OpClass:
+		asns, ok := tr.asns(re.Sub[0])
+		return asns, ok && len(asns) > 0
+	}
+
+	return nil, false
+}
+
+// asns returns the AS numbers matched by a single AS number, set, or class
+// which is not negated
+func (tr *translator) asns(re *aspath.Regexp) ([]uint32, bool) {
+	switch re.Op {
+	case aspath.OpASN:
+		return []uint32{re.ASN}, true
+	case aspath.OpSet:
+		asns, ok := tr.sets[re.Name]
+		return asns, ok
+	case aspath.OpRange:
+		if re.High-re.ASN >= maxRangeSize {
+			return nil, false
+		}
+		var asns []uint32
+		for asn := re.ASN; asn <= re.High && asn >= re.ASN; asn++ {
+			asns = append(asns, asn)
+		}
+		return asns, true
+	case aspath.OpClass:
+		if re.Negated {
+			return nil, false
+		}
+		var asns []uint32
+		for _, sub := range re.Sub {
+			items, ok := tr.asns(sub)
+			if !ok {
+				return nil, false
+			}
+			asns = append(asns, items...)
+		}
+		return uniqueASNs(asns), true
+	}
+
+	return nil, false
+}
+
+// alternatives returns the AS numbers matched by an AS number, set or class
+// as a regular expression alternation, recording it as unsupported when it
+// can not be expanded
+func (tr *translator) alternatives(re *aspath.Regexp, sep string) string {
+	asns, ok := tr.asns(re)
+	switch {
+	case !ok && re.Op == aspath.OpClass && re.Negated:
+		return tr.unsupport("negated class " + re.String())
+	case !ok && re.Op == aspath.OpSet:
+		return tr.unsupport("unexpanded as-set " + re.Name)
+	case !ok:
+		return tr.unsupport("AS number range in " + re.String())
+	case len(asns) == 0:
+		return tr.unsupport("empty " + re.String())
+	case len(asns) == 1:
+		return strconv.FormatUint(uint64(asns[0]), 10)
+	}
+
+	return "(" + joinASNs(asns, sep) + ")"
+}
+
+// cisco translates an expression into a Cisco style regular expression over
+// the textual AS path, e.g. "65537 65538". Each AS number is followed by an _
+// which matches the following space or the end of the path, and a leading _
+// prevents partial matches of unanchored expressions.
+func (tr *translator) cisco(re *aspath.Regexp) string {
+	s := tr.ciscoNode(re)
+	if !beginsAnchored(re) {
+		s = "_" + s
+	}
+
+	return s
+}
+
+func (tr *translator) ciscoNode(re *aspath.Regexp) string {
+	switch re.Op {
+	case aspath.OpASN, aspath.OpSet, aspath.OpClass:
+		return tr.alternatives(re, "|") + "_"
+	case aspath.OpAny:
+		return "[0-9]+_"
+	case aspath.OpBegin:
+		return "^"
+	case aspath.OpEnd:
+		return "$"
+	case aspath.OpPeerAS:
+		return tr.unsupport("PeerAS")
+	case aspath.OpConcat:
+		var b strings.Builder
+		for _, sub := range re.Sub {
+			b.WriteString(tr.ciscoNode(sub))
+		}
+		return b.String()
+	case aspath.OpAlternate:
+		items := make([]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			items[i] = tr.ciscoNode(sub)
+		}
+		return "(" + strings.Join(items, "|") + ")"
+	case aspath.OpRepeat:
+		if re.Same && !singleASN(re.Sub[0]) {
+			return tr.unsupport("same-AS repetition " + re.String())
+		}
+
+		// Cisco regular expressions have no {m,n} operator, so bounded
+		// repetitions are written out in full
+		sub := "(" + tr.ciscoNode(re.Sub[0]) + ")"
+		var b strings.Builder
+		for i := 0; i < re.Min; i++ {
+			b.WriteString(sub)
+		}
+		switch {
+		case re.Max == -1 && re.Min > 0:
+			b.WriteString(sub + "*")
+		case re.Max == -1:
+			return sub + "*"
+		default:
+			for i := re.Min; i < re.Max; i++ {
+				b.WriteString(sub + "?")
+			}
+		}
+		return b.String()
+	}
+
+	return ""
+}
+
+// junos translates an expression into a Junos AS path regular expression.
+// Junos expressions operate on whole AS numbers and must match the entire
+// path, so unanchored expressions are padded with .*
+func (tr *translator) junos(re *aspath.Regexp) string {
+	items := []*aspath.Regexp{re}
+	if re.Op == aspath.OpConcat {
+		items = re.Sub
+	}
+
+	s := tr.junosNode(re)
+	if !beginsAnchored(re) && !anyPath(items[0]) {
+		s = ".* " + s
+	}
+	if !endsAnchored(re) && !anyPath(items[len(items)-1]) {
+		s += " .*"
+	}
+
+	return strings.TrimSpace(s)
+}
+
+func (tr *translator) junosNode(re *aspath.Regexp) string {
+	switch re.Op {
+	case aspath.OpASN, aspath.OpSet:
+		return tr.alternatives(re, "|")
+	case aspath.OpClass:
+		if re.Negated {
+			return tr.unsupport("negated class " + re.String())
+		}
+		// Junos supports ranges of AS numbers directly
+		var items []string
+		for _, sub := range re.Sub {
+			if sub.Op == aspath.OpRange {
+				items = append(items, fmt.Sprintf("%d-%d", sub.ASN, sub.High))
+			} else if s := tr.alternatives(sub, "|"); s != "" {
+				items = append(items, strings.Trim(s, "()"))
+			}
+		}
+		if len(items) == 1 && !strings.Contains(items[0], "|") {
+			return items[0]
+		}
+		return "(" + strings.Join(items, "|") + ")"
+	case aspath.OpAny:
+		return "."
+	case aspath.OpBegin, aspath.OpEnd:
+		return ""
+	case aspath.OpPeerAS:
+		return tr.unsupport("PeerAS")
+	case aspath.OpConcat:
+		var items []string
+		for _, sub := range re.Sub {
+			if s := tr.junosNode(sub); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, " ")
+	case aspath.OpAlternate:
+		items := make([]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			items[i] = tr.junosNode(sub)
+		}
+		return "(" + strings.Join(items, " | ") + ")"
+	case aspath.OpRepeat:
+		if re.Same && !singleASN(re.Sub[0]) {
+			return tr.unsupport("same-AS repetition " + re.String())
+		}
+
+		sub := tr.junosNode(re.Sub[0])
+		if re.Sub[0].Op == aspath.OpConcat {
+			sub = "(" + sub + ")"
+		}
+		return sub + strings.TrimPrefix(re.Operator(), "~")
+	}
+
+	return ""
+}
+
+// bird translates an expression into a BIRD path mask, such as
+// [= * 65537 ? =]. Path masks only support AS numbers, sets of AS numbers, ?
+// for any single AS number and * for any sequence of AS numbers.
+func (tr *translator) bird(re *aspath.Regexp) string {
+	items := []*aspath.Regexp{re}
+	if re.Op == aspath.OpConcat {
+		items = re.Sub
+	}
+
+	var mask []string
+	if !beginsAnchored(re) {
+		mask = append(mask, "*")
+	}
+
+	for _, item := range items {
+		switch item.Op {
+		case aspath.OpBegin, aspath.OpEnd:
+		case aspath.OpASN:
+			mask = append(mask, strconv.FormatUint(uint64(item.ASN), 10))
+		case aspath.OpSet, aspath.OpClass:
+			asns, ok := tr.asns(item)
+			if !ok || len(asns) == 0 {
+				tr.alternatives(item, ", ")
+				continue
+			}
+			mask = append(mask, "[ "+joinASNs(asns, ", ")+" ]")
+		case aspath.OpAny:
+			mask = append(mask, "?")
+		case aspath.OpRepeat:
+			if item.Sub[0].Op != aspath.OpAny || item.Same {
+				tr.unsupport("repetition " + item.String())
+				continue
+			}
+			for i := 0; i < item.Min; i++ {
+				mask = append(mask, "?")
+			}
+			if item.Max == -1 {
+				mask = append(mask, "*")
+			} else if item.Max > item.Min {
+				tr.unsupport("bounded repetition " + item.String())
+			}
+		case aspath.OpPeerAS:
+			tr.unsupport("PeerAS")
+		default:
+			tr.unsupport("nested " + item.String())
+		}
+	}
+
+	if !endsAnchored(re) {
+		mask = append(mask, "*")
+	}
+
+	return "[= " + strings.Join(mask, " ") + " =]"
+}
+
+// openbgpd translates an expression into an OpenBGPD filter match. Only a
+// single AS number or set is supported, which is matched as the peer AS when
+// anchored to the beginning, the source AS when anchored to the end, or
+// anywhere in the path otherwise.
+func (tr *translator) openbgpd(name string, re *aspath.Regexp) ([]string, []uint32) {
+	items := []*aspath.Regexp{re}
+	if re.Op == aspath.OpConcat {
+		items = re.Sub
+	}
+
+	begin, end := beginsAnchored(re), endsAnchored(re)
+	var terms []*aspath.Regexp
+	for _, item := range items {
+		if item.Op != aspath.OpBegin && item.Op != aspath.OpEnd {
+			terms = append(terms, item)
+		}
+	}
+
+	if len(terms) != 1 || begin && end {
+		tr.unsupport(re.String())
+		return nil, nil
+	}
+
+	keyword := "AS"
+	switch {
+	case begin:
+		keyword = "peer-as"
+	case end:
+		keyword = "source-as"
+	}
+
+	switch terms[0].Op {
+	case aspath.OpASN:
+		return []string{fmt.Sprintf("%s %d", keyword, terms[0].ASN)}, nil
+	case aspath.OpSet, aspath.OpClass:
+		asns, ok := tr.asns(terms[0])
+		if !ok || len(asns) == 0 {
+			tr.alternatives(terms[0], " ")
+			return nil, nil
+		}
+		return []string{fmt.Sprintf("%s as-set %s", keyword, name)}, asns
+	}
+
+	tr.unsupport(terms[0].String())
+	return nil, nil
+}
+
+// ciscoOrigins returns Cisco style regular expressions matching routes
+// originated by any of the AS numbers
+func ciscoOrigins(asns []uint32) []string {
+	var entries []string
+	for i := 0; i < len(asns); i += originsPerLine {
+		end := i + originsPerLine
+		if end > len(asns) {
+			end = len(asns)
+		}
+
+		if end-i == 1 {
+			entries = append(entries, fmt.Sprintf("_%d$", asns[i]))
+		} else {
+			entries = append(entries, "_("+joinASNs(asns[i:end], "|")+")$")
+		}
+	}
+
+	return entries
+}
+
+// beginsAnchored reports whether the expression starts with ^
+func beginsAnchored(re *aspath.Regexp) bool {
+	if re.Op == aspath.OpConcat {
+		return re.Sub[0].Op == aspath.OpBegin
+	}
+
+	return re.Op == aspath.OpBegin
+}
+
+// endsAnchored reports whether the expression ends with $
+func endsAnchored(re *aspath.Regexp) bool {
+	if re.Op == aspath.OpConcat {
+		return re.Sub[len(re.Sub)-1].Op == aspath.OpEnd
+	}
+
+	return re.Op == aspath.OpEnd
+}
+
+// anyPath reports whether the expression is .*, matching any sequence of AS
+// numbers
+func anyPath(re *aspath.Regexp) bool {
+	return re.Op == aspath.OpRepeat && re.Min == 0 && re.Max == -1 && re.Sub[0].Op == aspath.OpAny
+}
+
+func singleASN(re *aspath.Regexp) bool {
+	return re.Op == aspath.OpASN
+}
+
+func uniqueASNs(asns []uint32) []uint32 {
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+
+	var result []uint32
+	for i, asn := range asns {
+		if i == 0 || asn != asns[i-1] {
+			result = append(result, asn)
+		}
+	}
+
+	return result
+}
+
+func joinASNs(asns []uint32, sep string) string {
+	items := make([]string, len(asns))
+	for i, asn := range asns {
+		items[i] = strconv.FormatUint(uint64(asn), 10)
+	}
+
+	return strings.Join(items, sep)
+}
@@ -0,0 +1,85 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrigins(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+
+	asns, err := Origins(d, "as-test", resolve.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint32{65537, 65538}, asns)
+	}
+
+	_, err = Origins(d, "RS-TEST", resolve.Options{})
+	assert.EqualError(t, err, "RS-TEST is not an AS number or as-set")
+}
+
+func TestASPathFilterWrite(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+
+	filters := map[string]string{
+		"origin":    "<AS-TEST$>",
+		"transit":   "<^AS65537 .* AS65538$>",
+		"regex":     "<^AS65537+ [AS65538 AS64496-AS64497]{1,2} .*>",
+		"alternate": "<^AS65537 | AS-TEST $>",
+	}
+
+	for name, expr := range filters {
+		f, err := NewASPathFilter(d, "AS-PATH-TEST", expr, resolve.Options{})
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+
+		for _, dialect := range Dialects() {
+			var buf bytes.Buffer
+			err := f.Write(&buf, dialect)
+			if _, ok := err.(*UnsupportedError); ok {
+				buf.WriteString(err.Error() + "\n")
+			} else if !assert.NoError(t, err, "%s %s", expr, dialect) {
+				continue
+			}
+
+			golden(t, fmt.Sprintf("aspath-%s-%s", name, dialect), buf.Bytes())
+		}
+	}
+}
+
+func TestASPathFilterUnsupported(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		expr     string
+		dialect  Dialect
+		expected string
+	}{
+		{"<[^AS65537] $>", CiscoIOS, "ios can not express negated class <[^AS65537]>"},
+		{"<^PeerAS>", Juniper, "junos can not express PeerAS"},
+		{"<(AS1 AS2)~*>", FRR, "frr can not express same-AS repetition <(AS1 AS2)~*>"},
+		{"<^AS1 AS2* $>", BIRD, "bird can not express repetition <AS2*>"},
+		{"<^AS1 AS2 $>", OpenBGPD, "openbgpd can not express <^ AS1 AS2 $>"},
+	}
+
+	for _, tt := range tests {
+		f, err := NewASPathFilter(d, "TEST", tt.expr, resolve.Options{})
+		if !assert.NoError(t, err, tt.expr) {
+			continue
+		}
+
+		var buf bytes.Buffer
+		assert.EqualError(t, f.Write(&buf, tt.dialect), tt.expected, tt.expr)
+		assert.Empty(t, buf.String())
+	}
+}
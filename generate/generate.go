@@ -0,0 +1,134 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Dialect is the configuration language of a router or routing daemon which
+// filters are generated for
+type Dialect int
+
+const (
+	// CiscoIOS generates ip prefix-list and ip as-path access-list commands
+	CiscoIOS Dialect = iota
+	// CiscoIOSXR generates prefix-set and as-path-set RPL
+	CiscoIOSXR
+	// Juniper generates Junos policy-options
+	Juniper
+	// Arista generates EOS configuration
+	Arista
+	// BIRD generates BIRD filter language definitions
+	BIRD
+	// FRR generates FRRouting configuration
+	FRR
+	// OpenBGPD generates bgpd.conf sets
+	OpenBGPD
+)
+
+var dialectNames = map[Dialect]string{
+	CiscoIOS:   "ios",
+	CiscoIOSXR: "iosxr",
+	Juniper:    "junos",
+	Arista:     "eos",
+	BIRD:       "bird",
+	FRR:        "frr",
+	OpenBGPD:   "openbgpd",
+}
+
+// Dialects returns every supported dialect
+func Dialects() []Dialect {
+	return []Dialect{CiscoIOS, CiscoIOSXR, Juniper, Arista, BIRD, FRR, OpenBGPD}
+}
+
+// ParseDialect returns the dialect with the given name, e.g. ios or junos
+func ParseDialect(name string) (Dialect, error) {
+	for dialect, n := range dialectNames {
+		if strings.EqualFold(n, name) {
+			return dialect, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown dialect %q", name)
+}
+
+func (d Dialect) String() string {
+	if name, ok := dialectNames[d]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// Prefixes expands the as-set, route-set or AS number to the prefix ranges it
+// contains for a single address family. AS numbers and the members of as-sets
+// are expanded to the routes they originate, leaving out any rejected by
+// opts.Filter. The result is sorted, and ranges which are covered by another
+// range are removed.
+func Prefixes(d *db.Database, object string, ipv6 bool, opts resolve.Options) ([]prefix.Range, error) {
+	object = strings.ToUpper(object)
+
+	var ranges []prefix.Range
+	switch setType(object) {
+	case token.CLASS_ROUTE_SET:
+		result, err := resolve.RouteSet(d, object, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range result.Ranges() {
+			if prefix.IsIPv4(r.Prefix) != ipv6 {
+				ranges = append(ranges, r)
+			}
+		}
+	case token.CLASS_AS_SET:
+		result, err := resolve.ASSet(d, object, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		class := token.CLASS_ROUTE
+		if ipv6 {
+			class = token.CLASS_ROUTE6
+		}
+
+		for _, asn := range result.Values() {
+			for _, route := range d.ByOrigin(asn) {
+				if route.Class() != class || opts.Filter != nil && !opts.Filter(route) {
+					continue
+				}
+
+				ipnet, err := prefix.Parse(route.Name())
+				if err != nil {
+					return nil, err
+				}
+				ranges = append(ranges, prefix.NewRange(ipnet))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s is not an AS number, as-set or route-set", object)
+	}
+
+	return prefix.Compact(ranges), nil
+}
+
+// setType returns the class of object named, with AS numbers treated as an
+// as-set with a single member
+func setType(name string) token.Type {
+	if lexer.IsASN(name) {
+		return token.CLASS_AS_SET
+	}
+
+	switch class := lexer.SetClass(name); class {
+	case token.CLASS_AS_SET, token.CLASS_ROUTE_SET:
+		return class
+	}
+
+	return token.ILLEGAL
+}
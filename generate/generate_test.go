@@ -0,0 +1,128 @@
+package generate
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares the output with the named golden file, or updates the file
+// when the -update flag is set
+func golden(t *testing.T, name string, output []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(expected), string(output), name)
+	}
+}
+
+func ranges(values ...string) []prefix.Range {
+	result := make([]prefix.Range, len(values))
+	for i, v := range values {
+		r, err := prefix.ParseRange(v)
+		if err != nil {
+			panic(err)
+		}
+		result[i] = r
+	}
+
+	return result
+}
+
+func rangeStrings(ranges []prefix.Range) []string {
+	result := make([]string, len(ranges))
+	for i, r := range ranges {
+		result[i] = r.String()
+	}
+
+	return result
+}
+
+func TestPrefixes(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		object   string
+		ipv6     bool
+		expected []string
+	}{
+		{"AS65537", false, []string{"10.0.0.0/8"}},
+		{"as-test", false, []string{"10.0.0.0/8", "10.1.0.0/16", "192.0.2.128/25"}},
+		{"AS-TEST", true, []string{"2001:db8::/32", "2001:db8:ffff::/48"}},
+		{"RS-TEST", false, []string{"10.0.0.0/8", "192.0.2.0/24^+", "198.51.100.0/24^25-26"}},
+		{"RS-TEST", true, []string{"2001:db8::/32^48"}},
+	}
+
+	for _, tt := range tests {
+		result, err := Prefixes(d, tt.object, tt.ipv6, resolve.Options{})
+		if assert.NoError(t, err, tt.object) {
+			assert.Equal(t, tt.expected, rangeStrings(result), "%s ipv6=%t", tt.object, tt.ipv6)
+		}
+	}
+
+	_, err = Prefixes(d, "RS-MISSING", false, resolve.Options{})
+	assert.EqualError(t, err, "route-set RS-MISSING not found")
+
+	_, err = Prefixes(d, "TEST-MNT", false, resolve.Options{})
+	assert.EqualError(t, err, "TEST-MNT is not an AS number, as-set or route-set")
+}
+
+func TestPrefixListWrite(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+
+	for _, ipv6 := range []bool{false, true} {
+		result, err := Prefixes(d, "RS-TEST", ipv6, resolve.Options{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		lists := map[string]*PrefixList{
+			"":       {Name: "RS-TEST", IPv6: ipv6, Ranges: result},
+			"-empty": {Name: "EMPTY", IPv6: ipv6},
+		}
+
+		for suffix, list := range lists {
+			if ipv6 {
+				suffix += "-ipv6"
+			}
+
+			for _, dialect := range Dialects() {
+				var buf bytes.Buffer
+				if assert.NoError(t, list.Write(&buf, dialect)) {
+					golden(t, fmt.Sprintf("prefixlist-%s%s", dialect, suffix), buf.Bytes())
+				}
+			}
+		}
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	for _, dialect := range Dialects() {
+		parsed, err := ParseDialect(dialect.String())
+		assert.NoError(t, err)
+		assert.Equal(t, dialect, parsed)
+	}
+
+	_, err := ParseDialect("quagga")
+	assert.EqualError(t, err, `unknown dialect "quagga"`)
+}
@@ -0,0 +1,205 @@
+package generate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/kkirsche/rpsl/prefix"
+)
+
+// PrefixList is a named list of prefix ranges for a single address family
+type PrefixList struct {
+	Name   string
+	IPv6   bool
+	Ranges []prefix.Range
+}
+
+// prefixListData is passed to the prefix list templates
+type prefixListData struct {
+	*PrefixList
+	Family string // ip or ipv6
+	Any    string // the range matching every prefix of the family
+}
+
+var prefixListFuncs = template.FuncMap{
+	"cisco":    ciscoRange,
+	"junos":    junosRange,
+	"bird":     birdRange,
+	"ident":    Identifier,
+	"openbgpd": openbgpdRange,
+	"seq":      func(i int) int { return (i + 1) * 10 },
+	"last":     func(i int, ranges []prefix.Range) bool { return i == len(ranges)-1 },
+	"exact":    allExact,
+}
+
+var prefixListTemplates = map[Dialect]*template.Template{
+	CiscoIOS: template.Must(template.New("ios").Funcs(prefixListFuncs).Parse(
+		`no {{.Family}} prefix-list {{.Name}}
+{{range .Ranges -}}
+{{$.Family}} prefix-list {{$.Name}} permit {{cisco .}}
+{{else -}}
+! {{.Name}} is empty
+{{.Family}} prefix-list {{.Name}} deny {{.Any}}
+{{end -}}
+`)),
+	CiscoIOSXR: template.Must(template.New("iosxr").Funcs(prefixListFuncs).Parse(
+		`no prefix-set {{.Name}}
+prefix-set {{.Name}}
+{{- range $i, $r := .Ranges}}
+  {{cisco $r}}{{if not (last $i $.Ranges)}},{{end}}
+{{- end}}
+end-set
+`)),
+	Juniper: template.Must(template.New("junos").Funcs(prefixListFuncs).Parse(
+		`policy-options {
+    replace:
+{{- if exact .Ranges}}
+    prefix-list {{.Name}} {
+{{- range .Ranges}}
+        {{.Prefix}};
+{{- end}}
+    }
+{{- else}}
+    route-filter-list {{.Name}} {
+{{- range .Ranges}}
+        {{junos .}};
+{{- end}}
+    }
+{{- end}}
+}
+`)),
+	Arista: template.Must(template.New("eos").Funcs(prefixListFuncs).Parse(
+		`no {{.Family}} prefix-list {{.Name}}
+{{.Family}} prefix-list {{.Name}}
+{{- range $i, $r := .Ranges}}
+   seq {{seq $i}} permit {{cisco $r}}
+{{- else}}
+   seq 10 deny {{.Any}}
+{{- end}}
+`)),
+	BIRD: template.Must(template.New("bird").Funcs(prefixListFuncs).Parse(
+		`define {{ident .Name}} = [
+{{- range $i, $r := .Ranges}}
+    {{bird $r}}{{if not (last $i $.Ranges)}},{{end}}
+{{- end}}
+];
+`)),
+	FRR: template.Must(template.New("frr").Funcs(prefixListFuncs).Parse(
+		`no {{.Family}} prefix-list {{.Name}}
+{{range $i, $r := .Ranges -}}
+{{$.Family}} prefix-list {{$.Name}} seq {{seq $i}} permit {{cisco $r}}
+{{else -}}
+{{.Family}} prefix-list {{.Name}} seq 10 deny {{.Any}}
+{{end -}}
+`)),
+	OpenBGPD: template.Must(template.New("openbgpd").Funcs(prefixListFuncs).Parse(
+		`prefix-set {{.Name}} {
+{{- range .Ranges}}
+	{{openbgpd .}}
+{{- end}}
+}
+`)),
+}
+
+// Write writes the prefix list in the configuration language of the dialect.
+// Lists are written so that they replace any existing list with the same name.
+func (l *PrefixList) Write(w io.Writer, dialect Dialect) error {
+	t, ok := prefixListTemplates[dialect]
+	if !ok {
+		return fmt.Errorf("prefix lists are not supported for %s", dialect)
+	}
+
+	data := prefixListData{PrefixList: l, Family: "ip", Any: "0.0.0.0/0 le 32"}
+	if l.IPv6 {
+		data.Family, data.Any = "ipv6", "::/0 le 128"
+	}
+
+	return t.Execute(w, data)
+}
+
+// ciscoRange formats the range using the ge and le keywords used by Cisco,
+// Arista and FRR
+func ciscoRange(r prefix.Range) string {
+	ones, bits := r.Prefix.Mask.Size()
+
+	switch {
+	case r.Min == ones && r.Max == ones:
+		return r.Prefix.String()
+	case r.Min == ones:
+		return fmt.Sprintf("%s le %d", r.Prefix, r.Max)
+	case r.Max == bits:
+		return fmt.Sprintf("%s ge %d", r.Prefix, r.Min)
+	default:
+		return fmt.Sprintf("%s ge %d le %d", r.Prefix, r.Min, r.Max)
+	}
+}
+
+// junosRange formats the range as a Junos route-filter
+func junosRange(r prefix.Range) string {
+	ones, bits := r.Prefix.Mask.Size()
+
+	switch {
+	case r.Min == ones && r.Max == ones:
+		return fmt.Sprintf("%s exact", r.Prefix)
+	case r.Min == ones && r.Max == bits:
+		return fmt.Sprintf("%s orlonger", r.Prefix)
+	case r.Min == ones+1 && r.Max == bits:
+		return fmt.Sprintf("%s longer", r.Prefix)
+	case r.Min == ones:
+		return fmt.Sprintf("%s upto /%d", r.Prefix, r.Max)
+	default:
+		return fmt.Sprintf("%s prefix-length-range /%d-/%d", r.Prefix, r.Min, r.Max)
+	}
+}
+
+// birdRange formats the range as a BIRD prefix pattern
+func birdRange(r prefix.Range) string {
+	ones, bits := r.Prefix.Mask.Size()
+
+	switch {
+	case r.Min == ones && r.Max == ones:
+		return r.Prefix.String()
+	case r.Min == ones && r.Max == bits:
+		return r.Prefix.String() + "+"
+	default:
+		return fmt.Sprintf("%s{%d,%d}", r.Prefix, r.Min, r.Max)
+	}
+}
+
+// openbgpdRange formats the range as an OpenBGPD prefix-set item
+func openbgpdRange(r prefix.Range) string {
+	ones, bits := r.Prefix.Mask.Size()
+
+	switch {
+	case r.Min == ones && r.Max == ones:
+		return r.Prefix.String()
+	case r.Min == ones && r.Max == bits:
+		return fmt.Sprintf("%s or-longer", r.Prefix)
+	default:
+		return fmt.Sprintf("%s prefixlen %d - %d", r.Prefix, r.Min, r.Max)
+	}
+}
+
+// Identifier replaces the characters which are not permitted in BIRD symbol
+// and OpenBGPD macro names, such as the hyphens in set names, with underscores
+func Identifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func allExact(ranges []prefix.Range) bool {
+	for _, r := range ranges {
+		if !r.Exact() {
+			return false
+		}
+	}
+
+	return true
+}
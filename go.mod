@@ -1,9 +1,17 @@
 module github.com/kkirsche/rpsl
 
-go 1.12
+go 1.23.0
 
 require (
-	github.com/kkirsche/monkey v0.0.0-20190731140858-53142c5a18a5 // indirect
-	github.com/mattn/go-runewidth v0.0.4
+	github.com/ProtonMail/go-crypto v1.5.2
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/crypto v0.41.0
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/cloudflare/circl v1.6.3 // indirect
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
@@ -0,0 +1,109 @@
+package lexer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kkirsche/rpsl/token"
+)
+
+// authScheme is an auth scheme registered with RegisterAuthScheme
+type authScheme struct {
+	prefix string // lower-cased
+	valid  func(value string) bool
+}
+
+var (
+	authSchemesMu sync.RWMutex
+	authSchemes   []authScheme // longest prefix first
+)
+
+var (
+	x509Pattern   = regexp.MustCompile(`^[0-9]+$`)
+	uuidPattern   = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	bcryptPattern = regexp.MustCompile(`^\$2[aby]?\$[0-9]{2}\$[./A-Za-z0-9]{53}$`)
+)
+
+func init() {
+	// X.509 certificates held in X509-<n> key-cert objects
+	RegisterAuthScheme("X509-", x509Pattern.MatchString)
+	// single sign-on accounts, identified by UUID, as used by the RIPE database
+	RegisterAuthScheme("SSO", uuidPattern.MatchString)
+	RegisterAuthScheme("BCRYPT-PW", bcryptPattern.MatchString)
+	// API keys, as used by IRRd
+	RegisterAuthScheme("IRRD-API-KEY", func(value string) bool { return value != "" })
+}
+
+// RegisterAuthScheme adds an auth scheme to those defined by RFC 2622 and
+// RFC 2725, so that auth lines using it are lexed as a DATA_AUTH token rather
+// than ILLEGAL. The prefix is matched case-insensitively. Unless the prefix
+// ends with a hyphen, as in X509-1, it must be followed by whitespace and then
+// the value, as in SSO <uuid>. valid, if not nil, reports whether the value is
+// well formed.
+func RegisterAuthScheme(prefix string, valid func(value string) bool) {
+	authSchemesMu.Lock()
+	defer authSchemesMu.Unlock()
+
+	scheme := authScheme{prefix: strings.ToLower(prefix), valid: valid}
+	for i, s := range authSchemes {
+		if s.prefix == scheme.prefix {
+			authSchemes[i] = scheme
+			return
+		}
+	}
+
+	authSchemes = append(authSchemes, scheme)
+	sort.SliceStable(authSchemes, func(i, j int) bool {
+		return len(authSchemes[i].prefix) > len(authSchemes[j].prefix)
+	})
+}
+
+// AuthScheme returns the prefix of the registered scheme used by an auth
+// value, e.g. X509- for X509-1, and whether the value is well formed
+func AuthScheme(value string) (string, bool) {
+	authSchemesMu.RLock()
+	defer authSchemesMu.RUnlock()
+
+	lower := strings.ToLower(value)
+	for _, s := range authSchemes {
+		if !strings.HasPrefix(lower, s.prefix) {
+			continue
+		}
+
+		rest := value[len(s.prefix):]
+		if !strings.HasSuffix(s.prefix, hyphen) {
+			trimmed := strings.TrimLeft(rest, whitespace)
+			if trimmed == rest {
+				// the scheme is only a prefix of a longer word
+				continue
+			}
+			rest = trimmed
+		}
+
+		return strings.ToUpper(s.prefix), s.valid == nil || s.valid(strings.TrimRight(rest, whitespace))
+	}
+
+	return "", false
+}
+
+// lexRegisteredAuthAttrValue lexes the value of an auth line using a scheme
+// registered with RegisterAuthScheme
+func lexRegisteredAuthAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
+	// the value ends at the end of the line, or at a trailing comment
+	end := strings.IndexAny(l.input[l.pos:], newline+pound)
+	if end < 0 {
+		end = len(l.input) - l.pos
+	}
+
+	value := strings.TrimRight(l.input[l.pos:l.pos+end], whitespace)
+	if _, ok := AuthScheme(value); !ok {
+		l.emit(token.ILLEGAL)
+		return nil
+	}
+
+	l.pos += len(value)
+	l.emit(token.DATA_AUTH)
+	return nextStateFn
+}
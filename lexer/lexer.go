@@ -12,7 +12,6 @@ const (
 	digits         = "0123456789"
 	hexAlphabetics = "abcdef"
 	hexDigits      = digits + hexAlphabetics
-	nonHex         = "ghijklmnopqrstuvwxyz"
 	alphaNumeric   = alpha + digits
 	period         = "."
 	hyphen         = "-"
@@ -23,6 +22,7 @@ const (
 	plus           = "+"
 	at             = "@"
 	pound          = "#"
+	percent        = "%"
 	forwardSlash   = "/"
 	backSlash      = "\\"
 	dollarSign     = "$"
@@ -160,7 +160,7 @@ func (l *Lexer) accept(valid string) bool {
 
 func (l *Lexer) acceptExcept(invalid string) bool {
 	invalid = strings.ToLower(invalid) + strings.ToUpper(invalid)
-	if strings.IndexRune(invalid, l.readRune()) == -1 {
+	if r := l.readRune(); r != eof && strings.IndexRune(invalid, r) == -1 {
 		return true
 	}
 	l.backup()
@@ -196,10 +196,24 @@ func (l *Lexer) acceptExceptRun(invalid string) bool {
 
 // lexObjectClass is used to determine what class of RPSL object we are on
 func lexObjectClass(l *Lexer) stateFn {
+	// objects are separated by blank lines, and database dumps and whois
+	// responses commonly contain comment lines beginning with # or %, so we
+	// skip over those before looking for the object class
+	for {
+		l.acceptRun(whitespace + newline)
+		if !l.accept(pound + percent) {
+			break
+		}
+		l.acceptExceptRun(newline)
+	}
+	l.ignore()
+
 	for {
 		switch {
 		case strings.HasPrefix(l.lowerInput[l.pos:], token.CLASS_MAINTAINER.Name()):
 			return lexAttrName(l, token.CLASS_MAINTAINER, lexNICHandleAttrValue, lexClassAttributes)
+		case strings.HasPrefix(l.lowerInput[l.pos:], token.CLASS_KEY_CERT.Name()):
+			return lexAttrName(l, token.CLASS_KEY_CERT, lexNICHandleAttrValue, lexClassAttributes)
 		case strings.HasPrefix(l.lowerInput[l.pos:], token.CLASS_PERSON.Name()):
 			return lexAttrName(l, token.CLASS_PERSON, lexFreeformAttrValue, lexClassAttributes)
 		case strings.HasPrefix(l.lowerInput[l.pos:], token.CLASS_ROLE.Name()):
@@ -286,6 +300,10 @@ func lexClassAttributes(l *Lexer) stateFn {
 		return lexAttrName(l, token.ATTR_NOTIFY_EMAIL, lexEmailAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MAINTAINED_BY.Name()):
 		return lexAttrName(l, token.ATTR_MAINTAINED_BY, lexNICHandleAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MAINTAINER_LOWER.Name()):
+		return lexAttrName(l, token.ATTR_MAINTAINER_LOWER, lexNICHandleAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MAINTAINER_ROUTES.Name()):
+		return lexAttrName(l, token.ATTR_MAINTAINER_ROUTES, lexFreeformAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_CHANGED_AT_AND_BY.Name()):
 		return lexAttrName(l, token.ATTR_CHANGED_AT_AND_BY, lexEmailAndDateAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_REGISTRY_SOURCE.Name()):
@@ -301,23 +319,34 @@ func lexClassAttributes(l *Lexer) stateFn {
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_EMAIL.Name()):
 		return lexAttrName(l, token.ATTR_EMAIL, lexEmailAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_EXPORT.Name()):
-		return lexAttrName(l, token.ATTR_EXPORT, lexExportAttrValue, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_EXPORT, lexPolicyAttrValue(token.DATA_EXPORT_POLICY), lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_IMPORT.Name()):
-		return lexAttrName(l, token.ATTR_IMPORT, lexImportAttrValue, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_IMPORT, lexPolicyAttrValue(token.DATA_IMPORT_POLICY), lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MULTI_PROTO_EXPORT_POLICY.Name()):
-		return lexAttrName(l, token.ATTR_MULTI_PROTO_EXPORT_POLICY, lexMultiProtoExportAttrValue, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_MULTI_PROTO_EXPORT_POLICY, lexPolicyAttrValue(token.DATA_MULTI_PROTO_EXPORT_POLICY), lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MULTI_PROTO_IMPORT_POLICY.Name()):
-		return lexAttrName(l, token.ATTR_MULTI_PROTO_IMPORT_POLICY, lexMultiProtoImportAttrValue, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_MULTI_PROTO_IMPORT_POLICY, lexPolicyAttrValue(token.DATA_MULTI_PROTO_IMPORT_POLICY), lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MULTI_PROTO_MEMBERS.Name()):
-		return lexAttrName(l, token.ATTR_MULTI_PROTO_MEMBERS, lexMultiProtoMembers, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_MULTI_PROTO_MEMBERS, lexMembersAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MEMBER_OF_ROUTE_SET.Name()):
 		return lexAttrName(l, token.ATTR_MEMBER_OF_ROUTE_SET, lexNICHandleAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_AS_SET_MEMBERS.Name()):
-		return lexAttrName(l, token.ATTR_AS_SET_MEMBERS, lexMultipleAutNumAttrValue, lexClassAttributes)
+		return lexAttrName(l, token.ATTR_AS_SET_MEMBERS, lexMembersAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_ORIGIN.Name()):
 		return lexAttrName(l, token.ATTR_ORIGIN, lexAutNumAttrValue, lexClassAttributes)
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_MEMBERS_BY_REFERENCE.Name()):
 		return lexAttrName(l, token.ATTR_MEMBERS_BY_REFERENCE, lexNICHandleAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_METHOD.Name()):
+		return lexAttrName(l, token.ATTR_METHOD, lexFreeformAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_OWNER.Name()):
+		return lexAttrName(l, token.ATTR_OWNER, lexFreeformAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_FINGERPRINT.Name()):
+		return lexAttrName(l, token.ATTR_FINGERPRINT, lexFreeformAttrValue, lexClassAttributes)
+	case strings.HasPrefix(l.lowerInput[l.pos:], token.ATTR_CERTIFICATE.Name()):
+		// each line of an ASCII armoured key is a separate certif attribute or
+		// a continuation line, with "+" marking the blank line after the
+		// armour headers
+		return lexAttrName(l, token.ATTR_CERTIFICATE, lexFreeformAttrValue, lexClassAttributes)
 	default:
 		return lexObjectClass(l)
 	}
@@ -348,7 +377,8 @@ func lexNICHandleAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 		return nil
 	}
 
-	l.acceptRun(alphaNumeric + hyphen + underscore)
+	// hierarchical set names, e.g. AS65537:AS-CUSTOMERS, are separated by colons
+	l.acceptRun(alphaNumeric + hyphen + underscore + colon)
 	if l.pos > l.start {
 		l.emit(token.DATA_NIC_HANDLE)
 	}
@@ -366,7 +396,7 @@ func lexNICHandleAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 			return nil
 		}
 
-		l.acceptRun(alphaNumeric + hyphen + underscore)
+		l.acceptRun(alphaNumeric + hyphen + underscore + colon)
 		if l.pos > l.start {
 			l.emit(token.DATA_NIC_HANDLE)
 		}
@@ -472,8 +502,7 @@ func lexAuthenticationAttrValue(l *Lexer, returnToStateFn stateFn) stateFn {
 	case strings.HasPrefix(l.lowerInput[l.pos:], token.DATA_NO_AUTH.Name()):
 		return lexNoAuthAttrValue(l, returnToStateFn)
 	default:
-		l.emit(token.ILLEGAL)
-		return nil
+		return lexRegisteredAuthAttrValue(l, returnToStateFn)
 	}
 }
 
@@ -497,7 +526,7 @@ func lexCryptPassAuthAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 	// you can generate a crypt password via:
 	// openssl passwd -crypt MyPassword
 	for i := 0; i < 13; i++ {
-		if !l.accept(alphaNumeric + forwardSlash + backSlash) {
+		if !l.accept(alphaNumeric + period + forwardSlash + backSlash) {
 			l.emit(token.ILLEGAL)
 			return nil
 		}
@@ -561,7 +590,8 @@ func lexMailFromPassAuthAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 		return nil
 	}
 
-	if !l.acceptRun(alphaNumeric + period + hyphen + underscore + colon) {
+	// the address is a regular expression, e.g. .*@example\.net$
+	if !l.acceptExceptRun(whitespace + newline) {
 		l.emit(token.ILLEGAL)
 		return nil
 	}
@@ -628,37 +658,25 @@ func lexPhoneOrFaxAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 	return nextStateFn
 }
 
-func lexExportAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
-	// lex [protocol <protocol-1>] [into <protocol-2>]
-	succeeded := partialLexProtocol(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
+// lexPolicyAttrValue lexes the value of an import, export, mp-import or
+// mp-export attribute as a single token of the given type. Policies may be
+// structured and span several continuation lines, so their grammar is left to
+// the policy package rather than being validated here.
+func lexPolicyAttrValue(tokenType token.Type) stagedStateFn {
+	return func(l *Lexer, nextStateFn stateFn) stateFn {
+		l.acceptExceptRun(newline + pound)
 
-	succeeded = partialLexToPeer(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAction(l, "announce")
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
+		// drop trailing whitespace, such as that before an end of line comment
+		for l.pos > l.start && strings.ContainsRune(whitespace, rune(l.input[l.pos-1])) {
+			l.pos--
+		}
 
-	succeeded = partialLexAnnouncement(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
+		if l.pos > l.start {
+			l.emit(tokenType)
+		}
 
-	if l.pos > l.start {
-		l.emit(token.DATA_EXPORT_POLICY)
+		return nextStateFn
 	}
-
-	return nextStateFn
 }
 
 func lexAutNumAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
@@ -677,379 +695,45 @@ func lexAutNumAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 	return nextStateFn
 }
 
-func lexMultipleAutNumAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
-	for tokenizingASN := true; tokenizingASN == true; {
-		for _, t := range "AS" {
-			if !l.accept(string(t)) {
-				l.emit(token.ILLEGAL)
-				return nil
-			}
-		}
+func lexMembersAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
+	// members of as-sets and route-sets are a comma separated list of AS
+	// numbers, set names and address prefixes. Set names and prefixes may be
+	// followed by a range operator, e.g. RS-FOO^+ or 192.0.2.0/24^24-32. We
+	// are not validating the prefixes or operators, that is the parser's
+	// responsibility.
+	for lexingMember := true; lexingMember == true; {
+		l.acceptExceptRun(whitespace + newline + comma + pound)
+		member := l.lowerInput[l.start:l.pos]
 
-		l.acceptRun(digits)
-		if l.pos > l.start {
+		switch {
+		case member == "":
+			l.emit(token.ILLEGAL)
+			return nil
+		case strings.Contains(member, forwardSlash) && strings.Contains(member, colon):
+			l.emit(token.DATA_IPv6_CIDR)
+		case strings.Contains(member, forwardSlash):
+			l.emit(token.DATA_IPv4_CIDR)
+		case IsASN(member):
 			l.emit(token.DATA_ASN)
+		case strings.ContainsAny(member[:1], alpha):
+			l.emit(token.DATA_NIC_HANDLE)
+		default:
+			l.emit(token.ILLEGAL)
+			return nil
 		}
 
 		l.acceptRun(whitespace)
-		if !l.accept(comma) {
-			tokenizingASN = false
-		}
+		lexingMember = l.accept(comma)
 		l.acceptRun(whitespace)
 		l.ignore()
-	}
-
-	return nextStateFn
-}
-
-func lexImportAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
-	// lex [protocol <protocol-1>] [into <protocol-2>]
-	succeeded := partialLexProtocol(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexFromPeer(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
 
-	succeeded = partialLexAction(l, "accept")
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAcceptAS(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	if l.pos > l.start {
-		l.emit(token.DATA_IMPORT_POLICY)
-	}
-
-	return nextStateFn
-}
-
-func lexMultiProtoExportAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
-	succeeded := partialLexProtocol(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAddressFamilyIdentifier(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexToPeer(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAction(l, "announce")
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAnnouncement(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	if l.pos > l.start {
-		l.emit(token.DATA_MULTI_PROTO_EXPORT_POLICY)
-	}
-
-	return nextStateFn
-}
-
-func lexMultiProtoImportAttrValue(l *Lexer, nextStateFn stateFn) stateFn {
-	succeeded := partialLexProtocol(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAddressFamilyIdentifier(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexFromPeer(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAction(l, "accept")
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	succeeded = partialLexAcceptAS(l)
-	if !succeeded {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	if l.pos > l.start {
-		l.emit(token.DATA_MULTI_PROTO_IMPORT_POLICY)
-	}
-
-	return nextStateFn
-}
-
-func partialLexProtocol(l *Lexer) bool {
-	// if the export policy begins with protocol
-	if strings.HasPrefix(l.lowerInput[l.pos:], "protocol") {
-		for _, t := range "protocol" {
-			if !l.accept(string(t)) {
-				return false
-			}
+		// a trailing comma is permitted when the list continues on the next line
+		if r := l.peek(); r == eof || strings.ContainsRune(newline, r) {
+			lexingMember = false
 		}
-		l.acceptRun(whitespace)
-
-		// protocol name 1
-		// e.g. BGP, BGP4, OSPF, STATIC, RIP, IS-IS, etc.
-		l.acceptRun(alphaNumeric + hyphen)
-		l.acceptRun(whitespace)
 	}
 
-	if strings.HasPrefix(l.lowerInput[l.pos:], "into") {
-		for _, t := range "into" {
-			if !l.accept(string(t)) {
-				return false
-			}
-		}
-		l.acceptRun(whitespace)
-
-		// protocol name 2
-		// e.g. BGP, BGP4, OSPF, STATIC, RIP, IS-IS, etc.
-		l.acceptRun(alphaNumeric + hyphen)
-		l.acceptRun(whitespace)
-	}
-
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexAddressFamilyIdentifier(l *Lexer) bool {
-	// if the export policy begins with protocol
-	if strings.HasPrefix(l.lowerInput[l.pos:], "afi") {
-		for _, t := range "afi" {
-			if !l.accept(string(t)) {
-				return false
-			}
-		}
-		l.acceptRun(whitespace)
-
-		// afi value - any.unicast, ipv6.unicast, etc.
-		for tokenizingAFI := true; tokenizingAFI == true; {
-			afiType := ""
-			// AFI type list
-			// https://tools.ietf.org/html/rfc4012#section-2.2
-			switch {
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv4.unicast"):
-				afiType = "ipv4.unicast"
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv4.multicast"):
-				afiType = "ipv4.multicast"
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv4"):
-				afiType = "ipv4"
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv6.unicast"):
-				afiType = "ipv6.unicast"
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv6.multicast"):
-				afiType = "ipv6.multicast"
-			case strings.HasPrefix(l.lowerInput[l.pos:], "ipv6"):
-				afiType = "ipv6"
-			default:
-				// illegal AFI
-				return false
-			}
-
-			for _, t := range afiType {
-				if !l.accept(string(t)) {
-					return false
-				}
-			}
-
-			l.acceptRun(whitespace)
-			if !l.accept(comma) {
-				tokenizingAFI = false
-			}
-		}
-	}
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexToPeer(l *Lexer) bool {
-	// to peer / mp-peer is a required attribute
-	for _, t := range "to" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	l.acceptRun(whitespace)
-
-	for _, t := range "AS" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	l.acceptRun(digits)
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexFromPeer(l *Lexer) bool {
-	// from peer / mp-peer is a required attribute
-	for _, t := range "from" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	l.acceptRun(whitespace)
-
-	for _, t := range "AS" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	if l.accept(hyphen) {
-		if !l.acceptRun(alphaNumeric) {
-			return false
-		}
-	} else {
-		if !l.acceptRun(digits) {
-			return false
-		}
-	}
-
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexAction(l *Lexer, nextClause string) bool {
-	if strings.HasPrefix(l.lowerInput[l.pos:], "action") {
-		for _, t := range "action" {
-			if !l.accept(string(t)) {
-				return false
-			}
-		}
-
-		for parsingAction := true; parsingAction == true; {
-			// action name
-			if !l.acceptRun(alphaNumeric + hyphen + period) {
-				return false
-			}
-			l.acceptRun(whitespace)
-			// assignment
-			if !l.accept(equal) {
-				return false
-			}
-			l.acceptRun(whitespace)
-			// action value
-			if !l.acceptRun(alphaNumeric + hyphen + period) {
-				return false
-			}
-			// action end
-			if !l.accept(semicolon) {
-				return false
-			}
-			l.acceptRun(whitespace)
-			// check for announce clause instead of another action
-			if strings.HasPrefix(l.lowerInput[l.pos:], nextClause) {
-				parsingAction = false
-			}
-		}
-	}
-
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexAnnouncement(l *Lexer) bool {
-	for _, t := range "announce" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	l.acceptRun(whitespace)
-
-	for parsingAS := true; parsingAS == true; {
-		for _, t := range "AS" {
-			if !l.accept(string(t)) {
-				return false
-			}
-		}
-
-		if l.accept(hyphen) {
-			l.acceptRun(alphaNumeric + underscore)
-		} else {
-			l.acceptRun(digits)
-		}
-
-		l.acceptRun(whitespace)
-		// check for another AS instead of the end of the line
-		if !strings.HasPrefix(l.lowerInput[l.pos:], "as") {
-			parsingAS = false
-		}
-	}
-
-	l.acceptRun(whitespace)
-	return true
-}
-
-func partialLexAcceptAS(l *Lexer) bool {
-	for _, t := range "accept" {
-		if !l.accept(string(t)) {
-			return false
-		}
-	}
-	l.acceptRun(whitespace)
-
-	if strings.HasPrefix(l.lowerInput[l.pos:], "any") {
-		for _, t := range "ANY" {
-			if !l.accept(string(t)) {
-				return false
-			}
-		}
-	} else {
-		for parsingAS := true; parsingAS == true; {
-			for _, t := range "AS" {
-				if !l.accept(string(t)) {
-					return false
-				}
-			}
-
-			if l.accept(hyphen) {
-				l.acceptRun(alphaNumeric + underscore + hyphen)
-			} else {
-				l.acceptRun(digits)
-			}
-
-			l.acceptRun(whitespace)
-			// check for another AS instead of the end of the line
-			if !strings.HasPrefix(l.lowerInput[l.pos:], "as") {
-				parsingAS = false
-			}
-		}
-	}
-
-	l.acceptRun(whitespace)
-	return true
+	return nextStateFn
 }
 
 func lexCIDRv4AttrValue(l *Lexer, nextStateFn stateFn) stateFn {
@@ -1139,127 +823,3 @@ func lexCIDRv6AttrValue(l *Lexer, nextStateFn stateFn) stateFn {
 
 	return nextStateFn
 }
-
-func lexMultiProtoMembers(l *Lexer, nextStateFn stateFn) stateFn {
-	if l.accept(nonHex) {
-		// this has to be a NIC handle / object as it's an alphabetic character
-		// that is not a valid hexadecimal digit
-		l.acceptRun(alphaNumeric + hyphen + underscore)
-		if l.pos > l.start {
-			l.emit(token.DATA_NIC_HANDLE)
-		}
-	} else if l.accept(hexAlphabetics) {
-		// we must have an IPv6 address
-		for i := 0; i < 8; i++ {
-			// this means we hit a ::
-			if l.accept(colon) {
-				continue
-			}
-
-			// accept up to four hex digits
-			for d := 0; d < 4; d++ {
-				l.accept(hexDigits)
-			}
-			// accept the separating colon
-			l.accept(colon)
-		}
-
-		if !l.accept(forwardSlash) {
-			l.emit(token.ILLEGAL)
-			return nil
-		}
-
-		// subnet size
-		for i := 0; i < 3; i++ {
-			l.accept(digits)
-		}
-
-		if l.pos > l.start {
-			l.emit(token.DATA_IPv6_CIDR)
-		}
-	} else if l.accept(digits) {
-		// we have an IP address but not sure if it's IPv4 or IPv6 yet
-		l.acceptRun(hexDigits)
-		if l.accept(period) {
-			// second octet
-			for i := 0; i < 3; i++ {
-				l.accept(digits)
-			}
-
-			if !l.accept(period) {
-				l.emit(token.ILLEGAL)
-				return nil
-			}
-
-			// third octet
-			for i := 0; i < 3; i++ {
-				l.accept(digits)
-			}
-
-			if !l.accept(period) {
-				l.emit(token.ILLEGAL)
-				return nil
-			}
-
-			// fourth octet
-			for i := 0; i < 3; i++ {
-				l.accept(digits)
-			}
-
-			if !l.accept(forwardSlash) {
-				l.emit(token.ILLEGAL)
-				return nil
-			}
-
-			// subnet size
-			for i := 0; i < 2; i++ {
-				l.accept(digits)
-			}
-
-			if l.pos > l.start {
-				l.emit(token.DATA_IPv4_CIDR)
-			}
-
-		} else if l.accept(colon) {
-			// we must have an IPv6 address to keep going
-			// so attempt to read in any remaining 7 octets
-			for i := 0; i < 7; i++ {
-				// this means we hit a ::
-				if l.accept(colon) {
-					continue
-				}
-
-				// accept up to four hex digits
-				for d := 0; d < 4; d++ {
-					l.accept(hexDigits)
-				}
-				// accept the separating colon
-				l.accept(colon)
-			}
-
-			if !l.accept(forwardSlash) {
-				l.emit(token.ILLEGAL)
-				return nil
-			}
-
-			// subnet size
-			for i := 0; i < 3; i++ {
-				l.accept(digits)
-			}
-
-			if l.pos > l.start {
-				l.emit(token.DATA_IPv6_CIDR)
-			}
-
-		} else {
-			l.emit(token.ILLEGAL)
-			return nil
-		}
-
-	} else {
-		l.emit(token.ILLEGAL)
-		return nil
-	}
-
-	return nextStateFn
-}
@@ -641,3 +641,366 @@ remarks:        remark
 		}
 	}
 }
+
+func TestLexSetMembers(t *testing.T) {
+	input := `route-set:      AS65537:RS-TEST
+members:        192.0.2.0/24^+, RS-OTHER^24-32,
++               AS65538, AS-TEST
+mp-members:     2001:db8::/32^48, 198.51.100.0/24
+mbrs-by-ref:    ANY
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_ROUTE_SET, "route-set", 1},
+		testExpectation{token.DATA_NIC_HANDLE, "AS65537:RS-TEST", 1},
+		testExpectation{token.ATTR_AS_SET_MEMBERS, "members", 2},
+		testExpectation{token.DATA_IPv4_CIDR, "192.0.2.0/24^+", 2},
+		testExpectation{token.DATA_NIC_HANDLE, "RS-OTHER^24-32", 2},
+		testExpectation{token.ATTR_CONTINUATION, "+", 3},
+		testExpectation{token.DATA_ASN, "AS65538", 3},
+		testExpectation{token.DATA_NIC_HANDLE, "AS-TEST", 3},
+		testExpectation{token.ATTR_MULTI_PROTO_MEMBERS, "mp-members", 4},
+		testExpectation{token.DATA_IPv6_CIDR, "2001:db8::/32^48", 4},
+		testExpectation{token.DATA_IPv4_CIDR, "198.51.100.0/24", 4},
+		testExpectation{token.ATTR_MEMBERS_BY_REFERENCE, "mbrs-by-ref", 5},
+		testExpectation{token.DATA_NIC_HANDLE, "ANY", 5},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 6},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 6},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("route-set-object", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexStructuredPolicy(t *testing.T) {
+	input := `aut-num:        AS65536
+import:         {
+                  from AS65537 accept ANY; # peers
+                } except afi ipv6 {
++                 from AS65538 accept <^AS65538+$>;
+                }
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_AUT_NUM, "aut-num", 1},
+		testExpectation{token.DATA_ASN, "AS65536", 1},
+		testExpectation{token.ATTR_IMPORT, "import", 2},
+		testExpectation{token.DATA_IMPORT_POLICY, "{", 2},
+		testExpectation{token.ATTR_CONTINUATION, " ", 3},
+		testExpectation{token.DATA_IMPORT_POLICY, "from AS65537 accept ANY;", 3},
+		testExpectation{token.ATTR_CONTINUATION, " ", 4},
+		testExpectation{token.DATA_IMPORT_POLICY, "} except afi ipv6 {", 4},
+		testExpectation{token.ATTR_CONTINUATION, "+", 5},
+		testExpectation{token.DATA_IMPORT_POLICY, "from AS65538 accept <^AS65538+$>;", 5},
+		testExpectation{token.ATTR_CONTINUATION, " ", 6},
+		testExpectation{token.DATA_IMPORT_POLICY, "}", 6},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 7},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 7},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("structured-policy", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexMissingFinalNewline(t *testing.T) {
+	input := `route:          192.0.2.0/24
+origin:         AS65537
+source:         TEST`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_ROUTE, "route", 1},
+		testExpectation{token.DATA_IPv4_CIDR, "192.0.2.0/24", 1},
+		testExpectation{token.ATTR_ORIGIN, "origin", 2},
+		testExpectation{token.DATA_ASN, "AS65537", 2},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 3},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 3},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("missing-final-newline", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexHierarchicalMaintainers(t *testing.T) {
+	input := `route:          192.0.2.0/24
+origin:         AS65537
+mnt-lower:      LOWER-MNT
+mnt-routes:     ROUTES-MNT {192.0.2.0/24^+}
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_ROUTE, "route", 1},
+		testExpectation{token.DATA_IPv4_CIDR, "192.0.2.0/24", 1},
+		testExpectation{token.ATTR_ORIGIN, "origin", 2},
+		testExpectation{token.DATA_ASN, "AS65537", 2},
+		testExpectation{token.ATTR_MAINTAINER_LOWER, "mnt-lower", 3},
+		testExpectation{token.DATA_NIC_HANDLE, "LOWER-MNT", 3},
+		testExpectation{token.ATTR_MAINTAINER_ROUTES, "mnt-routes", 4},
+		testExpectation{token.DATA_STRING, "ROUTES-MNT {192.0.2.0/24^+}", 4},
+		testExpectation{token.ATTR_MAINTAINED_BY, "mnt-by", 5},
+		testExpectation{token.DATA_NIC_HANDLE, "TEST-MNT", 5},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 6},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 6},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("hierarchical-maintainers", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexMailFromRegexp(t *testing.T) {
+	input := `mntner:         TEST-MNT
+auth:           MAIL-FROM .*@example\.net$
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_MAINTAINER, "mntner", 1},
+		testExpectation{token.DATA_NIC_HANDLE, "TEST-MNT", 1},
+		testExpectation{token.ATTR_AUTHENTICATION, "auth", 2},
+		testExpectation{token.DATA_MAIL_FROM_PASS, `.*@example\.net$`, 2},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 3},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 3},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("mail-from-regexp", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexKeyCert(t *testing.T) {
+	input := `key-cert:       PGPKEY-80F238C6
+method:         PGP
+owner:          Test Maintainer <noc@example.com>
+fingerpr:       D079 99F1 92D5 41B6 E7BC  6578 9175 DB8D 80F2 38C6
+certif:         -----BEGIN PGP PUBLIC KEY BLOCK-----
++
+                mQENBF1c
+certif:         -----END PGP PUBLIC KEY BLOCK-----
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_KEY_CERT, "key-cert", 1},
+		testExpectation{token.DATA_NIC_HANDLE, "PGPKEY-80F238C6", 1},
+		testExpectation{token.ATTR_METHOD, "method", 2},
+		testExpectation{token.DATA_STRING, "PGP", 2},
+		testExpectation{token.ATTR_OWNER, "owner", 3},
+		testExpectation{token.DATA_STRING, "Test Maintainer <noc@example.com>", 3},
+		testExpectation{token.ATTR_FINGERPRINT, "fingerpr", 4},
+		testExpectation{token.DATA_STRING, "D079 99F1 92D5 41B6 E7BC  6578 9175 DB8D 80F2 38C6", 4},
+		testExpectation{token.ATTR_CERTIFICATE, "certif", 5},
+		testExpectation{token.DATA_STRING, "-----BEGIN PGP PUBLIC KEY BLOCK-----", 5},
+		testExpectation{token.ATTR_CONTINUATION, "+", 6},
+		testExpectation{token.ATTR_CONTINUATION, " ", 7},
+		testExpectation{token.DATA_STRING, "mQENBF1c", 7},
+		testExpectation{token.ATTR_CERTIFICATE, "certif", 8},
+		testExpectation{token.DATA_STRING, "-----END PGP PUBLIC KEY BLOCK-----", 8},
+		testExpectation{token.ATTR_MAINTAINED_BY, "mnt-by", 9},
+		testExpectation{token.DATA_NIC_HANDLE, "TEST-MNT", 9},
+		testExpectation{token.ATTR_REGISTRY_SOURCE, "source", 10},
+		testExpectation{token.DATA_REGISTRY_NAME, "TEST", 10},
+		testExpectation{token.EOF, "", 0},
+	}
+
+	l := Lex("key-cert", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLexAuthSchemes(t *testing.T) {
+	input := `mntner:         TEST-MNT
+auth:           X509-1
+auth:           sso 3f2504e0-4f89-11d3-9a0c-0305e82c3301 # single sign-on
+auth:           BCRYPT-PW $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy
+auth:           X509-one
+source:         TEST
+`
+
+	tests := testExpectations{
+		testExpectation{token.CLASS_MAINTAINER, "mntner", 1},
+		testExpectation{token.DATA_NIC_HANDLE, "TEST-MNT", 1},
+		testExpectation{token.ATTR_AUTHENTICATION, "auth", 2},
+		testExpectation{token.DATA_AUTH, "X509-1", 2},
+		testExpectation{token.ATTR_AUTHENTICATION, "auth", 3},
+		testExpectation{token.DATA_AUTH, "sso 3f2504e0-4f89-11d3-9a0c-0305e82c3301", 3},
+		testExpectation{token.ATTR_AUTHENTICATION, "auth", 4},
+		testExpectation{token.DATA_AUTH, "BCRYPT-PW $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", 4},
+		testExpectation{token.ATTR_AUTHENTICATION, "auth", 5},
+		testExpectation{token.ILLEGAL, "", 5},
+	}
+
+	l := Lex("auth-schemes", input)
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		failure := false
+
+		if !assert.Equal(t, tt.typ, tok.Type, "Invalid token type '%s', expected '%s'", tok.Type, tt.typ) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.literal, tok.Literal, "Invalid token literal '%s', expected '%s'", tok.Literal, tt.literal) {
+			failure = true
+		}
+
+		if !assert.Equal(t, tt.line, tok.Line, "Invalid line number %d for token literal '%s'", tok.Line, tok.Literal) {
+			failure = true
+		}
+
+		if failure {
+			t.FailNow()
+		}
+	}
+}
+
+func TestRegisterAuthScheme(t *testing.T) {
+	_, ok := AuthScheme("TOTP-ALICE")
+	assert.False(t, ok)
+
+	RegisterAuthScheme("TOTP-", func(value string) bool { return value != "" })
+
+	tests := []struct {
+		value  string
+		prefix string
+		ok     bool
+	}{
+		{"TOTP-ALICE", "TOTP-", true},
+		{"totp-alice", "TOTP-", true},
+		{"TOTP-", "TOTP-", false},
+		{"SSO 3f2504e0-4f89-11d3-9a0c-0305e82c3301", "SSO", true},
+		{"SSOX 3f2504e0-4f89-11d3-9a0c-0305e82c3301", "", false},
+	}
+
+	for _, tt := range tests {
+		prefix, ok := AuthScheme(tt.value)
+		assert.Equal(t, tt.prefix, prefix, tt.value)
+		assert.Equal(t, tt.ok, ok, tt.value)
+	}
+}
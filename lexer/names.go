@@ -0,0 +1,40 @@
+package lexer
+
+import (
+	"strings"
+
+	"github.com/kkirsche/rpsl/token"
+)
+
+// setPrefixes are the prefixes which name each class of set
+var setPrefixes = []struct {
+	prefix string
+	class  token.Type
+}{
+	{"AS-", token.CLASS_AS_SET},
+	{"RS-", token.CLASS_ROUTE_SET},
+	{"FLTR-", token.CLASS_FILTER_SET},
+	{"PRNG-", token.CLASS_PEERING_SET},
+	{"RTRS-", token.CLASS_ROUTER_SET},
+}
+
+// IsASN reports whether the name is an AS number, e.g. AS65537, ignoring case
+func IsASN(name string) bool {
+	return len(name) > 2 && strings.EqualFold(name[:2], "as") && strings.Trim(name[2:], digits) == ""
+}
+
+// SetClass returns the class of the set named, which is given by the prefix
+// of the last component of a hierarchical name, e.g. as-set for
+// AS65537:AS-CUSTOMERS. token.ILLEGAL is returned if the name is not a set
+// name.
+func SetClass(name string) token.Type {
+	parts := strings.Split(strings.ToUpper(name), ":")
+	last := parts[len(parts)-1]
+	for _, p := range setPrefixes {
+		if strings.HasPrefix(last, p.prefix) {
+			return p.class
+		}
+	}
+
+	return token.ILLEGAL
+}
@@ -0,0 +1,38 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsASN(t *testing.T) {
+	for _, name := range []string{"AS65537", "as0", "As4200000000"} {
+		assert.True(t, IsASN(name), name)
+	}
+	for _, name := range []string{"AS", "AS-TEST", "AS65537:AS-TEST", "ASX1", "65537"} {
+		assert.False(t, IsASN(name), name)
+	}
+}
+
+func TestSetClass(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected token.Type
+	}{
+		{"AS-TEST", token.CLASS_AS_SET},
+		{"as65537:as-customers", token.CLASS_AS_SET},
+		{"AS65537:RS-ROUTES:AS-TEST", token.CLASS_AS_SET},
+		{"RS-TEST", token.CLASS_ROUTE_SET},
+		{"FLTR-TEST", token.CLASS_FILTER_SET},
+		{"AS65537:PRNG-TEST", token.CLASS_PEERING_SET},
+		{"RTRS-TEST", token.CLASS_ROUTER_SET},
+		{"AS65537", token.ILLEGAL},
+		{"AS-TEST:AS65537", token.ILLEGAL},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, SetClass(tt.name), tt.name)
+	}
+}
@@ -0,0 +1,196 @@
+// Package lint checks the referential integrity of a whole database, such as
+// a dump loaded from a registry, reporting references to objects which do not
+// exist and set memberships which the set does not accept.
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/schema"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Kind is the kind of problem a finding reports
+type Kind int
+
+// The kinds of problem which may be reported
+const (
+	MissingMntner     Kind = iota // mnt-by, mnt-lower, mnt-routes or mbrs-by-ref name a missing mntner
+	MissingContact                // admin-c or tech-c name a missing person or role
+	MissingKeyCert                // auth names a missing key-cert
+	MissingSet                    // member-of, members or mp-members name a missing set
+	MissingAutNum                 // origin names an AS number without an aut-num
+	MbrsByRefMismatch             // member-of names a set which does not accept the object as a member
+)
+
+var kindNames = map[Kind]string{
+	MissingMntner:     "missing-mntner",
+	MissingContact:    "missing-contact",
+	MissingKeyCert:    "missing-key-cert",
+	MissingSet:        "missing-set",
+	MissingAutNum:     "missing-aut-num",
+	MbrsByRefMismatch: "mbrs-by-ref-mismatch",
+}
+
+// String returns the name of the kind of problem
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler so that kinds are written by
+// name in JSON output
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ParseKind returns the kind with the given name, e.g. missing-mntner
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kindNames {
+		if strings.EqualFold(n, name) {
+			return k, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown kind %q", name)
+}
+
+// referenceKinds are the kinds reported for references to missing objects,
+// by the referencing attribute
+var referenceKinds = map[token.Type]Kind{
+	token.ATTR_ADMIN_CONTACT:        MissingContact,
+	token.ATTR_AS_SET_MEMBERS:       MissingSet,
+	token.ATTR_AUTHENTICATION:       MissingKeyCert,
+	token.ATTR_MAINTAINED_BY:        MissingMntner,
+	token.ATTR_MAINTAINER_LOWER:     MissingMntner,
+	token.ATTR_MAINTAINER_ROUTES:    MissingMntner,
+	token.ATTR_MEMBERS_BY_REFERENCE: MissingMntner,
+	token.ATTR_MEMBER_OF_ROUTE_SET:  MissingSet,
+	token.ATTR_MULTI_PROTO_MEMBERS:  MissingSet,
+	token.ATTR_ORIGIN:               MissingAutNum,
+	token.ATTR_TECHNICAL_CONTACT:    MissingContact,
+}
+
+// Finding is a single problem found in an object
+type Finding struct {
+	Kind      Kind   `json:"kind"`
+	Source    string `json:"source"`
+	Class     string `json:"class"`
+	Key       string `json:"key"`
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
+	Message   string `json:"message"`
+}
+
+// String formats the finding on a single line, e.g.
+//
+//	TEST route 192.0.2.0/24AS65537: mnt-by: mntner MISSING-MNT does not exist
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s %s: %s: %s", f.Source, f.Class, f.Key, f.Attribute, f.Message)
+}
+
+// Options select which objects are linted and which findings are reported
+type Options struct {
+	Sources []string // only lint objects from these sources, or every source if empty
+	Kinds   []Kind   // only report these kinds, or every kind if empty
+}
+
+// Lint checks every object in the database for dangling references to other
+// objects, and for member-of attributes which are not honoured by the set's
+// mbrs-by-ref. References are resolved against every source in the database,
+// whichever sources are linted. Findings are ordered by class and primary key.
+func Lint(d *db.Database, opts Options) []Finding {
+	sources := make(map[string]bool)
+	for _, source := range opts.Sources {
+		sources[strings.ToUpper(source)] = true
+	}
+	kinds := make(map[Kind]bool)
+	for _, k := range opts.Kinds {
+		kinds[k] = true
+	}
+
+	var findings []Finding
+	for _, obj := range d.Objects() {
+		source := strings.ToUpper(obj.Value(token.ATTR_REGISTRY_SOURCE))
+		if len(sources) > 0 && !sources[source] {
+			continue
+		}
+
+		for _, f := range lintObject(d, obj) {
+			if len(kinds) == 0 || kinds[f.Kind] {
+				f.Source = source
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	return findings
+}
+
+// lintObject returns the findings for a single object
+func lintObject(d *db.Database, obj *ast.Object) []Finding {
+	finding := func(k Kind, attr token.Type, value, format string, args ...interface{}) Finding {
+		return Finding{
+			Kind:      k,
+			Class:     obj.Class().Name(),
+			Key:       obj.Key(),
+			Attribute: attr.Name(),
+			Value:     value,
+			Message:   fmt.Sprintf(format, args...),
+		}
+	}
+
+	var findings []Finding
+	for _, ref := range schema.References(obj) {
+		k, ok := referenceKinds[ref.Attribute]
+		if !ok {
+			continue
+		}
+
+		set, found := lookup(d, ref)
+		switch {
+		case !found:
+			findings = append(findings, finding(k, ref.Attribute, ref.Key, "%s %s does not exist", ref.ClassNames(), ref.Key))
+		case ref.Attribute == token.ATTR_MEMBER_OF_ROUTE_SET:
+			if message := checkMbrsByRef(obj, set); message != "" {
+				findings = append(findings, finding(MbrsByRefMismatch, ref.Attribute, ref.Key, "%s", message))
+			}
+		}
+	}
+
+	return findings
+}
+
+// checkMbrsByRef returns why the set does not accept the object as a member
+// through member-of, or an empty string if it does
+func checkMbrsByRef(obj, set *ast.Object) string {
+	mbrsByRef := set.Values(token.ATTR_MEMBERS_BY_REFERENCE)
+	if len(mbrsByRef) == 0 {
+		return fmt.Sprintf("%s %s has no mbrs-by-ref, so does not accept members by reference", set.Class().Name(), set.Name())
+	}
+
+	mntners := make(map[string]bool)
+	for _, name := range obj.Values(token.ATTR_MAINTAINED_BY) {
+		mntners[strings.ToUpper(name)] = true
+	}
+	for _, name := range mbrsByRef {
+		if strings.EqualFold(name, "ANY") || mntners[strings.ToUpper(name)] {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("no mnt-by of the object is listed in the mbrs-by-ref of %s %s", set.Class().Name(), set.Name())
+}
+
+// lookup returns the referenced object
+func lookup(d *db.Database, ref schema.Reference) (*ast.Object, bool) {
+	for _, class := range ref.Classes {
+		if obj, ok := d.Get(class, ref.Key); ok {
+			return obj, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,94 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	d, err := db.LoadFile("testdata/lint.db")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"all", Options{}, []string{
+			"TEST as-set AS-CLOSED: mbrs-by-ref: mntner OTHER-MNT does not exist",
+			"TEST as-set AS-OPEN: members: as-set AS-MISSING does not exist",
+			"TEST aut-num AS65537: member-of: no mnt-by of the object is listed in the mbrs-by-ref of as-set AS-CLOSED",
+			"TEST aut-num AS65537: member-of: as-set AS-NOREF has no mbrs-by-ref, so does not accept members by reference",
+			"TEST aut-num AS65537: tech-c: person or role GONE1-TEST does not exist",
+			"TEST mntner TEST-MNT: auth: key-cert PGPKEY-DEADBEEF does not exist",
+			"TEST route 192.0.2.0/24AS65537: member-of: route-set RS-MISSING does not exist",
+			"OTHER route 198.51.100.0/24AS65538: origin: aut-num AS65538 does not exist",
+			"OTHER route 198.51.100.0/24AS65538: mnt-by: mntner OTHER-MNT does not exist",
+		}},
+		{"source", Options{Sources: []string{"other"}}, []string{
+			"OTHER route 198.51.100.0/24AS65538: origin: aut-num AS65538 does not exist",
+			"OTHER route 198.51.100.0/24AS65538: mnt-by: mntner OTHER-MNT does not exist",
+		}},
+		{"kinds", Options{Kinds: []Kind{MissingMntner, MissingAutNum}}, []string{
+			"TEST as-set AS-CLOSED: mbrs-by-ref: mntner OTHER-MNT does not exist",
+			"OTHER route 198.51.100.0/24AS65538: origin: aut-num AS65538 does not exist",
+			"OTHER route 198.51.100.0/24AS65538: mnt-by: mntner OTHER-MNT does not exist",
+		}},
+		{"source and kind", Options{Sources: []string{"TEST"}, Kinds: []Kind{MbrsByRefMismatch}}, []string{
+			"TEST aut-num AS65537: member-of: no mnt-by of the object is listed in the mbrs-by-ref of as-set AS-CLOSED",
+			"TEST aut-num AS65537: member-of: as-set AS-NOREF has no mbrs-by-ref, so does not accept members by reference",
+		}},
+		{"no findings", Options{Sources: []string{"RIPE"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			for _, f := range Lint(d, tt.opts) {
+				actual = append(actual, f.String())
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for k, name := range kindNames {
+		actual, err := ParseKind(strings.ToUpper(name))
+		assert.NoError(t, err)
+		assert.Equal(t, k, actual)
+	}
+
+	_, err := ParseKind("missing-everything")
+	assert.EqualError(t, err, `unknown kind "missing-everything"`)
+}
+
+func TestWrite(t *testing.T) {
+	d, err := db.LoadFile("testdata/lint.db")
+	require.NoError(t, err)
+	findings := Lint(d, Options{Sources: []string{"OTHER"}})
+
+	var b strings.Builder
+	if assert.NoError(t, WriteJSON(&b, findings)) {
+		assert.Contains(t, b.String(), `"kind": "missing-aut-num",
+    "source": "OTHER",
+    "class": "route",
+    "key": "198.51.100.0/24AS65538",
+    "attribute": "origin",
+    "value": "AS65538",`)
+	}
+
+	b.Reset()
+	if assert.NoError(t, WriteJSON(&b, nil)) {
+		assert.Equal(t, "[]\n", b.String())
+	}
+
+	b.Reset()
+	if assert.NoError(t, WriteSummary(&b, findings)) {
+		assert.Equal(t, "missing-mntner: 1\nmissing-aut-num: 1\n", b.String())
+	}
+}
@@ -0,0 +1,50 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteText writes a single line per finding
+func WriteText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON writes the findings as a JSON array
+func WriteJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
+
+// WriteSummary writes the number of findings of each kind, e.g.
+//
+//	missing-mntner: 2
+func WriteSummary(w io.Writer, findings []Finding) error {
+	counts := make(map[Kind]int)
+	for _, f := range findings {
+		counts[f.Kind]++
+	}
+
+	for k := MissingMntner; k <= MbrsByRefMismatch; k++ {
+		if counts[k] == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s: %d\n", k, counts[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
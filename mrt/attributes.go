@@ -0,0 +1,192 @@
+package mrt
+
+import (
+	"fmt"
+	"net"
+)
+
+// The BGP path attribute types which are read
+const (
+	attrASPath      uint8 = 2
+	attrCommunities uint8 = 8
+	attrMPReach     uint8 = 14
+	attrMPUnreach   uint8 = 15
+	attrAS4Path     uint8 = 17
+)
+
+// extendedLength is the path attribute flag for a two byte length
+const extendedLength = 0x10
+
+// attributes are the path attributes of a route
+type attributes struct {
+	path        []Segment
+	as4Path     []Segment
+	communities []uint32
+	// the unicast prefixes announced and withdrawn by MP_REACH_NLRI and
+	// MP_UNREACH_NLRI
+	reach, unreach []*net.IPNet
+}
+
+// parseAttributes parses BGP path attributes. as4 is set if AS_PATH holds four
+// byte AS numbers, as it always does in TABLE_DUMP_V2 records. mp is set if
+// MP_REACH_NLRI and MP_UNREACH_NLRI are read: TABLE_DUMP_V2 records carry
+// MP_REACH_NLRI with only it's next hop, as the prefix is given by the record.
+func parseAttributes(b []byte, as4, mp bool) (*attributes, error) {
+	a := &attributes{}
+	d := &decoder{b: b}
+	for len(d.b) > 0 && d.err == nil {
+		flags, typ := d.u8(), d.u8()
+		var length int
+		if flags&extendedLength != 0 {
+			length = int(d.u16())
+		} else {
+			length = int(d.u8())
+		}
+		value := d.bytes(length)
+		if d.err != nil {
+			break
+		}
+
+		var err error
+		switch typ {
+		case attrASPath:
+			a.path, err = parseASPath(value, as4)
+		case attrAS4Path:
+			a.as4Path, err = parseASPath(value, true)
+		case attrCommunities:
+			if len(value)%4 != 0 {
+				err = fmt.Errorf("length %d", len(value))
+				break
+			}
+			v := &decoder{b: value}
+			for len(v.b) > 0 {
+				a.communities = append(a.communities, v.u32())
+			}
+		case attrMPReach:
+			if mp {
+				a.reach, err = parseMPNLRI(value, true)
+			}
+		case attrMPUnreach:
+			if mp {
+				a.unreach, err = parseMPNLRI(value, false)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid path attribute %d: %s", typ, err)
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("invalid path attributes: %s", d.err)
+	}
+
+	return a, nil
+}
+
+// parseASPath parses the segments of an AS_PATH or AS4_PATH attribute
+func parseASPath(b []byte, as4 bool) ([]Segment, error) {
+	var segments []Segment
+	d := &decoder{b: b}
+	for len(d.b) > 0 && d.err == nil {
+		s := Segment{Type: SegmentType(d.u8())}
+		if s.Type < ASSet || s.Type > ConfedSet {
+			return nil, fmt.Errorf("segment type %d", s.Type)
+		}
+
+		s.ASNs = make([]uint32, d.u8())
+		for i := range s.ASNs {
+			if as4 {
+				s.ASNs[i] = d.u32()
+			} else {
+				s.ASNs[i] = uint32(d.u16())
+			}
+		}
+		segments = append(segments, s)
+	}
+
+	return segments, d.err
+}
+
+// parseMPNLRI returns the unicast prefixes of an MP_REACH_NLRI attribute, or of
+// an MP_UNREACH_NLRI attribute if reach is not set. Other address families
+// are ignored.
+func parseMPNLRI(b []byte, reach bool) ([]*net.IPNet, error) {
+	d := &decoder{b: b}
+	afi, safi := d.u16(), d.u8()
+	if reach {
+		d.bytes(int(d.u8())) // next hop
+		d.u8()               // reserved
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var size int
+	switch {
+	case safi != safiUnicast:
+		return nil, nil
+	case afi == afiIPv4:
+		size = net.IPv4len
+	case afi == afiIPv6:
+		size = net.IPv6len
+	default:
+		return nil, nil
+	}
+
+	var prefixes []*net.IPNet
+	for len(d.b) > 0 && d.err == nil {
+		prefixes = append(prefixes, d.prefix(size))
+	}
+
+	return prefixes, d.err
+}
+
+// mergeAS4Path reconstructs the AS path of a route received from a two byte
+// AS speaker, following RFC 6793: AS4_PATH replaces the trailing AS numbers
+// of AS_PATH, in which four byte AS numbers are AS_TRANS. AS4_PATH is ignored
+// if it is longer than AS_PATH.
+func mergeAS4Path(path, as4Path []Segment) []Segment {
+	n, n4 := pathLength(path), pathLength(as4Path)
+	if n4 > n {
+		return path
+	}
+
+	// keep the leading n - n4 AS numbers of AS_PATH
+	keep := n - n4
+	var merged []Segment
+	for _, s := range path {
+		if keep == 0 {
+			break
+		}
+		switch {
+		case s.Type == ConfedSequence || s.Type == ConfedSet:
+			merged = append(merged, s)
+		case s.Type == ASSet:
+			merged = append(merged, s)
+			keep--
+		case len(s.ASNs) <= keep:
+			merged = append(merged, s)
+			keep -= len(s.ASNs)
+		default:
+			merged = append(merged, Segment{Type: s.Type, ASNs: s.ASNs[:keep]})
+			keep = 0
+		}
+	}
+
+	return append(merged, as4Path...)
+}
+
+// pathLength counts the AS numbers of a path as RFC 4271 does for route
+// selection: an AS_SET counts as one, and confederation segments as none
+func pathLength(path []Segment) int {
+	n := 0
+	for _, s := range path {
+		switch s.Type {
+		case ASSet:
+			n++
+		case ASSequence:
+			n += len(s.ASNs)
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,432 @@
+// Package mrt reads BGP routing information exported in the MRT format of RFC
+// 6396, such as the RIB dumps and update files published by RouteViews and
+// RIPE RIS.
+package mrt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// The MRT record types of RFC 6396
+const (
+	typeTableDumpV2 uint16 = 13
+	typeBGP4MP      uint16 = 16
+	typeBGP4MPET    uint16 = 17
+)
+
+// The TABLE_DUMP_V2 subtypes of RFC 6396. Multicast, generic and RFC 8050
+// ADD-PATH RIBs are skipped.
+const (
+	subtypePeerIndexTable uint16 = 1
+	subtypeRIBIPv4Unicast uint16 = 2
+	subtypeRIBIPv6Unicast uint16 = 4
+)
+
+// The BGP4MP subtypes of RFC 6396 which carry BGP messages. State changes and
+// RFC 8050 ADD-PATH messages are skipped.
+const (
+	subtypeMessage         uint16 = 1
+	subtypeMessageAS4      uint16 = 4
+	subtypeMessageLocal    uint16 = 6
+	subtypeMessageAS4Local uint16 = 7
+)
+
+// The address families of RFC 4760
+const (
+	afiIPv4     uint16 = 1
+	afiIPv6     uint16 = 2
+	safiUnicast uint8  = 1
+)
+
+const (
+	bgpMarkerLength = 16
+	bgpTypeUpdate   = 2
+)
+
+const (
+	headerLength = 12
+	// maxRecordLength limits the records which are read, RIB records for a
+	// prefix seen from every peer of a large collector are well below it
+	maxRecordLength = 1 << 24
+)
+
+// errTruncated is returned when a record ends before one of it's fields
+var errTruncated = fmt.Errorf("truncated")
+
+// SegmentType is the type of an AS path segment
+type SegmentType uint8
+
+// The AS path segment types of RFC 4271 and RFC 5065
+const (
+	ASSet          SegmentType = 1
+	ASSequence     SegmentType = 2
+	ConfedSequence SegmentType = 3
+	ConfedSet      SegmentType = 4
+)
+
+// Segment is a single segment of an AS path
+type Segment struct {
+	Type SegmentType
+	ASNs []uint32
+}
+
+// Peer is a BGP peer of the collector which produced the dump
+type Peer struct {
+	BGPID   net.IP
+	Address net.IP
+	AS      uint32
+}
+
+// Route is a single route seen from a peer, or the withdrawal of a route
+type Route struct {
+	Time        time.Time
+	Peer        Peer
+	Prefix      *net.IPNet
+	Withdrawn   bool      // the route was withdrawn, so has no path or communities
+	Path        []Segment // the AS path, nearest AS first
+	Communities []uint32  // RFC 1997 communities, e.g. 65537:1 as 65537<<16|1
+}
+
+// Origin returns the AS originating the route: the last AS of the path,
+// ignoring confederation segments. It returns false for an empty path, and
+// for a path ending in an AS_SET of more than one AS, as aggregated routes
+// have no single origin.
+func (r *Route) Origin() (uint32, bool) {
+	for i := len(r.Path) - 1; i >= 0; i-- {
+		s := r.Path[i]
+		switch {
+		case s.Type == ConfedSequence || s.Type == ConfedSet || len(s.ASNs) == 0:
+			continue
+		case s.Type == ASSet && len(s.ASNs) > 1:
+			return 0, false
+		}
+
+		return s.ASNs[len(s.ASNs)-1], true
+	}
+
+	return 0, false
+}
+
+// PathString formats the AS path as a list of AS numbers, with sets in braces
+// and confederation segments in parentheses, e.g. 65536 65537 {65538,65539}
+func (r *Route) PathString() string {
+	parts := make([]string, len(r.Path))
+	for i, s := range r.Path {
+		asns := make([]string, len(s.ASNs))
+		for j, asn := range s.ASNs {
+			asns[j] = fmt.Sprint(asn)
+		}
+
+		switch s.Type {
+		case ASSet:
+			parts[i] = "{" + strings.Join(asns, ",") + "}"
+		case ConfedSequence:
+			parts[i] = "(" + strings.Join(asns, " ") + ")"
+		case ConfedSet:
+			parts[i] = "[" + strings.Join(asns, ",") + "]"
+		default:
+			parts[i] = strings.Join(asns, " ")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Reader reads the routes in an MRT dump. Records of types which are not
+// supported are skipped.
+type Reader struct {
+	r       *bufio.Reader
+	peers   []Peer   // the peers of the last TABLE_DUMP_V2 peer index table
+	pending []*Route // routes of the last record which are yet to be returned
+}
+
+// NewReader returns a Reader reading the MRT dump from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next route in the dump, or io.EOF once every record has
+// been read
+func (r *Reader) Next() (*Route, error) {
+	for len(r.pending) == 0 {
+		if err := r.readRecord(); err != nil {
+			return nil, err
+		}
+	}
+
+	route := r.pending[0]
+	r.pending = r.pending[1:]
+	return route, nil
+}
+
+// readRecord reads a single record, adding it's routes to the pending routes
+func (r *Reader) readRecord() error {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("truncated MRT record header")
+		}
+		return err
+	}
+
+	timestamp := time.Unix(int64(binary.BigEndian.Uint32(header)), 0).UTC()
+	typ, subtype := binary.BigEndian.Uint16(header[4:]), binary.BigEndian.Uint16(header[6:])
+	length := binary.BigEndian.Uint32(header[8:])
+	if length > maxRecordLength {
+		return fmt.Errorf("invalid MRT record length %d", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("truncated MRT record of type %d", typ)
+		}
+		return err
+	}
+
+	var err error
+	switch typ {
+	case typeTableDumpV2:
+		err = r.readTableDumpV2(subtype, timestamp, body)
+	case typeBGP4MP, typeBGP4MPET:
+		if typ == typeBGP4MPET && len(body) >= 4 {
+			micros := binary.BigEndian.Uint32(body)
+			timestamp = timestamp.Add(time.Duration(micros) * time.Microsecond)
+			body = body[4:]
+		}
+		err = r.readBGP4MP(subtype, timestamp, body)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid MRT record of type %d subtype %d: %s", typ, subtype, err)
+	}
+
+	return nil
+}
+
+func (r *Reader) readTableDumpV2(subtype uint16, timestamp time.Time, body []byte) error {
+	d := &decoder{b: body}
+	switch subtype {
+	case subtypePeerIndexTable:
+		d.bytes(4) // collector BGP ID
+		d.bytes(int(d.u16()))
+		peers := make([]Peer, d.u16())
+		for i := range peers {
+			flags := d.u8()
+			peers[i].BGPID = net.IP(d.bytes(4))
+			if flags&1 == 1 {
+				peers[i].Address = net.IP(d.bytes(net.IPv6len))
+			} else {
+				peers[i].Address = net.IP(d.bytes(net.IPv4len))
+			}
+			if flags&2 == 2 {
+				peers[i].AS = d.u32()
+			} else {
+				peers[i].AS = uint32(d.u16())
+			}
+		}
+		if d.err != nil {
+			return d.err
+		}
+		r.peers = peers
+	case subtypeRIBIPv4Unicast, subtypeRIBIPv6Unicast:
+		size := net.IPv4len
+		if subtype == subtypeRIBIPv6Unicast {
+			size = net.IPv6len
+		}
+
+		d.u32() // sequence number
+		ipnet := d.prefix(size)
+		count := int(d.u16())
+		for i := 0; i < count && d.err == nil; i++ {
+			index := int(d.u16())
+			originated := time.Unix(int64(d.u32()), 0).UTC()
+			attrs := d.bytes(int(d.u16()))
+			if d.err != nil {
+				break
+			}
+			if index >= len(r.peers) {
+				return fmt.Errorf("peer index %d not in the peer index table", index)
+			}
+
+			a, err := parseAttributes(attrs, true, false)
+			if err != nil {
+				return err
+			}
+			r.pending = append(r.pending, &Route{
+				Time:        originated,
+				Peer:        r.peers[index],
+				Prefix:      ipnet,
+				Path:        a.path,
+				Communities: a.communities,
+			})
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) readBGP4MP(subtype uint16, timestamp time.Time, body []byte) error {
+	var as4 bool
+	switch subtype {
+	case subtypeMessageAS4, subtypeMessageAS4Local:
+		as4 = true
+	case subtypeMessage, subtypeMessageLocal:
+	default:
+		return nil
+	}
+
+	d := &decoder{b: body}
+	var peer Peer
+	if as4 {
+		peer.AS = d.u32()
+		d.u32() // local AS
+	} else {
+		peer.AS = uint32(d.u16())
+		d.u16()
+	}
+	d.u16() // interface index
+
+	size := net.IPv4len
+	switch afi := d.u16(); {
+	case d.err != nil:
+		return d.err
+	case afi == afiIPv6:
+		size = net.IPv6len
+	case afi != afiIPv4:
+		return fmt.Errorf("address family %d", afi)
+	}
+	peer.Address = net.IP(d.bytes(size))
+	d.bytes(size) // local address
+
+	d.bytes(bgpMarkerLength)
+	length := int(d.u16())
+	typ := d.u8()
+	if d.err != nil {
+		return d.err
+	}
+	if typ != bgpTypeUpdate {
+		return nil
+	}
+	if length != bgpMarkerLength+3+len(d.b) {
+		return fmt.Errorf("BGP message length %d", length)
+	}
+
+	withdrawn := &decoder{b: d.bytes(int(d.u16()))}
+	attrs := d.bytes(int(d.u16()))
+	if d.err != nil {
+		return d.err
+	}
+
+	a, err := parseAttributes(attrs, as4, true)
+	if err != nil {
+		return err
+	}
+
+	path := a.path
+	if !as4 && a.as4Path != nil {
+		path = mergeAS4Path(a.path, a.as4Path)
+	}
+
+	// the withdrawn routes and NLRI fields only carry IPv4 prefixes
+	unreach, reach := a.unreach, a.reach
+	for len(withdrawn.b) > 0 && withdrawn.err == nil {
+		unreach = append(unreach, withdrawn.prefix(net.IPv4len))
+	}
+	for len(d.b) > 0 && d.err == nil {
+		reach = append(reach, d.prefix(net.IPv4len))
+	}
+	if withdrawn.err != nil {
+		return withdrawn.err
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	for _, ipnet := range unreach {
+		r.pending = append(r.pending, &Route{Time: timestamp, Peer: peer, Prefix: ipnet, Withdrawn: true})
+	}
+	for _, ipnet := range reach {
+		r.pending = append(r.pending, &Route{
+			Time:        timestamp,
+			Peer:        peer,
+			Prefix:      ipnet,
+			Path:        path,
+			Communities: a.communities,
+		})
+	}
+
+	return nil
+}
+
+// decoder reads the fields of a record, recording the first error so that the
+// fields of a record can be read before checking it
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) u8() uint8 {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+// prefix reads a prefix length followed by the significant bytes of the
+// prefix, for addresses of the given size
+func (d *decoder) prefix(size int) *net.IPNet {
+	length := int(d.u8())
+	if d.err == nil && length > size*8 {
+		d.err = fmt.Errorf("prefix length %d", length)
+	}
+
+	b := d.bytes((length + 7) / 8)
+	if d.err != nil {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, b)
+	mask := net.CIDRMask(length, size*8)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
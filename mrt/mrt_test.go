@@ -0,0 +1,337 @@
+package mrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// record encodes an MRT record with the timestamp 2021-01-01T00:00:00Z
+func record(typ, subtype uint16, body []byte) []byte {
+	return join(be32(1609459200), be16(typ), be16(subtype), be32(uint32(len(body))), body)
+}
+
+func peerIndexTable() []byte {
+	return record(typeTableDumpV2, subtypePeerIndexTable, join(
+		[]byte{192, 0, 2, 255}, be16(4), []byte("test"), be16(2),
+		// an IPv4 peer with a two byte AS number
+		[]byte{0}, []byte{192, 0, 2, 1}, []byte{192, 0, 2, 1}, be16(65001),
+		// an IPv6 peer with a four byte AS number
+		[]byte{3}, []byte{192, 0, 2, 2}, net.ParseIP("2001:db8::2"), be32(4200000000),
+	))
+}
+
+// asPath encodes an AS_PATH attribute of four byte AS numbers
+func asPath(segments ...Segment) []byte {
+	var value []byte
+	for _, s := range segments {
+		value = append(value, byte(s.Type), byte(len(s.ASNs)))
+		for _, asn := range s.ASNs {
+			value = append(value, be32(asn)...)
+		}
+	}
+
+	return join([]byte{0x40, attrASPath, byte(len(value))}, value)
+}
+
+func communities(values ...uint32) []byte {
+	var value []byte
+	for _, v := range values {
+		value = append(value, be32(v)...)
+	}
+
+	return join([]byte{0xc0 | extendedLength, attrCommunities}, be16(uint16(len(value))), value)
+}
+
+func ribEntry(peer uint16, attrs ...[]byte) []byte {
+	a := join(attrs...)
+	return join(be16(peer), be32(1577836800), be16(uint16(len(a))), a)
+}
+
+func rib(subtype uint16, prefix []byte, entries ...[]byte) []byte {
+	return record(typeTableDumpV2, subtype, join(be32(0), prefix, be16(uint16(len(entries))), join(entries...)))
+}
+
+func sequence(asns ...uint32) Segment {
+	return Segment{Type: ASSequence, ASNs: asns}
+}
+
+func dump() []byte {
+	return join(
+		peerIndexTable(),
+		rib(subtypeRIBIPv4Unicast, []byte{24, 192, 0, 2},
+			ribEntry(0, asPath(sequence(65001, 65537)), communities(65001<<16|100)),
+			ribEntry(1, asPath(sequence(4200000000, 65002), Segment{Type: ConfedSequence, ASNs: []uint32{64512}}, sequence(65538))),
+		),
+		// an unsupported record, which is skipped
+		record(12, 0, []byte{1, 2, 3}),
+		rib(subtypeRIBIPv6Unicast, []byte{32, 0x20, 0x01, 0x0d, 0xb8},
+			ribEntry(1, asPath(sequence(4200000000, 65003), Segment{Type: ASSet, ASNs: []uint32{65004, 65005}})),
+		),
+	)
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(bytes.NewReader(dump()))
+
+	var routes []*Route
+	for {
+		route, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		routes = append(routes, route)
+	}
+
+	if !assert.Len(t, routes, 3) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "192.0.2.0/24", routes[0].Prefix.String())
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), routes[0].Time)
+	assert.Equal(t, uint32(65001), routes[0].Peer.AS)
+	assert.Equal(t, "192.0.2.1", routes[0].Peer.Address.String())
+	assert.Equal(t, "65001 65537", routes[0].PathString())
+	assert.Equal(t, []uint32{65001<<16 | 100}, routes[0].Communities)
+
+	assert.Equal(t, uint32(4200000000), routes[1].Peer.AS)
+	assert.Equal(t, "2001:db8::2", routes[1].Peer.Address.String())
+	assert.Equal(t, "4200000000 65002 (64512) 65538", routes[1].PathString())
+
+	assert.Equal(t, "2001:db8::/32", routes[2].Prefix.String())
+	assert.Equal(t, "4200000000 65003 {65004,65005}", routes[2].PathString())
+}
+
+func TestOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []Segment
+		expected uint32
+		ok       bool
+	}{
+		{"sequence", []Segment{sequence(65001, 65537)}, 65537, true},
+		{"confederation", []Segment{sequence(65001), {Type: ConfedSequence, ASNs: []uint32{64512}}}, 65001, true},
+		{"single AS set", []Segment{sequence(65001), {Type: ASSet, ASNs: []uint32{65537}}}, 65537, true},
+		{"aggregate", []Segment{sequence(65001), {Type: ASSet, ASNs: []uint32{65537, 65538}}}, 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, ok := (&Route{Path: tt.path}).Origin()
+			assert.Equal(t, tt.expected, origin)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"truncated header", []byte{0, 0, 0}, "truncated MRT record header"},
+		{"truncated record", peerIndexTable()[:20], "truncated MRT record of type 13"},
+		{"RIB before peers", rib(subtypeRIBIPv4Unicast, []byte{24, 192, 0, 2}, ribEntry(0)),
+			"invalid MRT record of type 13 subtype 2: peer index 0 not in the peer index table"},
+		{"prefix length", join(peerIndexTable(), rib(subtypeRIBIPv4Unicast, []byte{33, 192, 0, 2, 0, 0})),
+			"invalid MRT record of type 13 subtype 2: prefix length 33"},
+		{"segment type", join(peerIndexTable(), rib(subtypeRIBIPv4Unicast, []byte{24, 192, 0, 2}, ribEntry(0, asPath(Segment{Type: 5})))),
+			"invalid MRT record of type 13 subtype 2: invalid path attribute 2: segment type 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(tt.input))
+			var err error
+			for err == nil {
+				_, err = r.Next()
+			}
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestLoadRIB(t *testing.T) {
+	rib, err := LoadRIB(bytes.NewReader(dump()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, ipnet, _ := net.ParseCIDR("192.0.2.0/24")
+	assert.Equal(t, []uint32{65537, 65538}, rib.Origins(ipnet))
+
+	// the IPv6 route is an aggregate without a single origin
+	_, ipnet, _ = net.ParseCIDR("2001:db8::/32")
+	assert.Empty(t, rib.Origins(ipnet))
+	assert.Equal(t, 1, rib.Len())
+}
+
+// update encodes a BGP4MP record carrying a BGP UPDATE message from 192.0.2.1
+func update(typ, subtype uint16, withdrawn, attrs, nlri []byte) []byte {
+	msg := join(be16(uint16(len(withdrawn))), withdrawn, be16(uint16(len(attrs))), attrs, nlri)
+	msg = join(bytes.Repeat([]byte{0xff}, bgpMarkerLength), be16(uint16(bgpMarkerLength+3+len(msg))), []byte{bgpTypeUpdate}, msg)
+
+	var peers []byte
+	if subtype == subtypeMessageAS4 {
+		peers = join(be32(65001), be32(65000))
+	} else {
+		peers = join(be16(65001), be16(65000))
+	}
+	body := join(peers, be16(0), be16(afiIPv4), []byte{192, 0, 2, 1}, []byte{192, 0, 2, 2}, msg)
+	if typ == typeBGP4MPET {
+		body = join(be32(500000), body)
+	}
+
+	return record(typ, subtype, body)
+}
+
+// asPath2 encodes an AS_PATH attribute of two byte AS numbers, followed by an
+// AS4_PATH attribute if as4 is given
+func asPath2(path []uint16, as4 ...uint32) []byte {
+	value := []byte{byte(ASSequence), byte(len(path))}
+	for _, asn := range path {
+		value = append(value, be16(asn)...)
+	}
+	attr := join([]byte{0x40, attrASPath, byte(len(value))}, value)
+	if len(as4) == 0 {
+		return attr
+	}
+
+	value = []byte{byte(ASSequence), byte(len(as4))}
+	for _, asn := range as4 {
+		value = append(value, be32(asn)...)
+	}
+	return join(attr, []byte{0xc0, attrAS4Path, byte(len(value))}, value)
+}
+
+func mpReach(nlri ...byte) []byte {
+	value := join(be16(afiIPv6), []byte{safiUnicast, 16}, net.ParseIP("2001:db8::1"), []byte{0}, nlri)
+	return join([]byte{0x80, attrMPReach, byte(len(value))}, value)
+}
+
+func mpUnreach(nlri ...byte) []byte {
+	value := join(be16(afiIPv6), []byte{safiUnicast}, nlri)
+	return join([]byte{0x80, attrMPUnreach, byte(len(value))}, value)
+}
+
+func TestReaderBGP4MP(t *testing.T) {
+	input := join(
+		update(typeBGP4MP, subtypeMessageAS4, nil,
+			asPath(sequence(65001, 65537)),
+			[]byte{24, 192, 0, 2, 24, 198, 51, 100}),
+		// a two byte AS speaker, with AS_TRANS replaced by AS4_PATH
+		update(typeBGP4MPET, subtypeMessage, []byte{24, 203, 0, 113},
+			asPath2([]uint16{65001, 23456}, 4200000000),
+			[]byte{16, 10, 1}),
+		update(typeBGP4MP, subtypeMessageAS4, nil,
+			join(asPath(sequence(65001, 65538)), mpReach(32, 0x20, 0x01, 0x0d, 0xb8), mpUnreach(48, 0x20, 0x01, 0x0d, 0xb8, 0, 1)),
+			nil),
+		// a state change, which is skipped
+		record(typeBGP4MP, 5, []byte{0}),
+	)
+
+	var routes []string
+	r := NewReader(bytes.NewReader(input))
+	for {
+		route, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		s := route.Prefix.String()
+		if route.Withdrawn {
+			s += " withdrawn"
+		} else {
+			s += " " + route.PathString()
+		}
+		routes = append(routes, s)
+
+		assert.Equal(t, uint32(65001), route.Peer.AS)
+		assert.Equal(t, "192.0.2.1", route.Peer.Address.String())
+	}
+
+	assert.Equal(t, []string{
+		"192.0.2.0/24 65001 65537",
+		"198.51.100.0/24 65001 65537",
+		"203.0.113.0/24 withdrawn",
+		"10.1.0.0/16 65001 4200000000",
+		"2001:db8:1::/48 withdrawn",
+		"2001:db8::/32 65001 65538",
+	}, routes)
+}
+
+func TestMergeAS4Path(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []Segment
+		as4Path  []Segment
+		expected []Segment
+	}{
+		{"trailing", []Segment{sequence(65001, 23456, 23456)}, []Segment{sequence(4200000000, 4200000001)},
+			[]Segment{sequence(65001), sequence(4200000000, 4200000001)}},
+		{"whole path", []Segment{sequence(23456)}, []Segment{sequence(4200000000)},
+			[]Segment{sequence(4200000000)}},
+		{"longer AS4_PATH", []Segment{sequence(65001)}, []Segment{sequence(65001, 4200000000)},
+			[]Segment{sequence(65001)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergeAS4Path(tt.path, tt.as4Path))
+		})
+	}
+}
+
+func TestRIBUpdates(t *testing.T) {
+	rib, err := LoadRIB(bytes.NewReader(dump()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// the peer 192.0.2.1 replaces it's route, then withdraws it
+	err = rib.Read(bytes.NewReader(join(
+		update(typeBGP4MP, subtypeMessageAS4, nil, asPath(sequence(65001, 65539)), []byte{24, 192, 0, 2}),
+		update(typeBGP4MP, subtypeMessageAS4, nil, asPath(sequence(65001, 65540)), []byte{24, 198, 51, 100}),
+	)))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, ipnet, _ := net.ParseCIDR("192.0.2.0/24")
+	assert.Equal(t, []uint32{65538, 65539}, rib.Origins(ipnet))
+
+	err = rib.Read(bytes.NewReader(update(typeBGP4MP, subtypeMessageAS4, []byte{24, 192, 0, 2}, nil, nil)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint32{65538}, rib.Origins(ipnet))
+		assert.Equal(t, 2, rib.Len())
+	}
+}
@@ -0,0 +1,153 @@
+package mrt
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RIB records the AS numbers originating each prefix in a dump
+type RIB struct {
+	// the origin of the route from each peer, keyed by prefix and then by
+	// the peer's address
+	origins map[string]map[string]uint32
+}
+
+// NewRIB returns an empty RIB
+func NewRIB() *RIB {
+	return &RIB{origins: make(map[string]map[string]uint32)}
+}
+
+// Add records the route's origin for it's prefix, replacing the route for the
+// prefix from the same peer. Withdrawn routes, and routes without a single
+// origin, remove the route from the peer.
+func (rib *RIB) Add(route *Route) {
+	k, peer := route.Prefix.String(), route.Peer.Address.String()
+	origin, ok := route.Origin()
+	if route.Withdrawn || !ok {
+		delete(rib.origins[k], peer)
+		if len(rib.origins[k]) == 0 {
+			delete(rib.origins, k)
+		}
+		return
+	}
+
+	if rib.origins[k] == nil {
+		rib.origins[k] = make(map[string]uint32)
+	}
+	rib.origins[k][peer] = origin
+}
+
+// Origins returns the AS numbers seen originating exactly the prefix, in
+// ascending order
+func (rib *RIB) Origins(ipnet *net.IPNet) []uint32 {
+	seen := make(map[uint32]bool)
+	var origins []uint32
+	for _, origin := range rib.origins[ipnet.String()] {
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	sort.Slice(origins, func(i, j int) bool { return origins[i] < origins[j] })
+
+	return origins
+}
+
+// Len returns the number of prefixes in the RIB
+func (rib *RIB) Len() int {
+	return len(rib.origins)
+}
+
+// Read reads every route in an MRT dump into the RIB. Update files may be read
+// after a RIB dump to bring it up to date.
+func (rib *RIB) Read(r io.Reader) error {
+	mr := NewReader(r)
+	for {
+		route, err := mr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rib.Add(route)
+	}
+}
+
+// ReadFile reads an MRT dump from a file into the RIB, see Read. Files ending
+// in .gz or .bz2, as published by RIPE RIS and RouteViews, are decompressed.
+func (rib *RIB) ReadFile(name string) error {
+	f, err := Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return rib.Read(f)
+}
+
+// LoadRIB reads an MRT dump into a new RIB, see Read
+func LoadRIB(r io.Reader) (*RIB, error) {
+	rib := NewRIB()
+	if err := rib.Read(r); err != nil {
+		return nil, err
+	}
+
+	return rib, nil
+}
+
+// LoadFile reads MRT dumps from files into a new RIB, in order, see ReadFile
+func LoadFile(names ...string) (*RIB, error) {
+	rib := NewRIB()
+	for _, name := range names {
+		if err := rib.ReadFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return rib, nil
+}
+
+// Open opens an MRT dump, decompressing files ending in .gz or .bz2
+func Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &decompressor{Reader: gz, closers: []io.Closer{gz, f}}, nil
+	case strings.HasSuffix(name, ".bz2"):
+		return &decompressor{Reader: bzip2.NewReader(f), closers: []io.Closer{f}}, nil
+	}
+
+	return f, nil
+}
+
+// decompressor reads a compressed file, closing the decompressor and the file
+type decompressor struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressor) Close() error {
+	var first error
+	for _, c := range d.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
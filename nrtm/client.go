@@ -0,0 +1,233 @@
+package nrtm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/parser"
+)
+
+// DefaultPort is the port NRTM queries are made to when an address does not
+// include one, IRRd serving them on the whois port
+const DefaultPort = "43"
+
+// DefaultTimeout limits how long fetching changes may take when
+// Client.Timeout is not set
+const DefaultTimeout = 5 * time.Minute
+
+// Error is an error returned by the server, e.g. for an unknown source or a
+// range of serials which is not available
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("nrtm: error %d: %s", e.Code, e.Message)
+}
+
+// Client fetches the changes made to a source from an NRTM version 3 server,
+// such as IRRd or the RIPE database
+type Client struct {
+	Address string
+	Source  string
+	Timeout time.Duration
+	// Dial connects to the server, net.DialTimeout is used if it is nil
+	Dial func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// NewClient returns a client for the source, e.g. RADB, served at the address
+func NewClient(address, source string) *Client {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	return &Client{Address: address, Source: source}
+}
+
+// Mirror applies the changes made after serial to the database, one serial at
+// a time, returning the serial of the last change applied. If an error occurs
+// the changes before it remain applied, so mirroring may be resumed from the
+// serial returned.
+func (c *Client) Mirror(d *db.Database, serial uint32) (uint32, error) {
+	changes, err := c.Fetch(serial+1, 0)
+	for _, change := range changes {
+		if applyErr := change.Apply(d); applyErr != nil {
+			return serial, applyErr
+		}
+		serial = change.Serial
+	}
+
+	return serial, err
+}
+
+// Fetch returns the changes from serial first to last inclusive, or to the
+// most recent change if last is 0. No changes are returned if there are none
+// after first. If an error occurs reading the response, the changes read
+// before it are returned along with the error.
+func (c *Client) Fetch(first, last uint32) ([]Change, error) {
+	dial := c.Dial
+	if dial == nil {
+		dial = net.DialTimeout
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := dial("tcp", c.Address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	end := "LAST"
+	if last != 0 {
+		end = strconv.FormatUint(uint64(last), 10)
+	}
+	if _, err := fmt.Fprintf(conn, "-g %s:3:%d-%s\r\n", c.Source, first, end); err != nil {
+		return nil, err
+	}
+
+	return readChanges(bufio.NewReader(conn), c.Source, first)
+}
+
+// readChanges reads an NRTM version 3 response, which begins with
+// %START Version: 3 <source> <first>-<last> and ends with %END <source>. Each
+// change between them is an ADD or DEL line with it's serial, followed by the
+// object after an empty line.
+func readChanges(r *bufio.Reader, source string, first uint32) ([]Change, error) {
+	var changes []Change
+	started, comments, next := false, false, first
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if !started && comments {
+				// only a warning is sent when there are no newer changes
+				return nil, nil
+			}
+			if !started {
+				return nil, fmt.Errorf("empty response")
+			}
+			return changes, fmt.Errorf("unexpected end of response after serial %d", next-1)
+		}
+		if err != nil && err != io.EOF {
+			return changes, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case strings.HasPrefix(line, "%ERROR:"):
+			return changes, parseError(line)
+		case !started && fields[0] == "%START":
+			if err := checkStart(fields, source, first); err != nil {
+				return nil, err
+			}
+			started = true
+		case !started && strings.HasPrefix(line, "%"):
+			// comments, such as a warning that there are no newer changes
+			comments = true
+		case started && fields[0] == "%END":
+			return changes, nil
+		case started && (fields[0] == "ADD" || fields[0] == "DEL") && len(fields) == 2:
+			change, err := readChange(r, fields, next)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, change)
+			next++
+		default:
+			return changes, fmt.Errorf("unexpected line %q", line)
+		}
+	}
+}
+
+// checkStart checks a %START line matches the query
+func checkStart(fields []string, source string, first uint32) error {
+	if len(fields) != 5 || fields[1] != "Version:" {
+		return fmt.Errorf("invalid start %q", strings.Join(fields, " "))
+	}
+	if fields[2] != "3" {
+		return fmt.Errorf("unsupported NRTM version %s", fields[2])
+	}
+	if !strings.EqualFold(fields[3], source) {
+		return fmt.Errorf("unexpected source %s", fields[3])
+	}
+
+	serials := strings.SplitN(fields[4], "-", 2)
+	if serials[0] != strconv.FormatUint(uint64(first), 10) {
+		return fmt.Errorf("unexpected serials %s", fields[4])
+	}
+
+	return nil
+}
+
+// readChange reads the object following an ADD or DEL line, which must be for
+// the next serial
+func readChange(r *bufio.Reader, fields []string, next uint32) (Change, error) {
+	change := Change{Operation: Add}
+	if fields[0] == "DEL" {
+		change.Operation = Delete
+	}
+
+	serial, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil || uint32(serial) != next {
+		return change, fmt.Errorf("unexpected serial %s, expected %d", fields[1], next)
+	}
+	change.Serial = uint32(serial)
+
+	var text strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return change, err
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if text.Len() > 0 || err == io.EOF {
+				break
+			}
+			continue
+		}
+		text.WriteString(strings.TrimRight(line, "\r\n") + "\n")
+		if err == io.EOF {
+			break
+		}
+	}
+
+	objects, err := parser.Parse(fmt.Sprintf("serial %d", serial), text.String())
+	if err != nil {
+		return change, fmt.Errorf("serial %d: %s", serial, err)
+	}
+	if len(objects) > 1 {
+		return change, fmt.Errorf("serial %d: %d objects", serial, len(objects))
+	}
+	if len(objects) == 1 {
+		change.Object = objects[0]
+	}
+
+	return change, nil
+}
+
+// parseError parses a %ERROR:<code>: <message> line
+func parseError(line string) error {
+	parts := strings.SplitN(strings.TrimPrefix(line, "%ERROR:"), ":", 2)
+	code, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) != 2 {
+		return &Error{Message: strings.TrimPrefix(line, "%ERROR:")}
+	}
+
+	return &Error{Code: code, Message: strings.TrimSpace(parts[1])}
+}
@@ -0,0 +1,158 @@
+package nrtm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+)
+
+// Operation is the kind of a change, ADD or DEL
+type Operation int
+
+const (
+	// Add adds an object, replacing any existing object with the same class
+	// and primary key
+	Add Operation = iota
+	// Delete removes an object
+	Delete
+)
+
+func (op Operation) String() string {
+	if op == Delete {
+		return "DEL"
+	}
+
+	return "ADD"
+}
+
+// Change is a single numbered change to a database. The Object of a change
+// read from a mirror is nil if it's class is not supported by the parser.
+type Change struct {
+	Serial    uint32
+	Operation Operation
+	Object    *ast.Object
+}
+
+// Apply makes the change to the database, a change without an object is
+// ignored
+func (c Change) Apply(d *db.Database) error {
+	if c.Object == nil {
+		return nil
+	}
+
+	if c.Operation == Delete {
+		if _, ok := d.Remove(c.Object); !ok {
+			return fmt.Errorf("serial %d: %s %s not found", c.Serial, c.Object.Class().Name(), c.Object.Key())
+		}
+		return nil
+	}
+
+	if err := d.Add(c.Object); err != nil {
+		return fmt.Errorf("serial %d: %s", c.Serial, err)
+	}
+	return nil
+}
+
+// Journal makes changes to a database, numbering and recording each one so
+// they can be served to mirrors. A Journal is safe for concurrent use.
+type Journal struct {
+	Source string
+
+	mu      sync.RWMutex
+	d       *db.Database
+	serial  uint32   // the serial of the last change
+	changes []Change // the recorded changes, ending with serial
+}
+
+// NewJournal returns a journal of the changes made to the database for the
+// source, e.g. RADB. The serial is that of the database's current contents,
+// the first change being numbered serial+1.
+func NewJournal(d *db.Database, source string, serial uint32) *Journal {
+	return &Journal{Source: source, d: d, serial: serial}
+}
+
+// Database returns the database the changes are made to
+func (j *Journal) Database() *db.Database {
+	return j.d
+}
+
+// Serial returns the serial of the last change
+func (j *Journal) Serial() uint32 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.serial
+}
+
+// Range returns the serials of the first and last changes which have been
+// recorded. If none have, first is greater than last.
+func (j *Journal) Range() (first, last uint32) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.serial - uint32(len(j.changes)) + 1, j.serial
+}
+
+// Add adds the object to the database, returning the serial of the change
+func (j *Journal) Add(obj *ast.Object) (uint32, error) {
+	return j.Apply(Change{Operation: Add, Object: obj})
+}
+
+// Delete removes the object from the database, returning the serial of the
+// change
+func (j *Journal) Delete(obj *ast.Object) (uint32, error) {
+	return j.Apply(Change{Operation: Delete, Object: obj})
+}
+
+// Apply makes the change to the database and records it under the next
+// serial, which is returned. The change's own serial is ignored, so changes
+// read from a mirror may be journalled to be served in turn. A change which
+// fails is not recorded.
+func (j *Journal) Apply(c Change) (uint32, error) {
+	if c.Object == nil {
+		return 0, fmt.Errorf("change has no object")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	c.Serial = j.serial + 1
+	if c.Operation == Delete {
+		// journal the deleted object as it was, not as given
+		existing, ok := j.d.Remove(c.Object)
+		if !ok {
+			return 0, fmt.Errorf("%s %s not found", c.Object.Class().Name(), c.Object.Key())
+		}
+		c.Object = existing
+	} else if err := c.Apply(j.d); err != nil {
+		return 0, err
+	}
+
+	j.serial = c.Serial
+	j.changes = append(j.changes, c)
+	return c.Serial, nil
+}
+
+// Changes returns the recorded changes from serial first to last inclusive
+func (j *Journal) Changes(first, last uint32) ([]Change, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	oldest := j.serial - uint32(len(j.changes)) + 1
+	if first < oldest || last > j.serial || first > last {
+		return nil, &RangeError{First: oldest, Last: j.serial}
+	}
+
+	return append([]Change(nil), j.changes[first-oldest:last-oldest+1]...), nil
+}
+
+// RangeError is returned when changes outside of those recorded are requested
+type RangeError struct {
+	First, Last uint32 // the serials which are available
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("invalid range: Not within %d-%d", e.First, e.Last)
+}
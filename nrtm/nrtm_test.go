@@ -0,0 +1,294 @@
+package nrtm
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `route:          192.0.2.0/24
+origin:         AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+
+route:          198.51.100.0/24
+origin:         AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+
+as-set:         AS-TEST
+members:        AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+`
+
+func parse(t *testing.T, text string) *ast.Object {
+	objects, err := parser.Parse("test", text)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1) {
+		t.FailNow()
+	}
+
+	return objects[0]
+}
+
+func dump(d *db.Database) string {
+	var out strings.Builder
+	for _, obj := range d.Objects() {
+		out.WriteString(obj.String() + "\n")
+	}
+
+	return out.String()
+}
+
+// newTestServer serves the journal over loopback TCP
+func newTestServer(t *testing.T, j *Journal) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(j)
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+// stubServer answers every query with the response, returning the address it
+// listens on and a channel receiving each query
+func stubServer(t *testing.T, response string) (net.Listener, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			query, _ := bufio.NewReader(conn).ReadString('\n')
+			queries <- query
+			conn.Write([]byte(response))
+			conn.Close()
+		}
+	}()
+
+	return l, queries
+}
+
+// changeUpstream makes changes through the journal: adding a route, changing
+// the as-set and deleting a route
+func changeUpstream(t *testing.T, j *Journal) {
+	serial, err := j.Add(parse(t, "route:          203.0.113.0/24\norigin:         AS65538\nmnt-by:         MAINT-TEST\nsource:         TEST\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(101), serial)
+
+	serial, err = j.Add(parse(t, "as-set:         AS-TEST\nmembers:        AS65537, AS65538\nmnt-by:         MAINT-TEST\nsource:         TEST\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(102), serial)
+
+	serial, err = j.Delete(parse(t, "route:          198.51.100.0/24\norigin:         AS65537\nsource:         TEST\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(103), serial)
+}
+
+func TestJournal(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+	j := NewJournal(d, "TEST", 100)
+
+	first, last := j.Range()
+	assert.True(t, first > last)
+
+	changeUpstream(t, j)
+	assert.Equal(t, uint32(103), j.Serial())
+	first, last = j.Range()
+	assert.Equal(t, uint32(101), first)
+	assert.Equal(t, uint32(103), last)
+
+	_, err := j.Delete(parse(t, "route:          198.51.100.0/24\norigin:         AS65537\nsource:         TEST\n"))
+	assert.EqualError(t, err, "route 198.51.100.0/24AS65537 not found")
+	assert.Equal(t, uint32(103), j.Serial())
+
+	changes, err := j.Changes(102, 103)
+	if assert.NoError(t, err) && assert.Len(t, changes, 2) {
+		assert.Equal(t, Add, changes[0].Operation)
+		assert.Equal(t, []string{"AS65537", "AS65538"}, changes[0].Object.Values(token.ATTR_AS_SET_MEMBERS))
+		assert.Equal(t, Delete, changes[1].Operation)
+		// the object deleted is journalled, rather than the one given
+		assert.Equal(t, "MAINT-TEST", changes[1].Object.Value(token.ATTR_MAINTAINED_BY))
+	}
+
+	for _, serials := range [][2]uint32{{100, 103}, {101, 104}, {103, 102}} {
+		_, err = j.Changes(serials[0], serials[1])
+		assert.EqualError(t, err, "invalid range: Not within 101-103")
+	}
+
+	assert.Equal(t, 3, j.Database().Len())
+	_, ok := j.Database().Get(token.CLASS_ROUTE, "198.51.100.0/24AS65537")
+	assert.False(t, ok)
+}
+
+func TestMirror(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+	j := NewJournal(d, "TEST", 100)
+	s, address := newTestServer(t, j)
+	defer s.Close()
+
+	mirror := db.New()
+	require.NoError(t, mirror.Load("test", strings.NewReader(testDatabase)))
+	c := NewClient(address, "TEST")
+
+	serial, err := c.Mirror(mirror, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100), serial)
+
+	changeUpstream(t, j)
+	serial, err = c.Mirror(mirror, serial)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(103), serial)
+	assert.Equal(t, dump(j.Database()), dump(mirror))
+
+	serial, err = c.Mirror(mirror, serial)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(103), serial)
+
+	// a mirror may journal the changes to serve them in turn
+	base := db.New()
+	require.NoError(t, base.Load("test", strings.NewReader(testDatabase)))
+	downstream := NewJournal(base, "TEST", 0)
+	changes, err := c.Fetch(101, 0)
+	assert.NoError(t, err)
+	for _, change := range changes {
+		_, err := downstream.Apply(change)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint32(3), downstream.Serial())
+	assert.Equal(t, dump(j.Database()), dump(downstream.Database()))
+
+	changes, err = c.Fetch(102, 102)
+	if assert.NoError(t, err) && assert.Len(t, changes, 1) {
+		assert.Equal(t, uint32(102), changes[0].Serial)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+	j := NewJournal(d, "TEST", 100)
+	changeUpstream(t, j)
+	s, address := newTestServer(t, j)
+	defer s.Close()
+
+	_, err := NewClient(address, "TEST").Fetch(50, 0)
+	assert.EqualError(t, err, "nrtm: error 401: invalid range: Not within 101-103")
+
+	_, err = NewClient(address, "TEST").Fetch(102, 110)
+	assert.EqualError(t, err, "nrtm: error 401: invalid range: Not within 101-103")
+
+	_, err = NewClient(address, "RADB").Fetch(101, 0)
+	assert.EqualError(t, err, "nrtm: error 403: unknown source RADB")
+
+	conn, err := net.Dial("tcp", address)
+	if assert.NoError(t, err) {
+		conn.Write([]byte("-g TEST:1:101-LAST\n"))
+		response, _ := bufio.NewReader(conn).ReadString('\n')
+		assert.Equal(t, "%ERROR:405: unsupported version 1\n", response)
+		conn.Close()
+	}
+}
+
+const ripeResponse = `% The RIPE Database is subject to Terms and Conditions.
+
+%START Version: 3 RIPE 11012700-11012702
+
+ADD 11012700
+
+route:          192.0.2.0/24
+origin:         AS65537
+source:         RIPE
+
+ADD 11012701
+
+inetnum:        192.0.2.0 - 192.0.2.255
+netname:        TEST
+source:         RIPE
+
+DEL 11012702
+
+route:          198.51.100.0/24
+origin:         AS65537
+source:         RIPE
+
+%END RIPE
+`
+
+func TestReadChanges(t *testing.T) {
+	l, queries := stubServer(t, ripeResponse)
+	defer l.Close()
+
+	d := db.New()
+	assert.NoError(t, d.Load("test", strings.NewReader("route: 198.51.100.0/24\norigin: AS65537\nsource: RIPE\n")))
+
+	serial, err := NewClient(l.Addr().String(), "RIPE").Mirror(d, 11012699)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(11012702), serial)
+	assert.Equal(t, "-g RIPE:3:11012700-LAST\r\n", <-queries)
+
+	// the inetnum is not supported, but it's serial is still counted
+	assert.Equal(t, 1, d.Len())
+	_, ok := d.Get(token.CLASS_ROUTE, "192.0.2.0/24AS65537")
+	assert.True(t, ok)
+}
+
+func TestReadChangesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		serial   uint32 // the serial mirroring reaches
+		err      string
+	}{
+		{"no updates", "% Warning: there are no newer updates available\n", 11012699, ""},
+		{"empty", "", 11012699, "empty response"},
+		{"error", "%ERROR:401: invalid range: Not within 1-5\n", 11012699, "nrtm: error 401: invalid range: Not within 1-5"},
+		{"version", "%START Version: 1 RIPE 11012700-11012702\n", 11012699, "unsupported NRTM version 1"},
+		{"source", "%START Version: 3 RADB 11012700-11012702\n", 11012699, "unexpected source RADB"},
+		{"start", "%START Version: 3 RIPE 11012701-11012702\n", 11012699, "unexpected serials 11012701-11012702"},
+		{"truncated", strings.Split(ripeResponse, "DEL")[0], 11012701, "unexpected end of response after serial 11012701"},
+		{"gap", strings.Replace(ripeResponse, "ADD 11012701", "ADD 11012705", 1), 11012700, "unexpected serial 11012705, expected 11012701"},
+		{"garbage", strings.Replace(ripeResponse, "DEL 11012702", "MOD 11012702", 1), 11012701, `unexpected line "MOD 11012702"`},
+		{"delete missing", strings.Replace(ripeResponse, "198.51.100.0/24", "203.0.113.0/24", 1), 11012701, "serial 11012702: route 203.0.113.0/24AS65537 not found"},
+	}
+
+	for _, tt := range tests {
+		l, _ := stubServer(t, tt.response)
+
+		d := db.New()
+		assert.NoError(t, d.Load("test", strings.NewReader("route: 198.51.100.0/24\norigin: AS65537\nsource: RIPE\n")))
+
+		serial, err := NewClient(l.Addr().String(), "RIPE").Mirror(d, 11012699)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.name)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.name)
+		}
+		assert.Equal(t, tt.serial, serial, tt.name)
+
+		// the changes before an error are applied
+		_, ok := d.Get(token.CLASS_ROUTE, "192.0.2.0/24AS65537")
+		assert.Equal(t, tt.serial > 11012699, ok, tt.name)
+
+		l.Close()
+	}
+}
@@ -0,0 +1,225 @@
+package nrtm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve once the server has been closed
+var ErrServerClosed = errors.New("nrtm: server closed")
+
+// NRTM error codes, as used by the RIPE database
+const (
+	errInvalidRange  = 401
+	errUnknownSource = 403
+	errInvalidQuery  = 405
+)
+
+// Server serves the changes recorded by a journal to mirrors, answering NRTM
+// version 3 queries of the form -g <source>:3:<first>-<last|LAST>
+type Server struct {
+	Journal *Journal
+	// Timeout limits how long each connection may take, DefaultTimeout is
+	// used if it is not set
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+}
+
+// NewServer returns a server for the changes recorded by the journal
+func NewServer(j *Journal) *Server {
+	return &Server{
+		Journal:   j,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// ListenAndServe listens on the TCP address and serves queries, see Serve
+func (s *Server) ListenAndServe(address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections from the listener, answering the query made on
+// each in a new goroutine. It always returns an error, ErrServerClosed once
+// Close has been called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server, closing it's listeners and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	query, err := bufio.NewReader(io.LimitReader(conn, 1024)).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	w := bufio.NewWriter(conn)
+	s.answer(w, strings.TrimSpace(query))
+	w.Flush()
+}
+
+// answer writes the response to a query
+func (s *Server) answer(w io.Writer, query string) {
+	first, last, err := s.parseQuery(query)
+	if err == nil && last == 0 {
+		if last = s.Journal.Serial(); first > last {
+			fmt.Fprintf(w, "%% Warning: there are no newer updates available\n")
+			return
+		}
+	}
+
+	var changes []Change
+	if err == nil {
+		changes, err = s.Journal.Changes(first, last)
+		if rangeErr, ok := err.(*RangeError); ok {
+			err = &Error{Code: errInvalidRange, Message: rangeErr.Error()}
+		}
+	}
+	if e, ok := err.(*Error); ok {
+		fmt.Fprintf(w, "%%ERROR:%d: %s\n", e.Code, e.Message)
+		return
+	}
+
+	fmt.Fprintf(w, "%%START Version: 3 %s %d-%d\n\n", s.Journal.Source, first, last)
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s %d\n\n%s\n", c.Operation, c.Serial, c.Object)
+	}
+	fmt.Fprintf(w, "%%END %s\n", s.Journal.Source)
+}
+
+// parseQuery parses a -g <source>:3:<first>-<last> query, in which last may
+// be LAST for the most recent change, returned as 0
+func (s *Server) parseQuery(query string) (first, last uint32, err error) {
+	invalid := &Error{Code: errInvalidQuery, Message: fmt.Sprintf("invalid query %q", query)}
+
+	fields := strings.Fields(query)
+	if len(fields) != 2 || fields[0] != "-g" {
+		return 0, 0, invalid
+	}
+
+	parts := strings.Split(fields[1], ":")
+	if len(parts) != 3 {
+		return 0, 0, invalid
+	}
+	if !strings.EqualFold(parts[0], s.Journal.Source) {
+		return 0, 0, &Error{Code: errUnknownSource, Message: fmt.Sprintf("unknown source %s", parts[0])}
+	}
+	if parts[1] != "3" {
+		return 0, 0, &Error{Code: errInvalidQuery, Message: fmt.Sprintf("unsupported version %s", parts[1])}
+	}
+
+	serials := strings.SplitN(parts[2], "-", 2)
+	if len(serials) != 2 {
+		return 0, 0, invalid
+	}
+
+	n, err := strconv.ParseUint(serials[0], 10, 32)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	first = uint32(n)
+
+	if strings.EqualFold(serials[1], "LAST") {
+		return first, 0, nil
+	}
+
+	if n, err = strconv.ParseUint(serials[1], 10, 32); err != nil || n == 0 {
+		return 0, 0, invalid
+	}
+
+	return first, uint32(n), nil
+}
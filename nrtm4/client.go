@@ -0,0 +1,410 @@
+package nrtm4
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// DefaultTimeout limits how long each download may take when
+// Client.HTTPClient is not set
+const DefaultTimeout = 5 * time.Minute
+
+// maxFileSize limits the size of a downloaded file, before decompression
+const maxFileSize = 4 << 30
+
+// recordSeparator begins each record of a JSON text sequence, RFC 7464
+const recordSeparator = 0x1e
+
+// Notification is the content of an update notification file, describing the
+// snapshot and deltas which are available for a source
+type Notification struct {
+	NRTMVersion    int       `json:"nrtm_version"`
+	Timestamp      time.Time `json:"timestamp"`
+	Type           string    `json:"type"`
+	Source         string    `json:"source"`
+	SessionID      string    `json:"session_id"`
+	Version        int       `json:"version"`
+	NextSigningKey string    `json:"next_signing_key,omitempty"`
+	Snapshot       FileRef   `json:"snapshot"`
+	Deltas         []FileRef `json:"deltas"`
+}
+
+// FileRef references a snapshot or delta file
+type FileRef struct {
+	Version int    `json:"version"`
+	URL     string `json:"url"`
+	Hash    string `json:"hash"` // the hex encoded SHA-256 of the file
+}
+
+// header is the first record of a snapshot or delta file
+type header struct {
+	NRTMVersion int    `json:"nrtm_version"`
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	SessionID   string `json:"session_id"`
+	Version     int    `json:"version"`
+}
+
+// record is any other record of a snapshot or delta file. A snapshot contains
+// only objects, while a delta's records have an action of add_modify, with an
+// object, or delete, with the object class and primary key.
+type record struct {
+	Action      string `json:"action"`
+	Object      string `json:"object"`
+	ObjectClass string `json:"object_class"`
+	PrimaryKey  string `json:"primary_key"`
+}
+
+// Client mirrors a source from an NRTM version 4 server. The SessionID and
+// Version are those of the database last returned by Update, and may be saved
+// and restored to continue mirroring.
+type Client struct {
+	// URL is the address of the update notification file
+	URL string
+	// Source is the name of the source being mirrored, e.g. RIPE
+	Source string
+	// PublicKeys verify the signature of the update notification file
+	PublicKeys []*ecdsa.PublicKey
+	// HTTPClient makes requests, a client with DefaultTimeout is used if it
+	// is nil
+	HTTPClient *http.Client
+
+	SessionID string
+	Version   int
+}
+
+// NewClient returns a client for the source, whose update notification file
+// is at the URL and is signed by the key
+func NewClient(url, source string, key *ecdsa.PublicKey) *Client {
+	return &Client{URL: url, Source: source, PublicKeys: []*ecdsa.PublicKey{key}}
+}
+
+// Notification downloads the update notification file, verifies it's
+// signature and checks it describes the source
+func (c *Client) Notification() (*Notification, error) {
+	data, err := c.get(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := verify(data, c.PublicKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("update notification file: %s", err)
+	}
+
+	var n Notification
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return nil, fmt.Errorf("invalid update notification file: %s", err)
+	}
+
+	switch {
+	case n.NRTMVersion != 4:
+		return nil, fmt.Errorf("unsupported NRTM version %d", n.NRTMVersion)
+	case n.Type != "notification":
+		return nil, fmt.Errorf("unexpected update notification file type %q", n.Type)
+	case !strings.EqualFold(n.Source, c.Source):
+		return nil, fmt.Errorf("unexpected source %s", n.Source)
+	case n.SessionID == "":
+		return nil, fmt.Errorf("update notification file has no session_id")
+	case n.Snapshot.Version <= 0 || n.Snapshot.Version > n.Version:
+		return nil, fmt.Errorf("invalid snapshot version %d", n.Snapshot.Version)
+	}
+
+	for i, delta := range n.Deltas {
+		if i > 0 && delta.Version != n.Deltas[i-1].Version+1 {
+			return nil, fmt.Errorf("deltas are not contiguous, version %d follows %d", delta.Version, n.Deltas[i-1].Version)
+		}
+		if i == len(n.Deltas)-1 && delta.Version != n.Version {
+			return nil, fmt.Errorf("last delta version %d is not the version %d", delta.Version, n.Version)
+		}
+	}
+
+	return &n, nil
+}
+
+// Update brings the database up to date with the server, returning the
+// database to use from then on. While the session is unchanged the deltas
+// published since Version are applied to d, each being checked completely
+// before it is applied. Otherwise, or when d is nil or the deltas needed are
+// no longer published, a new database is loaded from the snapshot and
+// returned. If an error occurs the database is returned as it was after the
+// last delta applied, with Version updated to match, or unchanged if the
+// snapshot could not be loaded.
+func (c *Client) Update(d *db.Database) (*db.Database, error) {
+	n, err := c.Notification()
+	if err != nil {
+		return d, err
+	}
+
+	if d == nil || c.SessionID != n.SessionID || !c.continuous(n) {
+		snapshot, err := c.loadSnapshot(n)
+		if err != nil {
+			return d, err
+		}
+		d = snapshot
+	}
+
+	for _, delta := range n.Deltas {
+		if delta.Version <= c.Version {
+			continue
+		}
+
+		if err := c.applyDelta(d, n, delta); err != nil {
+			return d, err
+		}
+		c.Version = delta.Version
+	}
+
+	return d, nil
+}
+
+// continuous reports whether the deltas published lead on from Version
+func (c *Client) continuous(n *Notification) bool {
+	switch {
+	case c.Version == n.Version:
+		return true
+	case c.Version > n.Version:
+		return false
+	}
+
+	return len(n.Deltas) > 0 && n.Deltas[0].Version <= c.Version+1
+}
+
+// loadSnapshot loads a new database from the snapshot
+func (c *Client) loadSnapshot(n *Notification) (*db.Database, error) {
+	records, err := c.download(n, n.Snapshot, "snapshot")
+	if err != nil {
+		return nil, err
+	}
+
+	d := db.New()
+	for i, r := range records {
+		obj, err := parseObject(r.Object, fmt.Sprintf("snapshot record %d", i+2))
+		if err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			continue
+		}
+
+		if err := d.Add(obj); err != nil {
+			return nil, fmt.Errorf("snapshot record %d: %s", i+2, err)
+		}
+	}
+
+	c.SessionID, c.Version = n.SessionID, n.Snapshot.Version
+	return d, nil
+}
+
+// change is a checked record of a delta, with a nil object for a class not
+// supported by the parser
+type change struct {
+	deletion bool
+	class    token.Type
+	key      string
+	object   *ast.Object
+}
+
+// applyDelta checks every record of the delta, then applies them to the
+// database
+func (c *Client) applyDelta(d *db.Database, n *Notification, delta FileRef) error {
+	name := fmt.Sprintf("delta %d", delta.Version)
+	records, err := c.download(n, delta, "delta")
+	if err != nil {
+		return err
+	}
+
+	// exists records whether the objects added or deleted so far in the delta
+	// will exist, so deletions can be checked before anything is applied
+	exists := make(map[string]bool)
+	changes := make([]change, 0, len(records))
+	for i, r := range records {
+		where := fmt.Sprintf("%s record %d", name, i+2)
+		switch r.Action {
+		case "add_modify":
+			obj, err := parseObject(r.Object, where)
+			if err != nil {
+				return err
+			}
+			if obj != nil {
+				exists[obj.Class().Name()+" "+strings.ToUpper(obj.Key())] = true
+			}
+			changes = append(changes, change{object: obj})
+		case "delete":
+			class, ok := token.Lookup(r.ObjectClass)
+			if r.ObjectClass == "" || r.PrimaryKey == "" {
+				return fmt.Errorf("%s: delete without object_class and primary_key", where)
+			}
+			if !ok || !class.IsClass() {
+				continue
+			}
+
+			key := class.Name() + " " + strings.ToUpper(r.PrimaryKey)
+			found, seen := exists[key]
+			if !seen {
+				_, found = d.Get(class, r.PrimaryKey)
+			}
+			if !found {
+				return fmt.Errorf("%s: %s %s not found", name, class.Name(), r.PrimaryKey)
+			}
+			exists[key] = false
+			changes = append(changes, change{deletion: true, class: class, key: r.PrimaryKey})
+		default:
+			return fmt.Errorf("%s: unknown action %q", where, r.Action)
+		}
+	}
+
+	for _, ch := range changes {
+		switch {
+		case ch.deletion:
+			if obj, ok := d.Get(ch.class, ch.key); ok {
+				d.Remove(obj)
+			}
+		case ch.object != nil:
+			if err := d.Add(ch.object); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// download fetches a snapshot or delta file, checking it's hash and header,
+// and returns the records following the header
+func (c *Client) download(n *Notification, ref FileRef, fileType string) ([]record, error) {
+	name := fileType
+	if fileType == "delta" {
+		name = fmt.Sprintf("delta %d", ref.Version)
+	}
+
+	location, err := url.Parse(ref.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid URL %q", name, ref.URL)
+	}
+	base, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.get(base.ResolveReference(location).String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), ref.Hash) {
+		return nil, fmt.Errorf("%s: hash mismatch", name)
+	}
+
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	texts := splitSequence(data)
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("%s: missing header", name)
+	}
+
+	var h header
+	if err := json.Unmarshal(texts[0], &h); err != nil {
+		return nil, fmt.Errorf("%s: invalid header: %s", name, err)
+	}
+	switch {
+	case h.NRTMVersion != 4:
+		return nil, fmt.Errorf("%s: unsupported NRTM version %d", name, h.NRTMVersion)
+	case h.Type != fileType:
+		return nil, fmt.Errorf("%s: unexpected type %q", name, h.Type)
+	case !strings.EqualFold(h.Source, n.Source):
+		return nil, fmt.Errorf("%s: unexpected source %s", name, h.Source)
+	case h.SessionID != n.SessionID:
+		return nil, fmt.Errorf("%s: unexpected session_id %s", name, h.SessionID)
+	case h.Version != ref.Version:
+		return nil, fmt.Errorf("%s: unexpected version %d", name, h.Version)
+	}
+
+	records := make([]record, len(texts)-1)
+	for i, text := range texts[1:] {
+		if err := json.Unmarshal(text, &records[i]); err != nil {
+			return nil, fmt.Errorf("%s: invalid record %d: %s", name, i+2, err)
+		}
+	}
+
+	return records, nil
+}
+
+// get downloads a file
+func (c *Client) get(location string) ([]byte, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxFileSize))
+}
+
+// splitSequence splits a JSON text sequence into it's texts, ignoring any
+// empty texts. JSON escapes control characters, so the record separator only
+// appears between texts.
+func splitSequence(data []byte) [][]byte {
+	var texts [][]byte
+	for _, text := range bytes.Split(data, []byte{recordSeparator}) {
+		if text = bytes.TrimSpace(text); len(text) > 0 {
+			texts = append(texts, text)
+		}
+	}
+
+	return texts
+}
+
+// parseObject parses the RPSL text of a single object, returning nil if it's
+// class is not supported by the parser
+func parseObject(text, where string) (*ast.Object, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	objects, err := parser.Parse(where, text)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %s", where, err)
+	case len(objects) > 1:
+		return nil, fmt.Errorf("%s: %d objects", where, len(objects))
+	case len(objects) == 0:
+		return nil, nil
+	}
+
+	return objects[0], nil
+}
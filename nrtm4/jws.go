@@ -0,0 +1,82 @@
+package nrtm4
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ParsePublicKey parses a PEM encoded ECDSA P-256 public key, as published by
+// a server for verifying it's update notification file
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key: no PEM data found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %s", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve.Params().Name != "P-256" {
+		return nil, fmt.Errorf("invalid public key: not an ECDSA P-256 key")
+	}
+
+	return ecKey, nil
+}
+
+// verify checks the signature of a JWS in compact serialization, which must
+// use ES256, returning it's payload
+func verify(jws []byte, keys ...*ecdsa.PublicKey) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(string(jws)), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWS: expected 3 parts, found %d", len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %s", err)
+	}
+
+	var header struct {
+		Alg  string   `json:"alg"`
+		Crit []string `json:"crit"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %s", err)
+	}
+	if header.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported JWS algorithm %q", header.Alg)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("unsupported critical JWS header parameters %s", strings.Join(header.Crit, ", "))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS payload: %s", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return nil, fmt.Errorf("invalid JWS signature")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	for _, key := range keys {
+		if key != nil && ecdsa.Verify(key, digest[:], r, s) {
+			return payload, nil
+		}
+	}
+
+	return nil, fmt.Errorf("JWS signature verification failed")
+}
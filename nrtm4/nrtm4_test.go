@@ -0,0 +1,376 @@
+package nrtm4
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+const sessionID = "ca128382-78d9-41d1-8927-1ecef15275be"
+
+// publisher serves the files of an NRTM version 4 source over HTTP
+type publisher struct {
+	key    *ecdsa.PrivateKey
+	server *httptest.Server
+
+	mu           sync.Mutex
+	files        map[string][]byte
+	requests     []string
+	notification Notification
+}
+
+func newPublisher(t *testing.T) *publisher {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &publisher{key: key, files: make(map[string][]byte)}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.requests = append(p.requests, r.URL.Path)
+		data, ok := p.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	p.notification = Notification{NRTMVersion: 4, Type: "notification", Source: "TEST", SessionID: sessionID, Timestamp: time.Now()}
+	return p
+}
+
+func (p *publisher) client() *Client {
+	return NewClient(p.server.URL+"/update-notification-file.jose", "TEST", &p.key.PublicKey)
+}
+
+// publish adds a snapshot or delta file with the records, which may be
+// strings of RPSL for a snapshot or records of a delta
+func (p *publisher) publish(t *testing.T, fileType string, version int, compress bool, records ...interface{}) FileRef {
+	var buf bytes.Buffer
+	for _, r := range append([]interface{}{header{4, fileType, "TEST", sessionID, version}}, records...) {
+		if object, ok := r.(string); ok {
+			r = record{Object: object}
+		}
+
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteByte(recordSeparator)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	data := buf.Bytes()
+	name := "/" + sessionID + "/nrtm-" + fileType + "." + string('0'+rune(version)) + ".json"
+	if compress {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(data)
+		zw.Close()
+		data, name = gz.Bytes(), name+".gz"
+	}
+
+	sum := sha256.Sum256(data)
+	ref := FileRef{Version: version, URL: name, Hash: hex.EncodeToString(sum[:])}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[name] = data
+	if fileType == "snapshot" {
+		p.notification.Snapshot = ref
+	} else {
+		p.notification.Deltas = append(p.notification.Deltas, ref)
+	}
+	if version > p.notification.Version {
+		p.notification.Version = version
+	}
+	p.signNotification(t)
+
+	return ref
+}
+
+// signNotification publishes the notification signed with the key
+func (p *publisher) signNotification(t *testing.T) {
+	payload, err := json.Marshal(p.notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.files["/update-notification-file.jose"] = []byte(sign(t, p.key, `{"alg":"ES256"}`, payload))
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, header string, payload []byte) string {
+	input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rBytes):], rBytes)
+	copy(signature[64-len(sBytes):], sBytes)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *publisher) downloads() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	requests := p.requests
+	p.requests = nil
+	return requests
+}
+
+func route(prefix, origin string) string {
+	return "route:          " + prefix + "\norigin:         " + origin + "\nmnt-by:         MAINT-TEST\nsource:         TEST\n"
+}
+
+func keys(d *db.Database) []string {
+	var keys []string
+	for _, obj := range d.Objects() {
+		keys = append(keys, obj.Key())
+	}
+
+	return keys
+}
+
+func TestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jws := sign(t, key, `{"alg":"ES256"}`, []byte(`{"version":1}`))
+	payload, err := verify([]byte(jws+"\n"), &other.PublicKey, &key.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":1}`, string(payload))
+
+	parts := strings.Split(jws, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"version":2}`)) + "." + parts[2]
+
+	tests := []struct {
+		jws string
+		err string
+	}{
+		{jws, "JWS signature verification failed"},
+		{tampered, "JWS signature verification failed"},
+		{sign(t, key, `{"alg":"HS256"}`, []byte(`{}`)), `unsupported JWS algorithm "HS256"`},
+		{sign(t, key, `{"alg":"ES256","crit":["exp"]}`, []byte(`{}`)), "unsupported critical JWS header parameters exp"},
+		{parts[0] + "." + parts[1], "invalid JWS: expected 3 parts, found 2"},
+		{parts[0] + "." + parts[1] + ".AAAA", "invalid JWS signature"},
+	}
+
+	for _, tt := range tests {
+		_, err := verify([]byte(tt.jws), &other.PublicKey)
+		assert.EqualError(t, err, tt.err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, parsed.X.Cmp(key.PublicKey.X))
+	}
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ = x509.MarshalPKIXPublicKey(&p384.PublicKey)
+	_, err = ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.EqualError(t, err, "invalid public key: not an ECDSA P-256 key")
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	assert.EqualError(t, err, "invalid public key: no PEM data found")
+}
+
+func TestUpdate(t *testing.T) {
+	p := newPublisher(t)
+	defer p.server.Close()
+
+	p.publish(t, "snapshot", 3, true,
+		route("192.0.2.0/24", "AS65537"),
+		route("198.51.100.0/24", "AS65537"),
+		"inetnum:        192.0.2.0 - 192.0.2.255\nnetname:        TEST\nsource:         TEST\n",
+	)
+	p.publish(t, "delta", 3, false, record{Action: "add_modify", Object: route("203.0.113.0/24", "AS65538")})
+	p.publish(t, "delta", 4, false,
+		record{Action: "delete", ObjectClass: "route", PrimaryKey: "198.51.100.0/24AS65537"},
+		record{Action: "delete", ObjectClass: "inetnum", PrimaryKey: "192.0.2.0 - 192.0.2.255"},
+	)
+	p.publish(t, "delta", 5, true, record{Action: "add_modify", Object: "as-set:         AS-TEST\nmembers:        AS65537\nsource:         TEST"})
+
+	c := p.client()
+	d, err := c.Update(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, sessionID, c.SessionID)
+	assert.Equal(t, 5, c.Version)
+	assert.Equal(t, []string{"AS-TEST", "192.0.2.0/24AS65537"}, keys(d))
+	assert.Equal(t, []string{
+		"/update-notification-file.jose",
+		"/" + sessionID + "/nrtm-snapshot.3.json.gz",
+		"/" + sessionID + "/nrtm-delta.4.json",
+		"/" + sessionID + "/nrtm-delta.5.json.gz",
+	}, p.downloads())
+
+	// nothing is downloaded when the version is unchanged
+	same, err := c.Update(d)
+	assert.NoError(t, err)
+	assert.True(t, same == d)
+	assert.Equal(t, []string{"/update-notification-file.jose"}, p.downloads())
+
+	p.publish(t, "delta", 6, false, record{Action: "add_modify", Object: "as-set:         AS-TEST\nmembers:        AS65537, AS65538\nsource:         TEST\n"})
+	same, err = c.Update(d)
+	assert.NoError(t, err)
+	assert.True(t, same == d)
+	assert.Equal(t, 6, c.Version)
+	obj, _ := d.Get(token.CLASS_AS_SET, "AS-TEST")
+	assert.Equal(t, []string{"AS65537", "AS65538"}, obj.Values(token.ATTR_AS_SET_MEMBERS))
+	assert.Equal(t, []string{"/update-notification-file.jose", "/" + sessionID + "/nrtm-delta.6.json"}, p.downloads())
+}
+
+func TestUpdateSnapshot(t *testing.T) {
+	p := newPublisher(t)
+	defer p.server.Close()
+
+	p.publish(t, "snapshot", 5, false, route("192.0.2.0/24", "AS65537"))
+	p.publish(t, "delta", 5, false, record{Action: "add_modify", Object: route("198.51.100.0/24", "AS65537")})
+	p.publish(t, "delta", 6, false, record{Action: "add_modify", Object: route("203.0.113.0/24", "AS65537")})
+
+	stale := db.New()
+	tests := []struct {
+		name      string
+		sessionID string
+		version   int
+		snapshot  bool
+	}{
+		{"continuous", sessionID, 4, false},
+		{"deltas expired", sessionID, 3, true},
+		{"newer than the server", sessionID, 7, true},
+		{"new session", "4af7b3d3-9e5f-4a4e-8e7a-8a3e2c7d1f00", 6, true},
+	}
+
+	for _, tt := range tests {
+		c := p.client()
+		c.SessionID, c.Version = tt.sessionID, tt.version
+
+		d, err := c.Update(stale)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.snapshot, d != stale, tt.name)
+		assert.Equal(t, sessionID, c.SessionID, tt.name)
+		assert.Equal(t, 6, c.Version, tt.name)
+		if tt.snapshot {
+			// delta 5 is already included in the snapshot
+			assert.Equal(t, []string{"192.0.2.0/24AS65537", "203.0.113.0/24AS65537"}, keys(d), tt.name)
+		}
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(p *publisher)
+		version int // the version reached
+		err     string
+	}{
+		{"signature", func(p *publisher) {
+			other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			p.key = other
+			p.signNotification(t)
+		}, 0, "update notification file: JWS signature verification failed"},
+		{"source", func(p *publisher) {
+			p.notification.Source = "OTHER"
+			p.signNotification(t)
+		}, 0, "unexpected source OTHER"},
+		{"contiguous", func(p *publisher) {
+			p.notification.Deltas = append(p.notification.Deltas[:1], p.notification.Deltas[2:]...)
+			p.signNotification(t)
+		}, 0, "deltas are not contiguous, version 5 follows 3"},
+		{"snapshot hash", func(p *publisher) {
+			p.files[p.notification.Snapshot.URL] = append(p.files[p.notification.Snapshot.URL], ' ')
+		}, 0, "snapshot: hash mismatch"},
+		{"delta missing", func(p *publisher) {
+			delete(p.files, p.notification.Deltas[1].URL)
+		}, 3, "delta 4: GET " + "%s" + "/" + sessionID + "/nrtm-delta.4.json: 404 Not Found"},
+		{"delta session", func(p *publisher) {
+			url := p.notification.Deltas[1].URL
+			p.files[url] = bytes.Replace(p.files[url], []byte(sessionID), []byte("00000000-0000-0000-0000-000000000000"), 1)
+			sum := sha256.Sum256(p.files[url])
+			p.notification.Deltas[1].Hash = hex.EncodeToString(sum[:])
+			p.signNotification(t)
+		}, 3, "delta 4: unexpected session_id 00000000-0000-0000-0000-000000000000"},
+		{"delete missing", func(p *publisher) {
+			p.notification.Deltas = p.notification.Deltas[:2]
+			p.notification.Version = 4
+			p.publish(t, "delta", 5, false,
+				record{Action: "add_modify", Object: route("203.0.113.0/24", "AS65537")},
+				record{Action: "delete", ObjectClass: "route", PrimaryKey: "203.0.113.0/24AS65538"},
+			)
+		}, 4, "delta 5: route 203.0.113.0/24AS65538 not found"},
+		{"action", func(p *publisher) {
+			p.notification.Deltas = p.notification.Deltas[:2]
+			p.notification.Version = 4
+			p.publish(t, "delta", 5, false, record{Action: "modify", Object: route("203.0.113.0/24", "AS65537")})
+		}, 4, `delta 5 record 2: unknown action "modify"`},
+	}
+
+	for _, tt := range tests {
+		p := newPublisher(t)
+		key := &p.key.PublicKey
+		p.publish(t, "snapshot", 3, false, route("192.0.2.0/24", "AS65537"))
+		p.publish(t, "delta", 3, false)
+		p.publish(t, "delta", 4, false, record{Action: "add_modify", Object: route("198.51.100.0/24", "AS65537")})
+		p.publish(t, "delta", 5, false)
+
+		tt.change(p)
+
+		c := p.client()
+		c.PublicKeys = []*ecdsa.PublicKey{key}
+		d, err := c.Update(nil)
+		if strings.Contains(tt.err, "%s") {
+			tt.err = strings.Replace(tt.err, "%s", p.server.URL, 1)
+		}
+		assert.EqualError(t, err, tt.err, tt.name)
+		assert.Equal(t, tt.version, c.Version, tt.name)
+
+		// a failed delta is not partially applied
+		if tt.version == 4 {
+			assert.Equal(t, []string{"192.0.2.0/24AS65537", "198.51.100.0/24AS65537"}, keys(d), tt.name)
+		}
+
+		p.server.Close()
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Parser is responsible for building RPSL objects from the tokens emitted by
+// the lexer
+type Parser struct {
+	l      *lexer.Lexer
+	errors []string
+
+	curToken  token.Token
+	peekToken token.Token
+}
+
+// New creates a new Parser reading tokens from the provided Lexer
+func New(l *lexer.Lexer) *Parser {
+	p := &Parser{
+		l:      l,
+		errors: []string{},
+	}
+
+	// read two tokens, so curToken and peekToken are both set
+	p.nextToken()
+	p.nextToken()
+
+	return p
+}
+
+// Parse is a convenience function which lexes and parses the input text,
+// returning the parsed objects or an error describing every problem found
+func Parse(inputName, inputText string) ([]*ast.Object, error) {
+	p := New(lexer.Lex(inputName, inputText))
+	objects := p.ParseObjects()
+	if errs := p.Errors(); len(errs) > 0 {
+		return objects, errors.New(strings.Join(errs, "; "))
+	}
+
+	return objects, nil
+}
+
+// Errors returns the errors encountered while parsing
+func (p *Parser) Errors() []string {
+	return p.errors
+}
+
+func (p *Parser) nextToken() {
+	p.curToken = p.peekToken
+	p.peekToken = p.l.NextToken()
+}
+
+// ParseObjects parses every object found in the input
+func (p *Parser) ParseObjects() []*ast.Object {
+	objects := []*ast.Object{}
+
+	for p.curToken.Type != token.EOF {
+		if !p.curToken.Type.IsClass() {
+			p.unexpectedTokenError()
+			p.skipObject()
+			continue
+		}
+
+		if obj := p.parseObject(); obj != nil {
+			objects = append(objects, obj)
+		}
+	}
+
+	return objects
+}
+
+func (p *Parser) parseObject() *ast.Object {
+	obj := &ast.Object{}
+	obj.Attributes = append(obj.Attributes, p.parseAttribute())
+
+	for p.curToken.Type.IsAttribute() {
+		if p.curToken.Type == token.ATTR_CONTINUATION {
+			last := obj.Attributes[len(obj.Attributes)-1]
+			last.Continuations = append(last.Continuations, p.parseAttribute())
+			continue
+		}
+
+		obj.Attributes = append(obj.Attributes, p.parseAttribute())
+	}
+
+	if p.curToken.Type == token.ILLEGAL {
+		p.unexpectedTokenError()
+		p.skipObject()
+		return nil
+	}
+
+	return obj
+}
+
+func (p *Parser) parseAttribute() *ast.Attribute {
+	attr := &ast.Attribute{Token: p.curToken}
+	p.nextToken()
+
+	for p.curToken.Type != token.EOF && p.curToken.Type != token.ILLEGAL &&
+		!p.curToken.Type.IsClass() && !p.curToken.Type.IsAttribute() {
+		attr.Values = append(attr.Values, p.curToken)
+		p.nextToken()
+	}
+
+	return attr
+}
+
+// skipObject advances past the remainder of the current object
+func (p *Parser) skipObject() {
+	p.nextToken()
+	for p.curToken.Type != token.EOF && !p.curToken.Type.IsClass() {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) unexpectedTokenError() {
+	msg := fmt.Sprintf("line %d: unexpected token %s with literal %q", p.curToken.Line, p.curToken.Type, p.curToken.Literal)
+	p.errors = append(p.errors, msg)
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseObjects(t *testing.T) {
+	input := `% comment lines are ignored
+route:          192.0.2.0/24
+descr:          example route
++               continued
+origin:         AS65537
+mnt-by:         OTHER1-MNT,OTHER2-MNT
+mnt-by:         TEST-MNT
+changed:        changed@example.com 20190701 # comment
+source:         TEST
+
+as-set:         AS-SETTEST
+members:        AS65538, AS65539
+source:         TEST
+`
+
+	p := New(lexer.Lex("objects", input))
+	objects := p.ParseObjects()
+	if !assert.Empty(t, p.Errors()) || !assert.Len(t, objects, 2) {
+		t.FailNow()
+	}
+
+	route := objects[0]
+	assert.Equal(t, token.CLASS_ROUTE, route.Class())
+	assert.Equal(t, "192.0.2.0/24", route.Name())
+	assert.Len(t, route.Attributes, 7)
+	assert.Equal(t, []string{"example route", "continued"}, route.Get(token.ATTR_DESCRIPTION)[0].Lines())
+	assert.Equal(t, []string{"OTHER1-MNT", "OTHER2-MNT", "TEST-MNT"}, route.Values(token.ATTR_MAINTAINED_BY))
+	assert.Equal(t, "changed@example.com 20190701", route.Value(token.ATTR_CHANGED_AT_AND_BY))
+
+	expected := `route:          192.0.2.0/24
+descr:          example route
++               continued
+origin:         AS65537
+mnt-by:         OTHER1-MNT, OTHER2-MNT
+mnt-by:         TEST-MNT
+changed:        changed@example.com 20190701
+source:         TEST
+`
+	assert.Equal(t, expected, route.String())
+
+	set := objects[1]
+	assert.Equal(t, token.CLASS_AS_SET, set.Class())
+	assert.Equal(t, []string{"AS65538", "AS65539"}, set.Values(token.ATTR_AS_SET_MEMBERS))
+}
+
+func TestParseIllegalValue(t *testing.T) {
+	input := `route:          192.0.2.0/24
+origin:         65537
+source:         TEST
+`
+
+	objects, err := Parse("illegal", input)
+	assert.Empty(t, objects)
+	assert.Error(t, err)
+}
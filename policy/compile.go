@@ -0,0 +1,765 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// DefaultMaxPreference is used when Options.MaxPreference is not set. RPSL
+// prefers routes with a smaller pref, while BGP prefers a higher local
+// preference, so pref is translated to a local preference of
+// MaxPreference - pref.
+const DefaultMaxPreference = 1000
+
+// DefaultMapName is used when Options.MapName is not set
+const DefaultMapName = "AS%d-%s"
+
+// Options control how policies are compiled
+type Options struct {
+	// MaxPreference is the local preference of routes with a pref of 0
+	MaxPreference int
+	// MapName is the name of compiled route maps, in which %d is replaced by
+	// the peer's AS number and %s by IMPORT or EXPORT. IPv6 route maps have
+	// -IPV6 appended.
+	MapName string
+	// Aggregate merges the prefix lists of each entry into as few ranges as
+	// possible, without changing the routes they match
+	Aggregate bool
+	// Resolve controls how sets are expanded
+	Resolve resolve.Options
+}
+
+// Neighbor is the BGP session a policy is compiled for
+type Neighbor struct {
+	LocalAS      uint32
+	LocalAddress net.IP // the local router, matched against the at clause of peerings, may be nil
+	PeerAS       uint32
+	PeerAddress  net.IP // the peer's router, may be nil
+}
+
+// RouteMap is the policy of an aut-num for a single neighbor, direction and
+// address family, along with the lists its entries refer to. Routes are
+// matched against the entries in order, and those matching no entry are
+// rejected.
+type RouteMap struct {
+	Name           string
+	Direction      Direction
+	IPv6           bool
+	Neighbor       Neighbor
+	Entries        []*Entry
+	PrefixLists    []*generate.PrefixList
+	ASPathFilters  []*generate.ASPathFilter
+	CommunityLists []*CommunityList
+	// Skipped describes the parts of the policy which could not be compiled,
+	// such as unsupported actions or missing sets. Rather than accepting more
+	// routes than intended, the routes they apply to are not matched.
+	Skipped []string
+}
+
+// Entry accepts the routes matching all of it's conditions, applying it's
+// actions to them
+type Entry struct {
+	Seq int
+	// Policy is the import, export, mp-import or mp-export attribute the entry
+	// was compiled from, and Clause the parts of it's expression which
+	// selected the entry: the matching peering, it's actions and the filter
+	Policy      string
+	Clause      string
+	Prefixes    *generate.PrefixList // nil to match every prefix
+	ASPaths     []PathMatch
+	Communities []CommunityMatch
+
+	LocalPref         string
+	MED               string // a number, or igp to use the IGP metric
+	SetCommunities    *CommunityList
+	AddCommunities    *CommunityList
+	DeleteCommunities *CommunityList
+	Prepend           []uint32
+	NextHop           string // an address, or self
+}
+
+// PathMatch is an AS path filter which routes must, or if Negated must not,
+// match
+type PathMatch struct {
+	Filter  *generate.ASPathFilter
+	Negated bool
+}
+
+// CommunityMatch is a community list which routes must, or if Negated must
+// not, match
+type CommunityMatch struct {
+	List    *CommunityList
+	Negated bool
+}
+
+// CommunityList is a named list of communities, written as ASN:value
+type CommunityList struct {
+	Name        string
+	Use         string // match, set, add or delete
+	Communities []string
+	Exact       bool // when matching, the route must have exactly these communities rather than at least them
+}
+
+// Compiler compiles the policies of aut-num objects
+type Compiler struct {
+	d      *db.Database
+	opts   Options
+	asSets map[string][]string
+}
+
+// NewCompiler returns a compiler for the aut-num objects in the database
+func NewCompiler(d *db.Database, opts Options) *Compiler {
+	if opts.MaxPreference <= 0 {
+		opts.MaxPreference = DefaultMaxPreference
+	}
+	if opts.MapName == "" {
+		opts.MapName = DefaultMapName
+	}
+
+	return &Compiler{d: d, opts: opts, asSets: make(map[string][]string)}
+}
+
+// compilation is the state of compiling a single route map
+type compilation struct {
+	*Compiler
+	rm *RouteMap
+}
+
+// rule is a filter and the actions applied to the routes it matches, after
+// the peerings and address families of a policy have been evaluated
+type rule struct {
+	filter  *Filter
+	actions []*Action
+	clause  string
+}
+
+// Compile compiles the import or export policies of the neighbor's local
+// aut-num which apply to the neighbor, for IPv4 or IPv6 unicast routes.
+// Policies are evaluated in the order they appear in the aut-num. Routes
+// matched by the lower policy of an EXCEPT use its actions, with the upper
+// policy applying to the rest, while a REFINE only matches the routes matched
+// by both policies and applies both of their actions.
+func (c *Compiler) Compile(dir Direction, n Neighbor, ipv6 bool) (*RouteMap, error) {
+	autNum := fmt.Sprintf("AS%d", n.LocalAS)
+	obj, ok := c.d.Get(token.CLASS_AUT_NUM, autNum)
+	if !ok {
+		return nil, fmt.Errorf("aut-num %s not found", autNum)
+	}
+
+	comp := &compilation{Compiler: c, rm: &RouteMap{
+		Name:      c.mapName(dir, n, ipv6),
+		Direction: dir,
+		IPv6:      ipv6,
+		Neighbor:  n,
+	}}
+
+	for _, attr := range obj.Attributes[1:] {
+		mp := attr.Token.Type == token.ATTR_MULTI_PROTO_IMPORT_POLICY || attr.Token.Type == token.ATTR_MULTI_PROTO_EXPORT_POLICY
+		switch attr.Token.Type {
+		case token.ATTR_IMPORT, token.ATTR_MULTI_PROTO_IMPORT_POLICY:
+			if dir != Import {
+				continue
+			}
+		case token.ATTR_EXPORT, token.ATTR_MULTI_PROTO_EXPORT_POLICY:
+			if dir != Export {
+				continue
+			}
+		default:
+			continue
+		}
+
+		// import and export only apply to IPv4 unicast routes
+		if ipv6 && !mp {
+			continue
+		}
+
+		policy, err := ParseAttribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		if !isBGP(policy.Protocol) || !isBGP(policy.Into) {
+			continue
+		}
+
+		afi := []string{"ipv4.unicast"}
+		if mp {
+			afi = []string{"any"}
+		}
+
+		text := attr.Name() + ": " + strings.Join(attr.Lines(), " ")
+		for _, r := range comp.expression(policy.Expression, afi) {
+			comp.addRule(text, r)
+		}
+	}
+
+	return comp.rm, nil
+}
+
+func (c *Compiler) mapName(dir Direction, n Neighbor, ipv6 bool) string {
+	name := strings.Replace(c.opts.MapName, "%d", strconv.FormatUint(uint64(n.PeerAS), 10), 1)
+	name = strings.Replace(name, "%s", strings.ToUpper(dir.String()), 1)
+	if ipv6 {
+		name += "-IPV6"
+	}
+
+	return name
+}
+
+// isBGP reports whether the protocol of a policy is BGP, which is assumed
+// when none is given
+func isBGP(protocol string) bool {
+	switch strings.ToUpper(protocol) {
+	case "", "BGP", "BGP4", "MPBGP":
+		return true
+	}
+
+	return false
+}
+
+func (c *compilation) skip(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, existing := range c.rm.Skipped {
+		if existing == msg {
+			return
+		}
+	}
+
+	c.rm.Skipped = append(c.rm.Skipped, msg)
+}
+
+// expression returns the rules of the policy expression which apply to the
+// neighbor, in the order routes should be matched against them
+func (c *compilation) expression(expr *Expression, afi []string) []rule {
+	if expr.AFI != nil {
+		afi = expr.AFI
+	}
+
+	var rules []rule
+	if includesAFI(afi, c.rm.IPv6) {
+		for _, factor := range expr.Term {
+			// the actions of the first matching peering are used
+			for _, pa := range factor.Peerings {
+				if c.peeringMatches(pa.Peering) {
+					rules = append(rules, rule{filter: factor.Filter, actions: pa.Actions, clause: c.clause(pa, factor.Filter)})
+					break
+				}
+			}
+		}
+	}
+
+	switch expr.Operator {
+	case "EXCEPT":
+		return append(c.expression(expr.Next, afi), rules...)
+	case "REFINE":
+		lower := c.expression(expr.Next, afi)
+
+		var refined []rule
+		for _, u := range rules {
+			for _, l := range lower {
+				refined = append(refined, rule{
+					filter:  &Filter{Op: FilterAnd, Sub: []*Filter{u.filter, l.filter}},
+					actions: append(append([]*Action{}, u.actions...), l.actions...),
+					clause:  u.clause + " REFINE " + l.clause,
+				})
+			}
+		}
+		return refined
+	}
+
+	return rules
+}
+
+// clause formats a peering, it's actions and a filter in RPSL notation, e.g.
+// from AS65537 action pref = 100; accept AS-TEST
+func (c *compilation) clause(pa *PeeringAction, filter *Filter) string {
+	peeringKeyword, filterKeyword := "from", "accept"
+	if c.rm.Direction == Export {
+		peeringKeyword, filterKeyword = "to", "announce"
+	}
+
+	s := peeringKeyword + " " + pa.Peering.String()
+	if len(pa.Actions) > 0 {
+		s += " action"
+		for _, a := range pa.Actions {
+			s += " " + a.String() + ";"
+		}
+	}
+
+	return s + " " + filterKeyword + " " + filter.String()
+}
+
+// includesAFI reports whether the list of address families includes IPv4 or
+// IPv6 unicast
+func includesAFI(afi []string, ipv6 bool) bool {
+	family := "ipv4"
+	if ipv6 {
+		family = "ipv6"
+	}
+
+	for _, a := range afi {
+		switch a {
+		case "any", "any.unicast", family, family + ".unicast":
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *compilation) peeringMatches(p *Peering) bool {
+	if p.Set != "" {
+		c.skip("unsupported peering-set %s", p.Set)
+		return false
+	}
+
+	return c.asMatches(p.AS) &&
+		(p.Remote == nil || c.routerMatches(p.Remote, c.rm.Neighbor.PeerAddress)) &&
+		(p.Local == nil || c.routerMatches(p.Local, c.rm.Neighbor.LocalAddress))
+}
+
+func (c *compilation) asMatches(e *SetExpr) bool {
+	switch e.Operator {
+	case "AND":
+		return c.asMatches(e.Left) && c.asMatches(e.Right)
+	case "OR":
+		return c.asMatches(e.Left) || c.asMatches(e.Right)
+	case "EXCEPT":
+		return c.asMatches(e.Left) && !c.asMatches(e.Right)
+	}
+
+	peer := fmt.Sprintf("AS%d", c.rm.Neighbor.PeerAS)
+	switch {
+	case e.Name == "AS-ANY":
+		return true
+	case lexer.IsASN(e.Name):
+		return e.Name == peer
+	}
+
+	members, ok := c.asSets[e.Name]
+	if !ok {
+		result, err := resolve.ASSet(c.d, e.Name, c.opts.Resolve)
+		if err != nil {
+			c.skip("%s", err)
+		} else {
+			members = result.Values()
+		}
+		c.asSets[e.Name] = members
+	}
+
+	for _, member := range members {
+		if member == peer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routerMatches reports whether the router expression matches the address. An
+// unknown address matches every expression.
+func (c *compilation) routerMatches(e *SetExpr, addr net.IP) bool {
+	if addr == nil {
+		return true
+	}
+
+	switch e.Operator {
+	case "AND":
+		return c.routerMatches(e.Left, addr) && c.routerMatches(e.Right, addr)
+	case "OR":
+		return c.routerMatches(e.Left, addr) || c.routerMatches(e.Right, addr)
+	case "EXCEPT":
+		return c.routerMatches(e.Left, addr) && !c.routerMatches(e.Right, addr)
+	}
+
+	ip := net.ParseIP(e.Name)
+	if ip == nil {
+		c.skip("unsupported router %s", e.Name)
+		return false
+	}
+
+	return ip.Equal(addr)
+}
+
+// conjunction is a set of conditions which a route must match together
+type conjunction struct {
+	prefixes    []prefix.Range
+	constrained bool // whether prefixes restricts the routes matched
+	asPaths     []pathMatch
+	communities []communityMatch
+}
+
+type pathMatch struct {
+	re      *aspath.Regexp
+	negated bool
+}
+
+type communityMatch struct {
+	communities []string
+	exact       bool
+	negated     bool
+}
+
+// disjunction converts the filter to a list of conjunctions, any of which
+// must match. Negations are pushed down to the filter's operands. Prefix
+// filters are evaluated against the database, so their negations and
+// intersections are computed rather than left to the router.
+func (c *compilation) disjunction(f *Filter, negated bool) []conjunction {
+	switch f.Op {
+	case FilterNot:
+		return c.disjunction(f.Sub[0], !negated)
+	case FilterAnd, FilterOr:
+		if (f.Op == FilterAnd) == negated {
+			var result []conjunction
+			for _, sub := range f.Sub {
+				result = append(result, c.disjunction(sub, negated)...)
+			}
+			return result
+		}
+
+		result := []conjunction{{}}
+		for _, sub := range f.Sub {
+			result = c.cross(result, c.disjunction(sub, negated))
+		}
+		return result
+	case FilterAny:
+		if negated {
+			return nil
+		}
+		return []conjunction{{}}
+	case FilterASPath:
+		return []conjunction{{asPaths: []pathMatch{{re: f.ASPath, negated: negated}}}}
+	case FilterCommunity:
+		communities, err := normalizeCommunities(f.Communities)
+		if err != nil {
+			c.skip("%s", err)
+			return nil
+		}
+		return []conjunction{{communities: []communityMatch{{communities: communities, exact: f.Method == "==", negated: negated}}}}
+	}
+
+	ranges, ok := c.prefixes(f)
+	if !ok {
+		return nil
+	}
+	if negated {
+		ranges = prefix.Subtract([]prefix.Range{c.universe()}, ranges)
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	return []conjunction{{prefixes: ranges, constrained: true}}
+}
+
+// cross returns the conjunctions matching the routes matched by both a
+// conjunction of a and one of b
+func (c *compilation) cross(a, b []conjunction) []conjunction {
+	var result []conjunction
+	for _, x := range a {
+		for _, y := range b {
+			merged := conjunction{
+				prefixes:    x.prefixes,
+				constrained: x.constrained || y.constrained,
+				asPaths:     append(append([]pathMatch{}, x.asPaths...), y.asPaths...),
+				communities: append(append([]communityMatch{}, x.communities...), y.communities...),
+			}
+
+			switch {
+			case x.constrained && y.constrained:
+				merged.prefixes = prefix.Intersect(x.prefixes, y.prefixes)
+			case y.constrained:
+				merged.prefixes = y.prefixes
+			}
+
+			if !merged.constrained || len(merged.prefixes) > 0 {
+				result = append(result, merged)
+			}
+		}
+	}
+
+	return result
+}
+
+// universe is the range matching every prefix of the address family
+func (c *compilation) universe() prefix.Range {
+	if c.rm.IPv6 {
+		return prefix.Range{Prefix: &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}, Min: 0, Max: 128}
+	}
+
+	return prefix.Range{Prefix: &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, Min: 0, Max: 32}
+}
+
+// prefixes returns the prefix ranges matched by a filter which selects routes
+// by their prefix, returning false if they can not be determined
+func (c *compilation) prefixes(f *Filter) ([]prefix.Range, bool) {
+	var ranges []prefix.Range
+	switch f.Op {
+	case FilterPeerAS, FilterASN, FilterASSet, FilterRouteSet:
+		name := f.Name
+		if f.Op == FilterPeerAS {
+			name = fmt.Sprintf("AS%d", c.rm.Neighbor.PeerAS)
+		}
+
+		result, err := generate.Prefixes(c.d, name, c.rm.IPv6, c.opts.Resolve)
+		if err != nil {
+			c.skip("%s", err)
+			return nil, false
+		}
+		ranges = result
+	case FilterPrefixes:
+		for _, value := range f.Prefixes {
+			r, err := prefix.ParseRange(value)
+			if err != nil {
+				c.skip("%s", err)
+				return nil, false
+			}
+			if prefix.IsIPv4(r.Prefix) != c.rm.IPv6 {
+				ranges = append(ranges, r)
+			}
+		}
+	default:
+		c.skip("unsupported filter %s", f)
+		return nil, false
+	}
+
+	if f.Operator == "" {
+		return prefix.Compact(ranges), true
+	}
+
+	var result []prefix.Range
+	for _, r := range ranges {
+		applied, err := r.Apply(f.Operator)
+		switch {
+		case err == prefix.ErrEmptyRange:
+		case err != nil:
+			c.skip("filter %s: %s", f, err)
+			return nil, false
+		default:
+			result = append(result, applied)
+		}
+	}
+
+	return prefix.Compact(result), true
+}
+
+// addRule adds an entry to the route map for each conjunction of the rule's
+// filter. The lists an entry uses are only added to the route map along with
+// the entry, so a conjunction which can not be compiled is skipped without
+// leaving lists behind.
+func (c *compilation) addRule(policy string, r rule) {
+	actions, ok := c.actions(r.actions)
+	if !ok {
+		return
+	}
+
+	for _, conj := range c.disjunction(r.filter, false) {
+		seq := (len(c.rm.Entries) + 1) * 10
+		name := fmt.Sprintf("%s-%d", c.rm.Name, seq)
+		entry := &Entry{
+			Seq:       seq,
+			Policy:    policy,
+			Clause:    r.clause,
+			LocalPref: actions.localPref,
+			MED:       actions.med,
+			Prepend:   actions.prepend,
+			NextHop:   actions.nextHop,
+		}
+
+		if !c.asPaths(entry, name, conj.asPaths) {
+			continue
+		}
+
+		if conj.constrained {
+			if c.opts.Aggregate {
+				conj.prefixes = prefix.Aggregate(conj.prefixes)
+			}
+			entry.Prefixes = &generate.PrefixList{Name: name, IPv6: c.rm.IPv6, Ranges: conj.prefixes}
+		}
+
+		for i, m := range conj.communities {
+			list := &CommunityList{Name: fmt.Sprintf("%s-COMM%d", name, i+1), Use: "match", Communities: m.communities, Exact: m.exact}
+			entry.Communities = append(entry.Communities, CommunityMatch{List: list, Negated: m.negated})
+		}
+
+		if actions.set != nil {
+			entry.SetCommunities = &CommunityList{Name: name + "-SET", Use: "set", Communities: actions.set}
+		}
+		if actions.add != nil {
+			entry.AddCommunities = &CommunityList{Name: name + "-ADD", Use: "add", Communities: actions.add}
+		}
+		if actions.delete != nil {
+			entry.DeleteCommunities = &CommunityList{Name: name + "-DELETE", Use: "delete", Communities: actions.delete}
+		}
+
+		c.addEntry(entry)
+	}
+}
+
+// asPaths builds the AS path filters of an entry, returning false if any can
+// not be built
+func (c *compilation) asPaths(entry *Entry, name string, matches []pathMatch) bool {
+	for i, m := range matches {
+		filter, err := generate.NewASPathFilter(c.d, fmt.Sprintf("%s-PATH%d", name, i+1), m.re.String(), c.opts.Resolve)
+		if err != nil {
+			c.skip("%s", err)
+			return false
+		}
+		entry.ASPaths = append(entry.ASPaths, PathMatch{Filter: filter, Negated: m.negated})
+	}
+
+	return true
+}
+
+// addEntry adds a complete entry to the route map, along with the lists it
+// uses
+func (c *compilation) addEntry(entry *Entry) {
+	if entry.Prefixes != nil {
+		c.rm.PrefixLists = append(c.rm.PrefixLists, entry.Prefixes)
+	}
+	for _, m := range entry.ASPaths {
+		c.rm.ASPathFilters = append(c.rm.ASPathFilters, m.Filter)
+	}
+	for _, m := range entry.Communities {
+		c.rm.CommunityLists = append(c.rm.CommunityLists, m.List)
+	}
+	for _, list := range []*CommunityList{entry.SetCommunities, entry.AddCommunities, entry.DeleteCommunities} {
+		if list != nil {
+			c.rm.CommunityLists = append(c.rm.CommunityLists, list)
+		}
+	}
+
+	c.rm.Entries = append(c.rm.Entries, entry)
+}
+
+var wellKnownCommunities = map[string]string{
+	"no_export":           "65535:65281",
+	"no_advertise":        "65535:65282",
+	"no_export_subconfed": "65535:65283",
+}
+
+// normalizeCommunities returns the communities as ASN:value. RPSL also permits
+// communities to be written as a single 32 bit number or by their well known
+// names.
+func normalizeCommunities(communities []string) ([]string, error) {
+	result := make([]string, len(communities))
+	for i, community := range communities {
+		if value, ok := wellKnownCommunities[strings.ToLower(community)]; ok {
+			result[i] = value
+			continue
+		}
+
+		var high, low uint64
+		var err error
+		if parts := strings.Split(community, ":"); len(parts) == 2 {
+			if high, err = strconv.ParseUint(parts[0], 10, 16); err == nil {
+				low, err = strconv.ParseUint(parts[1], 10, 16)
+			}
+		} else {
+			var value uint64
+			value, err = strconv.ParseUint(community, 10, 32)
+			high, low = value>>16, value&0xffff
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid community %q", community)
+		}
+		result[i] = fmt.Sprintf("%d:%d", high, low)
+	}
+
+	return result, nil
+}
+
+// actionSet is the result of evaluating a list of actions
+type actionSet struct {
+	localPref, med, nextHop string
+	set, add, delete        []string
+	prepend                 []uint32
+}
+
+// actions evaluates the actions, returning false if any can not be compiled
+func (c *compilation) actions(actions []*Action) (actionSet, bool) {
+	var result actionSet
+	for _, a := range actions {
+		arg := ""
+		if len(a.Args) == 1 {
+			arg = a.Args[0]
+		}
+
+		switch {
+		case a.Attribute == "pref" && a.Operator == "=":
+			pref, err := strconv.Atoi(arg)
+			if err != nil || pref < 0 {
+				c.skip("unsupported action %s", a)
+				return result, false
+			}
+
+			localPref := c.opts.MaxPreference - pref
+			if localPref < 0 {
+				localPref = 0
+			}
+			result.localPref = strconv.Itoa(localPref)
+		case a.Attribute == "med" && a.Operator == "=":
+			if arg == "igp_cost" {
+				result.med = "igp"
+			} else if _, err := strconv.ParseUint(arg, 10, 32); err == nil {
+				result.med = arg
+			} else {
+				c.skip("unsupported action %s", a)
+				return result, false
+			}
+		case a.Attribute == "community" && a.Operator == "=" && len(a.Args) > 0:
+			result.set, result.add = append([]string{}, a.Args...), nil
+		case a.Attribute == "community" && (a.Operator == ".=" || a.Method == "append"):
+			if result.set != nil {
+				result.set = append(result.set, a.Args...)
+			} else {
+				result.add = append(result.add, a.Args...)
+			}
+		case a.Attribute == "community" && a.Method == "delete":
+			result.delete = append(result.delete, a.Args...)
+		case a.Attribute == "aspath" && a.Method == "prepend":
+			for _, arg := range a.Args {
+				asn, err := aspath.ParseASN(arg)
+				if err != nil {
+					c.skip("unsupported action %s", a)
+					return result, false
+				}
+				result.prepend = append(result.prepend, asn)
+			}
+		case a.Attribute == "next-hop" && a.Operator == "=":
+			if ip := net.ParseIP(arg); ip == nil && arg != "self" {
+				c.skip("unsupported action %s", a)
+				return result, false
+			}
+			result.nextHop = arg
+		default:
+			c.skip("unsupported action %s", a)
+			return result, false
+		}
+	}
+
+	for _, list := range []*[]string{&result.set, &result.add, &result.delete} {
+		if *list == nil {
+			continue
+		}
+
+		normalized, err := normalizeCommunities(*list)
+		if err != nil {
+			c.skip("%s", err)
+			return result, false
+		}
+		*list = normalized
+	}
+
+	return result, true
+}
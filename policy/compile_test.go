@@ -0,0 +1,327 @@
+package policy
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares the output with the named golden file, or updates the file
+// when the -update flag is set
+func golden(t *testing.T, name string, output []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(expected), string(output), name)
+	}
+}
+
+func neighbor(localAS, peerAS uint32) Neighbor {
+	return Neighbor{
+		LocalAS:      localAS,
+		LocalAddress: net.ParseIP("192.0.2.2"),
+		PeerAS:       peerAS,
+		PeerAddress:  net.ParseIP("192.0.2.1"),
+	}
+}
+
+func prefixes(e *Entry) []string {
+	if e.Prefixes == nil {
+		return nil
+	}
+
+	result := make([]string, len(e.Prefixes.Ranges))
+	for i, r := range e.Prefixes.Ranges {
+		result[i] = r.String()
+	}
+
+	return result
+}
+
+func TestCompile(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	rm, err := c.Compile(Import, neighbor(65536, 65537), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "AS65537-IMPORT", rm.Name)
+	assert.Empty(t, rm.Skipped)
+	if !assert.Len(t, rm.Entries, 3) {
+		return
+	}
+
+	// the negated prefixes are removed from those of AS-TEST
+	e := rm.Entries[0]
+	assert.Equal(t, 10, e.Seq)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.128/25"}, prefixes(e))
+	assert.Equal(t, "900", e.LocalPref)
+	assert.Equal(t, "10", e.MED)
+
+	// the lower policy of the EXCEPT comes before the upper policy
+	e = rm.Entries[1]
+	assert.Equal(t, []string{"10.0.0.0/8^+"}, prefixes(e))
+	assert.Empty(t, e.LocalPref)
+	if assert.NotNil(t, e.AddCommunities) {
+		assert.Equal(t, []string{"65535:65281"}, e.AddCommunities.Communities)
+	}
+
+	e = rm.Entries[2]
+	assert.Equal(t, []string{"10.0.0.0/8"}, prefixes(e))
+	assert.Equal(t, "800", e.LocalPref)
+}
+
+func TestCompileIPv6(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{MaxPreference: 100, MapName: "%s-FROM-%d"})
+
+	rm, err := c.Compile(Import, neighbor(65536, 65537), true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the REFINE matches the routes matched by both policies
+	assert.Equal(t, "IMPORT-FROM-65537-IPV6", rm.Name)
+	if assert.Len(t, rm.Entries, 1) {
+		assert.Equal(t, []string{"2001:db8::/32^48"}, prefixes(rm.Entries[0]))
+		assert.Equal(t, "50", rm.Entries[0].LocalPref)
+	}
+
+	rm, err = c.Compile(Import, neighbor(65536, 65538), true)
+	if assert.NoError(t, err) {
+		assert.Empty(t, rm.Entries)
+	}
+}
+
+func TestCompileAggregate(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{Aggregate: true})
+
+	rm, err := c.Compile(Export, neighbor(65536, 65538), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// 198.51.100.0/25 and 198.51.100.128/25 are merged
+	if assert.Len(t, rm.Entries, 2) {
+		assert.Equal(t, []string{"198.51.100.0/24"}, prefixes(rm.Entries[0]))
+		assert.Equal(t, []string{"198.51.100.0/24^25"}, prefixes(rm.Entries[1]))
+	}
+}
+
+func TestCompileSkipped(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	rm, err := c.Compile(Import, neighbor(65539, 65537), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		"unsupported action dpa = 10",
+		"unsupported peering-set PRNG-TEST",
+		"unsupported filter FLTR-UNKNOWN",
+	}, rm.Skipped)
+	if assert.Len(t, rm.Entries, 1) {
+		e := rm.Entries[0]
+		assert.Nil(t, e.Prefixes)
+		assert.Equal(t, "igp", e.MED)
+		assert.Equal(t, "self", e.NextHop)
+		if assert.Len(t, e.ASPaths, 1) && assert.Len(t, e.Communities, 1) {
+			assert.True(t, e.ASPaths[0].Negated)
+			assert.False(t, e.Communities[0].Negated)
+			assert.True(t, e.Communities[0].List.Exact)
+		}
+	}
+
+	_, err = c.Compile(Import, neighbor(65540, 65537), false)
+	assert.EqualError(t, err, "aut-num AS65540 not found")
+}
+
+func TestRouteMapWrite(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	tests := []struct {
+		name string
+		dir  Direction
+		peer uint32
+		ipv6 bool
+	}{
+		{"import", Import, 65537, false},
+		{"import-aspath", Import, 65538, false},
+		{"import-ipv6", Import, 65537, true},
+		{"export", Export, 65537, false},
+		{"export-prepend", Export, 65538, false},
+		{"export-ipv6", Export, 65537, true},
+	}
+
+	for _, tt := range tests {
+		rm, err := c.Compile(tt.dir, neighbor(65536, tt.peer), tt.ipv6)
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+
+		for _, dialect := range generate.Dialects() {
+			var buf bytes.Buffer
+			err := rm.Write(&buf, dialect)
+			if _, ok := err.(*generate.UnsupportedError); ok {
+				buf.WriteString(err.Error() + "\n")
+			} else if !assert.NoError(t, err, "%s %s", tt.name, dialect) {
+				continue
+			}
+
+			golden(t, fmt.Sprintf("routemap-%s-%s", tt.name, dialect), buf.Bytes())
+		}
+	}
+}
+
+func TestRouteMapUnsupported(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	rm, err := c.Compile(Import, neighbor(65539, 65537), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		dialect  generate.Dialect
+		expected string
+	}{
+		{generate.CiscoIOS, "ios can not express NOT <^ AS65537 AS65538>, next-hop = self"},
+		{generate.Juniper, "junos can not express NOT <^ AS65537 AS65538>, community == {64500:2}"},
+		{generate.BIRD, "bird can not express community == {64500:2}, med = igp_cost, next-hop = self"},
+		{generate.OpenBGPD, "openbgpd can not express NOT <^ AS65537 AS65538>, community == {64500:2}, med = igp_cost"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		assert.EqualError(t, rm.Write(&buf, tt.dialect), tt.expected, tt.dialect.String())
+		assert.Empty(t, buf.String())
+	}
+
+	rm.Neighbor.PeerAddress = nil
+	assert.EqualError(t, rm.Write(ioutil.Discard, generate.OpenBGPD), "openbgpd route maps require the peer's address")
+}
+
+func TestRouteMapExecute(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	rm, err := c.Compile(Import, neighbor(65536, 65537), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tmpl := template.Must(template.New("custom").Funcs(TemplateFuncs).Parse(
+		`{{range .Entries}}{{$.Name}} {{.Seq}}{{range .Prefixes.Ranges}} {{.}}{{end}}{{"\n"}}{{end}}`))
+
+	var out bytes.Buffer
+	if assert.NoError(t, rm.Execute(&out, tmpl)) {
+		assert.Equal(t, strings.Join([]string{
+			"AS65537-IMPORT 10 10.0.0.0/8 192.0.2.128/25",
+			"AS65537-IMPORT 20 10.0.0.0/8^+",
+			"AS65537-IMPORT 30 10.0.0.0/8",
+			"",
+		}, "\n"), out.String())
+	}
+}
+
+func TestRouteMapMatch(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	route := func(cidr string, path []uint32, communities ...string) Route {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		return Route{Prefix: ipnet, Path: path, Communities: communities}
+	}
+
+	tests := []struct {
+		name     string
+		localAS  uint32
+		peerAS   uint32
+		route    Route
+		expected int // the sequence number of the matching entry, 0 if rejected
+	}{
+		{"AS-TEST prefix", 65536, 65537, route("10.0.0.0/8", []uint32{65537}), 10},
+		{"more specific by EXCEPT", 65536, 65537, route("10.2.0.0/16", []uint32{65537}), 20},
+		{"excluded prefix", 65536, 65537, route("192.0.2.0/25", []uint32{65537}), 0},
+		{"IPv6 route", 65536, 65537, route("2001:db8::/32", []uint32{65537}), 0},
+		{"path and community", 65536, 65538, route("10.1.0.0/16", []uint32{65538, 65537}, "64500:10"), 10},
+		{"missing community", 65536, 65538, route("10.1.0.0/16", []uint32{65538, 65537}), 20},
+		{"origin not in AS-TEST", 65536, 65538, route("192.0.2.0/24", []uint32{65538, 65540}, "64500:10"), 0},
+		{"negated path", 65539, 65537, route("192.0.2.0/24", []uint32{65537, 65538}, "64500:2"), 0},
+		{"exact community", 65539, 65537, route("192.0.2.0/24", []uint32{65537}, "64500:2"), 10},
+		{"extra community", 65539, 65537, route("192.0.2.0/24", []uint32{65537}, "64500:2", "64500:3"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm, err := c.Compile(Import, neighbor(tt.localAS, tt.peerAS), false)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			seq := 0
+			if e := rm.Match(tt.route); e != nil {
+				seq = e.Seq
+			}
+			assert.Equal(t, tt.expected, seq)
+		})
+	}
+}
+
+func TestCompileSkippedConjunction(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	rm, err := c.Compile(Import, neighbor(65541, 65537), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// only the conjunction using the missing as-set is skipped, and the lists
+	// of the remaining entry are the only ones in the route map
+	assert.Len(t, rm.Skipped, 1)
+	if assert.Len(t, rm.Entries, 1) {
+		assert.Equal(t, 10, rm.Entries[0].Seq)
+		assert.Equal(t, []string{"192.0.2.0/24"}, prefixes(rm.Entries[0]))
+	}
+	if assert.Len(t, rm.PrefixLists, 1) {
+		assert.Equal(t, "AS65537-IMPORT-10", rm.PrefixLists[0].Name)
+	}
+	assert.Empty(t, rm.ASPathFilters)
+}
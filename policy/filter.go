@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// FilterOp is the kind of a node in a filter expression
+type FilterOp int
+
+const (
+	// FilterAny matches every route
+	FilterAny FilterOp = iota
+	// FilterPeerAS matches the routes originated by the peer's AS
+	FilterPeerAS
+	// FilterASN matches the routes originated by an AS number
+	FilterASN
+	// FilterASSet matches the routes originated by the members of an as-set
+	FilterASSet
+	// FilterRouteSet matches the members of a route-set
+	FilterRouteSet
+	// FilterFilterSet matches the routes matched by a filter-set
+	FilterFilterSet
+	// FilterPrefixes matches an inline list of prefix ranges, e.g. {192.0.2.0/24^+}
+	FilterPrefixes
+	// FilterASPath matches routes with an AS path regular expression
+	FilterASPath
+	// FilterCommunity matches routes by their communities
+	FilterCommunity
+	// FilterNot matches the routes not matched by it's operand
+	FilterNot
+	// FilterAnd matches the routes matched by every operand
+	FilterAnd
+	// FilterOr matches the routes matched by any operand
+	FilterOr
+)
+
+// Filter is a node in an RPSL filter expression
+type Filter struct {
+	Op          FilterOp
+	Name        string         // the AS number or set name
+	Operator    string         // a range operator, e.g. ^+, applied to the matched prefixes
+	Prefixes    []string       // the prefix ranges of FilterPrefixes
+	ASPath      *aspath.Regexp // the regular expression of FilterASPath
+	Method      string         // contains, or == to match the communities exactly
+	Communities []string       // the communities of FilterCommunity
+	Sub         []*Filter      // the operands of FilterNot, FilterAnd and FilterOr
+}
+
+// ParseFilter parses an RPSL filter, such as the value following accept or
+// announce in a policy. IPv6 prefixes are only permitted in an mp-filter.
+func ParseFilter(value string, mp bool) (*Filter, error) {
+	tokens, err := scan(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %s", value, err)
+	}
+
+	p := &parser{tokens: tokens, mp: mp}
+	filter, err := p.filter()
+	if err == nil && p.pos < len(p.tokens) {
+		err = p.unexpected("end of filter")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %s", value, err)
+	}
+
+	return filter, nil
+}
+
+// String returns the filter in RPSL notation
+func (f *Filter) String() string {
+	switch f.Op {
+	case FilterAny:
+		return "ANY"
+	case FilterPeerAS:
+		return "PeerAS" + f.Operator
+	case FilterPrefixes:
+		return "{" + strings.Join(f.Prefixes, ", ") + "}" + f.Operator
+	case FilterASPath:
+		return f.ASPath.String()
+	case FilterCommunity:
+		if f.Method == "==" {
+			return "community == {" + strings.Join(f.Communities, ", ") + "}"
+		}
+		return "community.contains(" + strings.Join(f.Communities, ", ") + ")"
+	case FilterNot:
+		return "NOT " + f.Sub[0].operand(FilterNot)
+	case FilterAnd, FilterOr:
+		op := " OR "
+		if f.Op == FilterAnd {
+			op = " AND "
+		}
+
+		operands := make([]string, len(f.Sub))
+		for i, sub := range f.Sub {
+			operands[i] = sub.operand(f.Op)
+		}
+		return strings.Join(operands, op)
+	default:
+		return f.Name + f.Operator
+	}
+}
+
+// operand formats the filter as an operand of op, in parentheses if it binds
+// less tightly
+func (f *Filter) operand(op FilterOp) string {
+	if f.Op == FilterOr && op != FilterOr || f.Op == FilterAnd && op == FilterNot {
+		return "(" + f.String() + ")"
+	}
+
+	return f.String()
+}
+
+// filter parses a filter, in which NOT binds more tightly than AND, which
+// binds more tightly than OR. Operands which follow each other without an
+// operator are combined with OR.
+func (p *parser) filter() (*Filter, error) {
+	left, err := p.filterTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("or") || p.startsFilter() {
+		if p.is("or") {
+			p.next()
+		}
+
+		right, err := p.filterTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(FilterOr, left, right)
+	}
+
+	return left, nil
+}
+
+func (p *parser) filterTerm() (*Filter, error) {
+	left, err := p.filterFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("and") {
+		p.next()
+		right, err := p.filterFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = combine(FilterAnd, left, right)
+	}
+
+	return left, nil
+}
+
+func (p *parser) filterFactor() (*Filter, error) {
+	if p.is("not") {
+		p.next()
+		operand, err := p.filterFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: FilterNot, Sub: []*Filter{operand}}, nil
+	}
+
+	return p.filterOperand()
+}
+
+// startsFilter reports whether the next token begins a filter operand
+func (p *parser) startsFilter() bool {
+	tok := p.peek()
+	return tok == "(" || tok == "{" || strings.HasPrefix(tok, "<") || p.isName()
+}
+
+func (p *parser) filterOperand() (*Filter, error) {
+	switch tok := p.peek(); {
+	case tok == "(":
+		p.next()
+		filter, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		return filter, p.expect(")")
+	case tok == "{":
+		return p.prefixes()
+	case strings.HasPrefix(tok, "<"):
+		re, err := aspath.Parse(p.next())
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: FilterASPath, ASPath: re}, nil
+	case !p.isName():
+		return nil, p.unexpected("filter")
+	}
+
+	name, op := p.next(), ""
+	if i := strings.Index(name, "^"); i >= 0 {
+		name, op = name[:i], name[i:]
+	}
+
+	upper := strings.ToUpper(name)
+	switch class := lexer.SetClass(upper); {
+	case upper == "ANY" && op == "":
+		return &Filter{Op: FilterAny}, nil
+	case upper == "PEERAS":
+		return &Filter{Op: FilterPeerAS, Operator: op}, nil
+	case strings.HasPrefix(upper, "COMMUNITY") && op == "":
+		return p.community(strings.ToLower(name))
+	case lexer.IsASN(upper):
+		return &Filter{Op: FilterASN, Name: upper, Operator: op}, nil
+	case class == token.CLASS_AS_SET:
+		return &Filter{Op: FilterASSet, Name: upper, Operator: op}, nil
+	case class == token.CLASS_ROUTE_SET:
+		return &Filter{Op: FilterRouteSet, Name: upper, Operator: op}, nil
+	case class == token.CLASS_FILTER_SET && op == "":
+		return &Filter{Op: FilterFilterSet, Name: upper}, nil
+	}
+
+	return nil, fmt.Errorf("unknown filter %q", name+op)
+}
+
+// prefixes parses a list of prefix ranges within braces, which may be followed
+// by a range operator, e.g. {192.0.2.0/24, 198.51.100.0/24}^+
+func (p *parser) prefixes() (*Filter, error) {
+	p.next()
+	values, err := p.list("}")
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &Filter{Op: FilterPrefixes, Prefixes: []string{}}
+	for _, value := range values {
+		r, err := prefix.ParseRange(value)
+		if err != nil {
+			return nil, err
+		}
+		if !prefix.IsIPv4(r.Prefix) && !p.mp {
+			return nil, fmt.Errorf("IPv6 prefix %s is only permitted in an mp-filter", value)
+		}
+		filter.Prefixes = append(filter.Prefixes, value)
+	}
+
+	if strings.HasPrefix(p.peek(), "^") {
+		filter.Operator = p.next()
+	}
+
+	return filter, nil
+}
+
+// community parses a community filter, which is either community(...) or
+// community.contains(...) to match routes with at least the communities, or
+// community == {...} to match routes with exactly the communities
+func (p *parser) community(name string) (*Filter, error) {
+	filter := &Filter{Op: FilterCommunity, Method: "contains"}
+
+	var err error
+	switch {
+	case (name == "community" || name == "community.contains") && p.peek() == "(":
+		p.next()
+		filter.Communities, err = p.list(")")
+	case name == "community" && p.peek() == "==":
+		p.next()
+		if err = p.expect("{"); err == nil {
+			filter.Method = "=="
+			filter.Communities, err = p.list("}")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported community filter %q", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// combine joins two filters with AND or OR, flattening nested operations
+func combine(op FilterOp, left, right *Filter) *Filter {
+	if left.Op == op {
+		left.Sub = append(left.Sub, right)
+		return left
+	}
+
+	return &Filter{Op: op, Sub: []*Filter{left, right}}
+}
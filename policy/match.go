@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"net"
+
+	"github.com/kkirsche/rpsl/prefix"
+)
+
+// Route is a route matched against a route map
+type Route struct {
+	Prefix      *net.IPNet
+	Path        []uint32 // the AS path, nearest AS first
+	Communities []string // written as ASN:value
+}
+
+// Match returns the first entry of the route map which accepts the route, or
+// nil if the route is rejected. Routes of the other address family match no
+// entry.
+func (rm *RouteMap) Match(r Route) *Entry {
+	if prefix.IsIPv4(r.Prefix) == rm.IPv6 {
+		return nil
+	}
+
+	for _, e := range rm.Entries {
+		if e.Match(r, rm.Neighbor.PeerAS) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the route, exchanged with the peer AS, matches all of
+// the entry's conditions
+func (e *Entry) Match(r Route, peerAS uint32) bool {
+	if e.Prefixes != nil {
+		matched := false
+		for _, rng := range e.Prefixes.Ranges {
+			if rng.Contains(r.Prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, m := range e.ASPaths {
+		if m.Filter.Match(r.Path, peerAS) == m.Negated {
+			return false
+		}
+	}
+
+	for _, m := range e.Communities {
+		if m.List.Match(r.Communities) == m.Negated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match reports whether the communities of a route include every community of
+// the list, or if the list is Exact, are exactly those of the list
+func (l *CommunityList) Match(communities []string) bool {
+	has := make(map[string]bool)
+	for _, c := range communities {
+		has[c] = true
+	}
+
+	want := make(map[string]bool)
+	for _, c := range l.Communities {
+		if !has[c] {
+			return false
+		}
+		want[c] = true
+	}
+
+	return !l.Exact || len(has) == len(want)
+}
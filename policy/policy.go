@@ -0,0 +1,606 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Direction is whether a policy applies to the routes received from peers or
+// to those announced to them
+type Direction int
+
+const (
+	// Import policies are given by import and mp-import attributes
+	Import Direction = iota
+	// Export policies are given by export and mp-export attributes
+	Export
+)
+
+func (d Direction) String() string {
+	if d == Export {
+		return "export"
+	}
+
+	return "import"
+}
+
+// Policy is a parsed import, export, mp-import or mp-export attribute
+type Policy struct {
+	Direction     Direction
+	MultiProtocol bool   // mp-import or mp-export, which may use afi and IPv6
+	Protocol      string // the protocol routes are exchanged with, empty if not given
+	Into          string // the protocol routes are imported into or exported from, empty if not given
+	Expression    *Expression
+}
+
+// Expression is a policy term, optionally followed by EXCEPT or REFINE and the
+// expression which the term is combined with
+type Expression struct {
+	AFI      []string // the address families given by afi, nil if not given
+	Term     []*Factor
+	Operator string // EXCEPT or REFINE, empty if the expression is a single term
+	Next     *Expression
+}
+
+// Factor is one or more peerings, each with optional actions, and the filter
+// which selects the routes exchanged with them
+type Factor struct {
+	Peerings []*PeeringAction
+	Filter   *Filter
+}
+
+// PeeringAction is a from or to clause, along with the actions applied to
+// routes exchanged with the peering
+type PeeringAction struct {
+	Peering *Peering
+	Actions []*Action
+}
+
+// Peering describes the sessions a factor applies to: an expression of AS
+// numbers and as-sets, optionally limited to the peer's routers and to the
+// local routers given after at. The router expressions are nil if not given.
+type Peering struct {
+	AS     *SetExpr
+	Remote *SetExpr
+	Local  *SetExpr
+	Set    string // a peering-set name, used instead of the other fields
+}
+
+// SetExpr is an AS or router expression, either a single name or two
+// expressions combined with AND, OR or EXCEPT
+type SetExpr struct {
+	Operator    string // AND, OR or EXCEPT, empty for a name
+	Name        string
+	Left, Right *SetExpr
+}
+
+// Action is an action applied to routes, either an operator such as
+// pref = 10 or a method call such as community.append(65537:1)
+type Action struct {
+	Attribute string   // e.g. pref, community or aspath
+	Method    string   // e.g. append or prepend, empty for an operator
+	Operator  string   // e.g. = or .=, empty for a method call
+	Args      []string // the value, or the method arguments
+}
+
+func (e *SetExpr) String() string {
+	if e.Operator == "" {
+		return e.Name
+	}
+
+	return fmt.Sprintf("(%s %s %s)", e.Left, e.Operator, e.Right)
+}
+
+func (p *Peering) String() string {
+	if p.Set != "" {
+		return p.Set
+	}
+
+	s := p.AS.String()
+	if p.Remote != nil {
+		s += " " + p.Remote.String()
+	}
+	if p.Local != nil {
+		s += " at " + p.Local.String()
+	}
+
+	return s
+}
+
+func (a *Action) String() string {
+	if a.Method != "" {
+		return fmt.Sprintf("%s.%s(%s)", a.Attribute, a.Method, strings.Join(a.Args, ", "))
+	}
+
+	value := strings.Join(a.Args, ", ")
+	if len(a.Args) != 1 {
+		value = "{" + value + "}"
+	}
+
+	return fmt.Sprintf("%s %s %s", a.Attribute, a.Operator, value)
+}
+
+// keywords may not be used as names within a policy
+var keywords = map[string]bool{
+	"from": true, "to": true, "action": true, "accept": true, "announce": true,
+	"except": true, "refine": true, "at": true, "afi": true, "and": true,
+	"or": true, "not": true, "protocol": true, "into": true,
+}
+
+// Parse parses the value of an import, export, mp-import or mp-export
+// attribute, given by it's attribute type, e.g. token.ATTR_IMPORT. The value of
+// an attribute which spans several lines is it's lines joined by spaces.
+func Parse(t token.Type, value string) (*Policy, error) {
+	policy := &Policy{}
+	switch t {
+	case token.ATTR_IMPORT:
+	case token.ATTR_EXPORT:
+		policy.Direction = Export
+	case token.ATTR_MULTI_PROTO_IMPORT_POLICY:
+		policy.MultiProtocol = true
+	case token.ATTR_MULTI_PROTO_EXPORT_POLICY:
+		policy.Direction, policy.MultiProtocol = Export, true
+	default:
+		return nil, fmt.Errorf("%s is not a policy attribute", t.Name())
+	}
+
+	tokens, err := scan(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s policy %q: %s", t.Name(), value, err)
+	}
+
+	p := &parser{tokens: tokens, direction: policy.Direction, mp: policy.MultiProtocol}
+	if err := p.policy(policy); err != nil {
+		return nil, fmt.Errorf("invalid %s policy %q: %s", t.Name(), value, err)
+	}
+
+	return policy, nil
+}
+
+// ParseAttribute parses an import, export, mp-import or mp-export attribute,
+// including any continuation lines
+func ParseAttribute(attr *ast.Attribute) (*Policy, error) {
+	return Parse(attr.Token.Type, strings.Join(attr.Lines(), " "))
+}
+
+// scan splits a policy into words, punctuation, operators and AS path
+// regular expressions
+func scan(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '<' && operatorAt(s, i) == "":
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated AS path regular expression %q", s[i:])
+			}
+			tokens = append(tokens, s[i:i+end+1])
+			i += end + 1
+		case strings.IndexByte(";{}(),", c) >= 0:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case operatorAt(s, i) != "":
+			op := operatorAt(s, i)
+			tokens = append(tokens, op)
+			i += len(op)
+		case isWordByte(c):
+			j := i
+			for j < len(s) && isWordByte(s[j]) && operatorAt(s, j) == "" {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+var operators = []string{".=", "+=", "-=", "*=", "/=", "==", "!=", "<=", ">=", "="}
+
+// operatorAt returns the action operator found at position i, if any
+func operatorAt(s string, i int) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s[i:], op) {
+			return op
+		}
+	}
+
+	return ""
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_:.-/^+", c) >= 0
+}
+
+type parser struct {
+	tokens    []string
+	pos       int
+	direction Direction
+	mp        bool
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+
+	return tok
+}
+
+// is reports whether the next token is the keyword
+func (p *parser) is(keyword string) bool {
+	return strings.EqualFold(p.peek(), keyword)
+}
+
+func (p *parser) expect(expected string) error {
+	if !p.is(expected) {
+		return p.unexpected(expected)
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("expected %s, found end of policy", expected)
+	}
+
+	return fmt.Errorf("expected %s, found %q", expected, p.peek())
+}
+
+// isName reports whether the next token may be used as a name
+func (p *parser) isName() bool {
+	tok := p.peek()
+	return tok != "" && isWordByte(tok[0]) && !keywords[strings.ToLower(tok)]
+}
+
+// keywords returns the keywords which begin a peering and a filter
+func (p *parser) keywords() (string, string) {
+	if p.direction == Export {
+		return "to", "announce"
+	}
+
+	return "from", "accept"
+}
+
+func (p *parser) policy(policy *Policy) error {
+	if p.is("protocol") {
+		p.next()
+		if !p.isName() {
+			return p.unexpected("protocol name")
+		}
+		policy.Protocol = p.next()
+	}
+
+	if p.is("into") {
+		p.next()
+		if !p.isName() {
+			return p.unexpected("protocol name")
+		}
+		policy.Into = p.next()
+	}
+
+	expr, err := p.expression()
+	if err != nil {
+		return err
+	}
+	policy.Expression = expr
+
+	if p.peek() == ";" {
+		p.next()
+	}
+	if p.pos < len(p.tokens) {
+		return p.unexpected("end of policy")
+	}
+
+	return nil
+}
+
+func (p *parser) expression() (*Expression, error) {
+	expr := &Expression{}
+	if p.mp && p.is("afi") {
+		p.next()
+		afi, err := p.afiList()
+		if err != nil {
+			return nil, err
+		}
+		expr.AFI = afi
+	}
+
+	term, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	expr.Term = term
+
+	if p.is("except") || p.is("refine") {
+		expr.Operator = strings.ToUpper(p.next())
+		if expr.Next, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+
+	return expr, nil
+}
+
+// afiList parses a comma separated list of address families, e.g.
+// ipv4.unicast, ipv6
+func (p *parser) afiList() ([]string, error) {
+	var afi []string
+	for {
+		name := strings.ToLower(p.peek())
+		parts := strings.SplitN(name, ".", 2)
+		if parts[0] != "ipv4" && parts[0] != "ipv6" && parts[0] != "any" ||
+			len(parts) == 2 && parts[1] != "unicast" && parts[1] != "multicast" {
+			return nil, p.unexpected("address family")
+		}
+		afi = append(afi, name)
+		p.next()
+
+		if p.peek() != "," {
+			return afi, nil
+		}
+		p.next()
+	}
+}
+
+// term parses either a single factor or a structured term, which is a list of
+// factors separated by semicolons within braces
+func (p *parser) term() ([]*Factor, error) {
+	if p.peek() != "{" {
+		factor, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return []*Factor{factor}, nil
+	}
+	p.next()
+
+	var term []*Factor
+	for p.peek() != "}" {
+		factor, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		term = append(term, factor)
+
+		if p.peek() == ";" {
+			p.next()
+		} else if p.peek() != "}" {
+			return nil, p.unexpected(`";" or "}"`)
+		}
+	}
+	p.next()
+
+	if len(term) == 0 {
+		return nil, fmt.Errorf("empty policy term")
+	}
+
+	return term, nil
+}
+
+func (p *parser) factor() (*Factor, error) {
+	peeringKeyword, filterKeyword := p.keywords()
+	if !p.is(peeringKeyword) {
+		return nil, p.unexpected(peeringKeyword)
+	}
+
+	factor := &Factor{}
+	for p.is(peeringKeyword) {
+		p.next()
+		peering, err := p.peering()
+		if err != nil {
+			return nil, err
+		}
+
+		pa := &PeeringAction{Peering: peering}
+		if p.is("action") {
+			p.next()
+			if pa.Actions, err = p.actions(); err != nil {
+				return nil, err
+			}
+		}
+		factor.Peerings = append(factor.Peerings, pa)
+	}
+
+	if err := p.expect(filterKeyword); err != nil {
+		return nil, err
+	}
+
+	filter, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	factor.Filter = filter
+
+	return factor, nil
+}
+
+func (p *parser) peering() (*Peering, error) {
+	if p.isName() && lexer.SetClass(p.peek()) == token.CLASS_PEERING_SET {
+		return &Peering{Set: strings.ToUpper(p.next())}, nil
+	}
+
+	as, err := p.setExpr("AS number or as-set", func(name string) bool {
+		return lexer.IsASN(name) || lexer.SetClass(name) == token.CLASS_AS_SET
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	peering := &Peering{AS: as}
+	if p.isName() {
+		if peering.Remote, err = p.setExpr("router", anyName); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.is("at") {
+		p.next()
+		if peering.Local, err = p.setExpr("router", anyName); err != nil {
+			return nil, err
+		}
+	}
+
+	return peering, nil
+}
+
+func anyName(string) bool {
+	return true
+}
+
+// setExpr parses an AS or router expression, in which AND and EXCEPT bind
+// more tightly than OR
+func (p *parser) setExpr(expected string, valid func(string) bool) (*SetExpr, error) {
+	left, err := p.setTerm(expected, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("or") {
+		p.next()
+		right, err := p.setTerm(expected, valid)
+		if err != nil {
+			return nil, err
+		}
+		left = &SetExpr{Operator: "OR", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) setTerm(expected string, valid func(string) bool) (*SetExpr, error) {
+	left, err := p.setOperand(expected, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("and") || p.is("except") {
+		op := strings.ToUpper(p.next())
+		right, err := p.setOperand(expected, valid)
+		if err != nil {
+			return nil, err
+		}
+		left = &SetExpr{Operator: op, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) setOperand(expected string, valid func(string) bool) (*SetExpr, error) {
+	if p.peek() == "(" {
+		p.next()
+		expr, err := p.setExpr(expected, valid)
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+
+	if !p.isName() || !valid(strings.ToUpper(p.peek())) {
+		return nil, p.unexpected(expected)
+	}
+
+	return &SetExpr{Name: strings.ToUpper(p.next())}, nil
+}
+
+// actions parses the actions following the action keyword, each of which is
+// terminated by a semicolon
+func (p *parser) actions() ([]*Action, error) {
+	peeringKeyword, filterKeyword := p.keywords()
+
+	var actions []*Action
+	for {
+		action, err := p.action()
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+
+		if p.is(peeringKeyword) || p.is(filterKeyword) {
+			return actions, nil
+		}
+	}
+}
+
+func (p *parser) action() (*Action, error) {
+	if !p.isName() {
+		return nil, p.unexpected("action")
+	}
+
+	name := strings.ToLower(p.next())
+	action := &Action{Attribute: name}
+	if i := strings.Index(name, "."); i >= 0 {
+		action.Attribute, action.Method = name[:i], name[i+1:]
+	}
+
+	var err error
+	if action.Method != "" {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if action.Args, err = p.list(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		if action.Operator = operatorAt(p.peek(), 0); action.Operator == "" || action.Operator != p.peek() {
+			return nil, p.unexpected("action operator")
+		}
+		p.next()
+
+		switch {
+		case p.peek() == "{":
+			p.next()
+			if action.Args, err = p.list("}"); err != nil {
+				return nil, err
+			}
+		case p.isName():
+			action.Args = []string{p.next()}
+		default:
+			return nil, p.unexpected("action value")
+		}
+	}
+
+	return action, p.expect(";")
+}
+
+// list parses a comma separated list of names up to the closing token, which
+// is consumed
+func (p *parser) list(closing string) ([]string, error) {
+	var values []string
+	for p.peek() != closing {
+		if len(values) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		if !p.isName() {
+			return nil, p.unexpected("value")
+		}
+		values = append(values, p.next())
+	}
+	p.next()
+
+	return values, nil
+}
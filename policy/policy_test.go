@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(token.ATTR_IMPORT, "from AS65537 192.0.2.1 at 192.0.2.2 action pref = 100; community.append(65536:1); accept AS-TEST AND NOT {10.0.0.0/8^+}")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, Import, p.Direction)
+	assert.False(t, p.MultiProtocol)
+	assert.Nil(t, p.Expression.Next)
+	if !assert.Len(t, p.Expression.Term, 1) {
+		return
+	}
+
+	factor := p.Expression.Term[0]
+	if assert.Len(t, factor.Peerings, 1) {
+		peering := factor.Peerings[0]
+		assert.Equal(t, "AS65537", peering.Peering.AS.String())
+		assert.Equal(t, "192.0.2.1", peering.Peering.Remote.String())
+		assert.Equal(t, "192.0.2.2", peering.Peering.Local.String())
+		if assert.Len(t, peering.Actions, 2) {
+			assert.Equal(t, "pref = 100", peering.Actions[0].String())
+			assert.Equal(t, "community.append(65536:1)", peering.Actions[1].String())
+		}
+	}
+	assert.Equal(t, "AS-TEST AND NOT {10.0.0.0/8^+}", factor.Filter.String())
+}
+
+func TestParseStructured(t *testing.T) {
+	p, err := Parse(token.ATTR_MULTI_PROTO_EXPORT_POLICY, `protocol BGP4 into OSPF afi ipv6.unicast {
+		to AS65537 OR AS-PEERS EXCEPT AS65538 action med = 10; announce AS65536;
+		to AS65539 announce ANY;
+	} refine afi any to AS-ANY announce NOT community(no_export)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, Export, p.Direction)
+	assert.True(t, p.MultiProtocol)
+	assert.Equal(t, "BGP4", p.Protocol)
+	assert.Equal(t, "OSPF", p.Into)
+
+	expr := p.Expression
+	assert.Equal(t, []string{"ipv6.unicast"}, expr.AFI)
+	assert.Equal(t, "REFINE", expr.Operator)
+	if assert.Len(t, expr.Term, 2) {
+		assert.Equal(t, "(AS65537 OR (AS-PEERS EXCEPT AS65538))", expr.Term[0].Peerings[0].Peering.AS.String())
+		assert.Equal(t, "AS65536", expr.Term[0].Filter.String())
+		assert.Equal(t, "ANY", expr.Term[1].Filter.String())
+	}
+
+	if assert.NotNil(t, expr.Next) {
+		assert.Equal(t, []string{"any"}, expr.Next.AFI)
+		assert.Equal(t, "NOT community.contains(no_export)", expr.Next.Term[0].Filter.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		t        token.Type
+		value    string
+		expected string
+	}{
+		{token.ATTR_MAINTAINED_BY, "TEST-MNT", "mnt-by is not a policy attribute"},
+		{token.ATTR_IMPORT, "to AS65537 announce ANY", `invalid import policy "to AS65537 announce ANY": expected from, found "to"`},
+		{token.ATTR_IMPORT, "from AS65537 accept {2001:db8::/32}", `invalid import policy "from AS65537 accept {2001:db8::/32}": IPv6 prefix 2001:db8::/32 is only permitted in an mp-filter`},
+		{token.ATTR_EXPORT, "to AS65537 announce <^AS65537", `invalid export policy "to AS65537 announce <^AS65537": unterminated AS path regular expression "<^AS65537"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.t, tt.value)
+		assert.EqualError(t, err, tt.expected, tt.value)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"ANY", "ANY"},
+		{"AS65537 AS-TEST", "AS65537 OR AS-TEST"},
+		{"PeerAS^+ AND NOT AS65537:RS-TEST^24", "PeerAS^+ AND NOT AS65537:RS-TEST^24"},
+		{"(AS65537 OR AS65538) AND <^AS65537 .* $>", "(AS65537 OR AS65538) AND <^ AS65537 .* $>"},
+		{"NOT (AS65537 AND fltr-test)", "NOT (AS65537 AND FLTR-TEST)"},
+		{"community == {65536:1, no_export}", "community == {65536:1, no_export}"},
+		{"{192.0.2.0/24^25, 198.51.100.0/24}^+", "{192.0.2.0/24^25, 198.51.100.0/24}^+"},
+	}
+
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.value, false)
+		if assert.NoError(t, err, tt.value) {
+			assert.Equal(t, tt.expected, f.String(), tt.value)
+		}
+	}
+
+	_, err := ParseFilter("AS65537 AND", false)
+	assert.EqualError(t, err, `invalid filter "AS65537 AND": expected filter, found end of policy`)
+}
@@ -0,0 +1,605 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/kkirsche/rpsl/generate"
+)
+
+// routeMapData is passed to the route map templates
+type routeMapData struct {
+	*RouteMap
+	Definitions string // the prefix lists and AS path filters, written in the dialect
+	Family      string // ip or ipv6
+	AFI         string // ipv4 or ipv6
+	Way         string // in or out
+}
+
+// TemplateFuncs are the functions available to route map templates, including
+// those given to RouteMap.Execute
+var TemplateFuncs = template.FuncMap{
+	"ident":      generate.Identifier,
+	"join":       func(values []string, sep string) string { return strings.Join(values, sep) },
+	"asns":       joinASNs,
+	"reverse":    reverseASNs,
+	"exact":      exactList,
+	"last":       func(i int, values []string) bool { return i == len(values)-1 },
+	"conditions": hasConditions,
+	"community":  birdCommunity,
+	"xrPrepend":  xrPrepend,
+	"xrCondition": func(e *Entry) string {
+		var conditions []string
+		if e.Prefixes != nil {
+			conditions = append(conditions, "destination in "+e.Prefixes.Name)
+		}
+		for _, m := range e.ASPaths {
+			conditions = append(conditions, negate(m.Negated, "not ")+"as-path in "+m.Filter.Name)
+		}
+		for _, m := range e.Communities {
+			conditions = append(conditions, negate(m.Negated, "not ")+"community matches-every "+m.List.Name)
+		}
+		return strings.Join(conditions, " and ")
+	},
+	"birdCondition": func(e *Entry) string {
+		var conditions []string
+		if e.Prefixes != nil {
+			conditions = append(conditions, "net ~ "+generate.Identifier(e.Prefixes.Name))
+		}
+		for _, m := range e.ASPaths {
+			conditions = append(conditions, negate(m.Negated, "!")+generate.Identifier(m.Filter.Name)+"()")
+		}
+		for _, m := range e.Communities {
+			var members []string
+			for _, c := range m.List.Communities {
+				members = append(members, birdCommunity(c)+" ~ bgp_community")
+			}
+			condition := strings.Join(members, " && ")
+			if m.Negated {
+				condition = "!(" + condition + ")"
+			}
+			conditions = append(conditions, condition)
+		}
+		if len(conditions) == 0 {
+			return "true"
+		}
+		return strings.Join(conditions, " && ")
+	},
+	"openbgpdMatch": func(e *Entry) string {
+		var matches []string
+		if e.Prefixes != nil {
+			matches = append(matches, "prefix-set "+e.Prefixes.Name)
+		}
+		for _, m := range e.ASPaths {
+			matches = append(matches, "$"+generate.Identifier(m.Filter.Name)+"_match")
+		}
+		for _, m := range e.Communities {
+			for _, c := range m.List.Communities {
+				matches = append(matches, "community "+c)
+			}
+		}
+		return strings.Join(matches, " ")
+	},
+}
+
+var routeMapTemplates = map[generate.Dialect]*template.Template{
+	generate.CiscoIOS: template.Must(template.New("ios").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+{{range $l := .CommunityLists}}{{if eq .Use "match" "delete" -}}
+no ip community-list standard {{.Name}}
+{{if eq .Use "match" -}}
+ip community-list standard {{.Name}} permit {{join .Communities " "}}
+{{else -}}
+{{range .Communities}}ip community-list standard {{$l.Name}} permit {{.}}
+{{end -}}
+{{end -}}
+{{end}}{{end -}}
+no route-map {{.Name}}
+{{range .Entries -}}
+route-map {{$.Name}} permit {{.Seq}}
+{{with .Prefixes}} match {{$.Family}} address prefix-list {{.Name}}
+{{end -}}
+{{range .ASPaths}} match as-path {{.Filter.Name}}
+{{end -}}
+{{range .Communities}} match community {{.List.Name}}{{if .List.Exact}} exact-match{{end}}
+{{end -}}
+{{with .LocalPref}} set local-preference {{.}}
+{{end -}}
+{{with .MED}}{{if eq . "igp"}} set metric-type internal{{else}} set metric {{.}}{{end}}
+{{end -}}
+{{with .SetCommunities}} set community {{join .Communities " "}}
+{{end -}}
+{{with .AddCommunities}} set community {{join .Communities " "}} additive
+{{end -}}
+{{with .DeleteCommunities}} set comm-list {{.Name}} delete
+{{end -}}
+{{with .Prepend}} set as-path prepend {{asns . " "}}
+{{end -}}
+{{with .NextHop}} set {{$.Family}} next-hop {{.}}
+{{end -}}
+{{else -}}
+route-map {{.Name}} deny 10
+{{end -}}
+{{with .Neighbor.PeerAddress -}}
+router bgp {{$.Neighbor.LocalAS}}
+ neighbor {{.}} remote-as {{$.Neighbor.PeerAS}}
+ address-family {{$.AFI}} unicast
+  neighbor {{.}} activate
+  neighbor {{.}} route-map {{$.Name}} {{$.Way}}
+ exit-address-family
+{{end -}}
+`)),
+	generate.CiscoIOSXR: template.Must(template.New("iosxr").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+{{range $l := .CommunityLists -}}
+community-set {{.Name}}
+{{- range $i, $c := .Communities}}
+  {{$c}}{{if not (last $i $l.Communities)}},{{end}}
+{{- end}}
+end-set
+{{end -}}
+route-policy {{.Name}}
+{{- range .Entries}}
+{{- $indent := "  "}}
+{{- if conditions .}}
+  if {{xrCondition .}} then
+{{- $indent = "    "}}
+{{- end}}
+{{- with .LocalPref}}
+{{$indent}}set local-preference {{.}}
+{{- end}}
+{{- with .MED}}
+{{$indent}}set med {{if eq . "igp"}}igp-cost{{else}}{{.}}{{end}}
+{{- end}}
+{{- with .SetCommunities}}
+{{$indent}}set community {{.Name}}
+{{- end}}
+{{- with .AddCommunities}}
+{{$indent}}set community {{.Name}} additive
+{{- end}}
+{{- with .DeleteCommunities}}
+{{$indent}}delete community in {{.Name}}
+{{- end}}
+{{- range xrPrepend .Prepend}}
+{{$indent}}prepend as-path {{.}}
+{{- end}}
+{{- with .NextHop}}
+{{$indent}}set next-hop {{.}}
+{{- end}}
+{{$indent}}done
+{{- if conditions .}}
+  endif
+{{- end}}
+{{- end}}
+  drop
+end-policy
+{{with .Neighbor.PeerAddress -}}
+router bgp {{$.Neighbor.LocalAS}}
+ neighbor {{.}}
+  remote-as {{$.Neighbor.PeerAS}}
+  address-family {{$.AFI}} unicast
+   route-policy {{$.Name}} {{$.Way}}
+{{end -}}
+`)),
+	generate.Juniper: template.Must(template.New("junos").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+policy-options {
+{{- range .CommunityLists}}
+    replace:
+    community {{.Name}} members [ {{join .Communities " "}} ];
+{{- end}}
+    replace:
+    policy-statement {{.Name}} {
+{{- range .Entries}}
+        term {{.Seq}} {
+{{- if conditions .}}
+            from {
+{{- with .Prefixes}}
+                {{if exact .}}prefix-list{{else}}route-filter-list{{end}} {{.Name}};
+{{- end}}
+{{- range .ASPaths}}
+                as-path-group {{.Filter.Name}};
+{{- end}}
+{{- range .Communities}}
+                community {{.List.Name}};
+{{- end}}
+            }
+{{- end}}
+            then {
+{{- with .LocalPref}}
+                local-preference {{.}};
+{{- end}}
+{{- with .MED}}
+                metric {{.}};
+{{- end}}
+{{- with .SetCommunities}}
+                community set {{.Name}};
+{{- end}}
+{{- with .AddCommunities}}
+                community add {{.Name}};
+{{- end}}
+{{- with .DeleteCommunities}}
+                community delete {{.Name}};
+{{- end}}
+{{- with .Prepend}}
+                as-path-prepend "{{asns . " "}}";
+{{- end}}
+{{- with .NextHop}}
+                next-hop {{.}};
+{{- end}}
+                accept;
+            }
+        }
+{{- end}}
+        term reject {
+            then reject;
+        }
+    }
+}
+{{with .Neighbor.PeerAddress -}}
+protocols {
+    bgp {
+        group {{$.Name}} {
+            type external;
+            peer-as {{$.Neighbor.PeerAS}};
+            neighbor {{.}} {
+                {{if eq $.Way "in"}}import{{else}}export{{end}} {{$.Name}};
+            }
+        }
+    }
+}
+{{end -}}
+`)),
+	generate.Arista: template.Must(template.New("eos").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+{{range $l := .CommunityLists}}{{if eq .Use "match" "delete" -}}
+no ip community-list {{.Name}}
+{{if eq .Use "match" -}}
+ip community-list {{.Name}} permit {{join .Communities " "}}
+{{else -}}
+{{range .Communities}}ip community-list {{$l.Name}} permit {{.}}
+{{end -}}
+{{end -}}
+{{end}}{{end -}}
+no route-map {{.Name}}
+{{range .Entries -}}
+route-map {{$.Name}} permit {{.Seq}}
+{{with .Prefixes}}   match {{$.Family}} address prefix-list {{.Name}}
+{{end -}}
+{{range .ASPaths}}   match as-path {{.Filter.Name}}
+{{end -}}
+{{range .Communities}}   match community {{.List.Name}}{{if .List.Exact}} exact-match{{end}}
+{{end -}}
+{{with .LocalPref}}   set local-preference {{.}}
+{{end -}}
+{{with .MED}}   set metric {{.}}
+{{end -}}
+{{with .SetCommunities}}   set community {{join .Communities " "}}
+{{end -}}
+{{with .AddCommunities}}   set community {{join .Communities " "}} additive
+{{end -}}
+{{with .DeleteCommunities}}   set community community-list {{.Name}} delete
+{{end -}}
+{{with .Prepend}}   set as-path prepend {{asns . " "}}
+{{end -}}
+{{with .NextHop}}   set {{$.Family}} next-hop {{.}}
+{{end -}}
+{{else -}}
+route-map {{.Name}} deny 10
+{{end -}}
+{{with .Neighbor.PeerAddress -}}
+router bgp {{$.Neighbor.LocalAS}}
+   neighbor {{.}} remote-as {{$.Neighbor.PeerAS}}
+   address-family {{$.AFI}}
+      neighbor {{.}} activate
+      neighbor {{.}} route-map {{$.Name}} {{$.Way}}
+{{end -}}
+`)),
+	generate.BIRD: template.Must(template.New("bird").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+filter {{ident .Name}}
+{
+{{- range .Entries}}
+    if {{birdCondition .}} then {
+{{- with .LocalPref}}
+        bgp_local_pref = {{.}};
+{{- end}}
+{{- with .MED}}
+        bgp_med = {{.}};
+{{- end}}
+{{- with .SetCommunities}}
+        bgp_community = -empty-;
+{{- range .Communities}}
+        bgp_community.add({{community .}});
+{{- end}}
+{{- end}}
+{{- with .AddCommunities}}
+{{- range .Communities}}
+        bgp_community.add({{community .}});
+{{- end}}
+{{- end}}
+{{- with .DeleteCommunities}}
+{{- range .Communities}}
+        bgp_community.delete({{community .}});
+{{- end}}
+{{- end}}
+{{- range reverse .Prepend}}
+        bgp_path.prepend({{.}});
+{{- end}}
+{{- with .NextHop}}
+        bgp_next_hop = {{.}};
+{{- end}}
+        accept;
+    }
+{{- end}}
+    reject;
+}
+{{with .Neighbor.PeerAddress -}}
+protocol bgp {{ident $.Name}} {
+    local {{with $.Neighbor.LocalAddress}}{{.}} {{end}}as {{$.Neighbor.LocalAS}};
+    neighbor {{.}} as {{$.Neighbor.PeerAS}};
+    {{$.AFI}} {
+        {{if eq $.Way "in"}}import{{else}}export{{end}} filter {{ident $.Name}};
+    };
+}
+{{end -}}
+`)),
+	generate.FRR: template.Must(template.New("frr").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+{{range $l := .CommunityLists}}{{if eq .Use "match" "delete" -}}
+no bgp community-list standard {{.Name}}
+{{if eq .Use "match" -}}
+bgp community-list standard {{.Name}} permit {{join .Communities " "}}
+{{else -}}
+{{range .Communities}}bgp community-list standard {{$l.Name}} permit {{.}}
+{{end -}}
+{{end -}}
+{{end}}{{end -}}
+no route-map {{.Name}}
+{{range .Entries -}}
+route-map {{$.Name}} permit {{.Seq}}
+{{with .Prefixes}} match {{$.Family}} address prefix-list {{.Name}}
+{{end -}}
+{{range .ASPaths}} match as-path {{.Filter.Name}}
+{{end -}}
+{{range .Communities}} match community {{.List.Name}}{{if .List.Exact}} exact-match{{end}}
+{{end -}}
+{{with .LocalPref}} set local-preference {{.}}
+{{end -}}
+{{with .MED}} set metric {{.}}
+{{end -}}
+{{with .SetCommunities}} set community {{join .Communities " "}}
+{{end -}}
+{{with .AddCommunities}} set community {{join .Communities " "}} additive
+{{end -}}
+{{with .DeleteCommunities}} set comm-list {{.Name}} delete
+{{end -}}
+{{with .Prepend}} set as-path prepend {{asns . " "}}
+{{end -}}
+{{with .NextHop}} set {{$.Family}} next-hop {{if eq $.Family "ipv6"}}global {{end}}{{.}}
+{{end -}}
+{{else -}}
+route-map {{.Name}} deny 10
+{{end -}}
+{{with .Neighbor.PeerAddress -}}
+router bgp {{$.Neighbor.LocalAS}}
+ neighbor {{.}} remote-as {{$.Neighbor.PeerAS}}
+ address-family {{$.AFI}} unicast
+  neighbor {{.}} activate
+  neighbor {{.}} route-map {{$.Name}} {{$.Way}}
+ exit-address-family
+{{end -}}
+`)),
+	generate.OpenBGPD: template.Must(template.New("openbgpd").Funcs(TemplateFuncs).Parse(
+		`{{.Definitions -}}
+neighbor {{.Neighbor.PeerAddress}} {
+	remote-as {{.Neighbor.PeerAS}}
+}
+{{$way := "from"}}{{if eq .Way "out"}}{{$way = "to"}}{{end -}}
+{{range .Entries -}}
+allow quick {{$way}} {{$.Neighbor.PeerAddress}}{{with openbgpdMatch .}} {{.}}{{end}}
+{{- if or .LocalPref .MED .SetCommunities .AddCommunities .DeleteCommunities .Prepend .NextHop}} set {
+{{- with .LocalPref}} localpref {{.}}{{end}}
+{{- with .MED}} med {{.}}{{end}}
+{{- with .SetCommunities}} community delete *:*{{range .Communities}} community {{.}}{{end}}{{end}}
+{{- with .AddCommunities}}{{range .Communities}} community {{.}}{{end}}{{end}}
+{{- with .DeleteCommunities}}{{range .Communities}} community delete {{.}}{{end}}{{end}}
+{{- with .Prepend}} prepend-{{if eq $way "to"}}self{{else}}neighbor{{end}} {{len .}}{{end}}
+{{- with .NextHop}} nexthop {{.}}{{end}} }
+{{- end}}
+{{end -}}
+deny quick {{$way}} {{.Neighbor.PeerAddress}}
+`)),
+}
+
+// capabilities describes which parts of a route map a dialect can express
+type capabilities struct {
+	negation         bool // negated AS path and community matches
+	multiple         bool // an entry matching several AS path filters or community lists
+	exactCommunities bool
+	igpMED           bool
+	nextHopSelf      bool
+	anyPrepend       bool // prepending AS numbers other than the local or peer AS
+}
+
+var dialectCapabilities = map[generate.Dialect]capabilities{
+	generate.CiscoIOS:   {exactCommunities: true, igpMED: true, anyPrepend: true},
+	generate.CiscoIOSXR: {negation: true, multiple: true, igpMED: true, nextHopSelf: true, anyPrepend: true},
+	generate.Juniper:    {igpMED: true, nextHopSelf: true, anyPrepend: true},
+	generate.Arista:     {exactCommunities: true, anyPrepend: true},
+	generate.BIRD:       {negation: true, multiple: true, anyPrepend: true},
+	generate.FRR:        {exactCommunities: true, anyPrepend: true},
+	generate.OpenBGPD:   {nextHopSelf: true},
+}
+
+// Write writes the route map, along with the prefix lists, AS path filters and
+// community lists it uses, in the configuration language of the dialect. When
+// the neighbor's address is known the route map is also applied to it. A
+// *generate.UnsupportedError is returned if the route map uses constructs which
+// can not be expressed in the dialect, in which case nothing is written.
+func (rm *RouteMap) Write(w io.Writer, dialect generate.Dialect) error {
+	t, ok := routeMapTemplates[dialect]
+	if !ok {
+		return fmt.Errorf("route maps are not supported for %s", dialect)
+	}
+	if dialect == generate.OpenBGPD && rm.Neighbor.PeerAddress == nil {
+		return fmt.Errorf("%s route maps require the peer's address", dialect)
+	}
+
+	if unsupported := rm.unsupported(dialect); len(unsupported) > 0 {
+		return &generate.UnsupportedError{Dialect: dialect, Constructs: unsupported}
+	}
+
+	var definitions bytes.Buffer
+	for _, l := range rm.PrefixLists {
+		if err := l.Write(&definitions, dialect); err != nil {
+			return err
+		}
+	}
+	for _, f := range rm.ASPathFilters {
+		if err := f.Write(&definitions, dialect); err != nil {
+			return err
+		}
+	}
+
+	data := routeMapData{RouteMap: rm, Definitions: definitions.String(), Family: "ip", AFI: "ipv4", Way: "in"}
+	if rm.IPv6 {
+		data.Family, data.AFI = "ipv6", "ipv6"
+	}
+	if rm.Direction == Export {
+		data.Way = "out"
+	}
+
+	return t.Execute(w, data)
+}
+
+// Execute writes the route map using a template, which allows route maps to
+// be written for dialects which are not built in. The template is executed
+// with the route map as it's data and may use the TemplateFuncs.
+func (rm *RouteMap) Execute(w io.Writer, t *template.Template) error {
+	return t.Execute(w, rm)
+}
+
+// unsupported returns the constructs used by the route map which the dialect
+// can not express
+func (rm *RouteMap) unsupported(dialect generate.Dialect) []string {
+	caps := dialectCapabilities[dialect]
+
+	var constructs []string
+	add := func(format string, args ...interface{}) {
+		construct := fmt.Sprintf(format, args...)
+		for _, existing := range constructs {
+			if existing == construct {
+				return
+			}
+		}
+		constructs = append(constructs, construct)
+	}
+
+	for _, e := range rm.Entries {
+		if !caps.multiple && (len(e.ASPaths) > 1 || len(e.Communities) > 1) {
+			add("matching several AS path filters or community lists together")
+		}
+		for _, m := range e.ASPaths {
+			if m.Negated && !caps.negation {
+				add("NOT %s", m.Filter.Regexp)
+			}
+		}
+		for _, m := range e.Communities {
+			if m.Negated && !caps.negation {
+				add("NOT community.contains(%s)", strings.Join(m.List.Communities, ", "))
+			}
+			if m.List.Exact && !caps.exactCommunities {
+				add("community == {%s}", strings.Join(m.List.Communities, ", "))
+			}
+		}
+		if e.MED == "igp" && !caps.igpMED {
+			add("med = igp_cost")
+		}
+		if e.NextHop == "self" && !caps.nextHopSelf {
+			add("next-hop = self")
+		}
+		if len(e.Prepend) > 0 && !caps.anyPrepend {
+			asn := rm.Neighbor.PeerAS
+			if rm.Direction == Export {
+				asn = rm.Neighbor.LocalAS
+			}
+			for _, prepend := range e.Prepend {
+				if prepend != asn {
+					add("aspath.prepend(%s)", joinASNs(e.Prepend, ", "))
+					break
+				}
+			}
+		}
+	}
+
+	return constructs
+}
+
+func negate(negated bool, not string) string {
+	if negated {
+		return not
+	}
+
+	return ""
+}
+
+func hasConditions(e *Entry) bool {
+	return e.Prefixes != nil || len(e.ASPaths) > 0 || len(e.Communities) > 0
+}
+
+func exactList(l *generate.PrefixList) bool {
+	for _, r := range l.Ranges {
+		if !r.Exact() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// birdCommunity formats a community as a BIRD pair, e.g. (65537, 1)
+func birdCommunity(community string) string {
+	return "(" + strings.Replace(community, ":", ", ", 1) + ")"
+}
+
+func joinASNs(asns []uint32, sep string) string {
+	values := make([]string, len(asns))
+	for i, asn := range asns {
+		values[i] = strconv.FormatUint(uint64(asn), 10)
+	}
+
+	return strings.Join(values, sep)
+}
+
+func reverseASNs(asns []uint32) []uint32 {
+	reversed := make([]uint32, len(asns))
+	for i, asn := range asns {
+		reversed[len(asns)-1-i] = asn
+	}
+
+	return reversed
+}
+
+// xrPrepend groups consecutive repetitions of an AS number, as IOS-XR prepends
+// an AS number a given number of times, e.g. prepend as-path 65537 2. The
+// groups are reversed, as each is prepended in turn.
+func xrPrepend(asns []uint32) []string {
+	asns = reverseASNs(asns)
+
+	var result []string
+	for i := 0; i < len(asns); {
+		j := i
+		for j < len(asns) && asns[j] == asns[i] {
+			j++
+		}
+		result = append(result, fmt.Sprintf("%d %d", asns[i], j-i))
+		i = j
+	}
+
+	return result
+}
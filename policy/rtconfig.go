@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/kkirsche/rpsl/prefix"
+)
+
+// RtConfig expands templates written for IRRToolSet's rtconfig, easing
+// migration from it. Lines beginning with @RtConfig are commands and every
+// other line is copied to the output unchanged. The supported commands are:
+//
+//	@RtConfig import <ASN-1> <router-1> <ASN-2> <router-2>
+//	@RtConfig export <ASN-1> <router-1> <ASN-2> <router-2>
+//	@RtConfig set <variable> = <value>
+//	@RtConfig printPrefixes "<format>" filter <filter>
+//	@RtConfig printPrefixRanges "<format>" filter <filter>
+//
+// import and export write the route map of ASN-1's policy for the session
+// between it's router-1 and router-2 of ASN-2, in the address family of the
+// routers. The variables which may be set are cisco_map_name (or map_name),
+// using the format of Options.MapName, and cisco_max_preference (or
+// max_preference), and aggregate, which may be true or false and sets
+// Options.Aggregate. The print commands write each prefix range matched by the
+// filter using the format, in which %p is replaced by the address, %l by the
+// prefix length, %n by the minimum and %m by the maximum matched length.
+type RtConfig struct {
+	Database *db.Database
+	Dialect  generate.Dialect
+	Options  Options
+	// Warn is called with each part of a policy which could not be compiled,
+	// it may be nil
+	Warn func(line int, msg string)
+}
+
+// Process expands the template read from r, writing the result to w
+func (rc *RtConfig) Process(r io.Reader, w io.Writer) error {
+	opts := rc.Options
+	compiler := NewCompiler(rc.Database, opts)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "@RtConfig") {
+			if _, err := fmt.Fprintln(w, text); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var err error
+		switch command := strings.TrimSpace(text[strings.Index(text, fields[0])+len(fields[0]):]); {
+		case len(fields) < 2:
+			err = fmt.Errorf("missing command")
+		case strings.EqualFold(fields[1], "import"), strings.EqualFold(fields[1], "export"):
+			err = rc.routeMap(w, compiler, line, fields[1:])
+		case strings.EqualFold(fields[1], "set"):
+			if err = rc.set(&opts, strings.TrimSpace(command[len(fields[1]):])); err == nil {
+				compiler = NewCompiler(rc.Database, opts)
+			}
+		case strings.EqualFold(fields[1], "printPrefixes"), strings.EqualFold(fields[1], "printPrefixRanges"):
+			err = rc.printPrefixes(w, opts, strings.TrimSpace(command[len(fields[1]):]))
+		default:
+			err = fmt.Errorf("unknown command %q", fields[1])
+		}
+
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// routeMap compiles and writes the route map of an import or export command
+func (rc *RtConfig) routeMap(w io.Writer, compiler *Compiler, line int, args []string) error {
+	if len(args) != 5 {
+		return fmt.Errorf("usage: %s <ASN-1> <router-1> <ASN-2> <router-2>", args[0])
+	}
+
+	var n Neighbor
+	var err error
+	if n.LocalAS, err = aspath.ParseASN(args[1]); err != nil {
+		return err
+	}
+	if n.PeerAS, err = aspath.ParseASN(args[3]); err != nil {
+		return err
+	}
+	if n.LocalAddress = net.ParseIP(args[2]); n.LocalAddress == nil {
+		return fmt.Errorf("invalid router address %q", args[2])
+	}
+	if n.PeerAddress = net.ParseIP(args[4]); n.PeerAddress == nil {
+		return fmt.Errorf("invalid router address %q", args[4])
+	}
+
+	dir := Import
+	if strings.EqualFold(args[0], "export") {
+		dir = Export
+	}
+
+	rm, err := compiler.Compile(dir, n, n.PeerAddress.To4() == nil)
+	if err != nil {
+		return err
+	}
+
+	if rc.Warn != nil {
+		for _, skipped := range rm.Skipped {
+			rc.Warn(line, skipped)
+		}
+	}
+
+	return rm.Write(w, rc.Dialect)
+}
+
+// set changes a variable, given as <variable> = <value>
+func (rc *RtConfig) set(opts *Options, assignment string) error {
+	parts := strings.SplitN(assignment, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: set <variable> = <value>")
+	}
+
+	variable, value := strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	switch variable {
+	case "cisco_map_name", "map_name":
+		opts.MapName = value
+	case "cisco_max_preference", "max_preference":
+		max, err := strconv.Atoi(value)
+		if err != nil || max <= 0 {
+			return fmt.Errorf("invalid %s %q", variable, value)
+		}
+		opts.MaxPreference = max
+	case "aggregate":
+		aggregate, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", variable, value)
+		}
+		opts.Aggregate = aggregate
+	default:
+		return fmt.Errorf("unknown variable %q", variable)
+	}
+
+	return nil
+}
+
+// printPrefixes writes the prefix ranges matched by a filter, given as
+// "<format>" filter <filter>
+func (rc *RtConfig) printPrefixes(w io.Writer, opts Options, args string) error {
+	usage := fmt.Errorf(`usage: printPrefixes "<format>" filter <filter>`)
+	if !strings.HasPrefix(args, `"`) {
+		return usage
+	}
+
+	end := strings.Index(args[1:], `"`)
+	if end < 0 {
+		return usage
+	}
+	format, rest := args[1:end+1], strings.Fields(args[end+2:])
+	if len(rest) < 2 || !strings.EqualFold(rest[0], "filter") {
+		return usage
+	}
+
+	f, err := ParseFilter(strings.Join(rest[1:], " "), true)
+	if err != nil {
+		return err
+	}
+
+	replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+	format = replacer.Replace(format)
+
+	for _, ipv6 := range []bool{false, true} {
+		comp := &compilation{Compiler: NewCompiler(rc.Database, opts), rm: &RouteMap{IPv6: ipv6}}
+
+		var ranges []prefix.Range
+		for _, conj := range comp.disjunction(f, false) {
+			if len(conj.asPaths) > 0 || len(conj.communities) > 0 {
+				return fmt.Errorf("filter %s does not only match prefixes", f)
+			}
+
+			if !conj.constrained {
+				conj.prefixes = []prefix.Range{comp.universe()}
+			}
+			ranges = append(ranges, conj.prefixes...)
+		}
+
+		if len(comp.rm.Skipped) > 0 {
+			return fmt.Errorf("%s", comp.rm.Skipped[0])
+		}
+
+		ranges = prefix.Compact(ranges)
+		if opts.Aggregate {
+			ranges = prefix.Aggregate(ranges)
+		}
+
+		for _, r := range ranges {
+			length, _ := r.Prefix.Mask.Size()
+			out := strings.NewReplacer(
+				"%p", r.Prefix.IP.String(),
+				"%l", strconv.Itoa(length),
+				"%n", strconv.Itoa(r.Min),
+				"%m", strconv.Itoa(r.Max),
+			).Replace(format)
+
+			if _, err := io.WriteString(w, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
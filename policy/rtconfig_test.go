@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRtConfig(t *testing.T) {
+	input := `! AS65536 peers
+@RtConfig set cisco_map_name = "%s-%d"
+@RtConfig set cisco_max_preference = 500
+@RtConfig import AS65536 192.0.2.2 AS65537 192.0.2.1
+@rtconfig export AS65536 2001:db8::2 AS65537 2001:db8::1
+@RtConfig printPrefixes "ip route %p/%l Null0\n" filter AS-TEST
+@RtConfig printPrefixRanges "%p/%l^%n-%m\n" filter RS-TEST OR {192.0.2.0/24^+}
+@RtConfig set aggregate = true
+@RtConfig printPrefixRanges "%p/%l^%n-%m\n" filter {192.0.2.0/25, 192.0.2.128/25, 198.51.100.0/24}
+end
+`
+
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	rc := &RtConfig{Database: d, Dialect: generate.CiscoIOS}
+
+	var out bytes.Buffer
+	if assert.NoError(t, rc.Process(strings.NewReader(input), &out)) {
+		golden(t, "rtconfig-ios", out.Bytes())
+	}
+}
+
+func TestRtConfigWarn(t *testing.T) {
+	var warnings []string
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	rc := &RtConfig{Database: d, Dialect: generate.BIRD, Warn: func(line int, msg string) {
+		warnings = append(warnings, fmt.Sprintf("%d: %s", line, msg))
+	}}
+
+	input := "@RtConfig set max_preference = 100\n@RtConfig import AS65539 192.0.2.2 AS65537 192.0.2.1\n"
+	err = rc.Process(strings.NewReader(input), ioutil.Discard)
+	assert.EqualError(t, err, "line 2: bird can not express community == {64500:2}, med = igp_cost, next-hop = self")
+	assert.Equal(t, []string{
+		"2: unsupported action dpa = 10",
+		"2: unsupported peering-set PRNG-TEST",
+		"2: unsupported filter FLTR-UNKNOWN",
+	}, warnings)
+}
+
+func TestRtConfigErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@RtConfig", "line 1: missing command"},
+		{"\n@RtConfig static", `line 2: unknown command "static"`},
+		{"@RtConfig set cisco_map_name", "line 1: usage: set <variable> = <value>"},
+		{"@RtConfig set cisco_max_preference = -1", `line 1: invalid cisco_max_preference "-1"`},
+		{"@RtConfig set aggregate = yes", `line 1: invalid aggregate "yes"`},
+		{"@RtConfig set cisco_prefix_acl_no = 100", `line 1: unknown variable "cisco_prefix_acl_no"`},
+		{"@RtConfig import AS65536 192.0.2.2 AS65537", "line 1: usage: import <ASN-1> <router-1> <ASN-2> <router-2>"},
+		{"@RtConfig export AS65536 192.0.2.2 AS65537 router1", `line 1: invalid router address "router1"`},
+		{"@RtConfig import AS65540 192.0.2.2 AS65537 192.0.2.1", "line 1: aut-num AS65540 not found"},
+		{"@RtConfig printPrefixes %p filter ANY", `line 1: usage: printPrefixes "<format>" filter <filter>`},
+		{`@RtConfig printPrefixes "%p" filter <AS65537>`, "line 1: filter <AS65537> does not only match prefixes"},
+		{`@RtConfig printPrefixes "%p" filter AS-UNKNOWN`, "line 1: as-set AS-UNKNOWN not found"},
+	}
+
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	rc := &RtConfig{Database: d, Dialect: generate.CiscoIOS}
+	for _, tt := range tests {
+		assert.EqualError(t, rc.Process(strings.NewReader(tt.input), ioutil.Discard), tt.expected, tt.input)
+	}
+}
@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kkirsche/rpsl/prefix"
+)
+
+// Simulation is the outcome of evaluating an aut-num's policy for a single
+// route exchanged with a neighbor
+type Simulation struct {
+	RouteMap string `json:"route_map"`
+	Accepted bool   `json:"accepted"`
+	// Seq, Policy and Clause identify the entry which accepted the route
+	Seq    int    `json:"seq,omitempty"`
+	Policy string `json:"policy,omitempty"`
+	Clause string `json:"clause,omitempty"`
+	// Result is the route after the entry's actions are applied
+	Result *Attributes `json:"result,omitempty"`
+	// Skipped describes the parts of the policy which could not be evaluated,
+	// which may explain why a route was rejected
+	Skipped []string `json:"skipped"`
+}
+
+// Attributes are the BGP attributes of a route after a policy's actions are
+// applied to it. Those not set by the actions are left empty.
+type Attributes struct {
+	Path        []uint32 `json:"path"`
+	Communities []string `json:"communities"`
+	LocalPref   string   `json:"local_pref,omitempty"`
+	MED         string   `json:"med,omitempty"`
+	NextHop     string   `json:"next_hop,omitempty"`
+}
+
+// Simulate compiles the import or export policy of the neighbor's local
+// aut-num for the route's address family and reports whether it accepts the
+// route, which entry accepted it, and the attributes the route has once the
+// entry's actions are applied
+func (c *Compiler) Simulate(dir Direction, n Neighbor, r Route) (*Simulation, error) {
+	rm, err := c.Compile(dir, n, !prefix.IsIPv4(r.Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{RouteMap: rm.Name, Skipped: append([]string{}, rm.Skipped...)}
+	if e := rm.Match(r); e != nil {
+		attrs := e.Apply(r)
+		sim.Accepted = true
+		sim.Seq, sim.Policy, sim.Clause = e.Seq, e.Policy, e.Clause
+		sim.Result = &attrs
+	}
+
+	return sim, nil
+}
+
+// Apply returns the attributes of the route once the entry's actions are
+// applied: communities are set, then added to and deleted from, and the AS
+// numbers of aspath.prepend are placed ahead of the route's path
+func (e *Entry) Apply(r Route) Attributes {
+	attrs := Attributes{
+		Path:      append(append([]uint32{}, e.Prepend...), r.Path...),
+		LocalPref: e.LocalPref,
+		MED:       e.MED,
+		NextHop:   e.NextHop,
+	}
+
+	communities := r.Communities
+	if e.SetCommunities != nil {
+		communities = e.SetCommunities.Communities
+	}
+	if e.AddCommunities != nil {
+		communities = append(append([]string{}, communities...), e.AddCommunities.Communities...)
+	}
+
+	deleted := make(map[string]bool)
+	if e.DeleteCommunities != nil {
+		for _, c := range e.DeleteCommunities.Communities {
+			deleted[c] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	attrs.Communities = []string{}
+	for _, c := range communities {
+		if !seen[c] && !deleted[c] {
+			seen[c] = true
+			attrs.Communities = append(attrs.Communities, c)
+		}
+	}
+
+	return attrs
+}
+
+// WriteText writes the simulation in a human readable form, e.g.
+//
+//	accepted by AS65537-IMPORT 10
+//	policy: import: from AS65537 action pref = 100; accept AS-TEST
+//	clause: from AS65537 action pref = 100; accept AS-TEST
+//	path: 65537
+//	communities:
+//	local-pref: 900
+func (s *Simulation) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if !s.Accepted {
+		fmt.Fprintf(&b, "rejected by %s: no entry accepts the route\n", s.RouteMap)
+	} else {
+		fmt.Fprintf(&b, "accepted by %s %d\n", s.RouteMap, s.Seq)
+		fmt.Fprintf(&b, "policy: %s\n", s.Policy)
+		fmt.Fprintf(&b, "clause: %s\n", s.Clause)
+		fmt.Fprintln(&b, strings.TrimSpace("path: "+joinASNs(s.Result.Path, " ")))
+		fmt.Fprintln(&b, strings.TrimSpace("communities: "+strings.Join(s.Result.Communities, " ")))
+		for _, attr := range []struct{ name, value string }{
+			{"local-pref", s.Result.LocalPref},
+			{"med", s.Result.MED},
+			{"next-hop", s.Result.NextHop},
+		} {
+			if attr.value != "" {
+				fmt.Fprintf(&b, "%s: %s\n", attr.name, attr.value)
+			}
+		}
+	}
+
+	for _, skipped := range s.Skipped {
+		fmt.Fprintf(&b, "skipped: %s\n", skipped)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the simulation as an indented JSON object
+func (s *Simulation) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	route := func(cidr string, path []uint32, communities ...string) Route {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		return Route{Prefix: ipnet, Path: path, Communities: communities}
+	}
+
+	tests := []struct {
+		name     string
+		dir      Direction
+		peerAS   uint32
+		route    Route
+		expected string
+	}{
+		{"pref and med", Import, 65537, route("10.0.0.0/8", []uint32{65537}), `accepted by AS65537-IMPORT 10
+policy: import: from AS65537 192.0.2.1 at 192.0.2.2 action pref = 100; med = 10; accept AS-TEST AND NOT {10.1.0.0/16^+}
+clause: from AS65537 192.0.2.1 at 192.0.2.2 action pref = 100; med = 10; accept AS-TEST AND NOT {10.1.0.0/16^+}
+path: 65537
+communities:
+local-pref: 900
+med: 10
+`},
+		{"except", Import, 65537, route("10.2.0.0/16", []uint32{65537}, "64500:10"), `accepted by AS65537-IMPORT 20
+policy: import: { from AS-PEERS action pref = 200; accept PeerAS; } except { from AS65537 action community.append(no_export); accept {10.0.0.0/8^+}; }
+clause: from AS65537 action community.append(no_export); accept {10.0.0.0/8^+}
+path: 65537
+communities: 64500:10 65535:65281
+`},
+		{"prepend and append", Import, 65538, route("10.1.0.0/16", []uint32{65538, 65537}, "64500:10", "64500:100"), `accepted by AS65538-IMPORT 10
+policy: import: from AS65538 action community .= { 64500:100 }; aspath.prepend(AS65538, AS65538); accept <AS-TEST$> AND community(64500:10)
+clause: from AS65538 action community .= 64500:100; aspath.prepend(AS65538, AS65538); accept <AS-TEST $> AND community.contains(64500:10)
+path: 65538 65538 65538 65537
+communities: 64500:10 64500:100
+`},
+		{"refine", Import, 65537, route("2001:db8:1::/48", []uint32{65537}), `accepted by AS65537-IMPORT-IPV6 10
+policy: mp-import: afi ipv6.unicast from AS65537 accept RS-TEST refine afi ipv6 from AS-ANY action pref = 50; accept ANY
+clause: from AS65537 accept RS-TEST REFINE from AS-ANY action pref = 50; accept ANY
+path: 65537
+communities:
+local-pref: 950
+`},
+		{"set communities", Export, 65537, route("198.51.100.0/24", nil, "64500:2"), `accepted by AS65537-EXPORT 10
+policy: export: to AS65537 action med = 0; community = { 64500:1 }; announce AS65536
+clause: to AS65537 action med = 0; community = 64500:1; announce AS65536
+path:
+communities: 64500:1
+med: 0
+`},
+		{"rejected", Import, 65537, route("192.0.2.0/25", []uint32{65537}), `rejected by AS65537-IMPORT: no entry accepts the route
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, err := c.Simulate(tt.dir, neighbor(65536, tt.peerAS), tt.route)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var out bytes.Buffer
+			if assert.NoError(t, sim.WriteText(&out)) {
+				assert.Equal(t, tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestSimulateSkipped(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	c := NewCompiler(d, Options{})
+
+	_, ipnet, _ := net.ParseCIDR("192.0.2.0/24")
+	sim, err := c.Simulate(Import, neighbor(65539, 65537), Route{Prefix: ipnet, Path: []uint32{65537}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.False(t, sim.Accepted)
+	assert.Contains(t, sim.Skipped, "unsupported action dpa = 10")
+
+	var out bytes.Buffer
+	if assert.NoError(t, sim.WriteJSON(&out)) {
+		assert.True(t, strings.HasPrefix(out.String(), "{\n  \"route_map\": \"AS65537-IMPORT\",\n  \"accepted\": false,\n"))
+	}
+
+	_, err = c.Simulate(Import, neighbor(65540, 65537), Route{Prefix: ipnet})
+	assert.EqualError(t, err, "aut-num AS65540 not found")
+}
+
+func TestEntryApply(t *testing.T) {
+	e := &Entry{
+		Prepend:           []uint32{65536},
+		SetCommunities:    &CommunityList{Communities: []string{"64500:1", "64500:2"}},
+		AddCommunities:    &CommunityList{Communities: []string{"64500:2", "64500:3"}},
+		DeleteCommunities: &CommunityList{Communities: []string{"64500:1"}},
+		NextHop:           "self",
+	}
+
+	attrs := e.Apply(Route{Path: []uint32{65537}, Communities: []string{"64500:9"}})
+	assert.Equal(t, []uint32{65536, 65537}, attrs.Path)
+	assert.Equal(t, []string{"64500:2", "64500:3"}, attrs.Communities)
+	assert.Equal(t, "self", attrs.NextHop)
+}
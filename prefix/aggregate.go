@@ -0,0 +1,177 @@
+package prefix
+
+import (
+	"net"
+)
+
+// Aggregate returns ranges which match exactly the same prefixes as the given
+// ranges, merging them into as few ranges as it can. Ranges covered by another
+// range are removed, the prefix lengths matched by both halves of a prefix are
+// moved to the prefix itself, and overlapping or adjacent prefix lengths of
+// the same prefix are joined, so that e.g. 192.0.2.0/25 and 192.0.2.128/25
+// become 192.0.2.0/24^25. IPv4 and IPv6 ranges are aggregated separately and
+// the result is sorted.
+func Aggregate(ranges []Range) []Range {
+	var ipv4, ipv6 []Range
+	for _, r := range ranges {
+		if IsIPv4(r.Prefix) {
+			ipv4 = append(ipv4, r)
+		} else {
+			ipv6 = append(ipv6, r)
+		}
+	}
+
+	return Compact(append(aggregate(Compact(ipv4), 32), aggregate(Compact(ipv6), 128)...))
+}
+
+// lengths is an inclusive range of prefix lengths
+type lengths struct {
+	min, max int
+}
+
+// aggregate merges ranges of a single address family with the given number of
+// bits
+func aggregate(ranges []Range, bits int) []Range {
+	// the sorted, disjoint prefix lengths matched beneath each prefix, keyed by
+	// the prefix's address and indexed by it's length
+	byLength := make([]map[string][]lengths, bits+1)
+	for i := range byLength {
+		byLength[i] = make(map[string][]lengths)
+	}
+
+	size := bits / 8
+	for _, r := range ranges {
+		ones, _ := r.Prefix.Mask.Size()
+		key := string(address(r.Prefix.IP, size))
+		byLength[ones][key] = union(byLength[ones][key], lengths{r.Min, r.Max})
+	}
+
+	// working from the most specific prefixes, move the lengths matched under
+	// both halves of a prefix up to the prefix, which may then be merged with
+	// it's own sibling
+	for ones := bits; ones > 0; ones-- {
+		i, bit := (ones-1)/8, byte(0x80>>uint((ones-1)%8))
+		for key, low := range byLength[ones] {
+			if key[i]&bit != 0 {
+				continue
+			}
+
+			high := []byte(key)
+			high[i] |= bit
+			highKey := string(high)
+			common := intersection(low, byLength[ones][highKey])
+			if len(common) == 0 {
+				continue
+			}
+
+			// lengths are left in a half if removing them would split it's
+			// lengths, as matching them twice is harmless, and they are only
+			// moved when that does not add ranges
+			highLengths := byLength[ones][highKey]
+			newLow, newHigh := remove(low, common), remove(highLengths, common)
+			parent := byLength[ones-1][key]
+			newParent := parent
+			for _, l := range common {
+				newParent = union(newParent, l)
+			}
+			if len(newLow)+len(newHigh)+len(newParent) > len(low)+len(highLengths)+len(parent) {
+				continue
+			}
+
+			byLength[ones][key], byLength[ones][highKey] = newLow, newHigh
+			byLength[ones-1][key] = newParent
+		}
+	}
+
+	var result []Range
+	for ones, prefixes := range byLength {
+		for key, ls := range prefixes {
+			ipnet := &net.IPNet{IP: net.IP(key), Mask: net.CIDRMask(ones, bits)}
+			for _, l := range ls {
+				result = append(result, Range{Prefix: ipnet, Min: l.min, Max: l.max})
+			}
+		}
+	}
+
+	return result
+}
+
+// address returns a copy of the address with the given length in bytes
+func address(ip net.IP, size int) net.IP {
+	if size == net.IPv4len {
+		return append(net.IP{}, ip.To4()...)
+	}
+
+	return append(net.IP{}, ip.To16()...)
+}
+
+// union adds the lengths to a sorted, disjoint list, joining any it overlaps
+// or is adjacent to
+func union(ls []lengths, l lengths) []lengths {
+	var result []lengths
+	for i, existing := range ls {
+		switch {
+		case existing.max+1 < l.min:
+			result = append(result, existing)
+		case l.max+1 < existing.min:
+			result = append(result, l)
+			return append(result, ls[i:]...)
+		default:
+			l = lengths{minInt(l.min, existing.min), maxInt(l.max, existing.max)}
+		}
+	}
+
+	return append(result, l)
+}
+
+// intersection returns the lengths in both sorted, disjoint lists
+func intersection(a, b []lengths) []lengths {
+	var result []lengths
+	for _, x := range a {
+		for _, y := range b {
+			if l := (lengths{maxInt(x.min, y.min), minInt(x.max, y.max)}); l.min <= l.max {
+				result = append(result, l)
+			}
+		}
+	}
+
+	return result
+}
+
+// difference returns the lengths in the sorted, disjoint list a which are not
+// in b
+func difference(a, b []lengths) []lengths {
+	var result []lengths
+	for _, x := range a {
+		remaining := []lengths{x}
+		for _, y := range b {
+			var next []lengths
+			for _, r := range remaining {
+				if y.max < r.min || r.max < y.min {
+					next = append(next, r)
+					continue
+				}
+				if r.min < y.min {
+					next = append(next, lengths{r.min, y.min - 1})
+				}
+				if y.max < r.max {
+					next = append(next, lengths{y.max + 1, r.max})
+				}
+			}
+			remaining = next
+		}
+		result = append(result, remaining...)
+	}
+
+	return result
+}
+
+// remove removes the lengths in b from a, unless that would split any of the
+// lengths in a
+func remove(a, b []lengths) []lengths {
+	if result := difference(a, b); len(result) <= len(a) {
+		return result
+	}
+
+	return a
+}
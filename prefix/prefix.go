@@ -0,0 +1,54 @@
+package prefix
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Parse parses a prefix in CIDR notation. Unlike net.ParseCIDR, leading zeros
+// in IPv4 octets such as 192.0.02.0/24, which are still found in older IRR
+// objects, are accepted. Any host bits are cleared.
+func Parse(s string) (*net.IPNet, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid prefix %q", s)
+	}
+
+	address := parts[0]
+	if strings.Contains(address, ".") && !strings.Contains(address, ":") {
+		octets := strings.Split(address, ".")
+		for i, octet := range octets {
+			octet = strings.TrimLeft(octet, "0")
+			if octet == "" {
+				octet = "0"
+			}
+			octets[i] = octet
+		}
+		address = strings.Join(octets, ".")
+	}
+
+	_, ipnet, err := net.ParseCIDR(address + "/" + parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix %q", s)
+	}
+
+	return ipnet, nil
+}
+
+// Canonical returns the prefix written in it's canonical form, or the input
+// unchanged if it is not a valid prefix
+func Canonical(s string) string {
+	ipnet, err := Parse(s)
+	if err != nil {
+		return s
+	}
+
+	return ipnet.String()
+}
+
+// IsIPv4 reports whether the prefix is an IPv4 prefix
+func IsIPv4(ipnet *net.IPNet) bool {
+	_, bits := ipnet.Mask.Size()
+	return bits == net.IPv4len*8
+}
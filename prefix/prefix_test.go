@@ -0,0 +1,316 @@
+package prefix
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"192.0.2.0/24", "192.0.2.0/24"},
+		{"192.0.02.0/24", "192.0.2.0/24"},
+		{"192.0.2.1/24", "192.0.2.0/24"},
+		{"2001:0dB8::/48", "2001:db8::/48"},
+		{"192.0.2.0", ""},
+		{"192.0.2.0/33", ""},
+	}
+
+	for _, tt := range tests {
+		ipnet, err := Parse(tt.input)
+		if tt.expected == "" {
+			assert.Error(t, err, tt.input)
+			continue
+		}
+
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.expected, ipnet.String())
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		min, max int
+		str      string
+	}{
+		{"192.0.2.0/24", 24, 24, "192.0.2.0/24"},
+		{"192.0.2.0/24^+", 24, 32, "192.0.2.0/24^+"},
+		{"192.0.2.0/24^-", 25, 32, "192.0.2.0/24^-"},
+		{"192.0.2.0/24^26", 26, 26, "192.0.2.0/24^26"},
+		{"192.0.2.0/24^25-26", 25, 26, "192.0.2.0/24^25-26"},
+		{"2001:db8::/32^48", 48, 48, "2001:db8::/32^48"},
+		{"192.0.2.0/24^23", 0, 0, ""},
+		{"192.0.2.0/24^26-25", 0, 0, ""},
+		{"192.0.2.0/24^x", 0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.input)
+		if tt.str == "" {
+			assert.Error(t, err, tt.input)
+			continue
+		}
+
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.min, r.Min, tt.input)
+			assert.Equal(t, tt.max, r.Max, tt.input)
+			assert.Equal(t, tt.str, r.String())
+		}
+	}
+}
+
+func TestRangeApply(t *testing.T) {
+	// an operator replaces the lengths of an exact range
+	r, err := ParseRange("192.0.2.0/24")
+	if assert.NoError(t, err) {
+		r, err = r.Apply("^+")
+		assert.NoError(t, err)
+		assert.Equal(t, "192.0.2.0/24^+", r.String())
+	}
+
+	// and is intersected with the lengths of any other range
+	r, err = ParseRange("192.0.2.0/24^-")
+	if assert.NoError(t, err) {
+		r, err = r.Apply("^24-26")
+		assert.NoError(t, err)
+		assert.Equal(t, "192.0.2.0/24^25-26", r.String())
+	}
+
+	r, err = ParseRange("192.0.2.0/24^28")
+	if assert.NoError(t, err) {
+		_, err = r.Apply("^24-26")
+		assert.Equal(t, ErrEmptyRange, err)
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	r, err := ParseRange("192.0.2.0/24^25-26")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for input, expected := range map[string]bool{
+		"192.0.2.0/24":    false,
+		"192.0.2.128/25":  true,
+		"192.0.2.64/26":   true,
+		"192.0.2.64/27":   false,
+		"198.51.100.0/25": false,
+		"2001:db8::/25":   false,
+	} {
+		_, ipnet, _ := net.ParseCIDR(input)
+		assert.Equal(t, expected, r.Contains(ipnet), input)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	result := Compact(mustRanges(
+		"192.0.2.0/25",
+		"10.0.0.0/8^16-24",
+		"192.0.2.0/24^+",
+		"10.1.0.0/16^24",
+		"10.1.0.0/16^25",
+		"10.0.0.0/8^16-24",
+		"2001:db8::/32",
+		"192.0.2.0/24",
+	))
+
+	assert.Equal(t, []string{"10.0.0.0/8^16-24", "10.1.0.0/16^25", "192.0.2.0/24^+", "2001:db8::/32"}, rangeStrings(result))
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected []string
+	}{
+		{[]string{"0.0.0.0/0^0-32"}, []string{"192.0.2.0/24", "2001:db8::/32"}, []string{"192.0.2.0/24"}},
+		{[]string{"10.0.0.0/8^12-20"}, []string{"10.1.0.0/16^+"}, []string{"10.1.0.0/16^16-20"}},
+		{[]string{"10.0.0.0/8^8-16"}, []string{"10.1.0.0/16^17-24"}, nil},
+		{[]string{"10.0.0.0/8^+"}, []string{"192.0.2.0/24"}, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rangeStrings(Intersect(mustRanges(tt.a...), mustRanges(tt.b...))), "%v %v", tt.a, tt.b)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected []string
+	}{
+		{[]string{"192.0.2.0/24^+"}, []string{"198.51.100.0/24"}, []string{"192.0.2.0/24^+"}},
+		{[]string{"192.0.2.0/24^+"}, []string{"192.0.0.0/16^25-30"}, []string{"192.0.2.0/24", "192.0.2.0/24^31-32"}},
+		{[]string{"192.0.2.0/24^24-25"}, []string{"192.0.2.0/24"}, []string{"192.0.2.0/24^25"}},
+		{[]string{"192.0.2.0/24^+"}, []string{"192.0.2.0/25^+"}, []string{"192.0.2.0/24", "192.0.2.128/25^+"}},
+		{[]string{"192.0.2.0/24^24-26"}, []string{"192.0.2.64/26"}, []string{"192.0.2.0/24", "192.0.2.0/25", "192.0.2.0/26", "192.0.2.128/25^25-26"}},
+		{[]string{"192.0.2.0/24"}, []string{"192.0.2.0/24^+"}, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rangeStrings(Subtract(mustRanges(tt.a...), mustRanges(tt.b...))), "%v - %v", tt.a, tt.b)
+	}
+}
+
+// TestSetOperations checks Intersect and Subtract against every prefix of
+// 10.0.0.0/8 up to /14 for randomly generated ranges
+func TestSetOperations(t *testing.T) {
+	universe := subnets("10.0.0.0/8", 14)
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		a, b := randomRanges(random, universe, 4, 14), randomRanges(random, universe, 4, 14)
+		intersection, difference := Intersect(a, b), Subtract(a, b)
+
+		for _, p := range universe {
+			inA, inB := matches(a, p), matches(b, p)
+			if !assert.Equal(t, inA && inB, matches(intersection, p), "%s in %v and %v", p, a, b) {
+				return
+			}
+			if !assert.Equal(t, inA && !inB, matches(difference, p), "%s in %v - %v", p, a, b) {
+				return
+			}
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		ranges   []string
+		expected []string
+	}{
+		{
+			[]string{"192.0.2.0/25", "192.0.2.128/25"},
+			[]string{"192.0.2.0/24^25"},
+		},
+		{
+			[]string{"192.0.2.0/24", "192.0.2.0/25", "192.0.2.128/25"},
+			[]string{"192.0.2.0/24^24-25"},
+		},
+		{
+			[]string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24", "10.0.4.0/24"},
+			[]string{"10.0.0.0/22^24", "10.0.4.0/24"},
+		},
+		{
+			[]string{"10.0.0.0/9^+", "10.128.0.0/9^+", "10.0.0.0/8"},
+			[]string{"10.0.0.0/8^+"},
+		},
+		{
+			[]string{"10.0.0.0/9^+", "10.128.0.0/9^9-24"},
+			[]string{"10.0.0.0/8^9-24", "10.0.0.0/9^25-32"},
+		},
+		{
+			[]string{"192.0.2.0/24^25", "192.0.2.0/24^26-27", "192.0.2.0/24^+"},
+			[]string{"192.0.2.0/24^+"},
+		},
+		{
+			[]string{"192.0.2.0/25^26-28", "192.0.2.128/25^27"},
+			[]string{"192.0.2.0/24^27", "192.0.2.0/25^26-28"},
+		},
+		{
+			[]string{"2001:db8::/33", "192.0.2.0/25", "2001:db8:8000::/33", "192.0.2.128/25^26"},
+			[]string{"192.0.2.0/25", "192.0.2.128/25^26", "2001:db8::/32^33"},
+		},
+		{
+			nil,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rangeStrings(Aggregate(mustRanges(tt.ranges...))), "%v", tt.ranges)
+	}
+}
+
+// TestAggregateMatches checks that aggregated ranges match exactly the same
+// prefixes as the original ranges, for every prefix of 10.0.0.0/8 up to /14 and
+// 2001:db8::/32 up to /38
+func TestAggregateMatches(t *testing.T) {
+	ipv4, ipv6 := subnets("10.0.0.0/8", 14), subnets("2001:db8::/32", 38)
+	universe := append(append([]*net.IPNet{}, ipv4...), ipv6...)
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		ranges := append(randomRanges(random, ipv4, 40, 14), randomRanges(random, ipv6, 40, 38)...)
+		aggregated := Aggregate(ranges)
+
+		if !assert.True(t, len(aggregated) <= len(ranges), "%v aggregated to %v", ranges, aggregated) {
+			return
+		}
+		for _, p := range universe {
+			if !assert.Equal(t, matches(ranges, p), matches(aggregated, p), "%s in %v aggregated to %v", p, ranges, aggregated) {
+				return
+			}
+		}
+	}
+}
+
+// subnets returns the prefix and each of it's more specifics up to the maximum
+// length
+func subnets(s string, max int) []*net.IPNet {
+	ipnet, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	result := []*net.IPNet{ipnet}
+	if ones, _ := ipnet.Mask.Size(); ones < max {
+		low, high := children(ipnet, ipnet.IP)
+		result = append(result, subnets(low.String(), max)...)
+		result = append(result, subnets(high.String(), max)...)
+	}
+
+	return result
+}
+
+// randomRanges returns up to n random ranges of prefixes from the universe,
+// matching lengths up to max
+func randomRanges(random *rand.Rand, universe []*net.IPNet, n, max int) []Range {
+	var ranges []Range
+	for n = random.Intn(n); n >= 0; n-- {
+		p := universe[random.Intn(len(universe))]
+		ones, _ := p.Mask.Size()
+		min := ones + random.Intn(max+1-ones)
+		ranges = append(ranges, Range{Prefix: p, Min: min, Max: min + random.Intn(max+1-min)})
+	}
+
+	return ranges
+}
+
+func matches(ranges []Range, ipnet *net.IPNet) bool {
+	for _, r := range ranges {
+		if r.Contains(ipnet) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustRanges(values ...string) []Range {
+	ranges := make([]Range, len(values))
+	for i, v := range values {
+		r, err := ParseRange(v)
+		if err != nil {
+			panic(err)
+		}
+		ranges[i] = r
+	}
+
+	return ranges
+}
+
+func rangeStrings(ranges []Range) []string {
+	var result []string
+	for _, r := range ranges {
+		result = append(result, r.String())
+	}
+
+	return result
+}
@@ -0,0 +1,146 @@
+package prefix
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptyRange is returned when applying a range operator to a range leaves
+// no prefix lengths which match both
+var ErrEmptyRange = errors.New("prefix range is empty")
+
+// Range is an address prefix along with the inclusive range of prefix lengths
+// it matches, as described by the RPSL address prefix range operators:
+//
+//	192.0.2.0/24         matches only 192.0.2.0/24
+//	192.0.2.0/24^-       matches the more specifics of 192.0.2.0/24, but not itself
+//	192.0.2.0/24^+       matches 192.0.2.0/24 and it's more specifics
+//	192.0.2.0/24^26      matches the /26 more specifics of 192.0.2.0/24
+//	192.0.2.0/24^25-26   matches the /25 and /26 more specifics of 192.0.2.0/24
+type Range struct {
+	Prefix *net.IPNet
+	Min    int
+	Max    int
+}
+
+// NewRange returns the range which matches exactly the given prefix
+func NewRange(ipnet *net.IPNet) Range {
+	ones, _ := ipnet.Mask.Size()
+	return Range{Prefix: ipnet, Min: ones, Max: ones}
+}
+
+// ParseRange parses an address prefix with an optional range operator, such
+// as 192.0.2.0/24^+
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	op := ""
+	if i := strings.Index(s, "^"); i >= 0 {
+		s, op = s[:i], s[i:]
+	}
+
+	ipnet, err := Parse(s)
+	if err != nil {
+		return Range{}, err
+	}
+
+	return NewRange(ipnet).Apply(op)
+}
+
+// Exact reports whether the range only matches it's own prefix
+func (r Range) Exact() bool {
+	ones, _ := r.Prefix.Mask.Size()
+	return r.Min == ones && r.Max == ones
+}
+
+// Apply applies a range operator, such as ^+ or ^24-32, to the range. An empty
+// operator leaves the range unchanged. Applying an operator to an exact range
+// replaces it's prefix lengths, otherwise the result only includes the prefix
+// lengths matched by both the range and the operator, following RFC 2622.
+func (r Range) Apply(op string) (Range, error) {
+	if op == "" {
+		return r, nil
+	}
+
+	min, max, err := parseOperator(op, r.Prefix)
+	if err != nil {
+		return Range{}, err
+	}
+
+	if r.Exact() {
+		return Range{Prefix: r.Prefix, Min: min, Max: max}, nil
+	}
+
+	if r.Min > min {
+		min = r.Min
+	}
+	if r.Max < max {
+		max = r.Max
+	}
+	if min > max {
+		return Range{}, ErrEmptyRange
+	}
+
+	return Range{Prefix: r.Prefix, Min: min, Max: max}, nil
+}
+
+// Contains reports whether the prefix is matched by the range
+func (r Range) Contains(ipnet *net.IPNet) bool {
+	ones, bits := ipnet.Mask.Size()
+	if _, rangeBits := r.Prefix.Mask.Size(); bits != rangeBits {
+		return false
+	}
+
+	return ones >= r.Min && ones <= r.Max && r.Prefix.Contains(ipnet.IP)
+}
+
+// String returns the range in RPSL notation, e.g. 192.0.2.0/24^+
+func (r Range) String() string {
+	ones, bits := r.Prefix.Mask.Size()
+	p := r.Prefix.String()
+
+	switch {
+	case r.Min == ones && r.Max == ones:
+		return p
+	case r.Min == ones && r.Max == bits:
+		return p + "^+"
+	case r.Min == ones+1 && r.Max == bits:
+		return p + "^-"
+	case r.Min == r.Max:
+		return fmt.Sprintf("%s^%d", p, r.Min)
+	default:
+		return fmt.Sprintf("%s^%d-%d", p, r.Min, r.Max)
+	}
+}
+
+// parseOperator returns the prefix lengths matched by the operator when
+// applied to the prefix
+func parseOperator(op string, ipnet *net.IPNet) (min, max int, err error) {
+	ones, bits := ipnet.Mask.Size()
+	if !strings.HasPrefix(op, "^") {
+		return 0, 0, fmt.Errorf("invalid range operator %q", op)
+	}
+
+	switch spec := op[1:]; {
+	case spec == "+":
+		min, max = ones, bits
+	case spec == "-":
+		min, max = ones+1, bits
+	case strings.Contains(spec, "-"):
+		parts := strings.SplitN(spec, "-", 2)
+		if min, err = strconv.Atoi(parts[0]); err == nil {
+			max, err = strconv.Atoi(parts[1])
+		}
+	default:
+		min, err = strconv.Atoi(spec)
+		max = min
+	}
+
+	if err != nil || min < ones || max < min || max > bits {
+		return 0, 0, fmt.Errorf("invalid range operator %q for %s", op, ipnet)
+	}
+
+	return min, max, nil
+}
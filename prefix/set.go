@@ -0,0 +1,204 @@
+package prefix
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// Compact sorts the ranges and removes those which are matched entirely by
+// another range
+func Compact(ranges []Range) []Range {
+	Sort(ranges)
+
+	var result []Range
+	// the kept ranges whose prefix covers the current range's prefix, from the
+	// least to the most specific
+	var covering []Range
+	for _, r := range ranges {
+		for len(covering) > 0 && !covers(covering[len(covering)-1].Prefix, r.Prefix) {
+			covering = covering[:len(covering)-1]
+		}
+
+		covered := false
+		for _, c := range covering {
+			if c.Min <= r.Min && r.Max <= c.Max {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			result = append(result, r)
+			covering = append(covering, r)
+		}
+	}
+
+	return result
+}
+
+// Sort orders ranges by address, then prefix length, then with the widest
+// range of prefix lengths first
+func Sort(ranges []Range) {
+	sort.Slice(ranges, func(i, j int) bool {
+		a, b := ranges[i], ranges[j]
+		if c := bytes.Compare(a.Prefix.IP.To16(), b.Prefix.IP.To16()); c != 0 {
+			return c < 0
+		}
+
+		aLen, _ := a.Prefix.Mask.Size()
+		bLen, _ := b.Prefix.Mask.Size()
+		switch {
+		case aLen != bLen:
+			return aLen < bLen
+		case a.Min != b.Min:
+			return a.Min < b.Min
+		default:
+			return a.Max > b.Max
+		}
+	})
+}
+
+// Intersect returns the ranges matching the prefixes which are matched by both
+// a and b
+func Intersect(a, b []Range) []Range {
+	var result []Range
+	for _, r := range a {
+		for _, s := range b {
+			if i, ok := intersect(r, s); ok {
+				result = append(result, i)
+			}
+		}
+	}
+
+	return Compact(result)
+}
+
+// Subtract returns the ranges matching the prefixes which are matched by a but
+// not by b. The result matches exactly the same prefixes, although it may need
+// several ranges to describe what remains of a single range in a.
+func Subtract(a, b []Range) []Range {
+	var result []Range
+	for _, r := range a {
+		remaining := []Range{r}
+		for _, s := range b {
+			var next []Range
+			for _, rem := range remaining {
+				next = append(next, subtract(rem, s)...)
+			}
+			remaining = next
+		}
+		result = append(result, remaining...)
+	}
+
+	return Compact(result)
+}
+
+// intersect returns the range matching the prefixes matched by both r and s
+func intersect(r, s Range) (Range, bool) {
+	if !covers(r.Prefix, s.Prefix) {
+		if !covers(s.Prefix, r.Prefix) {
+			return Range{}, false
+		}
+		r, s = s, r
+	}
+
+	// every prefix matched by s is covered by r's prefix, so only the lengths
+	// need to be intersected
+	i := Range{Prefix: s.Prefix, Min: maxInt(r.Min, s.Min), Max: minInt(r.Max, s.Max)}
+	return i, i.Min <= i.Max
+}
+
+// subtract returns the ranges matching the prefixes matched by r but not by s
+func subtract(r, s Range) []Range {
+	if _, ok := intersect(r, s); !ok {
+		return []Range{r}
+	}
+
+	sLen, _ := s.Prefix.Mask.Size()
+	if covers(s.Prefix, r.Prefix) {
+		// s matches every prefix of r within it's lengths, leaving the lengths
+		// of r either side of them
+		return withLengths(r.Prefix, []int{r.Min, s.Min - 1, s.Max + 1, r.Max})
+	}
+
+	// s is more specific than r. Walk down from r's prefix towards s's,
+	// keeping each prefix on the way and the half of the address space which
+	// does not lead to s.
+	var result []Range
+	p := r.Prefix
+	for pLen, _ := p.Mask.Size(); pLen < sLen; pLen++ {
+		if pLen >= r.Min && pLen <= r.Max {
+			result = append(result, NewRange(p))
+		}
+
+		toward, away := children(p, s.Prefix.IP)
+		if pLen+1 <= r.Max {
+			result = append(result, Range{Prefix: away, Min: maxInt(r.Min, pLen+1), Max: r.Max})
+		}
+		p = toward
+	}
+
+	// then the lengths of r which s does not match beneath s's prefix
+	return append(result, withLengths(s.Prefix, []int{maxInt(r.Min, sLen), s.Min - 1, s.Max + 1, r.Max})...)
+}
+
+// withLengths returns the ranges of the prefix for each non-empty pair of
+// minimum and maximum lengths
+func withLengths(ipnet *net.IPNet, bounds []int) []Range {
+	var result []Range
+	for i := 0; i+1 < len(bounds); i += 2 {
+		if bounds[i] <= bounds[i+1] {
+			result = append(result, Range{Prefix: ipnet, Min: bounds[i], Max: bounds[i+1]})
+		}
+	}
+
+	return result
+}
+
+// children splits the prefix into it's two halves, returning the half which
+// contains the address and the half which does not
+func children(ipnet *net.IPNet, ip net.IP) (toward, away *net.IPNet) {
+	ones, bits := ipnet.Mask.Size()
+	if len(ip) != len(ipnet.IP) {
+		ip = ip.To16()
+		if len(ipnet.IP) == net.IPv4len {
+			ip = ip.To4()
+		}
+	}
+
+	mask := net.CIDRMask(ones+1, bits)
+	low := &net.IPNet{IP: ipnet.IP.Mask(mask), Mask: mask}
+	high := &net.IPNet{IP: append(net.IP{}, low.IP...), Mask: mask}
+	high.IP[ones/8] |= 0x80 >> uint(ones%8)
+
+	if high.Contains(ip) {
+		return high, low
+	}
+
+	return low, high
+}
+
+// covers reports whether the prefix outer covers the prefix inner
+func covers(outer, inner *net.IPNet) bool {
+	outerLen, outerBits := outer.Mask.Size()
+	innerLen, innerBits := inner.Mask.Size()
+
+	return outerBits == innerBits && outerLen <= innerLen && outer.Contains(inner.IP)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,481 @@
+package resolve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// DefaultMaxDepth is the maximum depth of nested sets which are expanded when
+// Options.MaxDepth is not set
+const DefaultMaxDepth = 32
+
+// Options control how sets are expanded
+type Options struct {
+	// MaxDepth limits how deeply nested sets are expanded, sets beyond this
+	// depth are reported in Result.DepthExceeded rather than expanded
+	MaxDepth int
+	// Filter, if set, is called with each route and route6 object found when
+	// expanding AS numbers to the routes they originate, or as members of a
+	// route-set by reference. Routes are left out of the result when it
+	// returns false, e.g. rpki.Validator.Accept drops RPKI invalid routes.
+	Filter func(route *ast.Object) bool
+}
+
+// Member is a single member of an expanded set, along with the sets which
+// directly contained it
+type Member struct {
+	Value string   `json:"value"` // an AS number, e.g. AS65537, or a prefix range, e.g. 192.0.2.0/24^+
+	Sets  []string `json:"sets"`
+}
+
+// Result is the result of expanding a set
+type Result struct {
+	Members       []Member   `json:"members"`
+	Cycles        [][]string `json:"cycles,omitempty"`         // each cycle, starting and ending with the same set
+	Missing       []string   `json:"missing,omitempty"`        // sets which are referenced but do not exist
+	DepthExceeded []string   `json:"depth_exceeded,omitempty"` // sets which were not expanded as they were too deeply nested
+}
+
+// Values returns the value of each member
+func (r *Result) Values() []string {
+	values := make([]string, len(r.Members))
+	for i, m := range r.Members {
+		values[i] = m.Value
+	}
+
+	return values
+}
+
+// Ranges returns the prefix range of each member of an expanded route-set
+func (r *Result) Ranges() []prefix.Range {
+	var ranges []prefix.Range
+	for _, m := range r.Members {
+		if rng, err := prefix.ParseRange(m.Value); err == nil {
+			ranges = append(ranges, rng)
+		}
+	}
+
+	return ranges
+}
+
+type resolver struct {
+	d        *db.Database
+	maxDepth int
+	filter   func(route *ast.Object) bool
+	result   *Result
+	members  map[string]int  // member value to index in result.Members
+	sets     map[string]bool // member value and set pairs recorded in result.Members
+	missing  uniqueValues
+	exceeded uniqueValues
+	stack    []string
+	expanded map[string][]string // set name and operators to the values it expanded to
+	reported map[string]bool
+}
+
+func newResolver(d *db.Database, opts Options) *resolver {
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	return &resolver{
+		d:        d,
+		maxDepth: maxDepth,
+		filter:   opts.Filter,
+		result:   &Result{Members: []Member{}},
+		members:  make(map[string]int),
+		sets:     make(map[string]bool),
+		expanded: make(map[string][]string),
+		reported: make(map[string]bool),
+	}
+}
+
+// ASSet recursively expands the as-set to the AS numbers it contains,
+// including the aut-num objects which are members by reference. If name is an
+// AS number, the result contains only that AS number.
+func ASSet(d *db.Database, name string, opts Options) (*Result, error) {
+	name = strings.ToUpper(name)
+	r := newResolver(d, opts)
+
+	if lexer.IsASN(name) {
+		r.add(name, "")
+		return r.result, nil
+	}
+
+	if _, ok := d.Get(token.CLASS_AS_SET, name); !ok {
+		return nil, fmt.Errorf("as-set %s not found", name)
+	}
+
+	r.expandASSet(name)
+	return r.result, nil
+}
+
+// RouteSet recursively expands the route-set to the prefix ranges it contains.
+// Members which are AS numbers or as-sets are expanded to the routes they
+// originate. As specified by RFC 4012, only IPv4 routes are included for AS
+// numbers and as-sets listed in the members attribute, while both IPv4 and
+// IPv6 routes are included for those listed in the mp-members attribute.
+func RouteSet(d *db.Database, name string, opts Options) (*Result, error) {
+	name = strings.ToUpper(name)
+	r := newResolver(d, opts)
+
+	if _, ok := d.Get(token.CLASS_ROUTE_SET, name); !ok {
+		return nil, fmt.Errorf("route-set %s not found", name)
+	}
+
+	r.expandRouteSet(name, nil)
+	return r.result, nil
+}
+
+// Members returns the members of the as-set or route-set without expanding
+// them, as listed in it's members and mp-members attributes followed by the
+// aut-num, route and route6 objects which are members by reference
+func Members(d *db.Database, name string) ([]string, error) {
+	name = strings.ToUpper(name)
+	r := newResolver(d, Options{})
+
+	class := token.CLASS_ROUTE_SET
+	if lexer.SetClass(name) == token.CLASS_AS_SET {
+		class = token.CLASS_AS_SET
+	}
+
+	obj, ok := d.Get(class, name)
+	if !ok {
+		return nil, fmt.Errorf("%s %s not found", class.Name(), name)
+	}
+
+	var members uniqueValues
+	for _, member := range obj.Values(token.ATTR_AS_SET_MEMBERS) {
+		members.add(strings.ToUpper(member))
+	}
+	for _, member := range obj.Values(token.ATTR_MULTI_PROTO_MEMBERS) {
+		members.add(strings.ToUpper(member))
+	}
+
+	for _, member := range r.membersByRef(obj, token.CLASS_AUT_NUM, token.CLASS_ROUTE, token.CLASS_ROUTE6) {
+		members.add(strings.ToUpper(member.Name()))
+	}
+
+	return members.list, nil
+}
+
+// enter pushes the set on to the stack, returning false if it should not be
+// expanded because it forms a cycle or is nested too deeply
+func (r *resolver) enter(name string) bool {
+	for i, existing := range r.stack {
+		if existing == name {
+			cycle := append(append([]string{}, r.stack[i:]...), name)
+			if key := strings.Join(cycle, " "); !r.reported[key] {
+				r.reported[key] = true
+				r.result.Cycles = append(r.result.Cycles, cycle)
+			}
+			return false
+		}
+	}
+
+	if len(r.stack) >= r.maxDepth {
+		r.depthExceeded(name)
+		return false
+	}
+
+	r.stack = append(r.stack, name)
+	return true
+}
+
+func (r *resolver) leave() {
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+// add records a member, along with the set which directly contained it
+func (r *resolver) add(value, set string) {
+	i, ok := r.members[value]
+	if !ok {
+		i = len(r.result.Members)
+		r.members[value] = i
+		r.result.Members = append(r.result.Members, Member{Value: value, Sets: []string{}})
+	}
+
+	if key := value + " " + set; set != "" && !r.sets[key] {
+		r.sets[key] = true
+		r.result.Members[i].Sets = append(r.result.Members[i].Sets, set)
+	}
+}
+
+// setMissing records a set which is referenced but does not exist
+func (r *resolver) setMissing(name string) {
+	r.missing.add(name)
+	r.result.Missing = r.missing.list
+}
+
+// depthExceeded records a set which is nested too deeply to be expanded
+func (r *resolver) depthExceeded(name string) {
+	r.exceeded.add(name)
+	r.result.DepthExceeded = r.exceeded.list
+}
+
+// expandASSet returns every AS number contained by the as-set, recording
+// those which it contains directly as members of the result
+func (r *resolver) expandASSet(name string) []string {
+	if values, ok := r.expanded[name]; ok {
+		return values
+	}
+
+	obj, ok := r.d.Get(token.CLASS_AS_SET, name)
+	if !ok {
+		r.setMissing(name)
+		return nil
+	}
+
+	if !r.enter(name) {
+		return nil
+	}
+	defer r.leave()
+
+	var values uniqueValues
+	for _, member := range upper(obj.Values(token.ATTR_AS_SET_MEMBERS)) {
+		if lexer.IsASN(member) {
+			r.add(member, name)
+			values.add(member)
+			continue
+		}
+
+		for _, asn := range r.expandASSet(member) {
+			values.add(asn)
+		}
+	}
+
+	for _, autNum := range r.membersByRef(obj, token.CLASS_AUT_NUM) {
+		asn := strings.ToUpper(autNum.Name())
+		r.add(asn, name)
+		values.add(asn)
+	}
+
+	r.expanded[name] = values.list
+	return values.list
+}
+
+// expandRouteSet returns every prefix range contained by the route-set, with
+// each of the range operators applied in order
+func (r *resolver) expandRouteSet(name string, ops []string) []string {
+	key := name + strings.Join(ops, "")
+	if values, ok := r.expanded[key]; ok {
+		return values
+	}
+
+	obj, ok := r.d.Get(token.CLASS_ROUTE_SET, name)
+	if !ok {
+		r.setMissing(name)
+		return nil
+	}
+
+	if !r.enter(name) {
+		return nil
+	}
+	defer r.leave()
+
+	var values uniqueValues
+	for _, attr := range obj.Get(token.ATTR_AS_SET_MEMBERS) {
+		r.expandRouteSetMembers(&values, name, attr, ops, false)
+	}
+
+	for _, attr := range obj.Get(token.ATTR_MULTI_PROTO_MEMBERS) {
+		r.expandRouteSetMembers(&values, name, attr, ops, true)
+	}
+
+	for _, route := range r.membersByRef(obj, token.CLASS_ROUTE, token.CLASS_ROUTE6) {
+		if r.filter == nil || r.filter(route) {
+			r.addRange(&values, route.Name(), name, ops)
+		}
+	}
+
+	r.expanded[key] = values.list
+	return values.list
+}
+
+func (r *resolver) expandRouteSetMembers(values *uniqueValues, name string, attr *ast.Attribute, ops []string, mp bool) {
+	tokens := append([]token.Token{}, attr.Values...)
+	for _, cont := range attr.Continuations {
+		tokens = append(tokens, cont.Values...)
+	}
+
+	for _, tok := range tokens {
+		if tok.Type == token.DATA_IPv4_CIDR || tok.Type == token.DATA_IPv6_CIDR {
+			r.addRange(values, tok.Literal, name, ops)
+			continue
+		}
+
+		member, op := splitOperator(strings.ToUpper(tok.Literal))
+		memberOps := ops
+		if op != "" {
+			memberOps = append([]string{op}, ops...)
+		}
+
+		switch {
+		case lexer.IsASN(member):
+			r.addOriginRoutes(values, []string{member}, name, memberOps, mp)
+		case lexer.SetClass(member) == token.CLASS_AS_SET:
+			r.addOriginRoutes(values, r.asSet(member), name, memberOps, mp)
+		default:
+			for _, value := range r.expandRouteSet(member, memberOps) {
+				values.add(value)
+			}
+		}
+	}
+}
+
+// asSet expands an as-set referenced by a route-set. The AS numbers are not
+// members of the route-set, but any problems found while expanding the as-set
+// are reported. The as-set is expanded to no more than the depth remaining,
+// which may leave none for it.
+func (r *resolver) asSet(name string) []string {
+	remaining := r.maxDepth - len(r.stack)
+	if remaining < 1 {
+		r.depthExceeded(name)
+		return nil
+	}
+
+	nested := newResolver(r.d, Options{MaxDepth: remaining})
+	asns := nested.expandASSet(name)
+
+	for _, cycle := range nested.result.Cycles {
+		if key := strings.Join(cycle, " "); !r.reported[key] {
+			r.reported[key] = true
+			r.result.Cycles = append(r.result.Cycles, cycle)
+		}
+	}
+	for _, missing := range nested.result.Missing {
+		r.setMissing(missing)
+	}
+	for _, exceeded := range nested.result.DepthExceeded {
+		r.depthExceeded(exceeded)
+	}
+
+	return asns
+}
+
+func (r *resolver) addOriginRoutes(values *uniqueValues, asns []string, set string, ops []string, mp bool) {
+	for _, asn := range asns {
+		for _, route := range r.d.ByOrigin(asn) {
+			if route.Class() == token.CLASS_ROUTE6 && !mp || r.filter != nil && !r.filter(route) {
+				continue
+			}
+			r.addRange(values, route.Name(), set, ops)
+		}
+	}
+}
+
+// addRange applies the range operators to the prefix range and records it as
+// a member of the set. Ranges which become empty are dropped.
+func (r *resolver) addRange(values *uniqueValues, value, set string, ops []string) {
+	value, op := splitOperator(value)
+	rng, err := prefix.ParseRange(value)
+	if err != nil {
+		return
+	}
+
+	for _, o := range append([]string{op}, ops...) {
+		if rng, err = rng.Apply(o); err != nil {
+			return
+		}
+	}
+
+	r.add(rng.String(), set)
+	values.add(rng.String())
+}
+
+// membersByRef returns the objects of the given classes which are members of
+// the set by reference, that is they list the set in their member-of
+// attribute and are maintained by one of the set's mbrs-by-ref maintainers
+func (r *resolver) membersByRef(set *ast.Object, classes ...token.Type) []*ast.Object {
+	mbrsByRef := upper(set.Values(token.ATTR_MEMBERS_BY_REFERENCE))
+	if len(mbrsByRef) == 0 {
+		return nil
+	}
+
+	var members []*ast.Object
+	for _, obj := range r.d.ByMemberOf(set.Name()) {
+		if !hasClass(obj, classes) {
+			continue
+		}
+
+		if containsSet(mbrsByRef, "ANY") || intersects(mbrsByRef, upper(obj.Values(token.ATTR_MAINTAINED_BY))) {
+			members = append(members, obj)
+		}
+	}
+
+	return members
+}
+
+func hasClass(obj *ast.Object, classes []token.Type) bool {
+	for _, class := range classes {
+		if obj.Class() == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+func intersects(a, b []string) bool {
+	for _, v := range a {
+		if containsSet(b, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uniqueValues is a list of values without duplicates, in the order they were
+// first added
+type uniqueValues struct {
+	list []string
+	seen map[string]bool
+}
+
+func (u *uniqueValues) add(value string) {
+	if u.seen[value] {
+		return
+	}
+
+	if u.seen == nil {
+		u.seen = make(map[string]bool)
+	}
+	u.seen[value] = true
+	u.list = append(u.list, value)
+}
+
+func containsSet(sets []string, name string) bool {
+	for _, set := range sets {
+		if set == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitOperator splits a member into it's name or prefix and it's range
+// operator, e.g. RS-FOO^+ into RS-FOO and ^+
+func splitOperator(member string) (string, string) {
+	if i := strings.Index(member, "^"); i >= 0 {
+		return member[:i], member[i:]
+	}
+
+	return member, ""
+}
+
+func upper(values []string) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = strings.ToUpper(v)
+	}
+
+	return result
+}
@@ -0,0 +1,178 @@
+package resolve
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `as-set:         AS-ROOT
+members:        AS65537, AS-CHILD
+mbrs-by-ref:    TEST-MNT
+mnt-by:         TEST-MNT
+source:         TEST
+
+as-set:         AS-CHILD
+members:        AS65538, AS-ROOT, AS-MISSING
+mnt-by:         TEST-MNT
+source:         TEST
+
+aut-num:        AS65539
+as-name:        TEST
+member-of:      AS-ROOT
+mnt-by:         TEST-MNT
+source:         TEST
+
+aut-num:        AS65540
+as-name:        OTHER
+member-of:      AS-ROOT
+mnt-by:         OTHER-MNT
+source:         TEST
+
+route-set:      AS65537:RS-ROOT
+members:        192.0.2.0/24^+, AS65537:RS-CHILD^26, AS65537
+mp-members:     AS-CHILD
+mbrs-by-ref:    ANY
+mnt-by:         TEST-MNT
+source:         TEST
+
+route-set:      AS65537:RS-CHILD
+members:        198.51.100.0/24^-, 203.0.113.0/24, AS65537:RS-ROOT
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          10.0.0.0/8
+origin:         AS65537
+member-of:      AS65537:RS-ROOT
+mnt-by:         OTHER-MNT
+source:         TEST
+
+route:          10.1.0.0/16
+origin:         AS65538
+mnt-by:         TEST-MNT
+source:         TEST
+
+route6:         2001:db8::/32
+origin:         AS65538
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+func TestASSet(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+
+	result, err := ASSet(d, "as-root", Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []Member{
+		{Value: "AS65537", Sets: []string{"AS-ROOT"}},
+		{Value: "AS65538", Sets: []string{"AS-CHILD"}},
+		{Value: "AS65539", Sets: []string{"AS-ROOT"}},
+	}, result.Members)
+	assert.Equal(t, [][]string{{"AS-ROOT", "AS-CHILD", "AS-ROOT"}}, result.Cycles)
+	assert.Equal(t, []string{"AS-MISSING"}, result.Missing)
+	assert.Empty(t, result.DepthExceeded)
+
+	result, err = ASSet(d, "AS-ROOT", Options{MaxDepth: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"AS65537", "AS65539"}, result.Values())
+		assert.Equal(t, []string{"AS-CHILD"}, result.DepthExceeded)
+	}
+
+	result, err = ASSet(d, "as65536", Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"AS65536"}, result.Values())
+	}
+
+	_, err = ASSet(d, "AS-MISSING", Options{})
+	assert.EqualError(t, err, "as-set AS-MISSING not found")
+}
+
+func TestRouteSet(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+
+	result, err := RouteSet(d, "as65537:rs-root", Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		"192.0.2.0/24^+",
+		"198.51.100.0/24^26",
+		"203.0.113.0/24^26",
+		"10.0.0.0/8",
+		"10.1.0.0/16",
+		"2001:db8::/32",
+	}, result.Values())
+	assert.Equal(t, []string{"AS65537:RS-CHILD"}, result.Members[1].Sets)
+	assert.Equal(t, []string{"AS65537:RS-ROOT"}, result.Members[3].Sets)
+	assert.Equal(t, [][]string{
+		{"AS65537:RS-ROOT", "AS65537:RS-CHILD", "AS65537:RS-ROOT"},
+		{"AS-CHILD", "AS-ROOT", "AS-CHILD"},
+	}, result.Cycles)
+	assert.Equal(t, []string{"AS-MISSING"}, result.Missing)
+
+	ranges := result.Ranges()
+	if assert.Len(t, ranges, 6) {
+		assert.Equal(t, 26, ranges[1].Min)
+		assert.Equal(t, 26, ranges[1].Max)
+	}
+
+	filter := func(route *ast.Object) bool { return route.Name() != "10.0.0.0/8" }
+	result, err = RouteSet(d, "AS65537:RS-ROOT", Options{Filter: filter})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"192.0.2.0/24^+",
+			"198.51.100.0/24^26",
+			"203.0.113.0/24^26",
+			"10.1.0.0/16",
+			"2001:db8::/32",
+		}, result.Values())
+	}
+
+	// an as-set referenced at the maximum depth is not expanded
+	result, err = RouteSet(d, "AS65537:RS-ROOT", Options{MaxDepth: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"192.0.2.0/24^+", "10.0.0.0/8"}, result.Values())
+		assert.Equal(t, []string{"AS65537:RS-CHILD", "AS-CHILD"}, result.DepthExceeded)
+	}
+
+	_, err = RouteSet(d, "RS-MISSING", Options{})
+	assert.EqualError(t, err, "route-set RS-MISSING not found")
+}
+
+func TestMembers(t *testing.T) {
+	d := db.New()
+	require.NoError(t, d.Load("test", strings.NewReader(testDatabase)))
+
+	tests := []struct {
+		name string
+		want []string
+		err  string
+	}{
+		{"as-root", []string{"AS65537", "AS-CHILD", "AS65539"}, ""},
+		{"AS-CHILD", []string{"AS65538", "AS-ROOT", "AS-MISSING"}, ""},
+		{"AS65537:RS-ROOT", []string{"192.0.2.0/24^+", "AS65537:RS-CHILD^26", "AS65537", "AS-CHILD", "10.0.0.0/8"}, ""},
+		{"AS-MISSING", nil, "as-set AS-MISSING not found"},
+		{"RS-MISSING", nil, "route-set RS-MISSING not found"},
+	}
+
+	for _, tt := range tests {
+		members, err := Members(d, tt.name)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.name)
+			continue
+		}
+
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, members, tt.name)
+	}
+}
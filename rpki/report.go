@@ -0,0 +1,87 @@
+package rpki
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Result is the validation state of a route or route6 object
+type Result struct {
+	Object *ast.Object
+	State  State
+	VRPs   []VRP // the VRPs covering the route's prefix
+}
+
+// Check validates every route and route6 object in the database, ordered by
+// class and primary key. Objects with an invalid prefix or origin are skipped.
+func Check(d *db.Database, v *Validator) []Result {
+	var results []Result
+	for _, obj := range d.Objects(token.CLASS_ROUTE, token.CLASS_ROUTE6) {
+		if state, vrps, ok := v.ValidateObject(obj); ok {
+			results = append(results, Result{Object: obj, State: state, VRPs: vrps})
+		}
+	}
+
+	return results
+}
+
+// Count returns the number of results in each state
+func Count(results []Result) map[State]int {
+	counts := make(map[State]int)
+	for _, r := range results {
+		counts[r.State]++
+	}
+
+	return counts
+}
+
+// WriteReport writes a line for each result in one of the given states, or
+// every result if none are given, followed by the number of routes in each
+// state
+func WriteReport(w io.Writer, results []Result, states ...State) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tORIGIN\tSTATE\tVRPS")
+	for _, r := range results {
+		if !includes(states, r.State) {
+			continue
+		}
+
+		vrps := "-"
+		if len(r.VRPs) > 0 {
+			names := make([]string, len(r.VRPs))
+			for i, vrp := range r.VRPs {
+				names[i] = vrp.String()
+			}
+			vrps = strings.Join(names, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Object.Name(), strings.ToUpper(r.Object.Value(token.ATTR_ORIGIN)), r.State, vrps)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	counts := Count(results)
+	_, err := fmt.Fprintf(w, "\n%d routes: %d valid, %d invalid-asn, %d invalid-length, %d not-found\n",
+		len(results), counts[Valid], counts[InvalidASN], counts[InvalidLength], counts[NotFound])
+	return err
+}
+
+func includes(states []State, state State) bool {
+	if len(states) == 0 {
+		return true
+	}
+
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
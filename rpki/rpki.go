@@ -0,0 +1,166 @@
+package rpki
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// State is the result of validating a route's origin, following RFC 6811
+type State int
+
+const (
+	// NotFound routes are not covered by any VRP
+	NotFound State = iota
+	// Valid routes match a VRP with their origin AS which permits their length
+	Valid
+	// InvalidASN routes are covered by VRPs, none of which are for their
+	// origin AS
+	InvalidASN
+	// InvalidLength routes are covered by a VRP for their origin AS, but are
+	// longer than it's maximum length
+	InvalidLength
+)
+
+var stateNames = map[State]string{
+	NotFound:      "not-found",
+	Valid:         "valid",
+	InvalidASN:    "invalid-asn",
+	InvalidLength: "invalid-length",
+}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+// ParseState parses the name of a state, e.g. invalid-asn
+func ParseState(name string) (State, error) {
+	for state, n := range stateNames {
+		if strings.EqualFold(name, n) {
+			return state, nil
+		}
+	}
+
+	return NotFound, fmt.Errorf("unknown validation state %q", name)
+}
+
+// Invalid reports whether the state is InvalidASN or InvalidLength
+func (s State) Invalid() bool {
+	return s == InvalidASN || s == InvalidLength
+}
+
+// Validator validates route origins against a set of VRPs
+type Validator struct {
+	// the VRPs for each family, keyed by prefix length and then by the
+	// prefix's address
+	ipv4, ipv6 map[int]map[string][]VRP
+	// the prefix lengths with VRPs in each family, in ascending order
+	ipv4Lengths, ipv6Lengths []int
+}
+
+// NewValidator returns a Validator for the VRPs
+func NewValidator(vrps []VRP) *Validator {
+	v := &Validator{ipv4: make(map[int]map[string][]VRP), ipv6: make(map[int]map[string][]VRP)}
+	for _, vrp := range vrps {
+		index := v.index(vrp.Prefix)
+		ones, _ := vrp.Prefix.Mask.Size()
+		if index[ones] == nil {
+			index[ones] = make(map[string][]VRP)
+		}
+		key := vrp.Prefix.IP.String()
+		index[ones][key] = append(index[ones][key], vrp)
+	}
+
+	v.ipv4Lengths, v.ipv6Lengths = lengths(v.ipv4), lengths(v.ipv6)
+	return v
+}
+
+func (v *Validator) index(ipnet *net.IPNet) map[int]map[string][]VRP {
+	if prefix.IsIPv4(ipnet) {
+		return v.ipv4
+	}
+
+	return v.ipv6
+}
+
+func lengths(index map[int]map[string][]VRP) []int {
+	var result []int
+	for ones := range index {
+		result = append(result, ones)
+	}
+	sort.Ints(result)
+
+	return result
+}
+
+// Validate returns the validation state of a route for the prefix with the
+// origin AS, along with the VRPs which cover the prefix. AS 0 never matches a
+// VRP, so a route with it is either invalid or not found.
+func (v *Validator) Validate(ipnet *net.IPNet, origin uint32) (State, []VRP) {
+	index, lengths := v.ipv4, v.ipv4Lengths
+	if !prefix.IsIPv4(ipnet) {
+		index, lengths = v.ipv6, v.ipv6Lengths
+	}
+
+	routeLength, bits := ipnet.Mask.Size()
+	var covering []VRP
+	for _, ones := range lengths {
+		if ones > routeLength {
+			break
+		}
+		key := ipnet.IP.Mask(net.CIDRMask(ones, bits)).String()
+		covering = append(covering, index[ones][key]...)
+	}
+
+	if len(covering) == 0 {
+		return NotFound, nil
+	}
+
+	state := InvalidASN
+	for _, vrp := range covering {
+		if vrp.ASN != origin || origin == 0 {
+			continue
+		}
+		if routeLength <= vrp.MaxLength {
+			return Valid, covering
+		}
+		state = InvalidLength
+	}
+
+	return state, covering
+}
+
+// ValidateObject validates a route or route6 object, returning false if it is
+// not one or it's prefix or origin are invalid
+func (v *Validator) ValidateObject(route *ast.Object) (State, []VRP, bool) {
+	if route.Class() != token.CLASS_ROUTE && route.Class() != token.CLASS_ROUTE6 {
+		return NotFound, nil, false
+	}
+
+	ipnet, err := prefix.Parse(route.Name())
+	if err != nil {
+		return NotFound, nil, false
+	}
+
+	origin, err := aspath.ParseASN(strings.TrimSpace(route.Value(token.ATTR_ORIGIN)))
+	if err != nil {
+		return NotFound, nil, false
+	}
+
+	state, vrps := v.Validate(ipnet, origin)
+	return state, vrps, true
+}
+
+// Accept returns false for route and route6 objects which are RPKI invalid.
+// It is intended as resolve.Options.Filter, to leave invalid routes out of
+// expanded sets and generated filters.
+func (v *Validator) Accept(route *ast.Object) bool {
+	state, _, ok := v.ValidateObject(route)
+	return !ok || !state.Invalid()
+}
@@ -0,0 +1,182 @@
+package rpki
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/generate"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validator(t *testing.T) *Validator {
+	vrps, err := LoadFile(filepath.Join("testdata", "rpki-client.json"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return NewValidator(vrps)
+}
+
+func TestLoad(t *testing.T) {
+	for _, name := range []string{"rpki-client.json", "routinator.json", "rtrmon.json"} {
+		vrps, err := LoadFile(filepath.Join("testdata", name))
+		if !assert.NoError(t, err, name) || !assert.Len(t, vrps, 4, name) {
+			continue
+		}
+
+		assert.Equal(t, "10.0.0.0/8-16 AS65537", vrps[0].String(), name)
+		assert.Equal(t, "192.0.2.0/24 AS65538", vrps[1].String(), name)
+		assert.Equal(t, "2001:db8::/32-48 AS65540", vrps[2].String(), name)
+		assert.Equal(t, uint32(0), vrps[3].ASN, name)
+		if name != "rtrmon.json" {
+			assert.Equal(t, "ripe", vrps[0].TA, name)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"roas": [`, "invalid VRP file: unexpected EOF"},
+		{`{"roas": [{"asn": "AS65537", "prefix": "10.0.0.0/33", "maxLength": 8}]}`, `invalid VRP 10.0.0.0/33: invalid prefix "10.0.0.0/33"`},
+		{`{"roas": [{"asn": "AS65537", "prefix": "10.0.0.0/8", "maxLength": 7}]}`, "invalid VRP 10.0.0.0/8: invalid maxLength 7"},
+		{`{"roas": [{"asn": "65537x", "prefix": "10.0.0.0/8", "maxLength": 8}]}`, `invalid VRP 10.0.0.0/8: invalid AS number "65537x"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Load(strings.NewReader(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v := validator(t)
+
+	tests := []struct {
+		prefix   string
+		origin   uint32
+		expected State
+		covering int
+	}{
+		{"10.0.0.0/8", 65537, Valid, 1},
+		{"10.1.0.0/16", 65537, Valid, 1},
+		{"10.1.2.0/24", 65537, InvalidLength, 1},
+		{"10.2.0.0/16", 65538, InvalidASN, 1},
+		{"192.0.2.0/24", 65538, Valid, 1},
+		{"192.0.2.0/25", 65538, InvalidLength, 1},
+		{"198.51.100.0/24", 65538, NotFound, 0},
+		{"0.0.0.0/0", 65537, NotFound, 0},
+		{"203.0.113.0/24", 0, InvalidASN, 1},
+		{"2001:db8::/48", 65540, Valid, 1},
+		{"2001:db8::/49", 65540, InvalidLength, 1},
+		{"2001:db8::/32", 65537, InvalidASN, 1},
+		{"2001:db9::/32", 65540, NotFound, 0},
+	}
+
+	for _, tt := range tests {
+		ipnet, err := prefix.Parse(tt.prefix)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		state, vrps := v.Validate(ipnet, tt.origin)
+		assert.Equal(t, tt.expected, state, "%s AS%d", tt.prefix, tt.origin)
+		assert.Len(t, vrps, tt.covering, "%s AS%d", tt.prefix, tt.origin)
+	}
+
+	// a route is valid if any covering VRP matches
+	v = NewValidator([]VRP{
+		{Prefix: mustParse("10.0.0.0/8"), MaxLength: 8, ASN: 65537},
+		{Prefix: mustParse("10.1.0.0/16"), MaxLength: 24, ASN: 65537},
+	})
+	state, vrps := v.Validate(mustParse("10.1.2.0/24"), 65537)
+	assert.Equal(t, Valid, state)
+	assert.Len(t, vrps, 2)
+}
+
+func TestParseState(t *testing.T) {
+	for _, state := range []State{NotFound, Valid, InvalidASN, InvalidLength} {
+		parsed, err := ParseState(strings.ToUpper(state.String()))
+		if assert.NoError(t, err) {
+			assert.Equal(t, state, parsed)
+		}
+	}
+
+	_, err := ParseState("invalid")
+	assert.EqualError(t, err, `unknown validation state "invalid"`)
+}
+
+func TestCheck(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	results := Check(d, validator(t))
+
+	var out bytes.Buffer
+	if !assert.NoError(t, WriteReport(&out, results)) {
+		return
+	}
+	assert.Equal(t, `PREFIX           ORIGIN   STATE           VRPS
+10.0.0.0/8       AS65537  valid           10.0.0.0/8-16 AS65537
+10.1.0.0/16      AS65537  valid           10.0.0.0/8-16 AS65537
+10.1.2.0/24      AS65537  invalid-length  10.0.0.0/8-16 AS65537
+10.2.0.0/16      AS65538  invalid-asn     10.0.0.0/8-16 AS65537
+192.0.2.0/24     AS65538  valid           192.0.2.0/24 AS65538
+198.51.100.0/24  AS65538  not-found       -
+203.0.113.0/24   AS65539  invalid-asn     203.0.113.0/24-32 AS0
+2001:db8:1::/48  AS65539  invalid-asn     2001:db8::/32-48 AS65540
+2001:db8::/32    AS65540  valid           2001:db8::/32-48 AS65540
+
+9 routes: 4 valid, 3 invalid-asn, 1 invalid-length, 1 not-found
+`, out.String())
+
+	out.Reset()
+	if assert.NoError(t, WriteReport(&out, results, InvalidLength)) {
+		assert.Equal(t, `PREFIX       ORIGIN   STATE           VRPS
+10.1.2.0/24  AS65537  invalid-length  10.0.0.0/8-16 AS65537
+
+9 routes: 4 valid, 3 invalid-asn, 1 invalid-length, 1 not-found
+`, out.String())
+	}
+}
+
+func TestAccept(t *testing.T) {
+	d, err := db.LoadFile(filepath.Join("testdata", "irr.db"))
+	require.NoError(t, err)
+	d, v := d, validator(t)
+
+	opts := resolve.Options{Filter: v.Accept}
+	ranges, err := generate.Prefixes(d, "AS-TEST", false, opts)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"10.0.0.0/8", "10.1.0.0/16", "192.0.2.0/24", "198.51.100.0/24"}, rangeStrings(ranges))
+	}
+
+	ranges, err = generate.Prefixes(d, "AS-TEST", true, opts)
+	if assert.NoError(t, err) {
+		assert.Empty(t, ranges)
+	}
+}
+
+func mustParse(s string) *net.IPNet {
+	ipnet, err := prefix.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipnet
+}
+
+func rangeStrings(ranges []prefix.Range) []string {
+	var result []string
+	for _, r := range ranges {
+		result = append(result, r.String())
+	}
+
+	return result
+}
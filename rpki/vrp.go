@@ -0,0 +1,120 @@
+package rpki
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/aspath"
+	"github.com/kkirsche/rpsl/prefix"
+)
+
+// VRP is a Validated ROA Payload: an AS number authorized to originate a
+// prefix and its more specifics up to a maximum length
+type VRP struct {
+	Prefix    *net.IPNet
+	MaxLength int
+	ASN       uint32
+	TA        string // the trust anchor the VRP was validated under, if known
+}
+
+func (v VRP) String() string {
+	ones, _ := v.Prefix.Mask.Size()
+	if v.MaxLength == ones {
+		return fmt.Sprintf("%s AS%d", v.Prefix, v.ASN)
+	}
+
+	return fmt.Sprintf("%s-%d AS%d", v.Prefix, v.MaxLength, v.ASN)
+}
+
+// vrpFile is the JSON written by rpki-client, Routinator and rtrmon, which all
+// list VRPs as roas with a prefix, maxLength, asn and ta. The AS number is a
+// number in rpki-client's output and a string such as AS65537 in the others.
+type vrpFile struct {
+	ROAs []vrpJSON `json:"roas"`
+}
+
+type vrpJSON struct {
+	Prefix    string          `json:"prefix"`
+	MaxLength int             `json:"maxLength"`
+	ASN       json.RawMessage `json:"asn"`
+	TA        string          `json:"ta"`
+}
+
+// Load reads VRPs from JSON in the formats exported by rpki-client, Routinator
+// and rtrmon
+func Load(r io.Reader) ([]VRP, error) {
+	var file vrpFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid VRP file: %s", err)
+	}
+
+	vrps := make([]VRP, 0, len(file.ROAs))
+	for _, v := range file.ROAs {
+		vrp, err := v.vrp()
+		if err != nil {
+			return nil, fmt.Errorf("invalid VRP %s: %s", v.Prefix, err)
+		}
+		vrps = append(vrps, vrp)
+	}
+
+	return vrps, nil
+}
+
+// LoadFile reads VRPs from a JSON file, see Load
+func LoadFile(name string) ([]VRP, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+func (v vrpJSON) vrp() (VRP, error) {
+	ipnet, err := prefix.Parse(v.Prefix)
+	if err != nil {
+		return VRP{}, err
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	maxLength := v.MaxLength
+	if maxLength == 0 {
+		maxLength = ones
+	}
+	if maxLength < ones || maxLength > bits {
+		return VRP{}, fmt.Errorf("invalid maxLength %d", maxLength)
+	}
+
+	asn, err := parseASN(v.ASN)
+	if err != nil {
+		return VRP{}, err
+	}
+
+	return VRP{Prefix: ipnet, MaxLength: maxLength, ASN: asn, TA: v.TA}, nil
+}
+
+// parseASN parses an AS number given as a JSON number, or as a string with or
+// without the AS prefix
+func parseASN(raw json.RawMessage) (uint32, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+
+	if strings.HasPrefix(strings.ToUpper(s), "AS") {
+		return aspath.ParseASN(s)
+	}
+
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS number %s", raw)
+	}
+
+	return uint32(asn), nil
+}
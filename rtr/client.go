@@ -0,0 +1,477 @@
+package rtr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kkirsche/rpsl/rpki"
+)
+
+// The protocol versions: version 0 is RFC 6810 and version 1 is RFC 8210
+const (
+	Version0 uint8 = 0
+	Version1 uint8 = 1
+)
+
+// The default timing parameters of RFC 8210, used until the cache sends it's
+// own in an End of Data PDU
+const (
+	DefaultRefresh = time.Hour
+	DefaultRetry   = 10 * time.Minute
+	DefaultExpire  = 2 * time.Hour
+)
+
+// The error codes of Error Report PDUs
+const (
+	CorruptData               uint16 = 0
+	InternalError             uint16 = 1
+	NoDataAvailable           uint16 = 2
+	InvalidRequest            uint16 = 3
+	UnsupportedVersion        uint16 = 4
+	UnsupportedPDUType        uint16 = 5
+	WithdrawalOfUnknownRecord uint16 = 6
+	DuplicateAnnouncement     uint16 = 7
+	UnexpectedVersion         uint16 = 8
+)
+
+var errorCodeNames = map[uint16]string{
+	CorruptData:               "corrupt data",
+	InternalError:             "internal error",
+	NoDataAvailable:           "no data available",
+	InvalidRequest:            "invalid request",
+	UnsupportedVersion:        "unsupported protocol version",
+	UnsupportedPDUType:        "unsupported PDU type",
+	WithdrawalOfUnknownRecord: "withdrawal of unknown record",
+	DuplicateAnnouncement:     "duplicate announcement received",
+	UnexpectedVersion:         "unexpected protocol version",
+}
+
+// ErrorReport is an error reported by the cache, or by the client when the
+// cache violates the protocol
+type ErrorReport struct {
+	Code uint16
+	Text string
+}
+
+func (e *ErrorReport) Error() string {
+	name, ok := errorCodeNames[e.Code]
+	if !ok {
+		name = fmt.Sprintf("error %d", e.Code)
+	}
+	if e.Text == "" {
+		return "rtr: " + name
+	}
+
+	return fmt.Sprintf("rtr: %s: %s", name, e.Text)
+}
+
+// Client is an RTR client which keeps a table of VRPs synchronized with a
+// cache. It is safe to read the table while the client is being updated.
+type Client struct {
+	// Dial connects to the cache
+	Dial func() (net.Conn, error)
+	// Version is the highest protocol version to use, the client falls back
+	// to version 0 if the cache does not support it
+	Version uint8
+
+	conn   net.Conn
+	reader *bufio.Reader
+	// version is the version in use, which is lower than Version once the
+	// client has downgraded
+	version    uint8
+	downgraded bool
+	// notified is set when a Serial Notify is received during a query
+	notified bool
+
+	mu          sync.RWMutex
+	vrps        map[string]rpki.VRP
+	session     uint16
+	serial      uint32
+	synced      bool
+	dataVersion uint8 // the version the session was established with
+	updated     time.Time
+	refresh     time.Duration
+	retry       time.Duration
+	expire      time.Duration
+	validator   *rpki.Validator
+}
+
+// NewClient returns a client which connects to the cache using dial, e.g.
+//
+//	rtr.NewClient(func() (net.Conn, error) { return net.Dial("tcp", "rpki.example.net:323") })
+func NewClient(dial func() (net.Conn, error)) *Client {
+	return &Client{
+		Dial:    dial,
+		Version: Version1,
+		vrps:    make(map[string]rpki.VRP),
+		refresh: DefaultRefresh,
+		retry:   DefaultRetry,
+		expire:  DefaultExpire,
+	}
+}
+
+// VRPs returns the current VRPs, sorted by prefix, maximum length and AS
+// number
+func (c *Client) VRPs() []rpki.VRP {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	vrps := make([]rpki.VRP, 0, len(c.vrps))
+	for _, vrp := range c.vrps {
+		vrps = append(vrps, vrp)
+	}
+	sort.Slice(vrps, func(i, j int) bool {
+		return vrpKey(vrps[i]) < vrpKey(vrps[j])
+	})
+
+	return vrps
+}
+
+// Validator returns a validator for the current VRPs
+func (c *Client) Validator() *rpki.Validator {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.validator == nil {
+		vrps := make([]rpki.VRP, 0, len(c.vrps))
+		for _, vrp := range c.vrps {
+			vrps = append(vrps, vrp)
+		}
+		c.validator = rpki.NewValidator(vrps)
+	}
+
+	return c.validator
+}
+
+// Session returns the session ID and serial number of the current data, and
+// whether any data has been received
+func (c *Client) Session() (uint16, uint32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.session, c.serial, c.synced
+}
+
+// Sync brings the VRPs up to date, connecting to the cache if necessary.
+// Once a session has been established incremental updates are requested
+// with a Serial Query, otherwise, or if the cache can not provide them, the
+// full set of VRPs is requested with a Reset Query. The changes of each
+// update are applied together once it's End of Data is received.
+func (c *Client) Sync() error {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+
+	err := c.query()
+	if e, ok := err.(*ErrorReport); ok && e.Code == UnsupportedVersion && c.version > Version0 {
+		// the cache only supports an earlier version, which it has closed
+		// the connection to downgrade to
+		c.Close()
+		c.version, c.downgraded = Version0, true
+		if err = c.connect(); err == nil {
+			err = c.query()
+		}
+	}
+
+	if err != nil {
+		c.Close()
+	}
+	return err
+}
+
+// Run keeps the VRPs synchronized until the context is done. It queries the
+// cache when notified of new data and at the refresh interval, and retries
+// at the retry interval after a failure. If the data can not be refreshed
+// before the expire interval it is discarded.
+func (c *Client) Run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		c.mu.RLock()
+		conn := c.conn
+		c.mu.RUnlock()
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		err := c.Sync()
+		refresh, retry := c.timers()
+
+		wait := refresh
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			wait = retry
+			c.expireData()
+		} else if c.notified {
+			continue
+		}
+
+		if err := c.wait(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connection to the cache, the VRPs are kept
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn, c.reader = nil, nil
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (c *Client) connect() error {
+	if !c.downgraded {
+		c.version = c.Version
+	}
+
+	conn, err := c.Dial()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	c.mu.Unlock()
+	return nil
+}
+
+// wait waits for the interval to pass or a Serial Notify to be received
+func (c *Client) wait(ctx context.Context, interval time.Duration) error {
+	deadline := time.Now().Add(interval)
+	for c.conn != nil && time.Now().Before(deadline) {
+		c.conn.SetReadDeadline(deadline)
+		p, err := readPDU(c.reader)
+		c.conn.SetReadDeadline(time.Time{})
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				c.Close()
+			}
+		case p.Type == typeSerialNotify:
+			return nil
+		}
+	}
+
+	if c.conn == nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+
+	return ctx.Err()
+}
+
+// timers returns the refresh and retry intervals
+func (c *Client) timers() (time.Duration, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.refresh, c.retry
+}
+
+// expireData discards the VRPs if they have not been refreshed within the
+// expire interval
+func (c *Client) expireData() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.synced && time.Since(c.updated) > c.expire {
+		c.vrps = make(map[string]rpki.VRP)
+		c.synced, c.validator = false, nil
+	}
+}
+
+// query sends a Serial Query, or a Reset Query if there is no session or the
+// cache responds with a Cache Reset, and applies the response
+func (c *Client) query() error {
+	c.notified = false
+	session, serial, synced := c.Session()
+
+	// a session can not continue with a different version
+	c.mu.RLock()
+	reset := !synced || c.dataVersion != c.version
+	c.mu.RUnlock()
+	for {
+		q := &pdu{Version: c.version, Type: typeResetQuery}
+		if !reset {
+			q = &pdu{Version: c.version, Type: typeSerialQuery, Session: session, Serial: serial}
+		}
+		if _, err := c.conn.Write(q.marshal()); err != nil {
+			return err
+		}
+
+		err := c.response(reset, session)
+		if err != errCacheReset {
+			return err
+		}
+		reset = true
+	}
+}
+
+// errCacheReset is returned by response when the cache can not provide
+// incremental updates
+var errCacheReset = fmt.Errorf("cache reset")
+
+// response reads the response to a query up to it's End of Data, then
+// applies it
+func (c *Client) response(reset bool, session uint16) error {
+	var announced, withdrawn []rpki.VRP
+	started := false
+	for {
+		p, err := readPDU(c.reader)
+		if err != nil {
+			if started {
+				c.report(CorruptData, p, err.Error())
+			}
+			return err
+		}
+
+		if p.Type == typeErrorReport {
+			return &ErrorReport{Code: p.Session, Text: p.Text}
+		}
+		if p.Version != c.version {
+			return c.report(UnexpectedVersion, p, fmt.Sprintf("received version %d during a version %d session", p.Version, c.version))
+		}
+
+		switch p.Type {
+		case typeSerialNotify:
+			c.notified = true
+		case typeCacheReset:
+			if started || reset {
+				return c.report(InvalidRequest, p, "unexpected Cache Reset")
+			}
+			return errCacheReset
+		case typeCacheResponse:
+			if started || !reset && p.Session != session {
+				return c.report(CorruptData, p, "unexpected Cache Response")
+			}
+			started, session = true, p.Session
+		case typeIPv4Prefix, typeIPv6Prefix:
+			if !started {
+				return c.report(CorruptData, p, "prefix before Cache Response")
+			}
+			if p.Announce {
+				announced = append(announced, p.VRP)
+			} else if reset {
+				return c.report(CorruptData, p, "withdrawal in response to a Reset Query")
+			} else {
+				withdrawn = append(withdrawn, p.VRP)
+			}
+		case typeRouterKey:
+			// router keys are for BGPsec, which the VRP table has no use for
+		case typeEndOfData:
+			if !started || p.Session != session {
+				return c.report(CorruptData, p, "unexpected End of Data")
+			}
+			return c.apply(reset, p, announced, withdrawn)
+		default:
+			return c.report(UnsupportedPDUType, p, fmt.Sprintf("unsupported PDU type %d", p.Type))
+		}
+	}
+}
+
+// apply applies the announcements and withdrawals of a response, which
+// succeeds or fails as a whole
+func (c *Client) apply(reset bool, end *pdu, announced, withdrawn []rpki.VRP) error {
+	vrps := make(map[string]rpki.VRP)
+	if !reset {
+		c.mu.RLock()
+		for key, vrp := range c.vrps {
+			vrps[key] = vrp
+		}
+		c.mu.RUnlock()
+	}
+
+	for _, vrp := range withdrawn {
+		key := vrpKey(vrp)
+		if _, ok := vrps[key]; !ok {
+			return c.report(WithdrawalOfUnknownRecord, prefixPDU(c.version, vrp, false), vrp.String())
+		}
+		delete(vrps, key)
+	}
+	for _, vrp := range announced {
+		key := vrpKey(vrp)
+		if _, ok := vrps[key]; ok {
+			return c.report(DuplicateAnnouncement, prefixPDU(c.version, vrp, true), vrp.String())
+		}
+		vrps[key] = vrp
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.vrps, c.validator = vrps, nil
+	c.session, c.serial, c.synced, c.updated = end.Session, end.Serial, true, time.Now()
+	c.dataVersion = end.Version
+	if end.Version > 0 {
+		// the cache's timers are clamped to the ranges of RFC 8210 section 6,
+		// so a refresh or retry of zero can not make Run query continuously
+		c.refresh = clamp(end.Refresh, 1, 86400)
+		c.retry = clamp(end.Retry, 1, 7200)
+		c.expire = clamp(end.Expire, 600, 172800)
+	}
+
+	return nil
+}
+
+// clamp returns the interval of seconds limited to the range min to max
+func clamp(seconds, min, max uint32) time.Duration {
+	if seconds < min {
+		seconds = min
+	} else if seconds > max {
+		seconds = max
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// report sends an Error Report for a PDU to the cache and returns it as an
+// error
+func (c *Client) report(code uint16, p *pdu, text string) error {
+	e := &pdu{Version: c.version, Type: typeErrorReport, Session: code, Text: text}
+	if p != nil {
+		e.PDU = p.marshal()
+	}
+	c.conn.Write(e.marshal())
+
+	return &ErrorReport{Code: code, Text: text}
+}
+
+// prefixPDU returns the IPv4 or IPv6 prefix PDU announcing or withdrawing the
+// VRP
+func prefixPDU(version uint8, vrp rpki.VRP, announce bool) *pdu {
+	t := typeIPv4Prefix
+	if vrp.Prefix.IP.To4() == nil {
+		t = typeIPv6Prefix
+	}
+
+	return &pdu{Version: version, Type: t, Announce: announce, VRP: vrp}
+}
+
+// vrpKey identifies a VRP, so that announcements and withdrawals of the same
+// VRP can be matched
+func vrpKey(vrp rpki.VRP) string {
+	ones, _ := vrp.Prefix.Mask.Size()
+	return fmt.Sprintf("%x/%03d-%03d AS%010d", []byte(vrp.Prefix.IP.To16()), ones, vrp.MaxLength, vrp.ASN)
+}
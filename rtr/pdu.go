@@ -0,0 +1,189 @@
+package rtr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/kkirsche/rpsl/rpki"
+)
+
+// The PDU types of RFC 6810 and RFC 8210
+const (
+	typeSerialNotify  uint8 = 0
+	typeSerialQuery   uint8 = 1
+	typeResetQuery    uint8 = 2
+	typeCacheResponse uint8 = 3
+	typeIPv4Prefix    uint8 = 4
+	typeIPv6Prefix    uint8 = 6
+	typeEndOfData     uint8 = 7
+	typeCacheReset    uint8 = 8
+	typeRouterKey     uint8 = 9
+	typeErrorReport   uint8 = 10
+)
+
+const (
+	headerLength = 8
+	// maxPDULength limits the PDUs which are read, the largest valid PDUs
+	// are error reports, which are bounded by the text and PDU they contain
+	maxPDULength = 1 << 16
+)
+
+// pdu is a single protocol data unit, of which only the fields used by it's
+// type are set
+type pdu struct {
+	Version uint8
+	Type    uint8
+	// Session is the session ID, the error code of an error report, or zero
+	Session uint16
+
+	Serial                 uint32 // serial notify, serial query and end of data
+	Refresh, Retry, Expire uint32 // version 1 end of data
+	Announce               bool   // prefix flags, true to announce and false to withdraw
+	VRP                    rpki.VRP
+	PDU                    []byte // the erroneous PDU of an error report
+	Text                   string // the diagnostic text of an error report
+	Body                   []byte // the body of other PDUs, such as router keys
+}
+
+// readPDU reads a single PDU
+func readPDU(r io.Reader) (*pdu, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	p := &pdu{Version: header[0], Type: header[1], Session: binary.BigEndian.Uint16(header[2:])}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length < headerLength || length > maxPDULength {
+		return nil, fmt.Errorf("invalid PDU length %d", length)
+	}
+
+	body := make([]byte, length-headerLength)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	if err := p.unmarshal(body); err != nil {
+		return nil, fmt.Errorf("invalid PDU of type %d: %s", p.Type, err)
+	}
+
+	return p, nil
+}
+
+func (p *pdu) unmarshal(body []byte) error {
+	want := map[uint8]int{
+		typeSerialNotify:  4,
+		typeSerialQuery:   4,
+		typeResetQuery:    0,
+		typeCacheResponse: 0,
+		typeIPv4Prefix:    12,
+		typeIPv6Prefix:    24,
+		typeEndOfData:     4,
+		typeCacheReset:    0,
+	}
+	if p.Type == typeEndOfData && p.Version > 0 {
+		want[typeEndOfData] = 16
+	}
+	if n, ok := want[p.Type]; ok && len(body) != n {
+		return fmt.Errorf("length %d", len(body)+headerLength)
+	}
+
+	switch p.Type {
+	case typeSerialNotify, typeSerialQuery:
+		p.Serial = binary.BigEndian.Uint32(body)
+	case typeEndOfData:
+		p.Serial = binary.BigEndian.Uint32(body)
+		if p.Version > 0 {
+			p.Refresh = binary.BigEndian.Uint32(body[4:])
+			p.Retry = binary.BigEndian.Uint32(body[8:])
+			p.Expire = binary.BigEndian.Uint32(body[12:])
+		}
+	case typeIPv4Prefix, typeIPv6Prefix:
+		size := net.IPv4len
+		if p.Type == typeIPv6Prefix {
+			size = net.IPv6len
+		}
+
+		length, maxLength := int(body[1]), int(body[2])
+		if length > size*8 || maxLength < length || maxLength > size*8 {
+			return fmt.Errorf("prefix length %d and max length %d", length, maxLength)
+		}
+
+		ip := net.IP(append([]byte{}, body[4:4+size]...))
+		mask := net.CIDRMask(length, size*8)
+		p.Announce = body[0]&1 == 1
+		p.VRP = rpki.VRP{
+			Prefix:    &net.IPNet{IP: ip.Mask(mask), Mask: mask},
+			MaxLength: maxLength,
+			ASN:       binary.BigEndian.Uint32(body[4+size:]),
+		}
+	case typeErrorReport:
+		if len(body) < 4 {
+			return fmt.Errorf("length %d", len(body)+headerLength)
+		}
+		// the lengths are checked as uint64 so a length near the maximum
+		// uint32 cannot wrap around
+		n := binary.BigEndian.Uint32(body)
+		if uint64(n)+8 > uint64(len(body)) {
+			return fmt.Errorf("encapsulated PDU length %d", n)
+		}
+		p.PDU = body[4 : 4+n]
+
+		rest := body[4+n:]
+		n = binary.BigEndian.Uint32(rest)
+		if uint64(n)+4 != uint64(len(rest)) {
+			return fmt.Errorf("error text length %d", n)
+		}
+		p.Text = string(rest[4:])
+	default:
+		p.Body = body
+	}
+
+	return nil
+}
+
+// marshal returns the PDU in it's wire format
+func (p *pdu) marshal() []byte {
+	var body []byte
+	switch p.Type {
+	case typeSerialNotify, typeSerialQuery:
+		body = be32(p.Serial)
+	case typeEndOfData:
+		body = be32(p.Serial)
+		if p.Version > 0 {
+			body = append(append(append(body, be32(p.Refresh)...), be32(p.Retry)...), be32(p.Expire)...)
+		}
+	case typeIPv4Prefix, typeIPv6Prefix:
+		ones, _ := p.VRP.Prefix.Mask.Size()
+		var flags byte
+		if p.Announce {
+			flags = 1
+		}
+
+		ip := p.VRP.Prefix.IP.To4()
+		if p.Type == typeIPv6Prefix {
+			ip = p.VRP.Prefix.IP.To16()
+		}
+		body = append([]byte{flags, byte(ones), byte(p.VRP.MaxLength), 0}, ip...)
+		body = append(body, be32(p.VRP.ASN)...)
+	case typeErrorReport:
+		body = append(be32(uint32(len(p.PDU))), p.PDU...)
+		body = append(append(body, be32(uint32(len(p.Text)))...), p.Text...)
+	default:
+		body = p.Body
+	}
+
+	b := make([]byte, headerLength, headerLength+len(body))
+	b[0], b[1] = p.Version, p.Type
+	binary.BigEndian.PutUint16(b[2:], p.Session)
+	binary.BigEndian.PutUint32(b[4:], uint32(headerLength+len(body)))
+	return append(b, body...)
+}
+
+func be32(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
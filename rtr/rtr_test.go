@@ -0,0 +1,436 @@
+package rtr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/rpki"
+	"github.com/stretchr/testify/assert"
+)
+
+// change is an announcement or withdrawal of a VRP by the test cache
+type change struct {
+	vrp      rpki.VRP
+	announce bool
+}
+
+// testCache is an in-process RTR cache, serving VRPs over loopback TCP
+type testCache struct {
+	listener net.Listener
+	version  uint8 // the highest version supported
+
+	mu      sync.Mutex
+	session uint16
+	serial  uint32
+	vrps    []rpki.VRP
+	history map[uint32][]change // the changes from each serial to the current one
+	queries []uint8             // the type of each query received
+	conns   []net.Conn
+	// respond, if set, replaces the response to queries
+	respond func(w *bufio.Writer, q *pdu)
+}
+
+func newTestCache(t *testing.T, version uint8, vrps ...rpki.VRP) *testCache {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testCache{listener: l, version: version, session: 42, serial: 1, vrps: vrps, history: make(map[uint32][]change)}
+	go c.serve()
+	return c
+}
+
+func (c *testCache) client() *Client {
+	return NewClient(func() (net.Conn, error) {
+		return net.Dial("tcp", c.listener.Addr().String())
+	})
+}
+
+func (c *testCache) Close() {
+	c.listener.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+}
+
+func (c *testCache) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.conns = append(c.conns, conn)
+		c.mu.Unlock()
+		go c.handle(conn)
+	}
+}
+
+func (c *testCache) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		q, err := readPDU(r)
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.queries = append(c.queries, q.Type)
+		if q.Version > c.version {
+			w.Write((&pdu{Version: c.version, Type: typeErrorReport, Session: UnsupportedVersion, PDU: q.marshal(), Text: "version 1 is not supported"}).marshal())
+			w.Flush()
+			c.mu.Unlock()
+			return
+		}
+
+		switch {
+		case c.respond != nil:
+			c.respond(w, q)
+		case q.Type == typeResetQuery:
+			w.Write((&pdu{Version: q.Version, Type: typeCacheResponse, Session: c.session}).marshal())
+			for _, vrp := range c.vrps {
+				w.Write(prefixPDU(q.Version, vrp, true).marshal())
+			}
+			c.endOfData(w, q.Version)
+		case q.Type == typeSerialQuery:
+			changes, ok := c.history[q.Serial]
+			if !ok && q.Serial != c.serial || q.Session != c.session {
+				w.Write((&pdu{Version: q.Version, Type: typeCacheReset}).marshal())
+				break
+			}
+
+			w.Write((&pdu{Version: q.Version, Type: typeCacheResponse, Session: c.session}).marshal())
+			for _, ch := range changes {
+				w.Write(prefixPDU(q.Version, ch.vrp, ch.announce).marshal())
+			}
+			c.endOfData(w, q.Version)
+		}
+		w.Flush()
+		c.mu.Unlock()
+	}
+}
+
+func (c *testCache) endOfData(w *bufio.Writer, version uint8) {
+	w.Write((&pdu{Version: version, Type: typeEndOfData, Session: c.session, Serial: c.serial, Refresh: 1, Retry: 1, Expire: 600}).marshal())
+}
+
+// update applies changes to the cache's VRPs under a new serial, then
+// notifies the connected clients
+func (c *testCache) update(changes ...change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for serial := range c.history {
+		c.history[serial] = append(c.history[serial], changes...)
+	}
+	c.history[c.serial] = changes
+	c.serial++
+
+	for _, ch := range changes {
+		if ch.announce {
+			c.vrps = append(c.vrps, ch.vrp)
+			continue
+		}
+		for i, vrp := range c.vrps {
+			if vrpKey(vrp) == vrpKey(ch.vrp) {
+				c.vrps = append(c.vrps[:i], c.vrps[i+1:]...)
+				break
+			}
+		}
+	}
+
+	for _, conn := range c.conns {
+		conn.Write((&pdu{Version: c.version, Type: typeSerialNotify, Session: c.session, Serial: c.serial}).marshal())
+	}
+}
+
+func (c *testCache) queryTypes() []uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]uint8{}, c.queries...)
+}
+
+func vrp(s string, maxLength int, asn uint32) rpki.VRP {
+	ipnet, err := prefix.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return rpki.VRP{Prefix: ipnet, MaxLength: maxLength, ASN: asn}
+}
+
+func vrpStrings(vrps []rpki.VRP) []string {
+	var result []string
+	for _, v := range vrps {
+		result = append(result, v.String())
+	}
+
+	return result
+}
+
+func TestPDU(t *testing.T) {
+	pdus := []*pdu{
+		{Version: 1, Type: typeSerialNotify, Session: 7, Serial: 9},
+		{Version: 1, Type: typeSerialQuery, Session: 7, Serial: 9},
+		{Version: 0, Type: typeResetQuery},
+		{Version: 1, Type: typeCacheResponse, Session: 7},
+		prefixPDU(1, vrp("192.0.2.0/24", 26, 65537), true),
+		prefixPDU(1, vrp("2001:db8::/32", 48, 65538), false),
+		{Version: 0, Type: typeEndOfData, Session: 7, Serial: 9},
+		{Version: 1, Type: typeEndOfData, Session: 7, Serial: 9, Refresh: 1, Retry: 2, Expire: 3},
+		{Version: 1, Type: typeCacheReset},
+		{Version: 1, Type: typeRouterKey, Body: make([]byte, 28)},
+		{Version: 1, Type: typeErrorReport, Session: CorruptData, PDU: []byte{1, 2}, Text: "bad"},
+	}
+
+	for _, p := range pdus {
+		b := p.marshal()
+		parsed, err := readPDU(bytes.NewReader(b))
+		if assert.NoError(t, err, "type %d", p.Type) {
+			assert.Equal(t, b, parsed.marshal(), "type %d", p.Type)
+		}
+	}
+
+	parsed, err := readPDU(bytes.NewReader(prefixPDU(1, vrp("2001:db8::/32", 48, 65538), true).marshal()))
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.Announce)
+		assert.Equal(t, "2001:db8::/32-48 AS65538", parsed.VRP.String())
+	}
+
+	_, err = readPDU(bytes.NewReader([]byte{1, typeIPv4Prefix, 0, 0, 0, 0, 0, 20, 1, 33, 33, 0, 192, 0, 2, 0, 0, 0, 0, 1}))
+	assert.EqualError(t, err, "invalid PDU of type 4: prefix length 33 and max length 33")
+
+	_, err = readPDU(bytes.NewReader([]byte{1, typeResetQuery, 0, 0, 0, 0, 0, 4}))
+	assert.EqualError(t, err, "invalid PDU length 4")
+
+	// error reports whose lengths would overflow a uint32 or run past the PDU
+	_, err = readPDU(bytes.NewReader([]byte{1, typeErrorReport, 0, 0, 0, 0, 0, 16, 0xff, 0xff, 0xff, 0xf8, 0, 0, 0, 0}))
+	assert.EqualError(t, err, "invalid PDU of type 10: encapsulated PDU length 4294967288")
+	_, err = readPDU(bytes.NewReader([]byte{1, typeErrorReport, 0, 0, 0, 0, 0, 16, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xfc}))
+	assert.EqualError(t, err, "invalid PDU of type 10: error text length 4294967292")
+	_, err = readPDU(bytes.NewReader([]byte{1, typeErrorReport, 0, 0, 0, 0, 0, 17, 0, 0, 0, 0, 0, 0, 0, 2, 'x'}))
+	assert.EqualError(t, err, "invalid PDU of type 10: error text length 2")
+}
+
+func TestSync(t *testing.T) {
+	cache := newTestCache(t, Version1, vrp("192.0.2.0/24", 24, 65537), vrp("2001:db8::/32", 48, 65538))
+	defer cache.Close()
+
+	c := cache.client()
+	defer c.Close()
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+	assert.Equal(t, []string{"192.0.2.0/24 AS65537", "2001:db8::/32-48 AS65538"}, vrpStrings(c.VRPs()))
+	session, serial, synced := c.Session()
+	assert.Equal(t, uint16(42), session)
+	assert.Equal(t, uint32(1), serial)
+	assert.True(t, synced)
+
+	state, _ := c.Validator().Validate(vrp("2001:db8:1::/48", 0, 0).Prefix, 65538)
+	assert.Equal(t, rpki.Valid, state)
+
+	// incremental updates are requested with a Serial Query
+	cache.update(
+		change{vrp("198.51.100.0/24", 24, 65539), true},
+		change{vrp("192.0.2.0/24", 24, 65537), false},
+	)
+	cache.update(change{vrp("203.0.113.0/24", 32, 65540), true})
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+	assert.Equal(t, []string{"198.51.100.0/24 AS65539", "203.0.113.0/24-32 AS65540", "2001:db8::/32-48 AS65538"}, vrpStrings(c.VRPs()))
+	_, serial, _ = c.Session()
+	assert.Equal(t, uint32(3), serial)
+	assert.Equal(t, []uint8{typeResetQuery, typeSerialQuery}, cache.queryTypes())
+
+	state, _ = c.Validator().Validate(vrp("192.0.2.0/24", 0, 0).Prefix, 65537)
+	assert.Equal(t, rpki.NotFound, state)
+}
+
+func TestSyncCacheReset(t *testing.T) {
+	cache := newTestCache(t, Version1, vrp("192.0.2.0/24", 24, 65537))
+	defer cache.Close()
+
+	c := cache.client()
+	defer c.Close()
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+
+	// the cache no longer has the changes since the client's serial
+	cache.update(change{vrp("198.51.100.0/24", 24, 65539), true})
+	cache.mu.Lock()
+	cache.history = make(map[uint32][]change)
+	cache.mu.Unlock()
+
+	if assert.NoError(t, c.Sync()) {
+		assert.Equal(t, []string{"192.0.2.0/24 AS65537", "198.51.100.0/24 AS65539"}, vrpStrings(c.VRPs()))
+		assert.Equal(t, []uint8{typeResetQuery, typeSerialQuery, typeResetQuery}, cache.queryTypes())
+	}
+}
+
+func TestSyncVersion0(t *testing.T) {
+	cache := newTestCache(t, Version0, vrp("192.0.2.0/24", 24, 65537))
+	defer cache.Close()
+
+	c := cache.client()
+	defer c.Close()
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+	assert.Equal(t, Version0, c.version)
+	assert.Equal(t, []string{"192.0.2.0/24 AS65537"}, vrpStrings(c.VRPs()))
+
+	// version 0 End of Data does not carry timers, so the defaults are kept
+	refresh, retry := c.timers()
+	assert.Equal(t, DefaultRefresh, refresh)
+	assert.Equal(t, DefaultRetry, retry)
+
+	cache.update(change{vrp("198.51.100.0/24", 24, 65539), true})
+	if assert.NoError(t, c.Sync()) {
+		assert.Equal(t, []string{"192.0.2.0/24 AS65537", "198.51.100.0/24 AS65539"}, vrpStrings(c.VRPs()))
+		assert.Equal(t, []uint8{typeResetQuery, typeResetQuery, typeSerialQuery}, cache.queryTypes())
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	cache := newTestCache(t, Version1, vrp("192.0.2.0/24", 24, 65537))
+	defer cache.Close()
+
+	c := cache.client()
+	defer c.Close()
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+
+	tests := []struct {
+		respond  func(w *bufio.Writer, q *pdu)
+		expected string
+	}{
+		{
+			func(w *bufio.Writer, q *pdu) {
+				w.Write((&pdu{Version: 1, Type: typeErrorReport, Session: NoDataAvailable}).marshal())
+			},
+			"rtr: no data available",
+		},
+		{
+			// the whole update is rejected when one of it's changes is invalid
+			func(w *bufio.Writer, q *pdu) {
+				w.Write((&pdu{Version: 1, Type: typeCacheResponse, Session: 42}).marshal())
+				w.Write(prefixPDU(1, vrp("198.51.100.0/24", 24, 65539), true).marshal())
+				w.Write(prefixPDU(1, vrp("203.0.113.0/24", 24, 65539), false).marshal())
+				w.Write((&pdu{Version: 1, Type: typeEndOfData, Session: 42, Serial: 2}).marshal())
+			},
+			"rtr: withdrawal of unknown record: 203.0.113.0/24 AS65539",
+		},
+		{
+			func(w *bufio.Writer, q *pdu) {
+				w.Write((&pdu{Version: 1, Type: typeCacheResponse, Session: 42}).marshal())
+				w.Write(prefixPDU(1, vrp("192.0.2.0/24", 24, 65537), true).marshal())
+				w.Write((&pdu{Version: 1, Type: typeEndOfData, Session: 42, Serial: 2}).marshal())
+			},
+			"rtr: duplicate announcement received: 192.0.2.0/24 AS65537",
+		},
+		{
+			func(w *bufio.Writer, q *pdu) {
+				w.Write((&pdu{Version: 1, Type: typeCacheResponse, Session: 43}).marshal())
+			},
+			"rtr: corrupt data: unexpected Cache Response",
+		},
+		{
+			func(w *bufio.Writer, q *pdu) {
+				w.Write((&pdu{Version: 0, Type: typeCacheResponse, Session: 42}).marshal())
+			},
+			"rtr: unexpected protocol version: received version 0 during a version 1 session",
+		},
+	}
+
+	for _, tt := range tests {
+		cache.mu.Lock()
+		cache.respond = tt.respond
+		cache.mu.Unlock()
+
+		assert.EqualError(t, c.Sync(), tt.expected)
+		assert.Equal(t, []string{"192.0.2.0/24 AS65537"}, vrpStrings(c.VRPs()))
+		_, serial, _ := c.Session()
+		assert.Equal(t, uint32(1), serial)
+	}
+}
+
+func TestSyncTimers(t *testing.T) {
+	cache := newTestCache(t, Version1)
+	defer cache.Close()
+
+	// timers outside the ranges of RFC 8210 are clamped
+	cache.respond = func(w *bufio.Writer, q *pdu) {
+		w.Write((&pdu{Version: 1, Type: typeCacheResponse, Session: 42}).marshal())
+		w.Write((&pdu{Version: 1, Type: typeEndOfData, Session: 42, Serial: 1, Refresh: 0, Retry: 0, Expire: 1 << 31}).marshal())
+	}
+
+	c := cache.client()
+	defer c.Close()
+
+	if !assert.NoError(t, c.Sync()) {
+		return
+	}
+
+	refresh, retry := c.timers()
+	assert.Equal(t, time.Second, refresh)
+	assert.Equal(t, time.Second, retry)
+	assert.Equal(t, 48*time.Hour, c.expire)
+}
+
+func TestRun(t *testing.T) {
+	cache := newTestCache(t, Version1, vrp("192.0.2.0/24", 24, 65537))
+	defer cache.Close()
+
+	c := cache.client()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	// the client queries the cache when it is notified of new data
+	waitFor(t, func() bool { return len(c.VRPs()) == 1 })
+	cache.update(change{vrp("198.51.100.0/24", 24, 65539), true})
+	waitFor(t, func() bool { return len(c.VRPs()) == 2 })
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
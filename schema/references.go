@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Reference is a reference from an attribute of one object to another object
+type Reference struct {
+	Attribute token.Type   // the referencing attribute, e.g. token.ATTR_MAINTAINED_BY
+	Classes   []token.Type // the classes the referenced object may belong to
+	Key       string       // the primary key of the referenced object, upper-cased
+}
+
+// ClassNames names the classes the referenced object may belong to, e.g.
+// person or role
+func (r Reference) ClassNames() string {
+	names := make([]string, len(r.Classes))
+	for i, class := range r.Classes {
+		names[i] = class.Name()
+	}
+
+	return strings.Join(names, " or ")
+}
+
+var (
+	mntner   = []token.Type{token.CLASS_MAINTAINER}
+	contact  = []token.Type{token.CLASS_PERSON, token.CLASS_ROLE}
+	keyCert  = []token.Type{token.CLASS_KEY_CERT}
+	autNum   = []token.Type{token.CLASS_AUT_NUM}
+	asSet    = []token.Type{token.CLASS_AS_SET}
+	routeSet = []token.Type{token.CLASS_ROUTE_SET}
+)
+
+// References returns the references an object makes to other objects: mntners
+// by mnt-by, mnt-lower, mnt-routes and mbrs-by-ref, person and role objects by
+// admin-c and tech-c, key-certs by auth, sets by member-of, members and
+// mp-members, and aut-nums by origin. AS number and prefix members of sets are
+// not references.
+func References(obj *ast.Object) []Reference {
+	if len(obj.Attributes) == 0 {
+		return nil
+	}
+
+	var refs []Reference
+	add := func(attr token.Type, classes []token.Type, key string) {
+		if key != "" {
+			refs = append(refs, Reference{Attribute: attr, Classes: classes, Key: strings.ToUpper(key)})
+		}
+	}
+
+	for _, attr := range obj.Attributes[1:] {
+		t := attr.Token.Type
+		tokens := valueTokens(attr)
+		switch t {
+		case token.ATTR_MAINTAINED_BY, token.ATTR_MAINTAINER_LOWER:
+			for _, tok := range tokens {
+				add(t, mntner, tok.Literal)
+			}
+		case token.ATTR_MEMBERS_BY_REFERENCE:
+			for _, tok := range tokens {
+				if !strings.EqualFold(tok.Literal, "ANY") {
+					add(t, mntner, tok.Literal)
+				}
+			}
+		case token.ATTR_MAINTAINER_ROUTES:
+			for _, name := range mntRoutesNames(joinLines(attr)) {
+				add(t, mntner, name)
+			}
+		case token.ATTR_ADMIN_CONTACT, token.ATTR_TECHNICAL_CONTACT:
+			for _, tok := range tokens {
+				add(t, contact, tok.Literal)
+			}
+		case token.ATTR_AUTHENTICATION:
+			if len(tokens) == 0 {
+				continue
+			}
+			switch tok := tokens[0]; {
+			case tok.Type == token.DATA_PGP_KEY:
+				add(t, keyCert, "PGPKEY-"+tok.Literal)
+			case tok.Type == token.DATA_AUTH && keyCertPattern.MatchString(tok.Literal):
+				add(t, keyCert, tok.Literal)
+			}
+		case token.ATTR_ORIGIN:
+			for _, tok := range tokens {
+				add(t, autNum, tok.Literal)
+			}
+		case token.ATTR_MEMBER_OF_ROUTE_SET, token.ATTR_AS_SET_MEMBERS, token.ATTR_MULTI_PROTO_MEMBERS:
+			for _, tok := range tokens {
+				// set members may carry a range operator, e.g. RS-FOO^24
+				name := strings.SplitN(tok.Literal, "^", 2)[0]
+				if classes := setClass(name); classes != nil {
+					add(t, classes, name)
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// valueTokens returns the value tokens of an attribute and it's continuation
+// lines
+func valueTokens(attr *ast.Attribute) []token.Token {
+	tokens := attr.Values
+	for _, cont := range attr.Continuations {
+		tokens = append(tokens[:len(tokens):len(tokens)], cont.Values...)
+	}
+
+	return tokens
+}
+
+// mntRoutesNames returns the mntners of a mnt-routes value, e.g. TEST-MNT for
+// TEST-MNT {192.0.2.0/24^+}
+func mntRoutesNames(value string) []string {
+	if i := strings.Index(value, "{"); i >= 0 {
+		value = value[:i]
+	}
+
+	var names []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+		if !strings.EqualFold(name, "ANY") {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// setClass returns the class of a set name, or nil if the name is not a set
+func setClass(name string) []token.Type {
+	switch {
+	case setName("AS-")(name) == nil:
+		return asSet
+	case setName("RS-")(name) == nil:
+		return routeSet
+	}
+
+	return nil
+}
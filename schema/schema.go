@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// Attribute describes how an attribute may be used within an object class
+type Attribute struct {
+	Type      token.Type
+	Mandatory bool // the attribute must appear at least once
+	Multiple  bool // the attribute may appear more than once
+}
+
+// Class describes the attributes which make up an object class
+type Class struct {
+	Type       token.Type
+	Attributes []Attribute // in the order they are conventionally written
+}
+
+// the attributes shared by every class, appended to the end of each class
+var common = []Attribute{
+	{Type: token.ATTR_REMARKS, Multiple: true},
+	{Type: token.ATTR_NOTIFY_EMAIL, Multiple: true},
+	{Type: token.ATTR_MAINTAINED_BY, Mandatory: true, Multiple: true},
+	{Type: token.ATTR_CHANGED_AT_AND_BY, Multiple: true},
+	{Type: token.ATTR_REGISTRY_SOURCE, Mandatory: true},
+}
+
+// classes are based on RFC 2622, RFC 2725 and RFC 4012. The changed attribute
+// is mandatory in RFC 2622, however it is optional here as modern registries
+// such as IRRd and the RIPE database have deprecated it.
+var classes = map[token.Type]*Class{
+	token.CLASS_MAINTAINER: newClass(token.CLASS_MAINTAINER,
+		Attribute{Type: token.ATTR_DESCRIPTION, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Multiple: true},
+		Attribute{Type: token.ATTR_UPDATED_TO_EMAIL, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_NOTIFY_EMAIL, Multiple: true},
+		Attribute{Type: token.ATTR_AUTHENTICATION, Mandatory: true, Multiple: true},
+	),
+	token.CLASS_KEY_CERT: newClass(token.CLASS_KEY_CERT,
+		Attribute{Type: token.ATTR_METHOD},
+		Attribute{Type: token.ATTR_OWNER, Multiple: true},
+		Attribute{Type: token.ATTR_FINGERPRINT},
+		Attribute{Type: token.ATTR_CERTIFICATE, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Multiple: true},
+	),
+	token.CLASS_PERSON: newClass(token.CLASS_PERSON,
+		Attribute{Type: token.ATTR_ADDRESS, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_PHONE_NUMBER, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_FAX_NUMBER, Multiple: true},
+		Attribute{Type: token.ATTR_EMAIL, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_NIC_HANDLE, Mandatory: true},
+	),
+	token.CLASS_ROLE: newClass(token.CLASS_ROLE,
+		Attribute{Type: token.ATTR_ADDRESS, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_PHONE_NUMBER, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_FAX_NUMBER, Multiple: true},
+		Attribute{Type: token.ATTR_EMAIL, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Multiple: true},
+		Attribute{Type: token.ATTR_NIC_HANDLE, Mandatory: true},
+	),
+	token.CLASS_AUT_NUM: newClass(token.CLASS_AUT_NUM,
+		Attribute{Type: token.ATTR_AS_NAME, Mandatory: true},
+		Attribute{Type: token.ATTR_DESCRIPTION, Multiple: true},
+		Attribute{Type: token.ATTR_MEMBER_OF_ROUTE_SET, Multiple: true},
+		Attribute{Type: token.ATTR_IMPORT, Multiple: true},
+		Attribute{Type: token.ATTR_EXPORT, Multiple: true},
+		Attribute{Type: token.ATTR_MULTI_PROTO_IMPORT_POLICY, Multiple: true},
+		Attribute{Type: token.ATTR_MULTI_PROTO_EXPORT_POLICY, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_LOWER, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_ROUTES, Multiple: true},
+	),
+	token.CLASS_AS_SET: newClass(token.CLASS_AS_SET,
+		Attribute{Type: token.ATTR_DESCRIPTION, Multiple: true},
+		Attribute{Type: token.ATTR_AS_SET_MEMBERS, Multiple: true},
+		Attribute{Type: token.ATTR_MEMBERS_BY_REFERENCE, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_LOWER, Multiple: true},
+	),
+	token.CLASS_ROUTE_SET: newClass(token.CLASS_ROUTE_SET,
+		Attribute{Type: token.ATTR_DESCRIPTION, Multiple: true},
+		Attribute{Type: token.ATTR_AS_SET_MEMBERS, Multiple: true},
+		Attribute{Type: token.ATTR_MULTI_PROTO_MEMBERS, Multiple: true},
+		Attribute{Type: token.ATTR_MEMBERS_BY_REFERENCE, Multiple: true},
+		Attribute{Type: token.ATTR_ADMIN_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_TECHNICAL_CONTACT, Mandatory: true, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_LOWER, Multiple: true},
+	),
+	token.CLASS_ROUTE: newClass(token.CLASS_ROUTE,
+		Attribute{Type: token.ATTR_DESCRIPTION, Multiple: true},
+		Attribute{Type: token.ATTR_ORIGIN, Mandatory: true},
+		Attribute{Type: token.ATTR_MEMBER_OF_ROUTE_SET, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_LOWER, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_ROUTES, Multiple: true},
+	),
+	token.CLASS_ROUTE6: newClass(token.CLASS_ROUTE6,
+		Attribute{Type: token.ATTR_DESCRIPTION, Multiple: true},
+		Attribute{Type: token.ATTR_ORIGIN, Mandatory: true},
+		Attribute{Type: token.ATTR_MEMBER_OF_ROUTE_SET, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_LOWER, Multiple: true},
+		Attribute{Type: token.ATTR_MAINTAINER_ROUTES, Multiple: true},
+	),
+}
+
+func newClass(t token.Type, attrs ...Attribute) *Class {
+	c := &Class{Type: t}
+	c.Attributes = append(c.Attributes, Attribute{Type: t, Mandatory: true})
+	c.Attributes = append(c.Attributes, attrs...)
+	c.Attributes = append(c.Attributes, common...)
+	return c
+}
+
+// Lookup returns the schema for the given object class
+func Lookup(class token.Type) (*Class, bool) {
+	c, ok := classes[class]
+	return c, ok
+}
+
+// Attribute returns the definition of the given attribute within the class
+func (c *Class) Attribute(t token.Type) (Attribute, bool) {
+	for _, attr := range c.Attributes {
+		if attr.Type == t {
+			return attr, true
+		}
+	}
+
+	return Attribute{}, false
+}
+
+// Validate checks the object against the schema of it's class, returning
+// every problem found. This includes attributes which are not permitted in
+// the class, missing mandatory attributes, repeated single-valued attributes
+// and attribute values with invalid syntax.
+func Validate(obj *ast.Object) []error {
+	c, ok := Lookup(obj.Class())
+	if !ok {
+		return []error{fmt.Errorf("unsupported object class %s", obj.Class())}
+	}
+
+	var errs []error
+	counts := make(map[token.Type]int)
+	for _, attr := range obj.Attributes {
+		t := attr.Token.Type
+		counts[t]++
+
+		def, ok := c.Attribute(t)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("line %d: attribute %s is not permitted in %s objects", attr.Token.Line, t.Name(), c.Type.Name()))
+			continue
+		case !def.Multiple && counts[t] == 2:
+			errs = append(errs, fmt.Errorf("line %d: attribute %s may only appear once", attr.Token.Line, t.Name()))
+		}
+
+		if err := ValidateValue(t, joinLines(attr)); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s", attr.Token.Line, err))
+		}
+	}
+
+	for _, def := range c.Attributes {
+		if def.Mandatory && counts[def.Type] == 0 {
+			errs = append(errs, fmt.Errorf("mandatory attribute %s is missing", def.Type.Name()))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,152 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	input := `route:          192.0.2.0/24
+descr:          example route
+origin:         AS65537
+origin:         AS65538
+admin-c:        PERSON-TEST
+source:         TEST
+`
+
+	objects, err := parser.Parse("schema", input)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	errs := Validate(objects[0])
+	if !assert.Len(t, errs, 3) {
+		t.FailNow()
+	}
+
+	assert.EqualError(t, errs[0], "line 4: attribute origin may only appear once")
+	assert.EqualError(t, errs[1], "line 5: attribute admin-c is not permitted in route objects")
+	assert.EqualError(t, errs[2], "mandatory attribute mnt-by is missing")
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		typ   token.Type
+		value string
+		valid bool
+	}{
+		{token.CLASS_ROUTE, "192.0.2.0/24", true},
+		{token.CLASS_ROUTE, "2001:db8::/32", false},
+		{token.CLASS_ROUTE6, "2001:db8::/32", true},
+		{token.CLASS_AS_SET, "AS-FOO", true},
+		{token.CLASS_AS_SET, "AS65537:AS-FOO", true},
+		{token.CLASS_AS_SET, "RS-FOO", false},
+		{token.CLASS_ROUTE_SET, "RS-FOO", true},
+		{token.CLASS_KEY_CERT, "PGPKEY-80F238C6", true},
+		{token.CLASS_KEY_CERT, "PGPKEY-80F238", false},
+		{token.CLASS_KEY_CERT, "X509-1", true},
+		{token.CLASS_KEY_CERT, "X509-ONE", false},
+		{token.ATTR_ORIGIN, "AS65537", true},
+		{token.ATTR_ORIGIN, "AS4294967296", false},
+		{token.ATTR_ORIGIN, "65537", false},
+		{token.ATTR_MAINTAINED_BY, "TEST-MNT, OTHER-MNT", true},
+		{token.ATTR_MAINTAINED_BY, "1-MNT", false},
+		{token.ATTR_MAINTAINER_LOWER, "TEST-MNT", true},
+		{token.ATTR_MAINTAINER_ROUTES, "TEST-MNT, OTHER-MNT", true},
+		{token.ATTR_MAINTAINER_ROUTES, "TEST-MNT ANY", true},
+		{token.ATTR_MAINTAINER_ROUTES, "TEST-MNT {192.0.2.0/24^+, 2001:db8::/32^48}", true},
+		{token.ATTR_MAINTAINER_ROUTES, "TEST-MNT {192.0.2.0/24^+", false},
+		{token.ATTR_MAINTAINER_ROUTES, "TEST-MNT {AS65537}", false},
+		{token.ATTR_AS_SET_MEMBERS, "AS65537, AS-FOO, 192.0.2.0/24^+, RS-BAR^24-32", true},
+		{token.ATTR_AS_SET_MEMBERS, "192.0.2.0/24^33-", false},
+		{token.ATTR_CHANGED_AT_AND_BY, "changed@example.com 20190701", true},
+		{token.ATTR_CHANGED_AT_AND_BY, "changed@example.com 2019", false},
+		{token.ATTR_PHONE_NUMBER, "+31 20 000 0000 ext. 12", true},
+		{token.ATTR_AUTHENTICATION, "PGPKey-80F238C6", true},
+		{token.ATTR_AUTHENTICATION, "PLAIN secret", false},
+		{token.ATTR_AUTHENTICATION, "X509-1", true},
+		{token.ATTR_AUTHENTICATION, "SSO 3f2504e0-4f89-11d3-9a0c-0305e82c3301", true},
+		{token.ATTR_AUTHENTICATION, "BCRYPT-PW $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", true},
+		{token.ATTR_AUTHENTICATION, "SSO not-a-uuid", false},
+		{token.ATTR_DESCRIPTION, "", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateValue(tt.typ, tt.value)
+		assert.Equal(t, tt.valid, err == nil, "%s %q: %v", tt.typ.Name(), tt.value, err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	input := `route-set:      RS-TEST
+members:        RS-OTHER^+, 192.0.2.0/24, AS65537:AS-CUSTOMERS
+mp-members:     2001:db8::/32,
++               AS65537:RS-V6
+mbrs-by-ref:    ANY
+admin-c:        TP1-TEST
+tech-c:         TP1-TEST, TP2-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+
+mntner:         TEST-MNT
+admin-c:        TP1-TEST
+auth:           PGPKEY-80F238C6
+auth:           X509-1
+auth:           MAIL-FROM noc@example\.com
+mnt-by:         TEST-MNT
+source:         TEST
+
+route:          192.0.2.0/24
+origin:         AS65537
+member-of:      RS-TEST
+mnt-routes:     CUSTOMER-MNT, OTHER-MNT {192.0.2.0/24^+}
+mnt-by:         TEST-MNT
+source:         TEST
+`
+
+	objects, err := parser.Parse("references", input)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 3) {
+		t.FailNow()
+	}
+
+	type ref struct {
+		attr  string
+		class string
+		key   string
+	}
+	tests := [][]ref{
+		{
+			{"members", "route-set", "RS-OTHER"},
+			{"members", "as-set", "AS65537:AS-CUSTOMERS"},
+			{"mp-members", "route-set", "AS65537:RS-V6"},
+			{"admin-c", "person or role", "TP1-TEST"},
+			{"tech-c", "person or role", "TP1-TEST"},
+			{"tech-c", "person or role", "TP2-TEST"},
+			{"mnt-by", "mntner", "TEST-MNT"},
+		},
+		{
+			{"admin-c", "person or role", "TP1-TEST"},
+			{"auth", "key-cert", "PGPKEY-80F238C6"},
+			{"auth", "key-cert", "X509-1"},
+			{"mnt-by", "mntner", "TEST-MNT"},
+		},
+		{
+			{"origin", "aut-num", "AS65537"},
+			{"member-of", "route-set", "RS-TEST"},
+			{"mnt-routes", "mntner", "CUSTOMER-MNT"},
+			{"mnt-routes", "mntner", "OTHER-MNT"},
+			{"mnt-by", "mntner", "TEST-MNT"},
+		},
+	}
+
+	for i, expected := range tests {
+		var refs []ref
+		for _, r := range References(objects[i]) {
+			refs = append(refs, ref{r.Attribute.Name(), r.ClassNames(), r.Key})
+		}
+		assert.Equal(t, expected, refs, objects[i].Name())
+	}
+}
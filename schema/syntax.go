@@ -0,0 +1,294 @@
+package schema
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/token"
+)
+
+var (
+	asnPattern        = regexp.MustCompile(`(?i)^AS[0-9]+$`)
+	objectNamePattern = regexp.MustCompile(`(?i)^[a-z][a-z0-9_-]*$`)
+	datePattern       = regexp.MustCompile(`^[0-9]{8}$`)
+	phonePattern      = regexp.MustCompile(`(?i)^\+[0-9][0-9 ]*( ext\. [0-9]+)?$`)
+	rangePattern      = regexp.MustCompile(`^\^([+-]|[0-9]+(-[0-9]+)?)$`)
+	keyCertPattern    = regexp.MustCompile(`(?i)^(PGPKEY-[0-9a-f]{8}|X509-[0-9]+)$`)
+	authPattern       = regexp.MustCompile(`(?i)^(PGPKey-[0-9a-f]{8}|CRYPT-PW \S{13}|MD5-pw \$1\$\S+|MAIL-FROM \S+@\S+|NONE)$`)
+)
+
+// syntaxes maps each attribute to the function which validates it's value
+var syntaxes = map[token.Type]func(string) error{
+	token.CLASS_AS_SET:                   setName("AS-"),
+	token.CLASS_AUT_NUM:                  validateASN,
+	token.CLASS_KEY_CERT:                 validateKeyCertName,
+	token.CLASS_MAINTAINER:               validateObjectName,
+	token.CLASS_PERSON:                   validateNotEmpty,
+	token.CLASS_ROLE:                     validateNotEmpty,
+	token.CLASS_ROUTE:                    prefix(false),
+	token.CLASS_ROUTE6:                   prefix(true),
+	token.CLASS_ROUTE_SET:                setName("RS-"),
+	token.ATTR_ADDRESS:                   validateNotEmpty,
+	token.ATTR_ADMIN_CONTACT:             list(validateObjectName),
+	token.ATTR_AS_NAME:                   validateObjectName,
+	token.ATTR_AS_SET_MEMBERS:            list(validateMember),
+	token.ATTR_AUTHENTICATION:            validateAuth,
+	token.ATTR_CHANGED_AT_AND_BY:         validateChanged,
+	token.ATTR_EMAIL:                     validateEmail,
+	token.ATTR_EXPORT:                    validateNotEmpty,
+	token.ATTR_FAX_NUMBER:                validatePhone,
+	token.ATTR_IMPORT:                    validateNotEmpty,
+	token.ATTR_MAINTAINED_BY:             list(validateObjectName),
+	token.ATTR_MAINTAINER_LOWER:          list(validateObjectName),
+	token.ATTR_MAINTAINER_NOTIFY_EMAIL:   validateEmail,
+	token.ATTR_MAINTAINER_ROUTES:         validateMntRoutes,
+	token.ATTR_MEMBERS_BY_REFERENCE:      list(validateObjectName),
+	token.ATTR_MEMBER_OF_ROUTE_SET:       list(validateObjectName),
+	token.ATTR_MULTI_PROTO_EXPORT_POLICY: validateNotEmpty,
+	token.ATTR_MULTI_PROTO_IMPORT_POLICY: validateNotEmpty,
+	token.ATTR_MULTI_PROTO_MEMBERS:       list(validateMember),
+	token.ATTR_NIC_HANDLE:                validateObjectName,
+	token.ATTR_NOTIFY_EMAIL:              validateEmail,
+	token.ATTR_ORIGIN:                    validateASN,
+	token.ATTR_PHONE_NUMBER:              validatePhone,
+	token.ATTR_REGISTRY_SOURCE:           validateObjectName,
+	token.ATTR_TECHNICAL_CONTACT:         list(validateObjectName),
+	token.ATTR_UPDATED_TO_EMAIL:          validateEmail,
+}
+
+// ValidateValue checks the syntax of an attribute's value. Values of
+// attributes without a defined syntax, such as descr and remarks, are always
+// valid.
+func ValidateValue(t token.Type, value string) error {
+	validate, ok := syntaxes[t]
+	if !ok {
+		return nil
+	}
+
+	if err := validate(strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("invalid %s value %q: %s", t.Name(), value, err)
+	}
+
+	return nil
+}
+
+// joinLines combines an attribute and it's continuation lines into a single
+// value, as continuation lines are semantically equivalent to a space
+func joinLines(attr *ast.Attribute) string {
+	return strings.Join(attr.Lines(), " ")
+}
+
+func list(validate func(string) error) func(string) error {
+	return func(value string) error {
+		for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if err := validate(item); err != nil {
+				return err
+			}
+		}
+
+		return validateNotEmpty(value)
+	}
+}
+
+func validateNotEmpty(value string) error {
+	if value == "" {
+		return fmt.Errorf("value must not be empty")
+	}
+
+	return nil
+}
+
+func validateKeyCertName(value string) error {
+	if !keyCertPattern.MatchString(value) {
+		return fmt.Errorf("expected a key ID such as PGPKEY-80F238C6 or X509-1")
+	}
+
+	return nil
+}
+
+func validateASN(value string) error {
+	if !asnPattern.MatchString(value) {
+		return fmt.Errorf("expected an AS number such as AS65537")
+	}
+
+	if _, err := strconv.ParseUint(value[2:], 10, 32); err != nil {
+		return fmt.Errorf("AS number out of range")
+	}
+
+	return nil
+}
+
+func validateObjectName(value string) error {
+	if !objectNamePattern.MatchString(value) {
+		return fmt.Errorf("expected a name beginning with a letter, containing only letters, digits, - and _")
+	}
+
+	return nil
+}
+
+// setName returns a validator for set names, which are made up of one or more
+// colon separated components, each an AS number or a name, where at least one
+// component must begin with the given prefix, e.g. AS65537:AS-CUSTOMERS
+func setName(prefix string) func(string) error {
+	return func(value string) error {
+		found := false
+		for _, part := range strings.Split(value, ":") {
+			switch {
+			case strings.HasPrefix(strings.ToUpper(part), prefix):
+				if err := validateObjectName(part); err != nil {
+					return err
+				}
+				found = true
+			case validateASN(part) != nil:
+				return fmt.Errorf("set name components must be AS numbers or begin with %s", prefix)
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("set names must contain a component beginning with %s", prefix)
+		}
+
+		return nil
+	}
+}
+
+func isSetName(value string) bool {
+	for _, prefix := range []string{"AS-", "RS-"} {
+		if setName(prefix)(value) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func prefix(ipv6 bool) func(string) error {
+	return func(value string) error {
+		ip, _, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("expected a prefix such as 192.0.2.0/24 or 2001:db8::/32")
+		}
+
+		if (ip.To4() == nil) != ipv6 {
+			if ipv6 {
+				return fmt.Errorf("expected an IPv6 prefix")
+			}
+			return fmt.Errorf("expected an IPv4 prefix")
+		}
+
+		return nil
+	}
+}
+
+// validateMember checks a single member of an as-set or route-set, which may
+// be an AS number, a set name or a prefix with an optional range operator
+func validateMember(value string) error {
+	if validateASN(value) == nil || isSetName(value) {
+		return nil
+	}
+
+	// set names may also carry a range operator, e.g. AS-FOO^24
+	address := value
+	if i := strings.Index(value, "^"); i >= 0 {
+		if !rangePattern.MatchString(value[i:]) {
+			return fmt.Errorf("invalid range operator %q", value[i:])
+		}
+		address = value[:i]
+	}
+
+	if isSetName(address) || validateASN(address) == nil {
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(address); err != nil {
+		return fmt.Errorf("expected an AS number, set name or prefix")
+	}
+
+	return nil
+}
+
+// validateMntRoutes checks a mnt-routes value, a list of mntners optionally
+// followed by ANY or a list of the prefix ranges they maintain within braces,
+// e.g. TEST-MNT {192.0.2.0/24^+}
+func validateMntRoutes(value string) error {
+	names, ranges := value, ""
+	if i := strings.Index(value, "{"); i >= 0 {
+		if !strings.HasSuffix(value, "}") {
+			return fmt.Errorf("missing closing brace")
+		}
+		names, ranges = value[:i], value[i+1:len(value)-1]
+	} else if fields := strings.Fields(value); len(fields) > 1 && strings.EqualFold(fields[len(fields)-1], "ANY") {
+		names = strings.Join(fields[:len(fields)-1], " ")
+	}
+
+	if err := list(validateObjectName)(strings.TrimSpace(names)); err != nil {
+		return err
+	}
+
+	for _, r := range strings.FieldsFunc(ranges, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		address := r
+		if i := strings.Index(r, "^"); i >= 0 {
+			if !rangePattern.MatchString(r[i:]) {
+				return fmt.Errorf("invalid range operator %q", r[i:])
+			}
+			address = r[:i]
+		}
+		if _, _, err := net.ParseCIDR(address); err != nil {
+			return fmt.Errorf("expected a prefix range such as 192.0.2.0/24^+")
+		}
+	}
+
+	return nil
+}
+
+func validateEmail(value string) error {
+	if _, err := mail.ParseAddress(value); err != nil {
+		return fmt.Errorf("expected an e-mail address")
+	}
+
+	return nil
+}
+
+func validateChanged(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("expected an e-mail address followed by an optional YYYYMMDD date")
+	}
+
+	if err := validateEmail(fields[0]); err != nil {
+		return err
+	}
+
+	if len(fields) == 2 && !datePattern.MatchString(fields[1]) {
+		return fmt.Errorf("expected a date in the format YYYYMMDD")
+	}
+
+	return nil
+}
+
+func validatePhone(value string) error {
+	if !phonePattern.MatchString(value) {
+		return fmt.Errorf("expected a number such as +31 20 000 0000")
+	}
+
+	return nil
+}
+
+func validateAuth(value string) error {
+	if authPattern.MatchString(value) {
+		return nil
+	}
+
+	// schemes beyond RFC 2622 and RFC 2725, such as X509-<n>
+	if _, ok := lexer.AuthScheme(value); !ok {
+		return fmt.Errorf("expected PGPKey-<id>, CRYPT-PW, MD5-pw, MAIL-FROM, NONE or a registered scheme such as X509-<n>")
+	}
+
+	return nil
+}
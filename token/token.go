@@ -27,6 +27,7 @@ const (
 
 	// Data Types
 	DATA_ASN
+	DATA_AUTH // an auth value of a scheme registered with lexer.RegisterAuthScheme, including the scheme
 	DATA_CRYPT_PASS
 	DATA_DATE
 	DATA_EMAIL
@@ -47,10 +48,12 @@ const (
 	DATA_TELEPHONE_OR_FAX_NUMBER
 
 	// Object Classes
+	classBegin
 	CLASS_AS_SET
 	CLASS_AUT_NUM
 	CLASS_DICTIONARY
 	CLASS_FILTER_SET
+	CLASS_KEY_CERT
 	CLASS_MAINTAINER
 	CLASS_PEERING_SET
 	CLASS_PERSON
@@ -60,35 +63,44 @@ const (
 	CLASS_ROUTER
 	CLASS_ROUTER_SET
 	CLASS_ROUTE_SET
+	classEnd
 
 	// Object Attributes
+	attributeBegin
 	ATTR_ADDRESS
 	ATTR_ADMIN_CONTACT
 	ATTR_AS_NAME
 	ATTR_AS_SET_MEMBERS
 	ATTR_AUTHENTICATION
+	ATTR_CERTIFICATE
 	ATTR_CHANGED_AT_AND_BY
 	ATTR_CONTINUATION // +: indicates repeat of the last attribute type / name
 	ATTR_DESCRIPTION
 	ATTR_EMAIL
 	ATTR_EXPORT
 	ATTR_FAX_NUMBER
+	ATTR_FINGERPRINT
 	ATTR_IMPORT
 	ATTR_MAINTAINED_BY
+	ATTR_MAINTAINER_LOWER
 	ATTR_MAINTAINER_NOTIFY_EMAIL
+	ATTR_MAINTAINER_ROUTES
 	ATTR_MEMBERS_BY_REFERENCE
 	ATTR_MEMBER_OF_ROUTE_SET
+	ATTR_METHOD
 	ATTR_MULTI_PROTO_EXPORT_POLICY
 	ATTR_MULTI_PROTO_IMPORT_POLICY
 	ATTR_MULTI_PROTO_MEMBERS
 	ATTR_NIC_HANDLE
 	ATTR_NOTIFY_EMAIL
 	ATTR_ORIGIN
+	ATTR_OWNER
 	ATTR_PHONE_NUMBER
 	ATTR_REGISTRY_SOURCE
 	ATTR_REMARKS
 	ATTR_TECHNICAL_CONTACT
 	ATTR_UPDATED_TO_EMAIL
+	attributeEnd
 )
 
 var names = map[Type]string{
@@ -96,6 +108,7 @@ var names = map[Type]string{
 	ILLEGAL: "ILLEGAL",
 	// Data Types
 	DATA_ASN:                       "DATA_ASN",
+	DATA_AUTH:                      "DATA_AUTH",
 	DATA_CRYPT_PASS:                "DATA_CRYPT_PASS",
 	DATA_DATE:                      "DATA_DATE",
 	DATA_EMAIL:                     "DATA_EMAIL",
@@ -119,6 +132,7 @@ var names = map[Type]string{
 	CLASS_AUT_NUM:     "CLASS_AUT_NUM",
 	CLASS_DICTIONARY:  "CLASS_DICTIONARY",
 	CLASS_FILTER_SET:  "CLASS_FILTER_SET",
+	CLASS_KEY_CERT:    "CLASS_KEY_CERT",
 	CLASS_MAINTAINER:  "CLASS_MAINTAINER",
 	CLASS_PEERING_SET: "CLASS_PEERING_SET",
 	CLASS_PERSON:      "CLASS_PERSON",
@@ -134,23 +148,29 @@ var names = map[Type]string{
 	ATTR_AS_NAME:                   "ATTR_AS_NAME",
 	ATTR_AS_SET_MEMBERS:            "ATTR_AS_SET_MEMBERS",
 	ATTR_AUTHENTICATION:            "ATTR_AUTHENTICATION",
+	ATTR_CERTIFICATE:               "ATTR_CERTIFICATE",
 	ATTR_CHANGED_AT_AND_BY:         "ATTR_CHANGED_AT_AND_BY",
 	ATTR_CONTINUATION:              "ATTR_CONTINUATION",
 	ATTR_DESCRIPTION:               "ATTR_DESCRIPTION",
 	ATTR_EMAIL:                     "ATTR_EMAIL",
 	ATTR_EXPORT:                    "ATTR_EXPORT",
 	ATTR_FAX_NUMBER:                "ATTR_FAX_NUMBER",
+	ATTR_FINGERPRINT:               "ATTR_FINGERPRINT",
 	ATTR_IMPORT:                    "ATTR_IMPORT",
 	ATTR_MAINTAINED_BY:             "ATTR_MAINTAINED_BY",
+	ATTR_MAINTAINER_LOWER:          "ATTR_MAINTAINER_LOWER",
 	ATTR_MAINTAINER_NOTIFY_EMAIL:   "ATTR_MAINTAINER_NOTIFY_EMAIL",
+	ATTR_MAINTAINER_ROUTES:         "ATTR_MAINTAINER_ROUTES",
 	ATTR_MEMBERS_BY_REFERENCE:      "ATTR_MEMBERS_BY_REFERENCE",
 	ATTR_MEMBER_OF_ROUTE_SET:       "ATTR_MEMBER_OF_ROUTE_SET",
+	ATTR_METHOD:                    "ATTR_METHOD",
 	ATTR_MULTI_PROTO_EXPORT_POLICY: "ATTR_MULTI_PROTO_EXPORT_POLICY",
 	ATTR_MULTI_PROTO_IMPORT_POLICY: "ATTR_MULTI_PROTO_IMPORT_POLICY",
 	ATTR_MULTI_PROTO_MEMBERS:       "ATTR_MULTI_PROTO_MEMBERS",
 	ATTR_NIC_HANDLE:                "ATTR_NIC_HANDLE",
 	ATTR_NOTIFY_EMAIL:              "ATTR_NOTIFY_EMAIL",
 	ATTR_ORIGIN:                    "ATTR_ORIGIN",
+	ATTR_OWNER:                     "ATTR_OWNER",
 	ATTR_PHONE_NUMBER:              "ATTR_PHONE_NUMBER",
 	ATTR_REGISTRY_SOURCE:           "ATTR_REGISTRY_SOURCE",
 	ATTR_REMARKS:                   "ATTR_REMARKS",
@@ -164,6 +184,7 @@ var objectStrings = map[Type]string{
 	CLASS_AUT_NUM:     "aut-num",
 	CLASS_DICTIONARY:  "dictionary",
 	CLASS_FILTER_SET:  "filter-set",
+	CLASS_KEY_CERT:    "key-cert",
 	CLASS_MAINTAINER:  "mntner",
 	CLASS_PEERING_SET: "peering-set",
 	CLASS_PERSON:      "person",
@@ -179,23 +200,29 @@ var objectStrings = map[Type]string{
 	ATTR_AS_NAME:                   "as-name",
 	ATTR_AS_SET_MEMBERS:            "members",
 	ATTR_AUTHENTICATION:            "auth",
+	ATTR_CERTIFICATE:               "certif",
 	ATTR_CHANGED_AT_AND_BY:         "changed",
 	ATTR_CONTINUATION:              "+",
 	ATTR_DESCRIPTION:               "descr",
 	ATTR_EMAIL:                     "e-mail",
 	ATTR_EXPORT:                    "export",
 	ATTR_FAX_NUMBER:                "fax-no",
+	ATTR_FINGERPRINT:               "fingerpr",
 	ATTR_IMPORT:                    "import",
 	ATTR_MAINTAINED_BY:             "mnt-by",
+	ATTR_MAINTAINER_LOWER:          "mnt-lower",
 	ATTR_MAINTAINER_NOTIFY_EMAIL:   "mnt-nfy",
+	ATTR_MAINTAINER_ROUTES:         "mnt-routes",
 	ATTR_MEMBERS_BY_REFERENCE:      "mbrs-by-ref",
 	ATTR_MEMBER_OF_ROUTE_SET:       "member-of",
+	ATTR_METHOD:                    "method",
 	ATTR_MULTI_PROTO_EXPORT_POLICY: "mp-export",
 	ATTR_MULTI_PROTO_IMPORT_POLICY: "mp-import",
 	ATTR_MULTI_PROTO_MEMBERS:       "mp-members",
 	ATTR_NIC_HANDLE:                "nic-hdl",
 	ATTR_NOTIFY_EMAIL:              "notify",
 	ATTR_ORIGIN:                    "origin",
+	ATTR_OWNER:                     "owner",
 	ATTR_PHONE_NUMBER:              "phone",
 	ATTR_REGISTRY_SOURCE:           "source",
 	ATTR_REMARKS:                   "remarks",
@@ -229,3 +256,39 @@ func (t Type) Name() string {
 
 	panic(fmt.Sprintf("Unknown token type received: %d", t))
 }
+
+// IsClass reports whether the token type is an object class, such as
+// CLASS_ROUTE or CLASS_AUT_NUM
+func (t Type) IsClass() bool {
+	return t > classBegin && t < classEnd
+}
+
+// Classes returns every object class, in the order they are declared
+func Classes() []Type {
+	var classes []Type
+	for t := classBegin + 1; t < classEnd; t++ {
+		classes = append(classes, t)
+	}
+
+	return classes
+}
+
+// IsAttribute reports whether the token type is an object attribute, such as
+// ATTR_MAINTAINED_BY. ATTR_CONTINUATION is considered an attribute.
+func (t Type) IsAttribute() bool {
+	return t > attributeBegin && t < attributeEnd
+}
+
+// Lookup translates an object class or attribute name, such as "route" or
+// "mnt-by", into it's token type. The lookup is case-insensitive. Value
+// prefixes, such as "CRYPT-PW", are not considered.
+func Lookup(name string) (Type, bool) {
+	name = strings.ToLower(name)
+	for t, s := range objectStrings {
+		if (t.IsClass() || t.IsAttribute()) && s == name {
+			return t, true
+		}
+	}
+
+	return ILLEGAL, false
+}
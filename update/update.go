@@ -0,0 +1,452 @@
+// Package update applies batches of object changes to a database as a single
+// transaction. Changes are ordered so that the objects they reference are
+// created first, each change is validated and optionally authorized, and the
+// references between objects are enforced. If any change fails the whole
+// transaction is rolled back.
+package update
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/diff"
+	"github.com/kkirsche/rpsl/schema"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// maxReferrers limits how many referencing objects are listed when an object
+// can not be deleted
+const maxReferrers = 5
+
+// enforced are the references which must resolve to an object in the
+// database. Registries commonly permit routes to be originated by AS numbers
+// without an aut-num, and sets to include sets held in other registries.
+var enforced = map[token.Type]bool{
+	token.ATTR_ADMIN_CONTACT:        true,
+	token.ATTR_AUTHENTICATION:       true,
+	token.ATTR_MAINTAINED_BY:        true,
+	token.ATTR_MAINTAINER_LOWER:     true,
+	token.ATTR_MAINTAINER_ROUTES:    true,
+	token.ATTR_MEMBERS_BY_REFERENCE: true,
+	token.ATTR_MEMBER_OF_ROUTE_SET:  true,
+	token.ATTR_TECHNICAL_CONTACT:    true,
+}
+
+// Change is a single object in a transaction, which is added, replacing any
+// existing version, or deleted
+type Change struct {
+	Object *ast.Object
+	Delete bool
+}
+
+// Status is the outcome of a single change
+type Status int
+
+const (
+	// Succeeded changes are applied if the transaction is committed
+	Succeeded Status = iota
+	// NoOp changes are identical to the object in the database
+	NoOp
+	// Failed changes cause the transaction to be rolled back
+	Failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case NoOp:
+		return "no-op"
+	case Failed:
+		return "failed"
+	}
+
+	return "succeeded"
+}
+
+// Result is the outcome of a single change
+type Result struct {
+	Change
+	Operation auth.Operation
+	Status    Status
+	Errors    []string
+	Auth      *auth.Result // nil if the change was not authorized
+}
+
+func (r *Result) String() string {
+	name := "<empty object>"
+	if len(r.Object.Attributes) > 0 {
+		name = r.Object.Class().Name() + " " + r.Object.Key()
+	}
+
+	s := fmt.Sprintf("%s %s %s", r.Status, r.Operation, name)
+	if len(r.Errors) > 0 {
+		s += ": " + strings.Join(r.Errors, "; ")
+	}
+
+	return s
+}
+
+// Report is the outcome of a transaction
+type Report struct {
+	DryRun    bool
+	Committed bool      // the changes were applied to the database
+	Results   []*Result // in the order the changes were given
+	Order     []int     // the indexes of the changes in the order they were applied
+}
+
+// String lists the result of each change, in the order they were applied
+func (r *Report) String() string {
+	var s strings.Builder
+	switch {
+	case r.DryRun:
+		s.WriteString("dry run, not committed\n")
+	case r.Committed:
+		s.WriteString("committed\n")
+	default:
+		s.WriteString("rolled back\n")
+	}
+
+	for _, i := range r.Order {
+		s.WriteString("  " + r.Results[i].String() + "\n")
+	}
+
+	return s.String()
+}
+
+// Options control how a transaction is applied
+type Options struct {
+	// DryRun checks every change, then rolls the transaction back
+	DryRun bool
+	// Credentials, if not nil, are checked against the mntners of each change
+	// as described by auth.Check
+	Credentials *auth.Credentials
+}
+
+// Engine applies transactions to a database. Transactions are applied one at
+// a time. The changes of a transaction are staged, see db.Database.Stage, and
+// are only written to the database once every change has succeeded, so
+// concurrent readers never see the changes of a dry run or of a transaction
+// which is rolled back.
+type Engine struct {
+	mu sync.Mutex
+	d  *db.Database
+}
+
+// New returns an Engine applying transactions to the database
+func New(d *db.Database) *Engine {
+	return &Engine{d: d}
+}
+
+// Apply applies the changes as a single transaction. Objects are created and
+// modified before any are deleted, each in an order such that referenced
+// objects are created before, and deleted after, the objects which reference
+// them. The transaction is committed only if every change succeeds, and the
+// database is left with no dangling references.
+func (e *Engine) Apply(changes []Change, opts Options) *Report {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	report := &Report{DryRun: opts.DryRun, Results: make([]*Result, len(changes))}
+	seen := make(map[string]int)
+	for i, c := range changes {
+		result := &Result{Change: c}
+		report.Results[i] = result
+		if c.Object == nil {
+			result.Object = &ast.Object{}
+		}
+		if len(result.Object.Attributes) == 0 {
+			if c.Delete {
+				result.Operation = auth.Delete
+			}
+			result.fail("object has no attributes")
+			continue
+		}
+
+		e.check(result)
+		k := objectKey(c.Object.Class(), c.Object.Key())
+		if first, ok := seen[k]; ok {
+			result.fail(fmt.Sprintf("duplicate of change %d", first+1))
+			continue
+		}
+		seen[k] = i
+	}
+
+	report.Order = order(changes)
+
+	staged := e.d.Stage()
+	applied := false
+	for _, i := range report.Order {
+		result := report.Results[i]
+		if result.Status != Succeeded {
+			continue
+		}
+		if apply(staged, result, opts.Credentials) {
+			applied = true
+		}
+	}
+
+	if applied {
+		checkReferences(staged, report)
+	}
+
+	for _, result := range report.Results {
+		if result.Status == Failed {
+			return report
+		}
+	}
+
+	if opts.DryRun {
+		return report
+	}
+
+	// the database was returned by Stage, so committing it can not fail
+	_ = staged.Commit()
+
+	report.Committed = true
+	return report
+}
+
+// check validates a change before it is applied
+func (e *Engine) check(result *Result) {
+	obj := result.Object
+	existing, exists := e.d.Get(obj.Class(), obj.Key())
+	switch {
+	case result.Delete:
+		result.Operation = auth.Delete
+		if !exists {
+			result.fail("object does not exist")
+		}
+		return
+	case exists:
+		result.Operation = auth.Modify
+		if len(diff.Objects(existing, obj)) == 0 {
+			result.Status = NoOp
+		}
+	default:
+		result.Operation = auth.Create
+	}
+
+	for _, err := range schema.Validate(obj) {
+		result.fail(err.Error())
+	}
+}
+
+// apply authorizes a single change and makes it to the staged database,
+// reporting whether it was made
+func apply(staged *db.Database, result *Result, creds *auth.Credentials) bool {
+	obj := result.Object
+	if creds != nil {
+		var err error
+		result.Auth, err = auth.Check(staged, result.Operation, obj, *creds)
+		switch {
+		case err != nil:
+			result.fail(err.Error())
+			return false
+		case !result.Auth.Authorized:
+			result.fail("not authorized")
+			return false
+		}
+	}
+
+	if result.Delete {
+		staged.Remove(obj)
+		return true
+	}
+
+	if err := staged.Add(obj); err != nil {
+		result.fail(err.Error())
+		return false
+	}
+
+	return true
+}
+
+// checkReferences fails changes which leave dangling references in the staged
+// database: objects referencing objects which do not exist, and deleted
+// objects which are still referenced. Only the objects indexed as referencing
+// a deleted object are examined, see db.Database.ByReference.
+func checkReferences(staged *db.Database, report *Report) {
+	for _, i := range report.Order {
+		result := report.Results[i]
+		if result.Status != Succeeded {
+			continue
+		}
+		if result.Delete {
+			checkReferrers(staged, result)
+			continue
+		}
+
+		for _, ref := range schema.References(result.Object) {
+			if enforced[ref.Attribute] && !exists(staged, ref) {
+				result.fail(fmt.Sprintf("%s references %s %s, which does not exist", ref.Attribute.Name(), ref.ClassNames(), ref.Key))
+			}
+		}
+	}
+}
+
+// checkReferrers fails a delete if the deleted object is still referenced
+func checkReferrers(staged *db.Database, result *Result) {
+	class, key := result.Object.Class(), strings.ToUpper(result.Object.Key())
+
+	var names []string
+	for _, obj := range staged.ByReference(key) {
+		for _, ref := range schema.References(obj) {
+			if enforced[ref.Attribute] && ref.Key == key && includesClass(ref.Classes, class) {
+				names = append(names, fmt.Sprintf("%s %s", obj.Class().Name(), obj.Key()))
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	names = unique(names)
+	if len(names) > maxReferrers {
+		names = append(names[:maxReferrers], fmt.Sprintf("%d more", len(names)-maxReferrers))
+	}
+	result.fail("object is referenced by " + strings.Join(names, ", "))
+}
+
+func includesClass(classes []token.Type, class token.Type) bool {
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exists reports whether the referenced object is in the database
+func exists(d *db.Database, ref schema.Reference) bool {
+	for _, class := range ref.Classes {
+		if _, ok := d.Get(class, ref.Key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Result) fail(err string) {
+	r.Status = Failed
+	r.Errors = append(r.Errors, err)
+}
+
+// order returns the order the changes are applied in: additions such that
+// objects come after those they reference, then deletions such that objects
+// come before those they reference. References which form a cycle, such as a
+// mntner and a person which reference each other, are broken by taking a
+// mntner, as a new mntner authorizes itself, or else the changes in the order
+// they were given.
+func order(changes []Change) []int {
+	var additions, deletions []int
+	for i, c := range changes {
+		if c.Delete {
+			deletions = append(deletions, i)
+		} else {
+			additions = append(additions, i)
+		}
+	}
+
+	return append(sortReferenced(changes, additions, false), sortReferenced(changes, deletions, true)...)
+}
+
+// sortReferenced orders the changes topologically by their references. Unless
+// reverse is set, referenced objects come first.
+func sortReferenced(changes []Change, indexes []int, reverse bool) []int {
+	byKey := make(map[string]int)
+	for _, i := range indexes {
+		obj := changes[i].Object
+		if obj != nil && len(obj.Attributes) > 0 {
+			byKey[objectKey(obj.Class(), obj.Key())] = i
+		}
+	}
+
+	// after[i] are the changes which must come after change i
+	after := make(map[int][]int)
+	pending := make(map[int]int)
+	for _, i := range indexes {
+		obj := changes[i].Object
+		if obj == nil || len(obj.Attributes) == 0 {
+			continue
+		}
+		for _, ref := range schema.References(obj) {
+			for _, class := range ref.Classes {
+				j, ok := byKey[objectKey(class, ref.Key)]
+				if !ok || j == i {
+					continue
+				}
+				first, second := j, i
+				if reverse {
+					first, second = i, j
+				}
+				after[first] = append(after[first], second)
+				pending[second]++
+			}
+		}
+	}
+
+	var sorted []int
+	done := make(map[int]bool)
+	for len(sorted) < len(indexes) {
+		next := -1
+		for _, i := range indexes {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			next = breakCycle(changes, indexes, done)
+		}
+
+		done[next] = true
+		sorted = append(sorted, next)
+		for _, j := range after[next] {
+			pending[j]--
+		}
+	}
+
+	return sorted
+}
+
+// breakCycle returns the change to take when every remaining change waits on
+// another: the first remaining mntner, or else the first remaining change
+func breakCycle(changes []Change, indexes []int, done map[int]bool) int {
+	first := -1
+	for _, i := range indexes {
+		if done[i] {
+			continue
+		}
+		if changes[i].Object.Class() == token.CLASS_MAINTAINER {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+
+	return first
+}
+
+func objectKey(class token.Type, key string) string {
+	return class.Name() + " " + strings.ToUpper(key)
+}
+
+func unique(names []string) []string {
+	sort.Strings(names)
+	result := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,207 @@
+package update
+
+import (
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/auth"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/parser"
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	newRoute = `route:          198.51.100.0/24
+origin:         AS65537
+mnt-by:         NEW-MNT
+source:         TEST
+`
+	newMntner = `mntner:         NEW-MNT
+descr:          new maintainer
+admin-c:        NP1-TEST
+upd-to:         new@example.com
+auth:           MAIL-FROM new@example\.com
+mnt-by:         NEW-MNT
+source:         TEST
+`
+	newPerson = `person:         New Person
+address:        Example Street 2
+phone:          +1 555 0102
+e-mail:         new@example.com
+nic-hdl:        NP1-TEST
+mnt-by:         NEW-MNT
+source:         TEST
+`
+	autNum = `aut-num:        AS65537
+as-name:        TEST
+admin-c:        TP1-TEST
+tech-c:         TP1-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+`
+	oldPerson = `person:         Old Person
+address:        Example Street 1
+phone:          +1 555 0101
+e-mail:         old@example.com
+nic-hdl:        OP1-TEST
+mnt-by:         TEST-MNT
+source:         TEST
+`
+)
+
+func mustParse(t *testing.T, text string) *ast.Object {
+	objects, err := parser.Parse("update", text)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1) {
+		t.FailNow()
+	}
+
+	return objects[0]
+}
+
+func statuses(report *Report) []string {
+	var s []string
+	for _, i := range report.Order {
+		s = append(s, report.Results[i].String())
+	}
+
+	return s
+}
+
+func TestApplyDependencyOrder(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+
+	// the route is authorized by the mntner created with it, which in turn
+	// references the person created with it
+	report := e.Apply([]Change{
+		{Object: mustParse(t, newRoute)},
+		{Object: mustParse(t, newPerson)},
+		{Object: mustParse(t, newMntner)},
+	}, Options{Credentials: &auth.Credentials{From: "new@example.com"}})
+
+	assert.True(t, report.Committed, report.String())
+	assert.Equal(t, []int{2, 0, 1}, report.Order)
+	assert.Equal(t, `committed
+  succeeded create mntner NEW-MNT
+  succeeded create route 198.51.100.0/24AS65537
+  succeeded create person NP1-TEST
+`, report.String())
+
+	_, ok := d.Get(token.CLASS_ROUTE, "198.51.100.0/24AS65537")
+	assert.True(t, ok)
+}
+
+func TestApplyDeleteReferenced(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+
+	report := e.Apply([]Change{
+		{Object: mustParse(t, oldPerson), Delete: true},
+	}, Options{})
+	assert.False(t, report.Committed)
+	assert.Equal(t, []string{"failed delete person OP1-TEST: object is referenced by aut-num AS65537"}, statuses(report))
+	_, ok := d.Get(token.CLASS_PERSON, "OP1-TEST")
+	assert.True(t, ok)
+
+	// replacing the reference in the same transaction allows the delete,
+	// whatever order the changes are given in
+	report = e.Apply([]Change{
+		{Object: mustParse(t, oldPerson), Delete: true},
+		{Object: mustParse(t, autNum)},
+	}, Options{})
+	assert.True(t, report.Committed, report.String())
+	assert.Equal(t, []string{
+		"succeeded modify aut-num AS65537",
+		"succeeded delete person OP1-TEST",
+	}, statuses(report))
+	_, ok = d.Get(token.CLASS_PERSON, "OP1-TEST")
+	assert.False(t, ok)
+}
+
+func TestApplyRollback(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+
+	report := e.Apply([]Change{
+		{Object: mustParse(t, autNum)},
+		{Object: mustParse(t, newRoute)},
+		{Object: mustParse(t, "route: 203.0.113.0/24\norigin: AS65537\nmnt-by: TEST-MNT\nsource: TEST\n"), Delete: true},
+		{Object: mustParse(t, autNum)},
+	}, Options{})
+
+	assert.False(t, report.Committed)
+	assert.Equal(t, []string{
+		"succeeded modify aut-num AS65537",
+		"failed modify aut-num AS65537: duplicate of change 1",
+		"failed create route 198.51.100.0/24AS65537: mnt-by references mntner NEW-MNT, which does not exist",
+		"failed delete route 203.0.113.0/24AS65537: object does not exist",
+	}, statuses(report))
+
+	aut, _ := d.Get(token.CLASS_AUT_NUM, "AS65537")
+	assert.Equal(t, "OP1-TEST", aut.Value(token.ATTR_ADMIN_CONTACT))
+	_, ok := d.Get(token.CLASS_ROUTE, "198.51.100.0/24AS65537")
+	assert.False(t, ok)
+}
+
+func TestApplyDryRun(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+	before := d.Len()
+
+	report := e.Apply([]Change{
+		{Object: mustParse(t, newMntner)},
+		{Object: mustParse(t, newPerson)},
+		{Object: mustParse(t, "route: 192.0.2.0/24\norigin: AS65537\nmnt-by: TEST-MNT\nsource: TEST\n")},
+		{Object: mustParse(t, oldPerson), Delete: true},
+		{Object: mustParse(t, autNum)},
+	}, Options{DryRun: true})
+
+	assert.False(t, report.Committed)
+	assert.Equal(t, `dry run, not committed
+  succeeded modify aut-num AS65537
+  no-op modify route 192.0.2.0/24AS65537
+  succeeded create mntner NEW-MNT
+  succeeded create person NP1-TEST
+  succeeded delete person OP1-TEST
+`, report.String())
+	assert.Equal(t, before, d.Len())
+	_, ok := d.Get(token.CLASS_MAINTAINER, "NEW-MNT")
+	assert.False(t, ok)
+}
+
+func TestApplyAuthorization(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+
+	report := e.Apply([]Change{
+		{Object: mustParse(t, autNum)},
+	}, Options{Credentials: &auth.Credentials{From: "someone@example.org"}})
+
+	assert.False(t, report.Committed)
+	if assert.Len(t, report.Results, 1) && assert.NotNil(t, report.Results[0].Auth) {
+		assert.Equal(t, []string{"not authorized"}, report.Results[0].Errors)
+		assert.False(t, report.Results[0].Auth.Authorized)
+	}
+	aut, _ := d.Get(token.CLASS_AUT_NUM, "AS65537")
+	assert.Equal(t, "OP1-TEST", aut.Value(token.ATTR_ADMIN_CONTACT))
+}
+
+func TestApplyEmptyObject(t *testing.T) {
+	d, err := db.LoadFile("testdata/update.db")
+	require.NoError(t, err)
+	e := New(d)
+
+	report := e.Apply([]Change{{Object: nil}, {Object: &ast.Object{}, Delete: true}}, Options{})
+	assert.False(t, report.Committed)
+	assert.Equal(t, `rolled back
+  failed create <empty object>: object has no attributes
+  failed delete <empty object>: object has no attributes
+`, report.String())
+}
@@ -0,0 +1,363 @@
+package whois
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/parser"
+)
+
+// DefaultPort is the whois port, used when an address does not include one
+const DefaultPort = "43"
+
+// DefaultTimeout limits how long each query may take when Client.Timeout is
+// not set
+const DefaultTimeout = 30 * time.Second
+
+// maxResponseLength limits the size of a response, so a misbehaving server
+// can not make the client allocate without bound
+const maxResponseLength = 1 << 26
+
+// Query is a RIPE style query, made up of flags and a search key, such as
+// -r -T route -i origin AS65537
+type Query struct {
+	Key         string
+	Types       []string // -T, the object classes to return
+	Inverse     []string // -i, the attributes to do an inverse lookup of the key on
+	Sources     []string // -s, the sources to search
+	NoRecursion bool     // -r, do not return the contacts referenced by objects
+	PrimaryKeys bool     // -K, only return the primary key attributes of objects
+}
+
+// String returns the query as sent to the server
+func (q Query) String() string {
+	var flags []string
+	if q.NoRecursion {
+		flags = append(flags, "-r")
+	}
+	if q.PrimaryKeys {
+		flags = append(flags, "-K")
+	}
+	if len(q.Types) > 0 {
+		flags = append(flags, "-T", strings.Join(q.Types, ","))
+	}
+	if len(q.Inverse) > 0 {
+		flags = append(flags, "-i", strings.Join(q.Inverse, ","))
+	}
+	if len(q.Sources) > 0 {
+		flags = append(flags, "-s", strings.Join(q.Sources, ","))
+	}
+
+	return strings.Join(append(flags, q.Key), " ")
+}
+
+// Error is an error returned by the server, either a RIPE style %ERROR line
+// or an IRRd F response
+type Error struct {
+	Code    int // the RIPE error code, zero for IRRd errors
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code == 0 {
+		return "whois: " + e.Message
+	}
+
+	return fmt.Sprintf("whois: error %d: %s", e.Code, e.Message)
+}
+
+// ripeNoEntries is the RIPE error code for a query which matched nothing
+const ripeNoEntries = 101
+
+// Client makes queries to a whois server, such as the RIPE database or IRRd.
+// By default each query uses a new connection. A persistent client keeps the
+// connection open, using RIPE's -k flag. A Client must not be used for
+// several queries at once.
+type Client struct {
+	Address    string
+	Timeout    time.Duration
+	Persistent bool
+	// Dial connects to the server, net.DialTimeout is used if it is nil
+	Dial func(network, address string, timeout time.Duration) (net.Conn, error)
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewClient returns a client for the server at the address, e.g.
+// whois.radb.net or whois.ripe.net:43
+func NewClient(address string) *Client {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	return &Client{Address: address}
+}
+
+// Close closes a persistent connection
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn, c.reader = nil, nil
+	return err
+}
+
+// Raw sends a query and returns the server's response. RIPE style error
+// lines are returned as an *Error, except for a query which matched no
+// objects, which has an empty response.
+func (c *Client) Raw(query string) (string, error) {
+	response, err := c.exchange(query, c.readResponse)
+	if err != nil {
+		return "", err
+	}
+
+	return response, ripeError(response)
+}
+
+// Search makes a RIPE style query and parses the objects returned
+func (c *Client) Search(q Query) ([]*ast.Object, error) {
+	response, err := c.Raw(q.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.Parse(c.Address, response)
+}
+
+// ASSetMembers returns the members of an as-set using IRRd's !i command,
+// expanding nested sets when recursive
+func (c *Client) ASSetMembers(name string, recursive bool) ([]string, error) {
+	command := "!i" + name
+	if recursive {
+		command += ",1"
+	}
+
+	data, err := c.IRRd(command)
+	return strings.Fields(data), err
+}
+
+// Prefixes returns the prefixes of the route objects, or with ipv6 the
+// route6 objects, originated by the AS number using IRRd's !g or !6 command
+func (c *Client) Prefixes(asn string, ipv6 bool) ([]string, error) {
+	command := "!g" + asn
+	if ipv6 {
+		command = "!6" + asn
+	}
+
+	data, err := c.IRRd(command)
+	return strings.Fields(data), err
+}
+
+// Routes returns the route or route6 objects for the prefix using IRRd's !r
+// command. The option may be empty for an exact match, o to return only the
+// origins, l for the one level less specific, L for all less specifics or M
+// for all more specifics.
+func (c *Client) Routes(prefix, option string) ([]*ast.Object, error) {
+	command := "!r" + prefix
+	if option != "" {
+		command += "," + option
+	}
+
+	data, err := c.IRRd(command)
+	if err != nil || option == "o" {
+		return nil, err
+	}
+
+	return parser.Parse(c.Address, data)
+}
+
+// IRRd sends an IRRd ! command and returns the data in the response. A
+// command which found nothing returns no data rather than an error.
+func (c *Client) IRRd(command string) (string, error) {
+	return c.exchange(command, c.readIRRdResponse)
+}
+
+// exchange sends a query, connecting first if necessary, and reads the
+// response
+func (c *Client) exchange(query string, read func() (string, error)) (string, error) {
+	if strings.ContainsAny(query, "\r\n") {
+		return "", fmt.Errorf("invalid query %q", query)
+	}
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return "", err
+		}
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+
+	response, err := c.send(query, read)
+	if err != nil || !c.Persistent {
+		c.Close()
+	}
+	return response, err
+}
+
+func (c *Client) connect() error {
+	dial := c.Dial
+	if dial == nil {
+		dial = net.DialTimeout
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := dial("tcp", c.Address, timeout)
+	if err != nil {
+		return err
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+
+	if c.Persistent {
+		// -k is acknowledged with an empty response
+		conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := c.send("-k", c.readResponse); err != nil {
+			c.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) send(query string, read func() (string, error)) (string, error) {
+	if _, err := io.WriteString(c.conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+
+	return read()
+}
+
+// readResponse reads a RIPE style response, which is ended by the server
+// closing the connection, or in persistent mode by two empty lines
+func (c *Client) readResponse() (string, error) {
+	if !c.Persistent {
+		data, err := ioutil.ReadAll(io.LimitReader(c.reader, maxResponseLength+1))
+		if err == nil && len(data) > maxResponseLength {
+			err = fmt.Errorf("response exceeds %d bytes", maxResponseLength)
+		}
+		return string(data), err
+	}
+
+	// lines are read a buffer at a time, so that the limit also applies to a
+	// single long line
+	var response bytes.Buffer
+	empty, start := 0, 0
+	for empty < 2 {
+		fragment, err := c.reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			return "", err
+		}
+
+		response.Write(fragment)
+		if response.Len() > maxResponseLength {
+			return "", fmt.Errorf("response exceeds %d bytes", maxResponseLength)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if strings.TrimRight(string(response.Bytes()[start:]), "\r\n") == "" {
+			empty++
+		} else {
+			empty = 0
+		}
+		start = response.Len()
+	}
+
+	return strings.TrimRight(response.String(), "\r\n") + "\n", nil
+}
+
+// readIRRdResponse reads the response to an IRRd command, which is one of:
+//
+//	A<length>  followed by length bytes of data and a C line
+//	C          success, with no data
+//	D          the key was not found
+//	E          there are multiple copies of the key
+//	F <error>  the command failed
+func (c *Client) readIRRdResponse() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch {
+	case strings.HasPrefix(line, "A"):
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return "", fmt.Errorf("invalid IRRd response %q", line)
+		}
+		if length > maxResponseLength {
+			return "", fmt.Errorf("IRRd response of %d bytes exceeds %d bytes", length, maxResponseLength)
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return "", err
+		}
+
+		end, err := c.reader.ReadString('\n')
+		for err == nil && strings.TrimSpace(end) == "" {
+			end, err = c.reader.ReadString('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(end) != "C" {
+			return "", fmt.Errorf("invalid IRRd response %q", end)
+		}
+
+		return strings.TrimRight(string(data), "\n"), nil
+	case line == "C", line == "D":
+		return "", nil
+	case line == "E":
+		return "", &Error{Message: "multiple copies of the key exist"}
+	case strings.HasPrefix(line, "F"):
+		return "", &Error{Message: strings.TrimSpace(line[1:])}
+	}
+
+	return "", fmt.Errorf("invalid IRRd response %q", line)
+}
+
+// ripeError returns the first %ERROR in a response, other than for a query
+// which matched nothing
+func ripeError(response string) error {
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "%ERROR:") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "%ERROR:"), ":", 2)
+		code, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return &Error{Message: strings.TrimPrefix(line, "%ERROR:")}
+		}
+		if code == ripeNoEntries {
+			return nil
+		}
+
+		return &Error{Code: code, Message: strings.TrimSpace(parts[1])}
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package whois
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kkirsche/rpsl/token"
+	"github.com/stretchr/testify/assert"
+)
+
+const routes = `% This is the RIPE Database query service.
+
+route:          192.0.2.0/24
+origin:         AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+
+route:          198.51.100.0/24
+origin:         AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+`
+
+const route6 = `route6:         2001:db8::/32
+origin:         AS65537
+mnt-by:         MAINT-TEST
+source:         TEST
+`
+
+// stubServer is a whois server which replies to known queries with canned
+// responses, over loopback TCP
+type stubServer struct {
+	listener  net.Listener
+	responses map[string]string // RIPE style responses, or the data of IRRd responses
+
+	mu      sync.Mutex
+	queries []string
+	conns   int
+}
+
+func newStubServer(t *testing.T, responses map[string]string) *stubServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubServer{listener: l, responses: responses}
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) client() *Client {
+	return NewClient(s.listener.Addr().String())
+}
+
+func (s *stubServer) Close() {
+	s.listener.Close()
+}
+
+func (s *stubServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *stubServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	persistent := false
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		query := strings.TrimRight(line, "\r\n")
+
+		s.mu.Lock()
+		s.queries = append(s.queries, query)
+		s.mu.Unlock()
+
+		response, ok := s.responses[query]
+		switch {
+		case query == "-k":
+			persistent = !persistent
+			response = ""
+		case strings.HasPrefix(query, "!"):
+			switch {
+			case strings.HasPrefix(response, "F"), response == "E":
+				response += "\n"
+			case !ok:
+				response = "D\n"
+			case response == "":
+				response = "C\n"
+			default:
+				response = fmt.Sprintf("A%d\n%s\nC\n", len(response)+1, response)
+			}
+		case !ok:
+			response = "%ERROR:101: no entries found\n"
+		}
+
+		if persistent && !strings.HasPrefix(query, "!") {
+			response += "\n\n"
+		}
+		conn.Write([]byte(response))
+
+		if !persistent {
+			return
+		}
+	}
+}
+
+func (s *stubServer) received() ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries, s.conns
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		query Query
+		want  string
+	}{
+		{Query{Key: "AS65537"}, "AS65537"},
+		{Query{Key: "AS65537", NoRecursion: true, Types: []string{"route"}, Inverse: []string{"origin"}}, "-r -T route -i origin AS65537"},
+		{Query{Key: "AS-TEST", PrimaryKeys: true, Sources: []string{"RADB", "RIPE"}}, "-K -s RADB,RIPE AS-TEST"},
+		{Query{Key: "MAINT-TEST", Types: []string{"route", "route6"}, Inverse: []string{"mnt-by"}}, "-T route,route6 -i mnt-by MAINT-TEST"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.query.String())
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	assert.Equal(t, "whois.radb.net:43", NewClient("whois.radb.net").Address)
+	assert.Equal(t, "whois.ripe.net:4343", NewClient("whois.ripe.net:4343").Address)
+	assert.Equal(t, "[2001:db8::1]:43", NewClient("2001:db8::1").Address)
+}
+
+func TestSearch(t *testing.T) {
+	s := newStubServer(t, map[string]string{
+		"-r -T route -i origin AS65537": routes,
+		"-r -s TEST AS65537":            "%ERROR:102: unknown source\n",
+	})
+	defer s.Close()
+
+	c := s.client()
+	objects, err := c.Search(Query{Key: "AS65537", NoRecursion: true, Types: []string{"route"}, Inverse: []string{"origin"}})
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "192.0.2.0/24AS65537", objects[0].Key())
+		assert.Equal(t, "MAINT-TEST", objects[1].Value(token.ATTR_MAINTAINED_BY))
+	}
+
+	objects, err = c.Search(Query{Key: "AS65538"})
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	_, err = c.Search(Query{Key: "AS65537", NoRecursion: true, Sources: []string{"TEST"}})
+	assert.Equal(t, &Error{Code: 102, Message: "unknown source"}, err)
+	assert.EqualError(t, err, "whois: error 102: unknown source")
+
+	_, err = c.Raw("AS65537\r\n-k")
+	assert.EqualError(t, err, `invalid query "AS65537\r\n-k"`)
+
+	_, conns := s.received()
+	assert.Equal(t, 3, conns)
+}
+
+func TestIRRd(t *testing.T) {
+	s := newStubServer(t, map[string]string{
+		"!iAS-TEST":         "AS65537 AS-NESTED",
+		"!iAS-TEST,1":       "AS65537 AS65538 AS65539",
+		"!gAS65537":         "192.0.2.0/24 198.51.100.0/24",
+		"!6AS65537":         "2001:db8::/32",
+		"!gAS65538":         "",
+		"!r192.0.2.0/24":    strings.SplitN(routes, "\n\n", 3)[1] + "\n",
+		"!r192.0.2.0/24,o":  "AS65537",
+		"!r2001:db8::/32,L": route6,
+		"!iAS-BROKEN":       "F invalid set name",
+		"!iAS-DUPLICATE":    "E",
+	})
+	defer s.Close()
+
+	c := s.client()
+
+	members, err := c.ASSetMembers("AS-TEST", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AS65537", "AS-NESTED"}, members)
+
+	members, err = c.ASSetMembers("AS-TEST", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AS65537", "AS65538", "AS65539"}, members)
+
+	prefixes, err := c.Prefixes("AS65537", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"}, prefixes)
+
+	prefixes, err = c.Prefixes("AS65537", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::/32"}, prefixes)
+
+	prefixes, err = c.Prefixes("AS65538", false)
+	assert.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	prefixes, err = c.Prefixes("AS65539", false)
+	assert.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	objects, err := c.Routes("192.0.2.0/24", "")
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "192.0.2.0/24AS65537", objects[0].Key())
+	}
+
+	objects, err = c.Routes("2001:db8::/32", "L")
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, token.CLASS_ROUTE6, objects[0].Class())
+	}
+
+	origins, err := c.IRRd("!r192.0.2.0/24,o")
+	assert.NoError(t, err)
+	assert.Equal(t, "AS65537", origins)
+
+	_, err = c.ASSetMembers("AS-BROKEN", false)
+	assert.EqualError(t, err, "whois: invalid set name")
+
+	_, err = c.ASSetMembers("AS-DUPLICATE", false)
+	assert.EqualError(t, err, "whois: multiple copies of the key exist")
+}
+
+func TestPersistent(t *testing.T) {
+	s := newStubServer(t, map[string]string{
+		"-r -T route -i origin AS65537":  routes,
+		"-r -T route6 -i origin AS65537": route6,
+		"!gAS65537":                      "192.0.2.0/24 198.51.100.0/24",
+	})
+	defer s.Close()
+
+	c := s.client()
+	c.Persistent = true
+	defer c.Close()
+
+	objects, err := c.Search(Query{Key: "AS65537", NoRecursion: true, Types: []string{"route"}, Inverse: []string{"origin"}})
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	prefixes, err := c.Prefixes("AS65537", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"}, prefixes)
+
+	objects, err = c.Search(Query{Key: "AS65538"})
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	objects, err = c.Search(Query{Key: "AS65537", NoRecursion: true, Types: []string{"route6"}, Inverse: []string{"origin"}})
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "2001:db8::/32AS65537", objects[0].Key())
+	}
+
+	queries, conns := s.received()
+	assert.Equal(t, 1, conns)
+	assert.Equal(t, []string{
+		"-k",
+		"-r -T route -i origin AS65537",
+		"!gAS65537",
+		"AS65538",
+		"-r -T route6 -i origin AS65537",
+	}, queries)
+}
+
+func TestIRRdResponseLength(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the server claims more data than the client will read, or more than
+	// fits in an int
+	replies := []string{"A100000000\n", "A9000000000000000000\n", "A99999999999999999999\n"}
+	go func() {
+		for _, reply := range replies {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte(reply))
+			conn.Close()
+		}
+	}()
+
+	c := NewClient(l.Addr().String())
+	_, err = c.IRRd("!gAS65537")
+	assert.EqualError(t, err, "IRRd response of 100000000 bytes exceeds 67108864 bytes")
+	_, err = c.IRRd("!gAS65537")
+	assert.EqualError(t, err, "IRRd response of 9000000000000000000 bytes exceeds 67108864 bytes")
+	_, err = c.IRRd("!gAS65537")
+	assert.EqualError(t, err, `invalid IRRd response "A99999999999999999999"`)
+}
+
+func TestResponseLength(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a persistent response with a single line longer than the limit
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		r.ReadString('\n')
+		conn.Write([]byte("\n\n"))
+		r.ReadString('\n')
+		conn.Write([]byte(strings.Repeat("x", 2*maxResponseLength)))
+	}()
+
+	c := NewClient(l.Addr().String())
+	c.Persistent = true
+	defer c.Close()
+
+	_, err = c.Search(Query{Key: "AS65537"})
+	assert.EqualError(t, err, "response exceeds 67108864 bytes")
+}
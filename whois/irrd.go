@@ -0,0 +1,243 @@
+package whois
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/lexer"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/resolve"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// answerIRRd writes the response to an IRRd ! command. The supported commands
+// are:
+//
+//	!!                    keep the connection open after each response
+//	!q                    close the connection
+//	!g<asn>, !6<asn>      the prefixes of the route or route6 objects originated by the AS
+//	!i<set>[,1]           the members of an as-set or route-set, expanded recursively with ,1
+//	!r<prefix>[,o|l|L|M]  the route objects for the prefix, see Client.Routes
+//	!m<class>,<key>       the object with the class and primary key
+//	!j<sources>           the serials of the sources, comma separated or -* for every source
+func answerIRRd(w io.Writer, d *db.Database, serial uint32, sess *session, command string) {
+	if len(command) < 2 {
+		writeIRRd(w, "", fmt.Errorf("missing command"))
+		return
+	}
+	args := command[2:]
+
+	var data string
+	var err error
+	switch command[1] {
+	case '!':
+		sess.persistent = true
+		return
+	case 'q':
+		sess.quit = true
+		return
+	case 'g':
+		data, err = originPrefixes(d, args, token.CLASS_ROUTE)
+	case '6':
+		data, err = originPrefixes(d, args, token.CLASS_ROUTE6)
+	case 'i':
+		data, err = setMembers(d, args)
+	case 'r':
+		data, err = routeObjects(d, args)
+	case 'm':
+		data, err = lookupObject(d, args)
+	case 'j':
+		data, err = serials(d, serial, args)
+	default:
+		err = fmt.Errorf("unrecognized command %q", command)
+	}
+
+	writeIRRd(w, data, err)
+}
+
+// errNotFound is returned by commands for a key which does not exist
+var errNotFound = fmt.Errorf("key not found")
+
+// writeIRRd writes the IRRd framing of a response, described in
+// Client.readIRRdResponse
+func writeIRRd(w io.Writer, data string, err error) {
+	switch {
+	case err == errNotFound:
+		io.WriteString(w, "D\n")
+	case err != nil:
+		fmt.Fprintf(w, "F %s\n", err)
+	case data == "":
+		io.WriteString(w, "C\n")
+	default:
+		data = strings.TrimRight(data, "\n") + "\n"
+		fmt.Fprintf(w, "A%d\n%sC\n", len(data), data)
+	}
+}
+
+func originPrefixes(d *db.Database, asn string, class token.Type) (string, error) {
+	if !lexer.IsASN(asn) {
+		return "", fmt.Errorf("invalid AS number %q", asn)
+	}
+
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, route := range d.ByOrigin(asn) {
+		if route.Class() == class && !seen[route.Name()] {
+			seen[route.Name()] = true
+			prefixes = append(prefixes, route.Name())
+		}
+	}
+
+	return strings.Join(prefixes, " "), nil
+}
+
+func setMembers(d *db.Database, args string) (string, error) {
+	name, recursive := args, false
+	if strings.HasSuffix(args, ",1") {
+		name, recursive = strings.TrimSuffix(args, ",1"), true
+	}
+	name = strings.ToUpper(name)
+
+	class := token.CLASS_ROUTE_SET
+	if lexer.SetClass(name) == token.CLASS_AS_SET {
+		class = token.CLASS_AS_SET
+	}
+	if _, ok := d.Get(class, name); !ok {
+		return "", errNotFound
+	}
+
+	if !recursive {
+		members, err := resolve.Members(d, name)
+		return strings.Join(members, " "), err
+	}
+
+	var result *resolve.Result
+	var err error
+	if class == token.CLASS_AS_SET {
+		result, err = resolve.ASSet(d, name, resolve.Options{})
+	} else {
+		result, err = resolve.RouteSet(d, name, resolve.Options{})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(result.Values(), " "), nil
+}
+
+// routeOptions maps the options of !r to database queries
+var routeOptions = map[string]db.Query{
+	"":  db.Exact,
+	"o": db.Exact,
+	"l": db.LessSpecific,
+	"L": db.AllLessSpecific,
+	"M": db.AllMoreSpecific,
+}
+
+func routeObjects(d *db.Database, args string) (string, error) {
+	parts := strings.SplitN(args, ",", 2)
+	option := ""
+	if len(parts) == 2 {
+		option = parts[1]
+	}
+
+	q, ok := routeOptions[option]
+	if !ok {
+		return "", fmt.Errorf("invalid option %q", option)
+	}
+
+	ipnet, err := prefix.Parse(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid prefix %q", parts[0])
+	}
+
+	objects := d.Routes(ipnet, q)
+	if len(objects) == 0 {
+		return "", errNotFound
+	}
+
+	if option == "o" {
+		var origins []string
+		seen := make(map[string]bool)
+		for _, obj := range objects {
+			if origin := strings.ToUpper(obj.Value(token.ATTR_ORIGIN)); !seen[origin] {
+				seen[origin] = true
+				origins = append(origins, origin)
+			}
+		}
+		return strings.Join(origins, " "), nil
+	}
+
+	return formatObjects(objects, false), nil
+}
+
+func lookupObject(d *db.Database, args string) (string, error) {
+	parts := strings.SplitN(args, ",", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("usage: !m<class>,<key>")
+	}
+
+	class, ok := token.Lookup(parts[0])
+	if !ok || !class.IsClass() {
+		return "", fmt.Errorf("unknown object class %q", parts[0])
+	}
+
+	obj, ok := d.Get(class, parts[1])
+	if !ok {
+		return "", errNotFound
+	}
+
+	return obj.String(), nil
+}
+
+// serials describes the serial of each source as <source>:<mirrorable>:<first>-<last>,
+// sources which are not in the database being described as <source>:X:Database unknown
+func serials(d *db.Database, serial uint32, args string) (string, error) {
+	known := sources(d)
+
+	wanted := known
+	if args != "-*" {
+		wanted = strings.Split(strings.ToUpper(args), ",")
+	}
+
+	var lines []string
+	for _, source := range wanted {
+		if containsString(known, source) {
+			lines = append(lines, fmt.Sprintf("%s:N:0-%d", source, serial))
+		} else {
+			lines = append(lines, source+":X:Database unknown")
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// sources returns the sources of the objects in the database
+func sources(d *db.Database) []string {
+	seen := make(map[string]bool)
+	for _, obj := range d.Objects() {
+		if source := strings.ToUpper(obj.Value(token.ATTR_REGISTRY_SOURCE)); source != "" {
+			seen[source] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
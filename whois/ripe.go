@@ -0,0 +1,279 @@
+package whois
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/kkirsche/rpsl/prefix"
+	"github.com/kkirsche/rpsl/token"
+)
+
+// RIPE style error codes
+const (
+	errNoEntries     = 101
+	errUnknownSource = 102
+	errUnknownClass  = 103
+	errNoKey         = 106
+	errInvalidFlags  = 109
+	errInvalidOption = 111
+	errInvalidKey    = 115
+)
+
+// prefixFlags maps the prefix lookup flags to database queries
+var prefixFlags = map[string]db.Query{
+	"-x": db.Exact,
+	"-l": db.LessSpecific,
+	"-L": db.AllLessSpecific,
+	"-m": db.MoreSpecific,
+	"-M": db.AllMoreSpecific,
+}
+
+// inverseLookups maps the attributes supported by -i to database lookups
+var inverseLookups = map[token.Type]func(d *db.Database, name string) []*ast.Object{
+	token.ATTR_ORIGIN:              (*db.Database).ByOrigin,
+	token.ATTR_MAINTAINED_BY:       (*db.Database).ByMntBy,
+	token.ATTR_MEMBER_OF_ROUTE_SET: (*db.Database).ByMemberOf,
+	token.ATTR_ADMIN_CONTACT:       byContact(token.ATTR_ADMIN_CONTACT),
+	token.ATTR_TECHNICAL_CONTACT:   byContact(token.ATTR_TECHNICAL_CONTACT),
+}
+
+// byContact returns a lookup of the objects referencing a nic-hdl in the
+// contact attribute
+func byContact(attr token.Type) func(d *db.Database, name string) []*ast.Object {
+	return func(d *db.Database, name string) []*ast.Object {
+		var objects []*ast.Object
+		for _, obj := range d.ByContact(name) {
+			if containsFold(obj.Values(attr), name) {
+				objects = append(objects, obj)
+			}
+		}
+		return objects
+	}
+}
+
+// parseQuery parses a RIPE style query into it's flags and search key. The
+// query's key is empty if only flags were given.
+func parseQuery(query string) (q Query, persistent bool, lookup *db.Query, err error) {
+	fields := strings.Fields(query)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+		flag := fields[0]
+		fields = fields[1:]
+
+		switch flag {
+		case "-r":
+			q.NoRecursion = true
+		case "-K":
+			q.PrimaryKeys = true
+		case "-k":
+			persistent = true
+		case "-B", "-G", "-a":
+			// filtering and grouping are not applied, and every source is searched by default
+		case "-x", "-l", "-L", "-m", "-M":
+			if lookup != nil {
+				return q, persistent, nil, &Error{Code: errInvalidFlags, Message: "invalid combination of flags passed"}
+			}
+			query := prefixFlags[flag]
+			lookup = &query
+		case "-T", "-i", "-s":
+			if len(fields) == 0 {
+				return q, persistent, nil, &Error{Code: errInvalidOption, Message: fmt.Sprintf("missing argument of %s", flag)}
+			}
+
+			values := strings.Split(fields[0], ",")
+			fields = fields[1:]
+			switch flag {
+			case "-T":
+				q.Types = append(q.Types, values...)
+			case "-i":
+				q.Inverse = append(q.Inverse, values...)
+			case "-s":
+				q.Sources = append(q.Sources, values...)
+			}
+		default:
+			return q, persistent, nil, &Error{Code: errInvalidOption, Message: fmt.Sprintf("invalid option %s", flag)}
+		}
+	}
+
+	q.Key = strings.Join(fields, " ")
+	return q, persistent, lookup, nil
+}
+
+// answerRIPE writes the response to a RIPE style query, the objects found
+// separated by empty lines or a %ERROR line. With -k the connection is kept
+// open, and each response ends with an extra empty line. A -k without a key
+// closes a persistent connection.
+func answerRIPE(w io.Writer, d *db.Database, sess *session, query string) {
+	q, persistent, lookup, err := parseQuery(query)
+	switch {
+	case err == nil && persistent && q.Key == "":
+		if sess.persistent {
+			sess.quit = true
+			return
+		}
+		sess.persistent = true
+		io.WriteString(w, "\n")
+	case err == nil:
+		if persistent {
+			sess.persistent = true
+		}
+
+		var objects []*ast.Object
+		if objects, err = search(d, q, lookup); err == nil {
+			io.WriteString(w, formatObjects(objects, q.PrimaryKeys))
+		}
+	}
+
+	if e, ok := err.(*Error); ok {
+		fmt.Fprintf(w, "%%ERROR:%d: %s\n\n", e.Code, e.Message)
+	}
+
+	if sess.persistent {
+		io.WriteString(w, "\n")
+	}
+}
+
+// search returns the objects matching a query, followed by the person and
+// role objects they reference unless NoRecursion or PrimaryKeys is set
+func search(d *db.Database, q Query, lookup *db.Query) ([]*ast.Object, error) {
+	if q.Key == "" {
+		return nil, &Error{Code: errNoKey, Message: "no search key specified"}
+	}
+
+	var classes []token.Type
+	for _, name := range q.Types {
+		class, ok := token.Lookup(name)
+		if !ok || !class.IsClass() {
+			return nil, &Error{Code: errUnknownClass, Message: fmt.Sprintf("unknown object type %s", name)}
+		}
+		classes = append(classes, class)
+	}
+
+	if len(q.Sources) > 0 {
+		known := sources(d)
+		for _, source := range q.Sources {
+			if !containsString(known, strings.ToUpper(source)) {
+				return nil, &Error{Code: errUnknownSource, Message: fmt.Sprintf("unknown source %s", source)}
+			}
+		}
+	}
+
+	var found []*ast.Object
+	switch ipnet, err := parsePrefix(q.Key); {
+	case len(q.Inverse) > 0:
+		if lookup != nil {
+			return nil, &Error{Code: errInvalidFlags, Message: "invalid combination of flags passed"}
+		}
+
+		for _, name := range q.Inverse {
+			attr, _ := token.Lookup(name)
+			byAttr, ok := inverseLookups[attr]
+			if !ok {
+				return nil, &Error{Code: errInvalidKey, Message: fmt.Sprintf("invalid inverse attribute %s", name)}
+			}
+			found = append(found, byAttr(d, q.Key)...)
+		}
+	case err == nil:
+		if lookup != nil {
+			found = d.Routes(ipnet, *lookup)
+		} else if found = d.Routes(ipnet, db.Exact); len(found) == 0 {
+			// as RIPE does, fall back to the most specific covering prefix
+			found = d.Routes(ipnet, db.LessSpecific)
+		}
+	case lookup != nil:
+		return nil, &Error{Code: errInvalidKey, Message: fmt.Sprintf("invalid prefix %s", q.Key)}
+	default:
+		for _, class := range token.Classes() {
+			if obj, ok := d.Get(class, q.Key); ok {
+				found = append(found, obj)
+			}
+		}
+	}
+
+	var objects []*ast.Object
+	for _, obj := range found {
+		if len(classes) > 0 && !hasClass(obj, classes) ||
+			len(q.Sources) > 0 && !containsFold(q.Sources, obj.Value(token.ATTR_REGISTRY_SOURCE)) {
+			continue
+		}
+		objects = appendObject(objects, obj)
+	}
+
+	if len(objects) == 0 {
+		return nil, &Error{Code: errNoEntries, Message: "no entries found"}
+	}
+
+	if !q.NoRecursion && !q.PrimaryKeys {
+		for _, obj := range objects {
+			for _, nicHdl := range append(obj.Values(token.ATTR_ADMIN_CONTACT), obj.Values(token.ATTR_TECHNICAL_CONTACT)...) {
+				for _, class := range []token.Type{token.CLASS_PERSON, token.CLASS_ROLE} {
+					if contact, ok := d.Get(class, nicHdl); ok {
+						objects = appendObject(objects, contact)
+					}
+				}
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// parsePrefix parses a prefix, or an address as a host prefix
+func parsePrefix(key string) (*net.IPNet, error) {
+	if ip := net.ParseIP(key); ip != nil {
+		if ip.To4() != nil {
+			return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	return prefix.Parse(key)
+}
+
+// formatObjects returns the objects as RPSL text, each followed by an empty
+// line. With primaryKeys only the primary key attributes are included.
+func formatObjects(objects []*ast.Object, primaryKeys bool) string {
+	var out strings.Builder
+	for _, obj := range objects {
+		if primaryKeys {
+			obj = &ast.Object{Attributes: obj.PrimaryKey()}
+		}
+		out.WriteString(obj.String())
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+func hasClass(obj *ast.Object, classes []token.Type) bool {
+	for _, class := range classes {
+		if obj.Class() == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendObject(objects []*ast.Object, obj *ast.Object) []*ast.Object {
+	for _, existing := range objects {
+		if existing == obj {
+			return objects
+		}
+	}
+
+	return append(objects, obj)
+}
@@ -0,0 +1,221 @@
+package whois
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kkirsche/rpsl/db"
+)
+
+// DefaultIdleTimeout is how long a connection may be idle before it is closed
+// when Server.IdleTimeout is not set
+const DefaultIdleTimeout = 5 * time.Minute
+
+// maxQueryLength limits the length of a query line
+const maxQueryLength = 4096
+
+// ErrServerClosed is returned by Serve once the server has been closed
+var ErrServerClosed = errors.New("whois: server closed")
+
+// Server answers whois queries from a Database, supporting RIPE style queries
+// and IRRd ! commands. A connection is closed after each response unless the
+// client asks for it to be kept open with -k or !!.
+//
+// The database may be replaced while queries are being answered, each query
+// is answered from the database as it was when the query was received.
+type Server struct {
+	IdleTimeout time.Duration
+
+	mu        sync.RWMutex
+	d         *db.Database
+	serial    uint32
+	closed    bool
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+}
+
+// NewServer returns a server answering queries from the database
+func NewServer(d *db.Database) *Server {
+	return &Server{
+		d:         d,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// Database returns the database queries are currently answered from
+func (s *Server) Database() *db.Database {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.d
+}
+
+// Serial returns the number of times the database has been reloaded, which
+// is reported as the serial of each source by !j
+func (s *Server) Serial() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.serial
+}
+
+// Reload replaces the database queries are answered from. Queries already
+// being answered continue to use the previous database.
+func (s *Server) Reload(d *db.Database) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.d = d
+	s.serial++
+}
+
+// ReloadFile loads the named file into a new database and, if it loaded
+// without error, replaces the database queries are answered from
+func (s *Server) ReloadFile(name string) error {
+	d := db.New()
+	if err := d.LoadFile(name); err != nil {
+		return err
+	}
+
+	s.Reload(d)
+	return nil
+}
+
+// ListenAndServe listens on the TCP address and serves queries, see Serve
+func (s *Server) ListenAndServe(address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections from the listener, answering the queries made on
+// each in a new goroutine. It always returns an error, ErrServerClosed once
+// Close has been called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.RLock()
+			closed := s.closed
+			s.mu.RUnlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server, closing it's listeners and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+// session is the state of a connection
+type session struct {
+	persistent bool // whether the connection is kept open after each response
+	quit       bool // whether the connection should be closed
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	timeout := s.IdleTimeout
+	if timeout == 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 1024), maxQueryLength)
+	w := bufio.NewWriter(conn)
+
+	var sess session
+	for {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if !scanner.Scan() {
+			return
+		}
+
+		s.answer(w, &sess, scanner.Text())
+		if err := w.Flush(); err != nil || sess.quit || !sess.persistent {
+			return
+		}
+	}
+}
+
+// answer writes the response to a query, from the database as it is now
+func (s *Server) answer(w io.Writer, sess *session, query string) {
+	s.mu.RLock()
+	d, serial := s.d, s.serial
+	s.mu.RUnlock()
+
+	if len(query) > 0 && query[0] == '!' {
+		answerIRRd(w, d, serial, sess, query)
+		return
+	}
+
+	answerRIPE(w, d, sess, query)
+}
@@ -0,0 +1,271 @@
+package whois
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kkirsche/rpsl/ast"
+	"github.com/kkirsche/rpsl/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the test database over loopback TCP
+func newTestServer(t *testing.T) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := db.LoadFile("testdata/irr.db")
+	require.NoError(t, err)
+	s := NewServer(d)
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func objectKeys(objects []*ast.Object) []string {
+	keys := make([]string, len(objects))
+	for i, obj := range objects {
+		keys[i] = obj.Class().Name() + " " + obj.Key()
+	}
+
+	return keys
+}
+
+func TestServerSearch(t *testing.T) {
+	s, address := newTestServer(t)
+	defer s.Close()
+
+	tests := []struct {
+		query Query
+		want  []string
+		err   string
+	}{
+		{Query{Key: "AS65537"}, []string{"aut-num AS65537", "person PERSON-TEST"}, ""},
+		{Query{Key: "as65537", NoRecursion: true}, []string{"aut-num AS65537"}, ""},
+		{Query{Key: "AS65537", NoRecursion: true, Types: []string{"route"}, Inverse: []string{"origin"}}, []string{"route 192.0.2.0/24AS65537", "route 192.0.2.0/25AS65537"}, ""},
+		{Query{Key: "AS65537", NoRecursion: true, Types: []string{"route", "route6"}, Inverse: []string{"origin"}}, []string{"route 192.0.2.0/24AS65537", "route 192.0.2.0/25AS65537", "route6 2001:db8::/32AS65537"}, ""},
+		{Query{Key: "MAINT-TEST", NoRecursion: true, Sources: []string{"other"}, Inverse: []string{"mnt-by"}}, []string{"route 203.0.113.0/24AS65538"}, ""},
+		{Query{Key: "PERSON-TEST", Inverse: []string{"tech-c"}}, []string{"aut-num AS65537", "person PERSON-TEST"}, ""},
+		{Query{Key: "192.0.2.0/24", NoRecursion: true}, []string{"route 192.0.2.0/24AS65537", "route 192.0.2.0/24AS65538"}, ""},
+		{Query{Key: "192.0.2.128", NoRecursion: true}, []string{"route 192.0.2.0/24AS65537", "route 192.0.2.0/24AS65538"}, ""},
+		{Query{Key: "192.0.2.0/24AS65538", NoRecursion: true}, []string{"route 192.0.2.0/24AS65538"}, ""},
+		{Query{Key: "AS-TEST", PrimaryKeys: true}, []string{"as-set AS-TEST"}, ""},
+		{Query{Key: "AS65540"}, []string{}, ""},
+		{Query{Key: "AS65537", Sources: []string{"MISSING"}}, nil, "whois: error 102: unknown source MISSING"},
+		{Query{Key: "AS65537", Types: []string{"inetnum"}}, nil, "whois: error 103: unknown object type inetnum"},
+		{Query{Key: "AS65537", Inverse: []string{"descr"}}, nil, "whois: error 115: invalid inverse attribute descr"},
+	}
+
+	c := NewClient(address)
+	for _, tt := range tests {
+		objects, err := c.Search(tt.query)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.query.String())
+			continue
+		}
+
+		assert.NoError(t, err, tt.query.String())
+		assert.Equal(t, tt.want, objectKeys(objects), tt.query.String())
+	}
+}
+
+func TestServerPrefixFlags(t *testing.T) {
+	s, address := newTestServer(t)
+	defer s.Close()
+
+	tests := []struct {
+		query string
+		want  string
+		err   string
+	}{
+		{"-r -x 192.0.2.128/25", "", ""},
+		{"-r -M 192.0.2.0/24", "route:          192.0.2.0/25\n", ""},
+		{"-r -l 192.0.2.0/25", "route:          192.0.2.0/24\n", ""},
+		{"-r -K -L 192.0.2.0/25", "route:          192.0.2.0/24\norigin:         AS65537\n\nroute:          192.0.2.0/24\norigin:         AS65538\n\nroute:          192.0.2.0/25\norigin:         AS65537\n\n", ""},
+		{"-r -m -M 192.0.2.0/24", "", "whois: error 109: invalid combination of flags passed"},
+		{"-r -M AS65537", "", "whois: error 115: invalid prefix AS65537"},
+		{"-r -T", "", "whois: error 111: missing argument of -T"},
+		{"-q AS65537", "", "whois: error 111: invalid option -q"},
+		{"-r", "", "whois: error 106: no search key specified"},
+	}
+
+	c := NewClient(address)
+	for _, tt := range tests {
+		response, err := c.Raw(tt.query)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.query)
+			continue
+		}
+
+		assert.NoError(t, err, tt.query)
+		if strings.Contains(tt.query, "-K") || tt.want == "" {
+			assert.Equal(t, tt.want, strings.Replace(response, "%ERROR:101: no entries found\n\n", "", 1), tt.query)
+		} else {
+			assert.True(t, strings.HasPrefix(response, tt.want), "%s: %q", tt.query, response)
+		}
+	}
+}
+
+func TestServerIRRd(t *testing.T) {
+	s, address := newTestServer(t)
+	defer s.Close()
+
+	tests := []struct {
+		command string
+		want    string
+		err     string
+	}{
+		{"!gAS65537", "192.0.2.0/24 192.0.2.0/25", ""},
+		{"!gas65538", "192.0.2.0/24 203.0.113.0/24", ""},
+		{"!6AS65537", "2001:db8::/32", ""},
+		{"!gAS65540", "", ""},
+		{"!iAS-TEST", "AS65538 AS-NESTED AS65537", ""},
+		{"!iAS-TEST,1", "AS65538 AS65539 AS65537", ""},
+		{"!iRS-TEST", "198.51.100.0/24^+ AS65538", ""},
+		{"!iRS-TEST,1", "198.51.100.0/24^+ 192.0.2.0/24 203.0.113.0/24", ""},
+		{"!iAS-MISSING,1", "", ""},
+		{"!r192.0.2.0/24,o", "AS65537 AS65538", ""},
+		{"!r192.0.2.0/25", "route:          192.0.2.0/25\norigin:         AS65537\nmnt-by:         MAINT-TEST\nsource:         TEST", ""},
+		{"!r198.51.100.0/24", "", ""},
+		{"!mroute,192.0.2.0/24as65538", "route:          192.0.2.0/24\norigin:         AS65538\nmnt-by:         MAINT-TEST\nsource:         TEST", ""},
+		{"!mperson,PERSON-MISSING", "", ""},
+		{"!j-*", "OTHER:N:0-0\nTEST:N:0-0", ""},
+		{"!jTEST,RADB", "TEST:N:0-0\nRADB:X:Database unknown", ""},
+		{"!gFOO", "", `whois: invalid AS number "FOO"`},
+		{"!r192.0.2.0/24,x", "", `whois: invalid option "x"`},
+		{"!mfoo,bar", "", `whois: unknown object class "foo"`},
+		{"!x", "", `whois: unrecognized command "!x"`},
+	}
+
+	c := NewClient(address)
+	for _, tt := range tests {
+		data, err := c.IRRd(tt.command)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.command)
+			continue
+		}
+
+		assert.NoError(t, err, tt.command)
+		assert.Equal(t, tt.want, data, tt.command)
+	}
+
+	objects, err := c.Routes("192.0.2.0/25", "L")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"route 192.0.2.0/24AS65537", "route 192.0.2.0/24AS65538", "route 192.0.2.0/25AS65537"}, objectKeys(objects))
+}
+
+func TestServerPersistent(t *testing.T) {
+	s, address := newTestServer(t)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", address)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("!!\n!gAS65537\n!iAS-MISSING\n!x\n!q\n"))
+	response, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "A26\n192.0.2.0/24 192.0.2.0/25\nC\nD\nF unrecognized command \"!x\"\n", string(response))
+
+	c := NewClient(address)
+	c.Persistent = true
+	defer c.Close()
+
+	objects, err := c.Search(Query{Key: "AS65537", NoRecursion: true, Types: []string{"route6"}, Inverse: []string{"origin"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"route6 2001:db8::/32AS65537"}, objectKeys(objects))
+	first := c.conn
+
+	prefixes, err := c.Prefixes("AS65537", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::/32"}, prefixes)
+
+	objects, err = c.Search(Query{Key: "AS65540"})
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	objects, err = c.Search(Query{Key: "AS-TEST", NoRecursion: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"as-set AS-TEST"}, objectKeys(objects))
+	assert.True(t, first == c.conn, "the connection was not kept open")
+}
+
+func TestServerReload(t *testing.T) {
+	s, address := newTestServer(t)
+	defer s.Close()
+
+	reloaded := db.New()
+	err := reloaded.Load("reloaded", strings.NewReader("route:          10.0.0.0/8\norigin:         AS65537\nsource:         TEST\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	original := s.Database()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c := NewClient(address)
+			c.Persistent = true
+			defer c.Close()
+
+			for j := 0; j < 50; j++ {
+				prefixes, err := c.Prefixes("AS65537", false)
+				assert.NoError(t, err)
+				if got := strings.Join(prefixes, " "); got != "192.0.2.0/24 192.0.2.0/25" && got != "10.0.0.0/8" {
+					t.Errorf("unexpected prefixes %q", got)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			s.Reload(reloaded)
+		} else {
+			s.Reload(original)
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint32(50), s.Serial())
+	data, err := NewClient(address).IRRd("!j-*")
+	assert.NoError(t, err)
+	assert.Equal(t, "OTHER:N:0-50\nTEST:N:0-50", data)
+
+	assert.NoError(t, s.ReloadFile("testdata/irr.db"))
+	assert.Error(t, s.ReloadFile("testdata/missing.db"))
+	assert.Equal(t, uint32(51), s.Serial())
+}
+
+func TestServerClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(db.New())
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	c := NewClient(l.Addr().String())
+	c.Persistent = true
+	_, err = c.Search(Query{Key: "AS65537"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Close())
+	assert.Equal(t, ErrServerClosed, <-done)
+
+	_, err = c.Search(Query{Key: "AS65537"})
+	assert.Error(t, err)
+	assert.Equal(t, ErrServerClosed, s.Serve(l))
+}